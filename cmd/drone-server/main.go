@@ -32,6 +32,11 @@ func main() {
 	app.Action = server
 	app.Flags = flags
 	app.Before = before
+	app.Commands = []cli.Command{
+		migrateLogsCmd,
+		encryptSecretsCmd,
+		rotateSecretsCmd,
+	}
 
 	if err := app.Run(os.Args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -0,0 +1,97 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/drone/drone/plugins/logs"
+	"github.com/drone/drone/store"
+	"github.com/drone/drone/store/datastore"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var migrateLogsCmd = cli.Command{
+	Name:   "migrate-logs",
+	Usage:  "copy the logs stored in the database to the s3 bucket",
+	Action: migrateLogs,
+	Flags:  flags,
+}
+
+func migrateLogs(c *cli.Context) error {
+	v := datastore.New(
+		c.String("driver"),
+		c.String("datasource"),
+	)
+	bucket := setupLogStore(c, nil)
+	if bucket == nil {
+		return errors.New("migrate-logs: no s3 bucket configured")
+	}
+
+	procs, err := v.LogProcList()
+	if err != nil {
+		return err
+	}
+	count, err := logs.Migrate(v, bucket, procs)
+	logrus.Infof("migrate-logs: copied %d of %d logs", count, len(procs))
+	return err
+}
+
+var encryptSecretsCmd = cli.Command{
+	Name:   "encrypt-secrets",
+	Usage:  "encrypt the secrets and registry credentials stored in plain text",
+	Action: encryptSecrets,
+	Flags:  flags,
+}
+
+var rotateSecretsCmd = cli.Command{
+	Name:   "rotate-secrets",
+	Usage:  "encrypt the secrets and registry credentials with a new key",
+	Action: rotateSecrets,
+	Flags:  flags,
+}
+
+func encryptSecrets(c *cli.Context) error {
+	return reencrypt(c, "encrypt-secrets")
+}
+
+func rotateSecrets(c *cli.Context) error {
+	if c.String("secret-encryption-key-old") == "" {
+		return errors.New("rotate-secrets: no previous encryption key configured")
+	}
+	return reencrypt(c, "rotate-secrets")
+}
+
+// reencrypt writes the stored secrets and registry credentials again,
+// encrypted with the current key.
+func reencrypt(c *cli.Context, name string) error {
+	if c.String("secret-encryption-key") == "" {
+		return fmt.Errorf("%s: no encryption key configured", name)
+	}
+	v := datastore.New(
+		c.String("driver"),
+		c.String("datasource"),
+	)
+	s, err := setupEncryption(c, v)
+	if err != nil {
+		return err
+	}
+	count, err := store.Reencrypt(s)
+	logrus.Infof("%s: encrypted %d secrets and registries", name, count)
+	return err
+}
@@ -110,15 +110,80 @@ var flags = []cli.Flag{
 	cli.StringFlag{
 		EnvVar: "DRONE_REPO_CONFIG",
 		Name:   "repo-config",
-		Usage:  "file path for the drone config",
+		Usage:  "file path for the drone config, or a directory of config files when it ends with a slash",
 		Value:  ".drone.yml",
 	},
+	cli.StringFlag{
+		EnvVar: "DRONE_REPO_CONFIG_FALLBACK",
+		Name:   "repo-config-fallback",
+		Usage:  "repository with the drone config used when a repository has none",
+	},
+	cli.StringFlag{
+		EnvVar: "DRONE_REPO_CONFIG_FALLBACK_PATH",
+		Name:   "repo-config-fallback-path",
+		Usage:  "file path for the drone config in the fallback repository",
+		Value:  ".drone.yml",
+	},
+	cli.BoolFlag{
+		EnvVar: "DRONE_SKIP_CI_DROP",
+		Name:   "skip-ci-drop",
+		Usage:  "drop commits with a [ci skip] directive instead of recording a skipped build",
+	},
 	cli.DurationFlag{
 		EnvVar: "DRONE_SESSION_EXPIRES",
 		Name:   "session-expires",
 		Usage:  "session expiration time",
 		Value:  time.Hour * 72,
 	},
+	cli.DurationFlag{
+		EnvVar: "DRONE_REAPER_INTERVAL",
+		Name:   "reaper-interval",
+		Usage:  "interval at which builds exceeding the repository timeout are killed, 0 to disable",
+		Value:  time.Minute * 5,
+	},
+	cli.DurationFlag{
+		EnvVar: "DRONE_REAPER_GRACE",
+		Name:   "reaper-grace",
+		Usage:  "grace period after the repository timeout before builds of unresponsive agents are killed",
+		Value:  time.Minute * 5,
+	},
+	cli.DurationFlag{
+		EnvVar: "DRONE_ZOMBIE_AGE",
+		Name:   "zombie-age",
+		Usage:  "age after which pending or running builds without queued tasks are killed, 0 to disable",
+	},
+	cli.IntFlag{
+		EnvVar: "DRONE_RETENTION_BUILDS",
+		Name:   "retention-builds",
+		Usage:  "number of most recent builds kept per repository, 0 to disable",
+	},
+	cli.IntFlag{
+		EnvVar: "DRONE_RETENTION_DAYS",
+		Name:   "retention-days",
+		Usage:  "number of days builds are kept, 0 to disable",
+	},
+	cli.IntFlag{
+		EnvVar: "DRONE_BUILD_RATE_LIMIT",
+		Name:   "build-rate-limit",
+		Usage:  "number of builds a repository can create through the api within the window, 0 to disable",
+	},
+	cli.IntFlag{
+		EnvVar: "DRONE_BUILD_RATE_LIMIT_USER",
+		Name:   "build-rate-limit-user",
+		Usage:  "number of builds a user can create through the api within the window, 0 to disable",
+	},
+	cli.DurationFlag{
+		EnvVar: "DRONE_BUILD_RATE_LIMIT_WINDOW",
+		Name:   "build-rate-limit-window",
+		Usage:  "window of the build rate limits",
+		Value:  time.Minute,
+	},
+	cli.DurationFlag{
+		EnvVar: "DRONE_RETENTION_INTERVAL",
+		Name:   "retention-interval",
+		Usage:  "interval at which builds outside of the retention policy are deleted, 0 to disable",
+		Value:  time.Hour,
+	},
 	cli.StringSliceFlag{
 		EnvVar: "DRONE_ESCALATE",
 		Name:   "escalate",
@@ -169,6 +234,58 @@ var flags = []cli.Flag{
 		Usage:  "database driver configuration string",
 		Value:  "drone.sqlite",
 	},
+	cli.StringFlag{
+		EnvVar: "DRONE_LOGS_S3_BUCKET",
+		Name:   "logs-s3-bucket",
+		Usage:  "s3 bucket used to store logs instead of the database",
+	},
+	cli.StringFlag{
+		EnvVar: "DRONE_LOGS_S3_ENDPOINT",
+		Name:   "logs-s3-endpoint",
+		Usage:  "s3 compatible endpoint used to store logs",
+		Value:  "https://s3.amazonaws.com",
+	},
+	cli.StringFlag{
+		EnvVar: "DRONE_LOGS_S3_REGION",
+		Name:   "logs-s3-region",
+		Usage:  "s3 region used to store logs",
+		Value:  "us-east-1",
+	},
+	cli.StringFlag{
+		EnvVar: "DRONE_LOGS_S3_PREFIX",
+		Name:   "logs-s3-prefix",
+		Usage:  "s3 key prefix used to store logs",
+	},
+	cli.StringFlag{
+		EnvVar: "DRONE_LOGS_S3_ACCESS_KEY",
+		Name:   "logs-s3-access-key",
+		Usage:  "s3 access key used to store logs",
+	},
+	cli.StringFlag{
+		EnvVar: "DRONE_LOGS_S3_SECRET_KEY",
+		Name:   "logs-s3-secret-key",
+		Usage:  "s3 secret key used to store logs",
+	},
+	cli.BoolFlag{
+		EnvVar: "DRONE_LOGS_S3_PATH_STYLE",
+		Name:   "logs-s3-path-style",
+		Usage:  "use path style s3 urls, required by minio",
+	},
+	cli.BoolFlag{
+		EnvVar: "DRONE_REGISTRY_VALIDATE",
+		Name:   "registry-validate",
+		Usage:  "validate registry credentials with the registry when they are saved",
+	},
+	cli.StringFlag{
+		EnvVar: "DRONE_SECRET_ENCRYPTION_KEY",
+		Name:   "secret-encryption-key",
+		Usage:  "key used to encrypt secrets and registry credentials, 16, 24 or 32 bytes long",
+	},
+	cli.StringFlag{
+		EnvVar: "DRONE_SECRET_ENCRYPTION_KEY_OLD",
+		Name:   "secret-encryption-key-old",
+		Usage:  "previous encryption key, used to read values while rotating the key",
+	},
 	cli.StringFlag{
 		EnvVar: "DRONE_PROMETHEUS_AUTH_TOKEN",
 		Name:   "prometheus-auth-token",
@@ -550,6 +667,39 @@ func server(c *cli.Context) error {
 		middleware.Remote(remote_),
 	)
 
+	// keep the repository and user count metrics up to date
+	go droneserver.CollectMetrics(store_, time.Minute)
+
+	// kill builds that exceed the repository timeout and zombie builds
+	if interval := c.Duration("reaper-interval"); interval > 0 {
+		reaper := &droneserver.Reaper{
+			Store:     store_,
+			Remote:    remote_,
+			Host:      droneserver.Config.Server.Host,
+			Grace:     c.Duration("reaper-grace"),
+			ZombieAge: c.Duration("zombie-age"),
+		}
+		go reaper.Start(interval)
+	}
+
+	// start the builds of the scheduled crons
+	scheduler := &droneserver.CronScheduler{
+		Store:  store_,
+		Remote: remote_,
+		Host:   droneserver.Config.Server.Host,
+	}
+	go scheduler.Start(time.Minute)
+
+	// delete the builds outside of the retention policy
+	if interval := c.Duration("retention-interval"); interval > 0 {
+		retention := &droneserver.Retention{
+			Store:  store_,
+			Builds: droneserver.Config.Retention.Builds,
+			Days:   droneserver.Config.Retention.Days,
+		}
+		go retention.Start(interval)
+	}
+
 	var g errgroup.Group
 
 	// start the grpc server
@@ -690,7 +840,16 @@ func setupEvilGlobals(c *cli.Context, v store.Store, r remote.Remote) {
 	droneserver.Config.Server.Host = strings.TrimRight(c.String("server-host"), "/")
 	droneserver.Config.Server.Port = c.String("server-addr")
 	droneserver.Config.Server.RepoConfig = c.String("repo-config")
+	droneserver.Config.Server.ConfigFallback = c.String("repo-config-fallback")
+	droneserver.Config.Server.ConfigFallbackPath = c.String("repo-config-fallback-path")
+	droneserver.Config.Retention.Builds = c.Int("retention-builds")
+	droneserver.Config.Retention.Days = c.Int("retention-days")
+	droneserver.Config.BuildRate.Repo = c.Int("build-rate-limit")
+	droneserver.Config.BuildRate.User = c.Int("build-rate-limit-user")
+	droneserver.Config.BuildRate.Window = c.Duration("build-rate-limit-window")
 	droneserver.Config.Server.SessionExpires = c.Duration("session-expires")
+	droneserver.Config.Server.RegistryValidate = c.Bool("registry-validate")
+	droneserver.Config.Server.SkipDrop = c.Bool("skip-ci-drop")
 	droneserver.Config.Pipeline.Networks = c.StringSlice("network")
 	droneserver.Config.Pipeline.Volumes = c.StringSlice("volume")
 	droneserver.Config.Pipeline.Privileged = c.StringSlice("escalate")
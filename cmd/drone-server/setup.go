@@ -21,6 +21,7 @@ import (
 	"github.com/cncd/queue"
 	"github.com/dimfeld/httptreemux"
 	"github.com/drone/drone/model"
+	"github.com/drone/drone/plugins/logs"
 	"github.com/drone/drone/plugins/registry"
 	"github.com/drone/drone/plugins/secrets"
 	"github.com/drone/drone/remote"
@@ -36,18 +37,68 @@ import (
 	"github.com/drone/drone/store"
 	"github.com/drone/drone/store/datastore"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
 func setupStore(c *cli.Context) store.Store {
-	return datastore.New(
+	v := datastore.New(
 		c.String("driver"),
 		c.String("datasource"),
 	)
+	var s store.Store = v
+	if logs := setupLogStore(c, v); logs != nil {
+		s = store.WithLogStore(s, logs)
+	}
+	s, err := setupEncryption(c, s)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+	return s
+}
+
+// setupEncryption wraps the store to encrypt secrets and registry
+// credentials when an encryption key is configured.
+func setupEncryption(c *cli.Context, s store.Store) (store.Store, error) {
+	key := c.String("secret-encryption-key")
+	if key == "" {
+		return s, nil
+	}
+	var old [][]byte
+	if k := c.String("secret-encryption-key-old"); k != "" {
+		old = append(old, []byte(k))
+	}
+	return store.WithEncryption(s, []byte(key), old...)
+}
+
+// setupLogStore returns the s3 log store when a bucket is configured,
+// and nil otherwise. Logs missing from the bucket are read from the
+// fallback store.
+func setupLogStore(c *cli.Context, fallback model.LogStore) model.LogStore {
+	if c.String("logs-s3-bucket") == "" {
+		return nil
+	}
+	return logs.NewS3(logs.S3Options{
+		Endpoint:  c.String("logs-s3-endpoint"),
+		Bucket:    c.String("logs-s3-bucket"),
+		Region:    c.String("logs-s3-region"),
+		Prefix:    c.String("logs-s3-prefix"),
+		AccessKey: c.String("logs-s3-access-key"),
+		SecretKey: c.String("logs-s3-secret-key"),
+		PathStyle: c.Bool("logs-s3-path-style"),
+	}, fallback)
 }
 
 func setupQueue(c *cli.Context, s store.Store) queue.Queue {
-	return model.WithTaskStore(queue.New(), s)
+	limit := func(name string) int {
+		repo, err := s.GetRepoName(name)
+		if err != nil {
+			return 0
+		}
+		return repo.Concurrency
+	}
+	q := model.WithConcurrencyLimit(model.WithPause(queue.New()), limit)
+	return model.WithTaskStore(q, s)
 }
 
 func setupSecretService(c *cli.Context, s store.Store) model.SecretService {
@@ -0,0 +1,52 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// Audit actions recorded for a build.
+const (
+	AuditApprove   = "approve"
+	AuditDecline   = "decline"
+	AuditCancel    = "cancel"
+	AuditKill      = "kill"
+	AuditCancelAll = "cancel_all"
+	AuditPurgeLogs = "purge_logs"
+	AuditPromote   = "promote"
+)
+
+// Audit actions recorded for global secrets.
+const (
+	AuditSecretCreate = "secret_create"
+	AuditSecretDelete = "secret_delete"
+)
+
+// AuditStore persists audit entries to storage.
+type AuditStore interface {
+	AuditList(*Repo) ([]*Audit, error)
+	AuditCreate(*Audit) error
+}
+
+// Audit records an action taken by a user on a build, or on a server
+// resource such as a global secret.
+//
+// swagger:model audit
+type Audit struct {
+	ID      int64  `json:"id"               meddler:"audit_id,pk"`
+	RepoID  int64  `json:"-"                meddler:"audit_repo_id"`
+	Build   int    `json:"build"            meddler:"audit_build"`
+	Actor   string `json:"actor"            meddler:"audit_actor"`
+	Action  string `json:"action"           meddler:"audit_action"`
+	Target  string `json:"target,omitempty" meddler:"audit_target"`
+	Created int64  `json:"created_at"       meddler:"audit_created"`
+}
@@ -14,40 +14,89 @@
 
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// buildStatuses and buildEvents list the values accepted
+// when filtering the build list.
+var (
+	buildStatuses = []string{
+		StatusSkipped,
+		StatusPending,
+		StatusRunning,
+		StatusSuccess,
+		StatusFailure,
+		StatusKilled,
+		StatusError,
+		StatusBlocked,
+		StatusDeclined,
+	}
+	buildEvents = []string{
+		EventPush,
+		EventPull,
+		EventTag,
+		EventDeploy,
+		EventCron,
+		EventManual,
+	}
+)
+
+var (
+	errBuildFilterStatus = fmt.Errorf("Invalid Build Status. Allowed values are %s", strings.Join(buildStatuses, ", "))
+	errBuildFilterEvent  = fmt.Errorf("Invalid Build Event. Allowed values are %s", strings.Join(buildEvents, ", "))
+)
+
 // swagger:model build
 type Build struct {
-	ID        int64   `json:"id"            meddler:"build_id,pk"`
-	RepoID    int64   `json:"-"             meddler:"build_repo_id"`
-	ConfigID  int64   `json:"-"             meddler:"build_config_id"`
-	Number    int     `json:"number"        meddler:"build_number"`
-	Parent    int     `json:"parent"        meddler:"build_parent"`
-	Event     string  `json:"event"         meddler:"build_event"`
-	Status    string  `json:"status"        meddler:"build_status"`
-	Error     string  `json:"error"         meddler:"build_error"`
-	Enqueued  int64   `json:"enqueued_at"   meddler:"build_enqueued"`
-	Created   int64   `json:"created_at"    meddler:"build_created"`
-	Started   int64   `json:"started_at"    meddler:"build_started"`
-	Finished  int64   `json:"finished_at"   meddler:"build_finished"`
-	Deploy    string  `json:"deploy_to"     meddler:"build_deploy"`
-	Commit    string  `json:"commit"        meddler:"build_commit"`
-	Branch    string  `json:"branch"        meddler:"build_branch"`
-	Ref       string  `json:"ref"           meddler:"build_ref"`
-	Refspec   string  `json:"refspec"       meddler:"build_refspec"`
-	Remote    string  `json:"remote"        meddler:"build_remote"`
-	Title     string  `json:"title"         meddler:"build_title"`
-	Message   string  `json:"message"       meddler:"build_message"`
-	Timestamp int64   `json:"timestamp"     meddler:"build_timestamp"`
-	Sender    string  `json:"sender"        meddler:"build_sender"`
-	Author    string  `json:"author"        meddler:"build_author"`
-	Avatar    string  `json:"author_avatar" meddler:"build_avatar"`
-	Email     string  `json:"author_email"  meddler:"build_email"`
-	Link      string  `json:"link_url"      meddler:"build_link"`
-	Signed    bool    `json:"signed"        meddler:"build_signed"`   // deprecate
-	Verified  bool    `json:"verified"      meddler:"build_verified"` // deprecate
-	Reviewer  string  `json:"reviewed_by"   meddler:"build_reviewer"`
-	Reviewed  int64   `json:"reviewed_at"   meddler:"build_reviewed"`
-	Procs     []*Proc `json:"procs,omitempty" meddler:"-"`
-	Files     []*File `json:"files,omitempty" meddler:"-"`
+	ID            int64             `json:"id"            meddler:"build_id,pk"`
+	RepoID        int64             `json:"-"             meddler:"build_repo_id"`
+	ConfigID      int64             `json:"-"             meddler:"build_config_id"`
+	Fallback      string            `json:"config_fallback,omitempty" meddler:"build_config_fallback"`
+	Number        int               `json:"number"        meddler:"build_number"`
+	Parent        int               `json:"parent"        meddler:"build_parent"`
+	Reproduction  bool              `json:"reproduction"  meddler:"build_reproduction"`
+	Trigger       string            `json:"trigger"       meddler:"build_trigger"`
+	Event         string            `json:"event"         meddler:"build_event"`
+	Status        string            `json:"status"        meddler:"build_status"`
+	Held          bool              `json:"held,omitempty" meddler:"build_held"` // pending on the build concurrency limit
+	Error         string            `json:"error"         meddler:"build_error"`
+	Enqueued      int64             `json:"enqueued_at"   meddler:"build_enqueued"`
+	Created       int64             `json:"created_at"    meddler:"build_created"`
+	Started       int64             `json:"started_at"    meddler:"build_started"`
+	Finished      int64             `json:"finished_at"   meddler:"build_finished"`
+	Deploy        string            `json:"deploy_to"     meddler:"build_deploy"`
+	Commit        string            `json:"commit"        meddler:"build_commit"`
+	Branch        string            `json:"branch"        meddler:"build_branch"`
+	Ref           string            `json:"ref"           meddler:"build_ref"`
+	Refspec       string            `json:"refspec"       meddler:"build_refspec"`
+	Remote        string            `json:"remote"        meddler:"build_remote"`
+	Title         string            `json:"title"         meddler:"build_title"`
+	Message       string            `json:"message"       meddler:"build_message"`
+	Timestamp     int64             `json:"timestamp"     meddler:"build_timestamp"`
+	Sender        string            `json:"sender"        meddler:"build_sender"`
+	Author        string            `json:"author"        meddler:"build_author"`
+	Avatar        string            `json:"author_avatar" meddler:"build_avatar"`
+	Email         string            `json:"author_email"  meddler:"build_email"`
+	Link          string            `json:"link_url"      meddler:"build_link"`
+	Signed        bool              `json:"signed"        meddler:"build_signed"`   // deprecate
+	Verified      bool              `json:"verified"      meddler:"build_verified"` // hook signature verified
+	Reviewer      string            `json:"reviewed_by"   meddler:"build_reviewer"`
+	Reviewed      int64             `json:"reviewed_at"   meddler:"build_reviewed"`
+	DeclineReason string            `json:"decline_reason,omitempty" meddler:"build_decline_reason"`
+	BlockReason   string            `json:"block_reason,omitempty" meddler:"build_block_reason"`
+	Duration      int64             `json:"duration,omitempty" meddler:"-"`
+	Awaiting      []int             `json:"awaiting_review,omitempty" meddler:"-"`
+	Procs         []*Proc           `json:"procs,omitempty" meddler:"-"`
+	Files         []*File           `json:"files,omitempty" meddler:"-"`
+	Configs       []string          `json:"configs,omitempty" meddler:"-"`
+	Params        map[string]string `json:"params,omitempty" meddler:"-"`
+	Environ       map[string]string `json:"environ,omitempty" meddler:"-"`
+	Restartable   bool              `json:"restartable" meddler:"-"`
+	Cancellable   bool              `json:"cancellable" meddler:"-"`
 }
 
 // Trim trims string values that would otherwise exceed
@@ -59,4 +108,110 @@ func (b *Build) Trim() {
 	if len(b.Message) > 2000 {
 		b.Message = b.Message[:2000]
 	}
+	if len(b.DeclineReason) > 500 {
+		b.DeclineReason = b.DeclineReason[:500]
+	}
+}
+
+// Review returns a description of the review of a blocked build, for
+// example "Approved by octocat at 2018-03-01T12:00:00Z". It returns an
+// empty string if the build was never reviewed.
+func (b *Build) Review() string {
+	if b.Reviewer == "" {
+		return ""
+	}
+	verb := "Approved"
+	if b.Status == StatusDeclined {
+		verb = "Declined"
+	}
+	at := time.Unix(b.Reviewed, 0).UTC().Format(time.RFC3339)
+	return fmt.Sprintf("%s by %s at %s", verb, b.Reviewer, at)
+}
+
+// MarshalJSON encodes the build with the description of its review,
+// so that clients can display who approved or declined the build.
+func (b Build) MarshalJSON() ([]byte, error) {
+	type build Build
+	return json.Marshal(struct {
+		build
+		Review string `json:"review,omitempty"`
+	}{build(b), b.Review()})
+}
+
+// SetAwaiting sets the pids of the pipelines waiting for approval.
+func (b *Build) SetAwaiting(procs []*Proc) {
+	b.Awaiting = nil
+	for _, proc := range Gated(procs) {
+		b.Awaiting = append(b.Awaiting, proc.PID)
+	}
+}
+
+// CanRestart returns true if the build can be restarted. Only finished
+// builds can be restarted. Pending and running builds must be
+// cancelled first, and blocked or declined builds must be reviewed
+// instead.
+func (b *Build) CanRestart() bool {
+	switch b.Status {
+	case StatusSuccess, StatusFailure, StatusError, StatusKilled:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanCancel returns true if the build can be cancelled, which is when
+// it is pending or running.
+func (b *Build) CanCancel() bool {
+	return b.Status == StatusPending || b.Status == StatusRunning
+}
+
+// SetActions sets whether the build can be restarted or cancelled, so
+// that clients do not have to replicate the rules.
+func (b *Build) SetActions() {
+	b.Restartable = b.CanRestart()
+	b.Cancellable = b.CanCancel()
+}
+
+// BuildFilter defines optional criteria used to narrow the
+// list of builds returned for a repository. Empty values
+// are ignored.
+type BuildFilter struct {
+	Status string
+	Event  string
+	Branch string
+	Author string
+	Ref    string
+	Refs   []string // any of the refs, eg of a pull request
+}
+
+// PullRequestRefs returns the git references of the pull request with
+// the given number, covering the naming schemes of the remotes.
+func PullRequestRefs(number int) []string {
+	return []string{
+		fmt.Sprintf("refs/pull/%d/head", number),
+		fmt.Sprintf("refs/pull/%d/merge", number),
+		fmt.Sprintf("refs/pull/%d/MERGE", number),
+		fmt.Sprintf("refs/merge-requests/%d/head", number),
+	}
+}
+
+// Validate validates the filter values.
+func (f *BuildFilter) Validate() error {
+	switch {
+	case f.Status != "" && !contains(buildStatuses, f.Status):
+		return errBuildFilterStatus
+	case f.Event != "" && !contains(buildEvents, f.Event):
+		return errBuildFilterEvent
+	default:
+		return nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
 }
@@ -16,6 +16,7 @@ package model
 
 import (
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"testing"
 )
@@ -35,3 +36,87 @@ func TestBuildTrim(t *testing.T) {
 		t.Errorf("Failed to trim text string to 2000 bytes")
 	}
 }
+
+func TestBuildFilterValidate(t *testing.T) {
+	filter := BuildFilter{}
+	if err := filter.Validate(); err != nil {
+		t.Errorf("Expect empty filter to be valid")
+	}
+	filter = BuildFilter{Status: StatusFailure, Event: EventPush}
+	if err := filter.Validate(); err != nil {
+		t.Errorf("Expect filter to be valid, got %s", err)
+	}
+	filter = BuildFilter{Status: "broken"}
+	if err := filter.Validate(); err != errBuildFilterStatus {
+		t.Errorf("Expect invalid status error, got %v", err)
+	}
+	filter = BuildFilter{Event: "commit"}
+	if err := filter.Validate(); err != errBuildFilterEvent {
+		t.Errorf("Expect invalid event error, got %v", err)
+	}
+}
+
+func TestBuildReview(t *testing.T) {
+	tests := []struct {
+		build Build
+		want  string
+	}{
+		{Build{Status: StatusSuccess}, ""},
+		{Build{Status: StatusSuccess, Reviewer: "octocat", Reviewed: 1519905600}, "Approved by octocat at 2018-03-01T12:00:00Z"},
+		{Build{Status: StatusDeclined, Reviewer: "octocat", Reviewed: 1519905600}, "Declined by octocat at 2018-03-01T12:00:00Z"},
+	}
+	for _, test := range tests {
+		if got := test.build.Review(); got != test.want {
+			t.Errorf("Want review %q, got %q", test.want, got)
+		}
+	}
+}
+
+func TestBuildReviewJSON(t *testing.T) {
+	build := &Build{Number: 1, Status: StatusSuccess, Reviewer: "octocat", Reviewed: 1519905600}
+	out := map[string]interface{}{}
+	data, _ := json.Marshal(build)
+	json.Unmarshal(data, &out)
+	if got := out["review"]; got != "Approved by octocat at 2018-03-01T12:00:00Z" {
+		t.Errorf("Want the review in the build json, got %v", got)
+	}
+	if got := out["reviewed_by"]; got != "octocat" {
+		t.Errorf("Want the reviewer in the build json, got %v", got)
+	}
+
+	out = map[string]interface{}{}
+	data, _ = json.Marshal(Event{Build: Build{Number: 1, Status: StatusSuccess}})
+	json.Unmarshal(data, &out)
+	encoded := out["build"].(map[string]interface{})
+	if _, ok := encoded["review"]; ok {
+		t.Errorf("Want no review in the json of builds that were never reviewed")
+	}
+	if got := encoded["number"]; got != float64(1) {
+		t.Errorf("Want the build fields in the json, got number %v", got)
+	}
+}
+
+func TestBuildActions(t *testing.T) {
+	tests := []struct {
+		status  string
+		restart bool
+		cancel  bool
+	}{
+		{StatusSuccess, true, false},
+		{StatusFailure, true, false},
+		{StatusError, true, false},
+		{StatusKilled, true, false},
+		{StatusPending, false, true},
+		{StatusRunning, false, true},
+		{StatusBlocked, false, false},
+		{StatusDeclined, false, false},
+	}
+	for _, test := range tests {
+		b := &Build{Status: test.status}
+		b.SetActions()
+		if b.Restartable != test.restart || b.Cancellable != test.cancel {
+			t.Errorf("Want a %s build restartable %v and cancellable %v, got %v and %v",
+				test.status, test.restart, test.cancel, b.Restartable, b.Cancellable)
+		}
+	}
+}
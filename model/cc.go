@@ -49,20 +49,30 @@ func NewCC(r *Repo, b *Build, link string) *CCProjects {
 	if b.Status != StatusPending &&
 		b.Status != StatusRunning {
 		proj.Activity = "Sleeping"
-		proj.LastBuildTime = time.Unix(b.Started, 0).Format(time.RFC3339)
+		proj.LastBuildTime = time.Unix(ccTime(b), 0).Format(time.RFC3339)
 		proj.LastBuildLabel = strconv.Itoa(b.Number)
 	}
 
 	// ensure the last build Status accepts a valid
-	// ccmenu enumeration
+	// ccmenu enumeration. Blocked builds are waiting
+	// for approval and have no outcome yet.
 	switch b.Status {
 	case StatusError, StatusKilled:
 		proj.LastBuildStatus = "Exception"
 	case StatusSuccess:
 		proj.LastBuildStatus = "Success"
-	case StatusFailure:
+	case StatusFailure, StatusDeclined:
 		proj.LastBuildStatus = "Failure"
 	}
 
 	return &CCProjects{Project: proj}
 }
+
+// ccTime returns the time the build started. Builds that never started,
+// such as blocked or declined builds, fall back to the created time.
+func ccTime(b *Build) int64 {
+	if b.Started != 0 {
+		return b.Started
+	}
+	return b.Created
+}
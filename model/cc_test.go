@@ -83,6 +83,31 @@ func TestCC(t *testing.T) {
 			g.Assert(cc.Project.Activity).Equal("Sleeping")
 		})
 
+		g.It("Should properly label declined", func() {
+			r := &Repo{FullName: "foo/bar"}
+			b := &Build{
+				Status:  StatusDeclined,
+				Number:  1,
+				Created: 1257894000,
+			}
+			cc := NewCC(r, b, "http://localhost/foo/bar/1")
+			g.Assert(cc.Project.LastBuildStatus).Equal("Failure")
+			g.Assert(cc.Project.Activity).Equal("Sleeping")
+			g.Assert(cc.Project.LastBuildTime).Equal(time.Unix(1257894000, 0).Format(time.RFC3339))
+		})
+
+		g.It("Should properly label blocked", func() {
+			r := &Repo{FullName: "foo/bar"}
+			b := &Build{
+				Status:  StatusBlocked,
+				Number:  1,
+				Created: 1257894000,
+			}
+			cc := NewCC(r, b, "http://localhost/foo/bar/1")
+			g.Assert(cc.Project.LastBuildStatus).Equal("Unknown")
+			g.Assert(cc.Project.Activity).Equal("Sleeping")
+		})
+
 		g.It("Should properly label running", func() {
 			r := &Repo{FullName: "foo/bar"}
 			b := &Build{
@@ -0,0 +1,138 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "strconv"
+
+// Proc changes between two builds.
+const (
+	ProcAdded     = "added"
+	ProcRemoved   = "removed"
+	ProcChanged   = "changed"
+	ProcUnchanged = "unchanged"
+)
+
+// BuildComparison represents the differences between two builds of a
+// repository. All durations are in seconds, and deltas are the head
+// duration minus the base duration.
+type BuildComparison struct {
+	Base          int               `json:"base"`
+	Head          int               `json:"head"`
+	BaseStatus    string            `json:"base_status"`
+	HeadStatus    string            `json:"head_status"`
+	BaseDuration  int64             `json:"base_duration"`
+	HeadDuration  int64             `json:"head_duration"`
+	DurationDelta int64             `json:"duration_delta"`
+	Procs         []*ProcComparison `json:"procs"`
+}
+
+// ProcComparison represents the differences of a proc between two
+// builds. Procs are matched by their path, the names of the pipeline
+// and the step separated by a slash.
+type ProcComparison struct {
+	Path          string `json:"path"`
+	Change        string `json:"change"`
+	BaseState     string `json:"base_state,omitempty"`
+	HeadState     string `json:"head_state,omitempty"`
+	BaseDuration  int64  `json:"base_duration"`
+	HeadDuration  int64  `json:"head_duration"`
+	DurationDelta int64  `json:"duration_delta"`
+}
+
+// Compare computes the differences between the base and head builds
+// and their procs. Procs that did not finish yet are measured until
+// now. Procs are listed in the order of the head build, followed by
+// the procs removed from the base build.
+func Compare(base *Build, baseProcs []*Proc, head *Build, headProcs []*Proc, now int64) *BuildComparison {
+	base.SetTimings(baseProcs, now)
+	head.SetTimings(headProcs, now)
+
+	comp := &BuildComparison{
+		Base:          base.Number,
+		Head:          head.Number,
+		BaseStatus:    base.Status,
+		HeadStatus:    head.Status,
+		BaseDuration:  base.Duration,
+		HeadDuration:  head.Duration,
+		DurationDelta: head.Duration - base.Duration,
+		Procs:         []*ProcComparison{},
+	}
+
+	basePaths := procPaths(baseProcs)
+	headPaths := procPaths(headProcs)
+	byPath := map[string]*Proc{}
+	for i, proc := range baseProcs {
+		byPath[basePaths[i]] = proc
+	}
+	seen := map[string]bool{}
+	for i, proc := range headProcs {
+		path := headPaths[i]
+		seen[path] = true
+		pc := &ProcComparison{
+			Path:          path,
+			Change:        ProcAdded,
+			HeadState:     proc.State,
+			HeadDuration:  proc.Duration,
+			DurationDelta: proc.Duration,
+		}
+		if prev, ok := byPath[path]; ok {
+			pc.Change = ProcUnchanged
+			if prev.State != proc.State {
+				pc.Change = ProcChanged
+			}
+			pc.BaseState = prev.State
+			pc.BaseDuration = prev.Duration
+			pc.DurationDelta = proc.Duration - prev.Duration
+		}
+		comp.Procs = append(comp.Procs, pc)
+	}
+	for i, proc := range baseProcs {
+		path := basePaths[i]
+		if seen[path] {
+			continue
+		}
+		comp.Procs = append(comp.Procs, &ProcComparison{
+			Path:          path,
+			Change:        ProcRemoved,
+			BaseState:     proc.State,
+			BaseDuration:  proc.Duration,
+			DurationDelta: -proc.Duration,
+		})
+	}
+	return comp
+}
+
+// procPaths returns the path of each proc, the name of its pipeline
+// followed by its own name. Unnamed pipelines are named by their pid.
+func procPaths(procs []*Proc) []string {
+	names := map[int]string{}
+	for _, proc := range procs {
+		if proc.PPID == 0 {
+			names[proc.PID] = proc.Name
+			if proc.Name == "" {
+				names[proc.PID] = strconv.Itoa(proc.PID)
+			}
+		}
+	}
+	paths := make([]string, len(procs))
+	for i, proc := range procs {
+		if proc.PPID == 0 {
+			paths[i] = names[proc.PID]
+		} else {
+			paths[i] = names[proc.PPID] + "/" + proc.Name
+		}
+	}
+	return paths
+}
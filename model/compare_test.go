@@ -0,0 +1,66 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	base := &Build{Number: 1, Status: StatusSuccess, Started: 100, Finished: 160}
+	baseProcs := []*Proc{
+		{PID: 1, Name: "linux/amd64", State: StatusSuccess, Started: 100, Stopped: 160},
+		{PID: 2, PPID: 1, Name: "clone", State: StatusSuccess, Started: 100, Stopped: 110},
+		{PID: 3, PPID: 1, Name: "test", State: StatusSuccess, Started: 110, Stopped: 150},
+		{PID: 4, PPID: 1, Name: "lint", State: StatusSuccess, Started: 150, Stopped: 160},
+	}
+	head := &Build{Number: 2, Status: StatusFailure, Started: 200, Finished: 290}
+	headProcs := []*Proc{
+		{PID: 1, Name: "linux/amd64", State: StatusFailure, Started: 200, Stopped: 290},
+		{PID: 2, PPID: 1, Name: "clone", State: StatusSuccess, Started: 200, Stopped: 215},
+		{PID: 3, PPID: 1, Name: "test", State: StatusFailure, Started: 215, Stopped: 280},
+		{PID: 4, PPID: 1, Name: "build", State: StatusSkipped},
+	}
+
+	comp := Compare(base, baseProcs, head, headProcs, 300)
+
+	if comp.DurationDelta != 30 {
+		t.Errorf("Want build duration delta 30, got %d", comp.DurationDelta)
+	}
+	tests := []struct {
+		path   string
+		change string
+		from   string
+		to     string
+		delta  int64
+	}{
+		{"linux/amd64", ProcChanged, StatusSuccess, StatusFailure, 30},
+		{"linux/amd64/clone", ProcUnchanged, StatusSuccess, StatusSuccess, 5},
+		{"linux/amd64/test", ProcChanged, StatusSuccess, StatusFailure, 25},
+		{"linux/amd64/build", ProcAdded, "", StatusSkipped, 0},
+		{"linux/amd64/lint", ProcRemoved, StatusSuccess, "", -10},
+	}
+	if len(comp.Procs) != len(tests) {
+		t.Fatalf("Want %d procs compared, got %d", len(tests), len(comp.Procs))
+	}
+	for i, test := range tests {
+		got := comp.Procs[i]
+		if got.Path != test.path || got.Change != test.change ||
+			got.BaseState != test.from || got.HeadState != test.to ||
+			got.DurationDelta != test.delta {
+			t.Errorf("Want proc %s %s %s→%s delta %d, got %s %s %s→%s delta %d",
+				test.path, test.change, test.from, test.to, test.delta,
+				got.Path, got.Change, got.BaseState, got.HeadState, got.DurationDelta)
+		}
+	}
+}
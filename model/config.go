@@ -28,4 +28,8 @@ type Config struct {
 	RepoID int64  `json:"-"    meddler:"config_repo_id"`
 	Data   string `json:"data" meddler:"config_data"`
 	Hash   string `json:"hash" meddler:"config_hash"`
+
+	// Name is the name of the configuration file, set when the
+	// configuration is one of many files in a configuration directory.
+	Name string `json:"name,omitempty" meddler:"-"`
 }
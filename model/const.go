@@ -19,6 +19,8 @@ const (
 	EventPull   = "pull_request"
 	EventTag    = "tag"
 	EventDeploy = "deployment"
+	EventCron   = "cron"
+	EventManual = "manual"
 )
 
 const (
@@ -31,6 +33,16 @@ const (
 	StatusError    = "error"
 	StatusBlocked  = "blocked"
 	StatusDeclined = "declined"
+	StatusGated    = "gated" // pipeline waiting for approval
+)
+
+// Build triggers recording how a build was created.
+const (
+	TriggerHook    = "push-hook"   // webhook from the remote
+	TriggerAPI     = "manual-api"  // triggered or promoted through the api
+	TriggerRestart = "restart"     // restart of a previous build
+	TriggerCron    = "cron"        // scheduled build
+	TriggerReplay  = "hook-replay" // replay of a stored webhook delivery
 )
 
 const (
@@ -40,6 +52,14 @@ const (
 	RepoPerforce = "perforce"
 )
 
+// Approval policies deciding which builds wait for approval.
+const (
+	ApprovalNone         = "none"
+	ApprovalForks        = "forks"         // pull requests from forks
+	ApprovalPullRequests = "pull_requests" // all pull requests
+	ApprovalAll          = "all"           // all events
+)
+
 const (
 	VisibilityPublic   = "public"
 	VisibilityPrivate  = "private"
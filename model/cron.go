@@ -0,0 +1,88 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/drone/drone/shared/schedule"
+)
+
+var (
+	errCronNameInvalid   = errors.New("Invalid Cron Name")
+	errCronBranchInvalid = errors.New("Invalid Cron Branch")
+	errCronNeverDue      = errors.New("Cron Expression is never due")
+)
+
+// CronStore persists cron information to storage.
+type CronStore interface {
+	CronFind(*Repo, string) (*Cron, error)
+	CronList(*Repo) ([]*Cron, error)
+	CronListNext(int64) ([]*Cron, error)
+	CronCreate(*Cron) error
+	CronUpdate(*Cron) error
+	CronDelete(*Cron) error
+}
+
+// Cron represents a build that is scheduled to run periodically.
+type Cron struct {
+	ID      int64  `json:"id"            meddler:"cron_id,pk"`
+	RepoID  int64  `json:"-"             meddler:"cron_repo_id"`
+	Name    string `json:"name"          meddler:"cron_name"`
+	Expr    string `json:"expr"          meddler:"cron_expr"`
+	Branch  string `json:"branch"        meddler:"cron_branch"`
+	Target  string `json:"target"        meddler:"cron_target"`
+	Creator string `json:"creator"       meddler:"cron_creator"`
+	Overlap bool   `json:"overlap"       meddler:"cron_overlap"`
+	Next    int64  `json:"next_exec"     meddler:"cron_next"`
+	Build   int    `json:"last_build"    meddler:"cron_build"`
+	Created int64  `json:"created_at"    meddler:"cron_created"`
+}
+
+// CronPatch represents a cron patch object.
+type CronPatch struct {
+	Expr    *string `json:"expr,omitempty"`
+	Branch  *string `json:"branch,omitempty"`
+	Target  *string `json:"target,omitempty"`
+	Overlap *bool   `json:"overlap,omitempty"`
+}
+
+// Validate validates the required fields and formats.
+func (c *Cron) Validate() error {
+	switch {
+	case len(c.Name) == 0:
+		return errCronNameInvalid
+	case len(c.Branch) == 0:
+		return errCronBranchInvalid
+	}
+	_, err := schedule.Parse(c.Expr)
+	return err
+}
+
+// Schedule computes the next execution of the cron after the given
+// time.
+func (c *Cron) Schedule(now time.Time) error {
+	s, err := schedule.Parse(c.Expr)
+	if err != nil {
+		return err
+	}
+	next := s.Next(now)
+	if next.IsZero() {
+		return errCronNeverDue
+	}
+	c.Next = next.Unix()
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// DeliveryStore persists webhook deliveries to storage.
+type DeliveryStore interface {
+	DeliveryList(*Repo) ([]*Delivery, error)
+	DeliveryFind(*Repo, int64) (*Delivery, error)
+	DeliveryCreate(*Delivery) error
+	DeliveryPrune(*Repo, int) error
+}
+
+// Delivery records a webhook delivered by the remote for a repository,
+// and the outcome of processing it.
+//
+// swagger:model delivery
+type Delivery struct {
+	ID       int64               `json:"id"                  meddler:"delivery_id,pk"`
+	RepoID   int64               `json:"-"                   meddler:"delivery_repo_id"`
+	Event    string              `json:"event"               meddler:"delivery_event"`
+	Headers  map[string][]string `json:"headers"             meddler:"delivery_headers,json"`
+	Payload  string              `json:"payload"             meddler:"delivery_payload"`
+	Status   int                 `json:"status"              meddler:"delivery_status"`
+	Build    int                 `json:"build,omitempty"     meddler:"delivery_build"`
+	Reason   string              `json:"reason,omitempty"    meddler:"delivery_reason"`
+	Replay   int64               `json:"replay_of,omitempty" meddler:"delivery_replay"`
+	Verified bool                `json:"verified"            meddler:"delivery_verified"`
+	Created  int64               `json:"created_at"          meddler:"delivery_created"`
+}
@@ -16,6 +16,7 @@ package model
 
 import (
 	"errors"
+	"regexp"
 )
 
 var (
@@ -23,28 +24,38 @@ var (
 	errEnvironValueInvalid = errors.New("Invalid Environment Variable Value")
 )
 
-// EnvironService defines a service for managing environment variables.
+// EnvironService defines a service for managing the global environment
+// variables injected into every build.
 type EnvironService interface {
 	EnvironList(*Repo) ([]*Environ, error)
 }
 
-// EnvironStore persists environment information to storage.
+// EnvironStore persists the environment variables of repositories to
+// storage.
 type EnvironStore interface {
+	EnvironFind(*Repo, string) (*Environ, error)
 	EnvironList(*Repo) ([]*Environ, error)
+	EnvironCreate(*Environ) error
+	EnvironUpdate(*Environ) error
+	EnvironDelete(*Environ) error
 }
 
 // Environ represents an environment variable.
 // swagger:model environ
 type Environ struct {
-	ID    int64  `json:"id"              meddler:"env_id,pk"`
-	Name  string `json:"name"            meddler:"env_name"`
-	Value string `json:"value,omitempty" meddler:"env_value"`
+	ID     int64  `json:"id"              meddler:"env_id,pk"`
+	RepoID int64  `json:"-"               meddler:"env_repo_id"`
+	Name   string `json:"name"            meddler:"env_name"`
+	Value  string `json:"value,omitempty" meddler:"env_value"`
 }
 
+// environNameRegexp matches valid environment variable names.
+var environNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // Validate validates the required fields and formats.
 func (e *Environ) Validate() error {
 	switch {
-	case len(e.Name) == 0:
+	case !environNameRegexp.MatchString(e.Name):
 		return errEnvironNameInvalid
 	case len(e.Value) == 0:
 		return errEnvironValueInvalid
@@ -22,6 +22,7 @@ const (
 	Started   EventType = "started"
 	Finished  EventType = "finished"
 	Cancelled EventType = "cancelled"
+	Deployed  EventType = "deployed"
 )
 
 // Event represents a build event.
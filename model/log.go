@@ -0,0 +1,31 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "io"
+
+// LogStore persists the logs of pipeline procs.
+type LogStore interface {
+	LogFind(*Proc) (io.ReadCloser, error)
+	LogSave(*Proc, io.Reader) error
+	LogDelete(*Proc) error
+}
+
+// GzipLog is implemented by the readers of compressed logs, giving
+// access to the compressed log so it can be served without being
+// decompressed and compressed again.
+type GzipLog interface {
+	Gzip() io.Reader
+}
@@ -43,6 +43,8 @@ type Proc struct {
 	Platform string            `json:"platform,omitempty"   meddler:"proc_platform"`
 	Environ  map[string]string `json:"environ,omitempty"    meddler:"proc_environ,json"`
 	Children []*Proc           `json:"children,omitempty"   meddler:"-"`
+	Duration int64             `json:"duration,omitempty"   meddler:"-"`
+	Pending  int64             `json:"pending,omitempty"    meddler:"-"`
 }
 
 // Running returns true if the process state is pending or running.
@@ -55,6 +57,17 @@ func (p *Proc) Failing() bool {
 	return p.State == StatusError || p.State == StatusKilled || p.State == StatusFailure
 }
 
+// Gated returns the pipelines waiting for approval.
+func Gated(procs []*Proc) []*Proc {
+	var gated []*Proc
+	for _, proc := range procs {
+		if proc.PPID == 0 && proc.State == StatusGated {
+			gated = append(gated, proc)
+		}
+	}
+	return gated
+}
+
 // Tree creates a process tree from a flat process list.
 func Tree(procs []*Proc) []*Proc {
 	var (
@@ -16,6 +16,7 @@ package model
 
 import (
 	"context"
+	"sync"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/cncd/queue"
@@ -90,3 +91,239 @@ func (q *persistentQueue) Evict(c context.Context, id string) error {
 	}
 	return err
 }
+
+// QueueHeld returns the number of tasks held back per repository by a
+// queue with a concurrency limit.
+func QueueHeld(q queue.Queue) map[string]int {
+	for ; q != nil; q = unwrapQueue(q) {
+		if l, ok := q.(*limitedQueue); ok {
+			return l.Held()
+		}
+	}
+	return map[string]int{}
+}
+
+// QueuePauser returns the pausable queue wrapped by the queue, if any.
+func QueuePauser(q queue.Queue) (PausableQueue, bool) {
+	for ; q != nil; q = unwrapQueue(q) {
+		if p, ok := q.(PausableQueue); ok {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// unwrapQueue returns the queue wrapped by the queue, or nil.
+func unwrapQueue(q queue.Queue) queue.Queue {
+	switch q := q.(type) {
+	case *persistentQueue:
+		return q.Queue
+	case *limitedQueue:
+		return q.Queue
+	case *pausableQueue:
+		return q.Queue
+	}
+	return nil
+}
+
+// WithConcurrencyLimit returns a queue that limits the number of tasks
+// of a repository in the underlying queue. The repository is read from
+// the repo task label, and limit returns its maximum number of tasks,
+// where zero means unlimited. Tasks over the limit are held back until
+// a task of the same repository is done.
+func WithConcurrencyLimit(q queue.Queue, limit func(repo string) int) queue.Queue {
+	return &limitedQueue{
+		Queue:  q,
+		limit:  limit,
+		active: map[string]int{},
+		tasks:  map[string]string{},
+	}
+}
+
+type limitedQueue struct {
+	queue.Queue
+	sync.Mutex
+
+	limit  func(string) int
+	active map[string]int
+	tasks  map[string]string
+	held   []*queue.Task
+}
+
+// Push pushes a task to the underlying queue, or holds it back if the
+// repository has reached its concurrency limit.
+func (q *limitedQueue) Push(c context.Context, task *queue.Task) error {
+	q.Lock()
+	if !q.admit(task) {
+		logrus.Debugf("queue: hold task %s: concurrency limit reached", task.ID)
+		q.held = append(q.held, task)
+		q.Unlock()
+		return nil
+	}
+	q.Unlock()
+	return q.Queue.Push(c, task)
+}
+
+// Done signals that the task is done executing.
+func (q *limitedQueue) Done(c context.Context, id string) error {
+	err := q.Queue.Done(c, id)
+	q.release(c, id)
+	return err
+}
+
+// Error signals that the task is done executing with error.
+func (q *limitedQueue) Error(c context.Context, id string, err error) error {
+	rerr := q.Queue.Error(c, id, err)
+	q.release(c, id)
+	return rerr
+}
+
+// Evict removes a pending or held back task from the queue.
+func (q *limitedQueue) Evict(c context.Context, id string) error {
+	q.Lock()
+	for i, task := range q.held {
+		if task.ID == id {
+			q.held = append(q.held[:i], q.held[i+1:]...)
+			q.Unlock()
+			return nil
+		}
+	}
+	q.Unlock()
+
+	err := q.Queue.Evict(c, id)
+	if err == nil {
+		q.release(c, id)
+	}
+	return err
+}
+
+// Info returns internal queue information, where held back tasks are
+// reported as pending.
+func (q *limitedQueue) Info(c context.Context) queue.InfoT {
+	info := q.Queue.Info(c)
+	q.Lock()
+	info.Pending = append(info.Pending, q.held...)
+	info.Stats.Pending += len(q.held)
+	q.Unlock()
+	return info
+}
+
+// Held returns the number of tasks held back per repository.
+func (q *limitedQueue) Held() map[string]int {
+	q.Lock()
+	defer q.Unlock()
+	held := map[string]int{}
+	for _, task := range q.held {
+		held[task.Labels["repo"]]++
+	}
+	return held
+}
+
+// admit reports whether the task may be pushed to the underlying
+// queue and, if so, counts it against the repository limit. The lock
+// must be held by the caller.
+func (q *limitedQueue) admit(task *queue.Task) bool {
+	repo := task.Labels["repo"]
+	if repo == "" {
+		return true
+	}
+	if n := q.limit(repo); n > 0 && q.active[repo] >= n {
+		return false
+	}
+	q.active[repo]++
+	q.tasks[task.ID] = repo
+	return true
+}
+
+// release frees the slot of a finished task and pushes the next held
+// back task of the same repository to the underlying queue.
+func (q *limitedQueue) release(c context.Context, id string) {
+	q.Lock()
+	repo, ok := q.tasks[id]
+	if !ok {
+		q.Unlock()
+		return
+	}
+	delete(q.tasks, id)
+	q.active[repo]--
+
+	var next *queue.Task
+	for i, task := range q.held {
+		if task.Labels["repo"] == repo && q.admit(task) {
+			q.held = append(q.held[:i], q.held[i+1:]...)
+			next = task
+			break
+		}
+	}
+	q.Unlock()
+
+	if next != nil {
+		q.Queue.Push(c, next)
+	}
+}
+
+// PausableQueue is a queue that can temporarily stop handing out tasks.
+type PausableQueue interface {
+	queue.Queue
+
+	// Pause stops handing out tasks. Tasks are still accepted.
+	Pause()
+
+	// Resume resumes handing out tasks.
+	Resume()
+
+	// Paused reports whether the queue is paused.
+	Paused() bool
+}
+
+// WithPause returns a queue that can be paused, for example to drain
+// the agents before maintenance without cancelling running tasks. It
+// should wrap the innermost queue, since resuming pushes the pending
+// tasks to the wrapped queue again.
+func WithPause(q queue.Queue) PausableQueue {
+	return &pausableQueue{Queue: q}
+}
+
+type pausableQueue struct {
+	queue.Queue
+
+	mu     sync.Mutex
+	paused bool
+}
+
+// Poll retrieves and removes a task head of this queue. No task is
+// returned while the queue is paused.
+func (q *pausableQueue) Poll(c context.Context, f queue.Filter) (*queue.Task, error) {
+	return q.Queue.Poll(c, func(task *queue.Task) bool {
+		return !q.Paused() && f(task)
+	})
+}
+
+// Pause stops handing out tasks.
+func (q *pausableQueue) Pause() {
+	q.mu.Lock()
+	q.paused = true
+	q.mu.Unlock()
+}
+
+// Resume resumes handing out tasks. The pending tasks are pushed to the
+// queue again so they are offered to the waiting workers.
+func (q *pausableQueue) Resume() {
+	q.mu.Lock()
+	q.paused = false
+	q.mu.Unlock()
+
+	c := context.Background()
+	for _, task := range q.Queue.Info(c).Pending {
+		if err := q.Queue.Evict(c, task.ID); err == nil {
+			q.Queue.Push(c, task)
+		}
+	}
+}
+
+// Paused reports whether the queue is paused.
+func (q *pausableQueue) Paused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cncd/queue"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	noContext := context.Background()
+	limit := func(repo string) int {
+		if repo == "octocat/hello-world" {
+			return 1
+		}
+		return 0
+	}
+	q := WithConcurrencyLimit(queue.New(), limit)
+
+	push := func(id, repo string) {
+		q.Push(noContext, &queue.Task{
+			ID:     id,
+			Labels: map[string]string{"repo": repo},
+		})
+	}
+	push("1", "octocat/hello-world")
+	push("2", "octocat/hello-world")
+	push("3", "octocat/spoon-knife")
+	push("4", "octocat/spoon-knife")
+
+	info := q.Info(noContext)
+	if info.Stats.Pending != 4 {
+		t.Errorf("Want 4 pending tasks, got %d", info.Stats.Pending)
+	}
+	held := QueueHeld(q)
+	if held["octocat/hello-world"] != 1 || held["octocat/spoon-knife"] != 0 {
+		t.Errorf("Want 1 task held back for octocat/hello-world, got %v", held)
+	}
+
+	task, _ := q.Poll(noContext, func(*queue.Task) bool { return true })
+	if task.ID != "1" {
+		t.Fatalf("Want task 1 polled, got %s", task.ID)
+	}
+	q.Done(noContext, task.ID)
+
+	held = QueueHeld(q)
+	if held["octocat/hello-world"] != 0 {
+		t.Errorf("Want held back task released when a slot frees, got %v", held)
+	}
+	if info := q.Info(noContext); info.Stats.Pending != 3 {
+		t.Errorf("Want 3 pending tasks, got %d", info.Stats.Pending)
+	}
+}
+
+func TestConcurrencyLimitEvict(t *testing.T) {
+	noContext := context.Background()
+	q := WithConcurrencyLimit(queue.New(), func(string) int { return 1 })
+
+	for _, id := range []string{"1", "2"} {
+		q.Push(noContext, &queue.Task{
+			ID:     id,
+			Labels: map[string]string{"repo": "octocat/hello-world"},
+		})
+	}
+	if err := q.Evict(noContext, "2"); err != nil {
+		t.Errorf("Want held back task evicted, got error %s", err)
+	}
+	if held := QueueHeld(q); held["octocat/hello-world"] != 0 {
+		t.Errorf("Want no held back tasks after evict, got %v", held)
+	}
+	if err := q.Evict(noContext, "1"); err != nil {
+		t.Errorf("Want pending task evicted, got error %s", err)
+	}
+}
+
+func TestPause(t *testing.T) {
+	noContext := context.Background()
+	q := WithPause(queue.New())
+	q.Pause()
+	q.Push(noContext, &queue.Task{ID: "1"})
+
+	result := make(chan *queue.Task)
+	go func() {
+		task, _ := q.Poll(noContext, func(*queue.Task) bool { return true })
+		result <- task
+	}()
+
+	select {
+	case <-result:
+		t.Fatalf("Want no task handed out while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !q.Paused() {
+		t.Errorf("Want queue paused")
+	}
+
+	q.Resume()
+	select {
+	case task := <-result:
+		if task.ID != "1" {
+			t.Errorf("Want task 1 handed out after resume, got %s", task.ID)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Want pending task handed out after resume")
+	}
+}
@@ -16,6 +16,7 @@ package model
 
 import (
 	"fmt"
+	"path"
 	"strings"
 )
 
@@ -30,31 +31,42 @@ type RepoLite struct {
 //
 // swagger:model repo
 type Repo struct {
-	ID          int64  `json:"id,omitempty"             meddler:"repo_id,pk"`
-	UserID      int64  `json:"-"                        meddler:"repo_user_id"`
-	Owner       string `json:"owner"                    meddler:"repo_owner"`
-	Name        string `json:"name"                     meddler:"repo_name"`
-	FullName    string `json:"full_name"                meddler:"repo_full_name"`
-	Avatar      string `json:"avatar_url,omitempty"     meddler:"repo_avatar"`
-	Link        string `json:"link_url,omitempty"       meddler:"repo_link"`
-	Kind        string `json:"scm,omitempty"            meddler:"repo_scm"`
-	Clone       string `json:"clone_url,omitempty"      meddler:"repo_clone"`
-	Branch      string `json:"default_branch,omitempty" meddler:"repo_branch"`
-	Timeout     int64  `json:"timeout,omitempty"        meddler:"repo_timeout"`
-	Visibility  string `json:"visibility"               meddler:"repo_visibility"`
-	IsPrivate   bool   `json:"private"                  meddler:"repo_private"`
-	IsTrusted   bool   `json:"trusted"                  meddler:"repo_trusted"`
-	IsStarred   bool   `json:"starred,omitempty"        meddler:"-"`
-	IsGated     bool   `json:"gated"                    meddler:"repo_gated"`
-	IsActive    bool   `json:"active"                   meddler:"repo_active"`
-	AllowPull   bool   `json:"allow_pr"                 meddler:"repo_allow_pr"`
-	AllowPush   bool   `json:"allow_push"               meddler:"repo_allow_push"`
-	AllowDeploy bool   `json:"allow_deploys"            meddler:"repo_allow_deploys"`
-	AllowTag    bool   `json:"allow_tags"               meddler:"repo_allow_tags"`
-	Counter     int    `json:"last_build"               meddler:"repo_counter"`
-	Config      string `json:"config_file"              meddler:"repo_config_path"`
-	Hash        string `json:"-"                        meddler:"repo_hash"`
-	Perm        *Perm  `json:"-"                        meddler:"-"`
+	ID           int64    `json:"id,omitempty"             meddler:"repo_id,pk"`
+	UserID       int64    `json:"-"                        meddler:"repo_user_id"`
+	Owner        string   `json:"owner"                    meddler:"repo_owner"`
+	Name         string   `json:"name"                     meddler:"repo_name"`
+	FullName     string   `json:"full_name"                meddler:"repo_full_name"`
+	Avatar       string   `json:"avatar_url,omitempty"     meddler:"repo_avatar"`
+	Link         string   `json:"link_url,omitempty"       meddler:"repo_link"`
+	Kind         string   `json:"scm,omitempty"            meddler:"repo_scm"`
+	Clone        string   `json:"clone_url,omitempty"      meddler:"repo_clone"`
+	Branch       string   `json:"default_branch,omitempty" meddler:"repo_branch"`
+	Timeout      int64    `json:"timeout,omitempty"        meddler:"repo_timeout"`
+	Concurrency  int      `json:"concurrency"              meddler:"repo_concurrency"`
+	MaxBuilds    int      `json:"build_concurrency"        meddler:"repo_build_concurrency"`
+	RetainBuilds int      `json:"retain_builds"            meddler:"repo_retain_builds"`
+	RetainDays   int      `json:"retain_days"              meddler:"repo_retain_days"`
+	Visibility   string   `json:"visibility"               meddler:"repo_visibility"`
+	IsPrivate    bool     `json:"private"                  meddler:"repo_private"`
+	IsTrusted    bool     `json:"trusted"                  meddler:"repo_trusted"`
+	IsStarred    bool     `json:"starred,omitempty"        meddler:"-"`
+	IsGated      bool     `json:"gated"                    meddler:"repo_gated"`
+	Approval     string   `json:"approval_policy"          meddler:"repo_approval"`
+	ApproveAdmin bool     `json:"approve_admin"            meddler:"repo_approve_admin"`
+	Approvers    []string `json:"approvers,omitempty"      meddler:"repo_approvers,json"`
+	Params       []string `json:"allowed_params,omitempty" meddler:"repo_allowed_params,json"`
+	ProtBranches []string `json:"protected_branches,omitempty" meddler:"repo_protected_branches,json"`
+	ProtTargets  []string `json:"protected_targets,omitempty"  meddler:"repo_protected_targets,json"`
+	IsActive     bool     `json:"active"                   meddler:"repo_active"`
+	AllowPull    bool     `json:"allow_pr"                 meddler:"repo_allow_pr"`
+	AllowPush    bool     `json:"allow_push"               meddler:"repo_allow_push"`
+	AllowDeploy  bool     `json:"allow_deploys"            meddler:"repo_allow_deploys"`
+	AllowTag     bool     `json:"allow_tags"               meddler:"repo_allow_tags"`
+	Counter      int      `json:"last_build"               meddler:"repo_counter"`
+	Config       string   `json:"config_file"              meddler:"repo_config_path"`
+	NoFallback   bool     `json:"no_config_fallback"       meddler:"repo_no_config_fallback"`
+	Hash         string   `json:"-"                        meddler:"repo_hash"`
+	Perm         *Perm    `json:"-"                        meddler:"-"`
 }
 
 func (r *Repo) ResetVisibility() {
@@ -64,6 +76,88 @@ func (r *Repo) ResetVisibility() {
 	}
 }
 
+// ApprovalPolicy returns the approval policy of the repository. The
+// legacy gated flag maps to the all events policy when no policy is
+// set.
+func (r *Repo) ApprovalPolicy() string {
+	switch {
+	case r.Approval != "":
+		return r.Approval
+	case r.IsGated:
+		return ApprovalAll
+	default:
+		return ApprovalNone
+	}
+}
+
+// IsFork returns true if the build is a pull request from a fork of
+// the repository. Pull requests without a known source repository are
+// treated as forks.
+func (r *Repo) IsFork(build *Build) bool {
+	if build.Event != EventPull {
+		return false
+	}
+	if build.Remote == "" {
+		return true
+	}
+	return normalizeRemote(build.Remote) != normalizeRemote(r.Clone)
+}
+
+func normalizeRemote(s string) string {
+	s = strings.ToLower(strings.TrimSuffix(s, "/"))
+	return strings.TrimSuffix(s, ".git")
+}
+
+// ParamAllowed returns true if the repository permits the build
+// parameter. All parameters are permitted unless the repository
+// defines a list of allowed parameters.
+func (r *Repo) ParamAllowed(name string) bool {
+	return len(r.Params) == 0 || contains(r.Params, name)
+}
+
+// AllowEvent returns true if the repository permits builds for the
+// event. Events without a repository setting, such as cron and manual
+// events, are always permitted.
+func (r *Repo) AllowEvent(event string) bool {
+	switch event {
+	case EventPush:
+		return r.AllowPush
+	case EventPull:
+		return r.AllowPull
+	case EventTag:
+		return r.AllowTag
+	case EventDeploy:
+		return r.AllowDeploy
+	default:
+		return true
+	}
+}
+
+// Protected returns the reason the build requires the approval of a
+// repository admin because it builds a protected branch or deploys to
+// a protected target environment. It returns an empty string if the
+// build is not protected. The protected branches and targets are glob
+// patterns. The target is checked for any build that deploys, such as
+// a cron with a target.
+func (r *Repo) Protected(build *Build) string {
+	if build.Event == EventDeploy || build.Deploy != "" {
+		for _, pattern := range r.ProtTargets {
+			if ok, _ := path.Match(pattern, build.Deploy); ok {
+				return fmt.Sprintf("deployments to %s require a repository admin", build.Deploy)
+			}
+		}
+	}
+	if build.Event == EventDeploy {
+		return ""
+	}
+	for _, pattern := range r.ProtBranches {
+		if ok, _ := path.Match(pattern, build.Branch); ok {
+			return fmt.Sprintf("builds of branch %s require a repository admin", build.Branch)
+		}
+	}
+	return ""
+}
+
 // ParseRepo parses the repository owner and name from a string.
 func ParseRepo(str string) (user, repo string, err error) {
 	var parts = strings.Split(str, "/")
@@ -95,14 +189,25 @@ func (r *Repo) Update(from *Repo) {
 
 // RepoPatch represents a repository patch object.
 type RepoPatch struct {
-	Config       *string `json:"config_file,omitempty"`
-	IsTrusted    *bool   `json:"trusted,omitempty"`
-	IsGated      *bool   `json:"gated,omitempty"`
-	Timeout      *int64  `json:"timeout,omitempty"`
-	Visibility   *string `json:"visibility,omitempty"`
-	AllowPull    *bool   `json:"allow_pr,omitempty"`
-	AllowPush    *bool   `json:"allow_push,omitempty"`
-	AllowDeploy  *bool   `json:"allow_deploy,omitempty"`
-	AllowTag     *bool   `json:"allow_tag,omitempty"`
-	BuildCounter *int    `json:"build_counter,omitempty"`
+	Config       *string   `json:"config_file,omitempty"`
+	NoFallback   *bool     `json:"no_config_fallback,omitempty"`
+	IsTrusted    *bool     `json:"trusted,omitempty"`
+	IsGated      *bool     `json:"gated,omitempty"`
+	Approval     *string   `json:"approval_policy,omitempty"`
+	ApproveAdmin *bool     `json:"approve_admin,omitempty"`
+	Approvers    *[]string `json:"approvers,omitempty"`
+	Params       *[]string `json:"allowed_params,omitempty"`
+	ProtBranches *[]string `json:"protected_branches,omitempty"`
+	ProtTargets  *[]string `json:"protected_targets,omitempty"`
+	Timeout      *int64    `json:"timeout,omitempty"`
+	Concurrency  *int      `json:"concurrency,omitempty"`
+	MaxBuilds    *int      `json:"build_concurrency,omitempty"`
+	RetainBuilds *int      `json:"retain_builds,omitempty"`
+	RetainDays   *int      `json:"retain_days,omitempty"`
+	Visibility   *string   `json:"visibility,omitempty"`
+	AllowPull    *bool     `json:"allow_pr,omitempty"`
+	AllowPush    *bool     `json:"allow_push,omitempty"`
+	AllowDeploy  *bool     `json:"allow_deploy,omitempty"`
+	AllowTag     *bool     `json:"allow_tag,omitempty"`
+	BuildCounter *int      `json:"build_counter,omitempty"`
 }
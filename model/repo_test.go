@@ -0,0 +1,102 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "testing"
+
+func TestRepoApprovalPolicy(t *testing.T) {
+	tests := []struct {
+		repo   Repo
+		policy string
+	}{
+		{Repo{}, ApprovalNone},
+		{Repo{IsGated: true}, ApprovalAll},
+		{Repo{IsGated: true, Approval: ApprovalForks}, ApprovalForks},
+		{Repo{Approval: ApprovalAll}, ApprovalAll},
+	}
+	for _, test := range tests {
+		if got := test.repo.ApprovalPolicy(); got != test.policy {
+			t.Errorf("Want approval policy %s, got %s", test.policy, got)
+		}
+	}
+}
+
+func TestRepoIsFork(t *testing.T) {
+	repo := &Repo{Clone: "https://github.com/octocat/hello-world.git"}
+	tests := []struct {
+		build Build
+		fork  bool
+	}{
+		{Build{Event: EventPush, Remote: "https://github.com/spaceghost/hello-world.git"}, false},
+		{Build{Event: EventPull, Remote: "https://github.com/octocat/hello-world.git"}, false},
+		{Build{Event: EventPull, Remote: "https://github.com/Octocat/hello-world"}, false},
+		{Build{Event: EventPull, Remote: "https://github.com/spaceghost/hello-world.git"}, true},
+		{Build{Event: EventPull}, true},
+	}
+	for _, test := range tests {
+		if got := repo.IsFork(&test.build); got != test.fork {
+			t.Errorf("Want fork %v for %s from %q, got %v", test.fork, test.build.Event, test.build.Remote, got)
+		}
+	}
+}
+
+func TestRepoParamAllowed(t *testing.T) {
+	repo := new(Repo)
+	if !repo.ParamAllowed("TARGET") {
+		t.Errorf("Want all params allowed without an allow-list")
+	}
+	repo.Params = []string{"TARGET"}
+	if !repo.ParamAllowed("TARGET") {
+		t.Errorf("Want listed param allowed")
+	}
+	if repo.ParamAllowed("REGION") {
+		t.Errorf("Want unlisted param rejected")
+	}
+}
+
+func TestRepoAllowEvent(t *testing.T) {
+	repo := &Repo{AllowPush: true, AllowPull: true}
+	for _, event := range []string{EventPush, EventPull, EventCron, EventManual} {
+		if !repo.AllowEvent(event) {
+			t.Errorf("Want %s events allowed", event)
+		}
+	}
+	for _, event := range []string{EventTag, EventDeploy} {
+		if repo.AllowEvent(event) {
+			t.Errorf("Want %s events rejected", event)
+		}
+	}
+}
+
+func TestRepoProtected(t *testing.T) {
+	repo := &Repo{ProtBranches: []string{"release/*"}, ProtTargets: []string{"prod*"}}
+	tests := []struct {
+		build     *Build
+		protected bool
+	}{
+		{&Build{Event: EventPush, Branch: "release/1.0"}, true},
+		{&Build{Event: EventPush, Branch: "master"}, false},
+		{&Build{Event: EventDeploy, Branch: "master", Deploy: "production"}, true},
+		{&Build{Event: EventDeploy, Branch: "release/1.0", Deploy: "staging"}, false},
+		{&Build{Event: EventCron, Branch: "master", Deploy: "production"}, true},
+		{&Build{Event: EventCron, Branch: "release/1.0"}, true},
+		{&Build{Event: EventCron, Branch: "master", Deploy: "staging"}, false},
+	}
+	for _, test := range tests {
+		if got := repo.Protected(test.build) != ""; got != test.protected {
+			t.Errorf("Want %s build of %s to %q protected %v", test.build.Event, test.build.Branch, test.build.Deploy, test.protected)
+		}
+	}
+}
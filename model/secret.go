@@ -32,6 +32,11 @@ type SecretService interface {
 	SecretCreate(*Repo, *Secret) error
 	SecretUpdate(*Repo, *Secret) error
 	SecretDelete(*Repo, string) error
+	GlobalSecretFind(string) (*Secret, error)
+	GlobalSecretList() ([]*Secret, error)
+	GlobalSecretCreate(*Secret) error
+	GlobalSecretUpdate(*Secret) error
+	GlobalSecretDelete(string) error
 }
 
 // SecretStore persists secret information to storage.
@@ -46,14 +51,16 @@ type SecretStore interface {
 // Secret represents a secret variable, such as a password or token.
 // swagger:model registry
 type Secret struct {
-	ID         int64    `json:"id"              meddler:"secret_id,pk"`
-	RepoID     int64    `json:"-"               meddler:"secret_repo_id"`
-	Name       string   `json:"name"            meddler:"secret_name"`
-	Value      string   `json:"value,omitempty" meddler:"secret_value"`
-	Images     []string `json:"image"           meddler:"secret_images,json"`
-	Events     []string `json:"event"           meddler:"secret_events,json"`
-	SkipVerify bool     `json:"-"               meddler:"secret_skip_verify"`
-	Conceal    bool     `json:"-"               meddler:"secret_conceal"`
+	ID          int64    `json:"id"              meddler:"secret_id,pk"`
+	RepoID      int64    `json:"-"               meddler:"secret_repo_id"`
+	Name        string   `json:"name"            meddler:"secret_name"`
+	Value       string   `json:"value,omitempty" meddler:"secret_value"`
+	Images      []string `json:"image"           meddler:"secret_images,json"`
+	Events      []string `json:"event"           meddler:"secret_events,json"`
+	Branches    []string `json:"branch"          meddler:"secret_branches,json"`
+	PullRequest bool     `json:"pull_request"    meddler:"secret_pull_request"`
+	SkipVerify  bool     `json:"-"               meddler:"secret_skip_verify"`
+	Conceal     bool     `json:"-"               meddler:"secret_conceal"`
 }
 
 // Match returns true if an image and event match the restricted list.
@@ -69,6 +76,31 @@ func (s *Secret) Match(event string) bool {
 	return false
 }
 
+// MatchBranch returns true if the branch matches the restricted list.
+// Branches are matched with glob patterns.
+func (s *Secret) MatchBranch(branch string) bool {
+	if len(s.Branches) == 0 {
+		return true
+	}
+	for _, pattern := range s.Branches {
+		if match, _ := filepath.Match(pattern, branch); match {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchBuild returns true if the secret may be provided to the build.
+// The build must match the event and branch restrictions, and pull
+// requests from forks only receive secrets that are marked as safe for
+// pull requests.
+func (s *Secret) MatchBuild(repo *Repo, build *Build) bool {
+	if !s.Match(build.Event) || !s.MatchBranch(build.Branch) {
+		return false
+	}
+	return s.PullRequest || !repo.IsFork(build)
+}
+
 // Validate validates the required fields and formats.
 func (s *Secret) Validate() error {
 	switch {
@@ -84,10 +116,12 @@ func (s *Secret) Validate() error {
 // Copy makes a copy of the secret without the value.
 func (s *Secret) Copy() *Secret {
 	return &Secret{
-		ID:     s.ID,
-		RepoID: s.RepoID,
-		Name:   s.Name,
-		Images: s.Images,
-		Events: s.Events,
+		ID:          s.ID,
+		RepoID:      s.RepoID,
+		Name:        s.Name,
+		Images:      s.Images,
+		Events:      s.Events,
+		Branches:    s.Branches,
+		PullRequest: s.PullRequest,
 	}
 }
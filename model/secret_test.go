@@ -39,6 +39,28 @@ func TestSecret(t *testing.T) {
 			secret := Secret{}
 			g.Assert(secret.Match("pull_request")).IsTrue()
 		})
+		g.It("should match branch", func() {
+			secret := Secret{}
+			secret.Branches = []string{"release/*"}
+			g.Assert(secret.MatchBranch("release/1.0")).IsTrue()
+		})
+		g.It("should not match branch", func() {
+			secret := Secret{}
+			secret.Branches = []string{"release/*"}
+			g.Assert(secret.MatchBranch("master")).IsFalse()
+		})
+		g.It("should match when no branch filters defined", func() {
+			secret := Secret{}
+			g.Assert(secret.MatchBranch("master")).IsTrue()
+		})
+		g.It("should not match pull request from fork", func() {
+			repo := &Repo{Clone: "https://github.com/octocat/hello-world.git"}
+			build := &Build{Event: EventPull, Remote: "https://github.com/spaceghost/hello-world.git"}
+			secret := Secret{}
+			g.Assert(secret.MatchBuild(repo, build)).IsFalse()
+			secret.PullRequest = true
+			g.Assert(secret.MatchBuild(repo, build)).IsTrue()
+		})
 		g.It("should pass validation", func() {
 			secret := Secret{}
 			secret.Name = "secretname"
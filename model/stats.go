@@ -0,0 +1,36 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// RepoStats represents aggregate build statistics of a repository.
+//
+// swagger:model repoStats
+type RepoStats struct {
+	Since       int64                   `json:"since"`
+	Builds      int                     `json:"builds"`
+	Finished    int                     `json:"finished"`
+	SuccessRate float64                 `json:"success_rate"`
+	AvgDuration int64                   `json:"avg_duration"`
+	P95Duration int64                   `json:"p95_duration"`
+	AvgWait     int64                   `json:"avg_queue_wait"`
+	Events      map[string]int          `json:"events"`
+	Branches    map[string]*BranchStats `json:"branches"`
+}
+
+// BranchStats represents aggregate build statistics of a branch.
+type BranchStats struct {
+	Builds      int   `json:"builds"`
+	AvgDuration int64 `json:"avg_duration"`
+}
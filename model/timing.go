@@ -0,0 +1,96 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// BuildTimings represents the timing breakdown of a build. All
+// durations are in seconds.
+type BuildTimings struct {
+	Number   int            `json:"number"`
+	Status   string         `json:"status"`
+	Pending  int64          `json:"pending"`
+	Duration int64          `json:"duration"`
+	Procs    []*ProcTimings `json:"procs"`
+}
+
+// ProcTimings represents the timing breakdown of a proc.
+type ProcTimings struct {
+	PID      int    `json:"pid"`
+	PPID     int    `json:"ppid"`
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Pending  int64  `json:"pending"`
+	Duration int64  `json:"duration"`
+}
+
+// SetTimings computes the wall clock duration of the build and the
+// duration and pending time of its procs. The time spent pending is
+// measured from the moment the build was enqueued. Procs and builds
+// that did not finish yet are measured until now.
+func (b *Build) SetTimings(procs []*Proc, now int64) {
+	b.Duration = elapsed(b.Started, b.Finished, now)
+	for _, proc := range procs {
+		proc.Duration = elapsed(proc.Started, proc.Stopped, now)
+		switch {
+		case proc.Started != 0:
+			proc.Pending = elapsed(b.Enqueued, proc.Started, now)
+		case proc.State == StatusPending:
+			proc.Pending = elapsed(b.Enqueued, 0, now)
+		}
+	}
+}
+
+// Timings computes the timing breakdown of the build and its procs.
+func (b *Build) Timings(procs []*Proc, now int64) *BuildTimings {
+	b.SetTimings(procs, now)
+
+	t := &BuildTimings{
+		Number:   b.Number,
+		Status:   b.Status,
+		Duration: b.Duration,
+		Procs:    []*ProcTimings{},
+	}
+	switch {
+	case b.Started != 0:
+		t.Pending = elapsed(b.Enqueued, b.Started, now)
+	case b.Status == StatusPending:
+		t.Pending = elapsed(b.Enqueued, 0, now)
+	}
+	for _, proc := range procs {
+		t.Procs = append(t.Procs, &ProcTimings{
+			PID:      proc.PID,
+			PPID:     proc.PPID,
+			Name:     proc.Name,
+			State:    proc.State,
+			Pending:  proc.Pending,
+			Duration: proc.Duration,
+		})
+	}
+	return t
+}
+
+// elapsed returns the seconds between start and stop, or between start
+// and now when stop is not known yet.
+func elapsed(start, stop, now int64) int64 {
+	if start == 0 {
+		return 0
+	}
+	if stop == 0 {
+		stop = now
+	}
+	if stop < start {
+		return 0
+	}
+	return stop - start
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "testing"
+
+func TestBuildTimings(t *testing.T) {
+	b := &Build{Number: 1, Status: StatusRunning, Enqueued: 100, Started: 110}
+	procs := []*Proc{
+		{PID: 1, Name: "linux/amd64", State: StatusRunning, Started: 110},
+		{PID: 2, PPID: 1, Name: "clone", State: StatusSuccess, Started: 115, Stopped: 130},
+		{PID: 3, PPID: 1, Name: "test", State: StatusPending},
+		{PID: 4, PPID: 1, Name: "deploy", State: StatusSkipped},
+	}
+
+	timings := b.Timings(procs, 200)
+
+	if got, want := timings.Pending, int64(10); got != want {
+		t.Errorf("Want build pending %d, got %d", want, got)
+	}
+	if got, want := timings.Duration, int64(90); got != want {
+		t.Errorf("Want build duration %d, got %d", want, got)
+	}
+	tests := []struct {
+		pending  int64
+		duration int64
+	}{
+		{10, 90},
+		{15, 15},
+		{100, 0},
+		{0, 0},
+	}
+	for i, test := range tests {
+		proc := timings.Procs[i]
+		if proc.Pending != test.pending || proc.Duration != test.duration {
+			t.Errorf("Want proc %s pending %d and duration %d, got %d and %d",
+				proc.Name, test.pending, test.duration, proc.Pending, proc.Duration)
+		}
+	}
+	if procs[1].Duration != 15 {
+		t.Errorf("Want proc durations set on the procs")
+	}
+}
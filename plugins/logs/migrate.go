@@ -0,0 +1,36 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logs
+
+import "github.com/drone/drone/model"
+
+// Migrate copies the logs of the procs from one store to another, and
+// returns the number of copied logs.
+func Migrate(from, to model.LogStore, procs []*model.Proc) (int, error) {
+	var count int
+	for _, proc := range procs {
+		rc, err := from.LogFind(proc)
+		if err != nil {
+			return count, err
+		}
+		err = to.LogSave(proc, rc)
+		rc.Close()
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
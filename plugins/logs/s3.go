@@ -0,0 +1,173 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/drone/drone/model"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// S3Options configures the S3 compatible log store.
+type S3Options struct {
+	// Endpoint is the url of the S3 compatible service, for example
+	// https://s3.amazonaws.com or http://minio:9000.
+	Endpoint string
+	Bucket   string
+	Region   string
+	// Prefix is prepended to the object keys.
+	Prefix string
+	// AccessKey and SecretKey default to the AWS environment
+	// variables when empty.
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket in the url path instead of the
+	// host name, which is required by minio.
+	PathStyle bool
+}
+
+// s3Timeout bounds the requests to the bucket, so that an unresponsive
+// bucket does not block the handlers reading and writing logs.
+const s3Timeout = time.Minute
+
+type s3 struct {
+	opts     S3Options
+	client   *http.Client
+	signer   *v4.Signer
+	fallback model.LogStore
+}
+
+// NewS3 returns a LogStore that stores logs in an S3 compatible
+// bucket, with one object per proc. Logs that are not found in the
+// bucket, such as logs written before the bucket was configured, are
+// read from the fallback store when not nil.
+func NewS3(opts S3Options, fallback model.LogStore) model.LogStore {
+	creds := credentials.NewEnvCredentials()
+	if opts.AccessKey != "" {
+		creds = credentials.NewStaticCredentials(opts.AccessKey, opts.SecretKey, "")
+	}
+	return &s3{
+		opts:     opts,
+		client:   &http.Client{Timeout: s3Timeout},
+		signer:   v4.NewSigner(creds, func(s *v4.Signer) { s.DisableURIPathEscaping = true }),
+		fallback: fallback,
+	}
+}
+
+func (s *s3) LogFind(proc *model.Proc) (io.ReadCloser, error) {
+	req, err := s.request("GET", proc, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && s.fallback != nil {
+		resp.Body.Close()
+		return s.fallback.LogFind(proc)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s.error(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *s3) LogSave(proc *model.Proc, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	req, err := s.request("PUT", proc, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.error(resp)
+	}
+	return nil
+}
+
+func (s *s3) LogDelete(proc *model.Proc) error {
+	req, err := s.request("DELETE", proc, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+	default:
+		return s.error(resp)
+	}
+	if s.fallback != nil {
+		return s.fallback.LogDelete(proc)
+	}
+	return nil
+}
+
+// request returns a signed request for the log object of the proc.
+func (s *s3) request(method string, proc *model.Proc, data []byte) (*http.Request, error) {
+	uri, err := url.Parse(s.opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s%d", s.opts.Prefix, proc.ID)
+	if s.opts.PathStyle {
+		uri.Path = strings.TrimSuffix(uri.Path, "/") + "/" + s.opts.Bucket + "/" + key
+	} else {
+		uri.Host = s.opts.Bucket + "." + uri.Host
+		uri.Path = strings.TrimSuffix(uri.Path, "/") + "/" + key
+	}
+
+	var body io.ReadSeeker
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, uri.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.signer.Sign(req, body, "s3", s.opts.Region, time.Now()); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// error returns the error of the failed response.
+func (s *s3) error(resp *http.Response) error {
+	out, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3: %s: %s", resp.Status, bytes.TrimSpace(out))
+}
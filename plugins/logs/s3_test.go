@@ -0,0 +1,190 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+// bucket is a minimal in-memory s3 compatible server.
+type bucket struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *bucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.Lock()
+	defer b.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case "PUT":
+		b.objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+	case "GET":
+		data, ok := b.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case "DELETE":
+		delete(b.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// memLogs is an in-memory log store.
+type memLogs map[int64]string
+
+func (m memLogs) LogFind(proc *model.Proc) (io.ReadCloser, error) {
+	data, ok := m[proc.ID]
+	if !ok {
+		return nil, io.EOF
+	}
+	return ioutil.NopCloser(strings.NewReader(data)), nil
+}
+
+func (m memLogs) LogSave(proc *model.Proc, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	m[proc.ID] = string(data)
+	return err
+}
+
+func (m memLogs) LogDelete(proc *model.Proc) error {
+	delete(m, proc.ID)
+	return nil
+}
+
+func newBucket() (*bucket, *httptest.Server) {
+	b := &bucket{objects: map[string][]byte{}}
+	return b, httptest.NewServer(b)
+}
+
+func TestS3SaveFind(t *testing.T) {
+	b, server := newBucket()
+	defer server.Close()
+
+	logs := NewS3(S3Options{
+		Endpoint:  server.URL,
+		Bucket:    "drone",
+		Region:    "us-east-1",
+		Prefix:    "logs/",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	}, nil)
+
+	proc := &model.Proc{ID: 42}
+	if err := logs.LogSave(proc, bytes.NewBufferString("echo hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.objects["/drone/logs/42"]; !ok {
+		t.Errorf("Want log stored with key logs/42 in bucket drone")
+	}
+
+	rc, err := logs.LogFind(proc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	out, _ := ioutil.ReadAll(rc)
+	if got, want := string(out), "echo hi"; got != want {
+		t.Errorf("Want log data %s, got %s", want, got)
+	}
+
+	if _, err := logs.LogFind(&model.Proc{ID: 1}); err == nil {
+		t.Errorf("Want error for missing log without a fallback")
+	}
+}
+
+func TestS3Fallback(t *testing.T) {
+	_, server := newBucket()
+	defer server.Close()
+
+	fallback := memLogs{1: "echo database"}
+	logs := NewS3(S3Options{
+		Endpoint:  server.URL,
+		Bucket:    "drone",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	}, fallback)
+
+	rc, err := logs.LogFind(&model.Proc{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	out, _ := ioutil.ReadAll(rc)
+	if got, want := string(out), "echo database"; got != want {
+		t.Errorf("Want log read from the fallback store, got %s", got)
+	}
+}
+
+func TestS3Delete(t *testing.T) {
+	b, server := newBucket()
+	defer server.Close()
+
+	fallback := memLogs{1: "echo database"}
+	logs := NewS3(S3Options{
+		Endpoint:  server.URL,
+		Bucket:    "drone",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	}, fallback)
+
+	proc := &model.Proc{ID: 1}
+	if err := logs.LogSave(proc, bytes.NewBufferString("echo hi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := logs.LogDelete(proc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.objects["/drone/1"]; ok {
+		t.Errorf("Want log deleted from the bucket")
+	}
+	if _, ok := fallback[1]; ok {
+		t.Errorf("Want log deleted from the fallback store")
+	}
+	if err := logs.LogDelete(&model.Proc{ID: 2}); err != nil {
+		t.Errorf("Want no error deleting a missing log, got %s", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	from := memLogs{1: "echo hi", 2: "echo allo?"}
+	to := memLogs{}
+
+	procs := []*model.Proc{{ID: 1}, {ID: 2}}
+	count, err := Migrate(from, to, procs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || to[1] != "echo hi" || to[2] != "echo allo?" {
+		t.Errorf("Want all logs copied, got %d", count)
+	}
+}
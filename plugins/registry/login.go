@@ -0,0 +1,144 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AuthError is returned by Login when the registry rejects the
+// credentials.
+type AuthError struct {
+	Status  int
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("registry: authentication failed: %s", e.Message)
+}
+
+// Login performs the docker registry v2 authentication handshake with
+// the username and password, returning an AuthError if the registry
+// rejects the credentials. Registries that do not require
+// authentication accept any credentials.
+func Login(client *http.Client, addr, username, password string) error {
+	base := strings.TrimRight(addr, "/")
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+
+	res, err := client.Get(base + "/v2/")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode/100 == 2:
+		return nil
+	case res.StatusCode != http.StatusUnauthorized:
+		return fmt.Errorf("registry: unexpected status %d from %s", res.StatusCode, base)
+	}
+
+	scheme, params := parseChallenge(res.Header.Get("WWW-Authenticate"))
+	var req *http.Request
+	switch strings.ToLower(scheme) {
+	case "basic":
+		req, err = http.NewRequest("GET", base+"/v2/", nil)
+	case "bearer":
+		var realm *url.URL
+		if realm, err = url.Parse(params["realm"]); err != nil {
+			return err
+		}
+		q := realm.Query()
+		if service := params["service"]; service != "" {
+			q.Set("service", service)
+		}
+		q.Set("account", username)
+		realm.RawQuery = q.Encode()
+		req, err = http.NewRequest("GET", realm.String(), nil)
+	default:
+		return fmt.Errorf("registry: unsupported authentication scheme %q", scheme)
+	}
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, password)
+
+	res, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &AuthError{
+			Status:  res.StatusCode,
+			Message: errorMessage(res),
+		}
+	default:
+		return fmt.Errorf("registry: unexpected status %d from %s", res.StatusCode, req.URL.Host)
+	}
+}
+
+// parseChallenge parses the scheme and parameters of the
+// WWW-Authenticate header, e.g. Bearer realm="https://auth.docker.io/token",service="registry.docker.io".
+func parseChallenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) == 1 {
+		return parts[0], params
+	}
+	s := parts[1]
+	for s != "" {
+		eq := strings.Index(s, "=")
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end == -1 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else if end := strings.Index(s, ","); end != -1 {
+			value, s = s[:end], s[end:]
+		} else {
+			value, s = s, ""
+		}
+		params[key] = strings.TrimSpace(value)
+		s = strings.TrimLeft(s, ", ")
+	}
+	return parts[0], params
+}
+
+// errorMessage returns the error message of the registry or token
+// server response, falling back to the status text.
+func errorMessage(res *http.Response) string {
+	out := struct {
+		Details string `json:"details"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<16))
+	json.Unmarshal(body, &out)
+	switch {
+	case out.Details != "":
+		return out.Details
+	case len(out.Errors) != 0 && out.Errors[0].Message != "":
+		return out.Errors[0].Message
+	default:
+		return http.StatusText(res.StatusCode)
+	}
+}
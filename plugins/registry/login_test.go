@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoginBearer(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="registry.test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if r.FormValue("service") != "registry.test" || r.FormValue("account") != user {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if user != "octocat" || pass != "correct-horse" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"details":"incorrect username or password"}`))
+			return
+		}
+		w.Write([]byte(`{"token":"abc"}`))
+	})
+
+	if err := Login(http.DefaultClient, srv.URL, "octocat", "correct-horse"); err != nil {
+		t.Errorf("Want credentials accepted, got %s", err)
+	}
+	err := Login(http.DefaultClient, srv.URL, "octocat", "battery-staple")
+	if e, ok := err.(*AuthError); !ok || e.Message != "incorrect username or password" {
+		t.Errorf("Want an authentication error with the registry message, got %v", err)
+	}
+}
+
+func TestLoginBasic(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "octocat" || pass != "correct-horse" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors":[{"code":"UNAUTHORIZED","message":"authentication required"}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	if err := Login(http.DefaultClient, srv.URL, "octocat", "correct-horse"); err != nil {
+		t.Errorf("Want credentials accepted, got %s", err)
+	}
+	err := Login(http.DefaultClient, srv.URL, "octocat", "battery-staple")
+	if e, ok := err.(*AuthError); !ok || e.Message != "authentication required" {
+		t.Errorf("Want an authentication error with the registry message, got %v", err)
+	}
+}
+
+func TestLoginUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	err := Login(http.DefaultClient, srv.URL, "octocat", "correct-horse")
+	if _, ok := err.(*AuthError); ok || err == nil {
+		t.Errorf("Want a network error, got %v", err)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:foo:pull,push"`)
+	if scheme != "Bearer" {
+		t.Errorf("Want scheme Bearer, got %q", scheme)
+	}
+	if params["realm"] != "https://auth.docker.io/token" || params["service"] != "registry.docker.io" || params["scope"] != "repository:foo:pull,push" {
+		t.Errorf("Want challenge parameters parsed, got %v", params)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"github.com/drone/drone/model"
 )
 
+// global is the repository of the global secrets, which are stored
+// without a repository.
+var global = &model.Repo{}
+
 type builtin struct {
 	store model.SecretStore
 }
@@ -21,8 +25,35 @@ func (b *builtin) SecretList(repo *model.Repo) ([]*model.Secret, error) {
 	return b.store.SecretList(repo)
 }
 
+// SecretListBuild returns the repository secrets and the global secrets
+// that may be provided to the build. The repository secrets take
+// precedence over global secrets with the same name.
 func (b *builtin) SecretListBuild(repo *model.Repo, build *model.Build) ([]*model.Secret, error) {
-	return b.store.SecretList(repo)
+	secrets, err := b.store.SecretList(repo)
+	if err != nil {
+		return nil, err
+	}
+	globals, err := b.store.SecretList(global)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, secret := range secrets {
+		names[secret.Name] = true
+	}
+	for _, secret := range globals {
+		if !names[secret.Name] {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	var matched []*model.Secret
+	for _, secret := range secrets {
+		if secret.MatchBuild(repo, build) {
+			matched = append(matched, secret)
+		}
+	}
+	return matched, nil
 }
 
 func (b *builtin) SecretCreate(repo *model.Repo, in *model.Secret) error {
@@ -40,3 +71,25 @@ func (b *builtin) SecretDelete(repo *model.Repo, name string) error {
 	}
 	return b.store.SecretDelete(secret)
 }
+
+func (b *builtin) GlobalSecretFind(name string) (*model.Secret, error) {
+	return b.store.SecretFind(global, name)
+}
+
+func (b *builtin) GlobalSecretList() ([]*model.Secret, error) {
+	return b.store.SecretList(global)
+}
+
+func (b *builtin) GlobalSecretCreate(in *model.Secret) error {
+	in.RepoID = global.ID
+	return b.store.SecretCreate(in)
+}
+
+func (b *builtin) GlobalSecretUpdate(in *model.Secret) error {
+	in.RepoID = global.ID
+	return b.store.SecretUpdate(in)
+}
+
+func (b *builtin) GlobalSecretDelete(name string) error {
+	return b.SecretDelete(global, name)
+}
@@ -1 +1,142 @@
 package secrets
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+func TestSecretListBuildGlobal(t *testing.T) {
+	store := &secretStore{
+		secrets: map[int64][]*model.Secret{
+			0: {
+				{Name: "proxy_password", Value: "global"},
+				{Name: "artifact_token", Value: "global", Images: []string{"plugins/s3"}},
+			},
+			1: {
+				{RepoID: 1, Name: "proxy_password", Value: "repo"},
+			},
+		},
+	}
+
+	list, err := New(store).SecretListBuild(&model.Repo{ID: 1}, &model.Build{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("Want 2 secrets, got %d", len(list))
+	}
+	if got := list[0]; got.Name != "proxy_password" || got.Value != "repo" {
+		t.Errorf("Want the repository secret to take precedence, got %s=%s", got.Name, got.Value)
+	}
+	if got := list[1]; got.Name != "artifact_token" || len(got.Images) != 1 {
+		t.Errorf("Want the global secret with its image restriction, got %s %v", got.Name, got.Images)
+	}
+}
+
+func TestGlobalSecretCreate(t *testing.T) {
+	store := &secretStore{secrets: map[int64][]*model.Secret{}}
+	err := New(store).GlobalSecretCreate(&model.Secret{RepoID: 1, Name: "proxy_password", Value: "global"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.secrets[0]) != 1 || len(store.secrets[1]) != 0 {
+		t.Errorf("Want the global secret stored without a repository")
+	}
+}
+
+// secretStore is an in-memory secret store keyed by repository id.
+type secretStore struct {
+	secrets map[int64][]*model.Secret
+}
+
+func (s *secretStore) SecretFind(repo *model.Repo, name string) (*model.Secret, error) {
+	for _, secret := range s.secrets[repo.ID] {
+		if secret.Name == name {
+			return secret, nil
+		}
+	}
+	return nil, nil
+}
+func (s *secretStore) SecretList(repo *model.Repo) ([]*model.Secret, error) {
+	return s.secrets[repo.ID], nil
+}
+func (s *secretStore) SecretCreate(secret *model.Secret) error {
+	s.secrets[secret.RepoID] = append(s.secrets[secret.RepoID], secret)
+	return nil
+}
+func (s *secretStore) SecretUpdate(*model.Secret) error {
+	return nil
+}
+func (s *secretStore) SecretDelete(*model.Secret) error {
+	return nil
+}
+
+func TestSecretListBuildRestricted(t *testing.T) {
+	store := &secretStore{
+		secrets: map[int64][]*model.Secret{
+			1: {
+				{RepoID: 1, Name: "token", Value: "any"},
+				{RepoID: 1, Name: "deploy_key", Value: "release", Branches: []string{"release/*"}},
+				{RepoID: 1, Name: "docker_password", Value: "push", Events: []string{model.EventPush}},
+				{RepoID: 1, Name: "coverage_token", Value: "safe", PullRequest: true},
+			},
+		},
+	}
+	repo := &model.Repo{ID: 1, Clone: "https://github.com/octocat/hello-world.git"}
+
+	tests := []struct {
+		build model.Build
+		want  []string
+	}{
+		{
+			build: model.Build{Event: model.EventPush, Branch: "master"},
+			want:  []string{"token", "docker_password", "coverage_token"},
+		},
+		{
+			build: model.Build{Event: model.EventTag, Branch: "release/1.0"},
+			want:  []string{"token", "deploy_key", "coverage_token"},
+		},
+		{
+			build: model.Build{Event: model.EventPull, Branch: "master", Remote: "https://github.com/octocat/hello-world.git"},
+			want:  []string{"token", "coverage_token"},
+		},
+		{
+			build: model.Build{Event: model.EventPull, Branch: "master", Remote: "https://github.com/spaceghost/hello-world.git"},
+			want:  []string{"coverage_token"},
+		},
+	}
+	for _, test := range tests {
+		list, err := New(store).SecretListBuild(repo, &test.build)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, secret := range list {
+			got = append(got, secret.Name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Want secrets %v for %s to %s, got %v", test.want, test.build.Event, test.build.Branch, got)
+		}
+	}
+}
+
+func TestSecretListBuildFork(t *testing.T) {
+	store := &secretStore{
+		secrets: map[int64][]*model.Secret{
+			0: {{Name: "proxy_password", Value: "global"}},
+			1: {{RepoID: 1, Name: "token", Value: "repo"}},
+		},
+	}
+	repo := &model.Repo{ID: 1, Clone: "https://github.com/octocat/hello-world.git"}
+	build := &model.Build{Event: model.EventPull, Branch: "master", Remote: "https://github.com/spaceghost/hello-world.git"}
+
+	list, err := New(store).SecretListBuild(repo, build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Errorf("Want no secrets for a pull request from a fork, got %d", len(list))
+	}
+}
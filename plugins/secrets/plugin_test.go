@@ -66,3 +66,18 @@ func (m *mocker) SecretUpdate(*model.Repo, *model.Secret) error {
 func (m *mocker) SecretDelete(*model.Repo, string) error {
 	return nil
 }
+func (m *mocker) GlobalSecretFind(string) (*model.Secret, error) {
+	return nil, nil
+}
+func (m *mocker) GlobalSecretList() ([]*model.Secret, error) {
+	return nil, nil
+}
+func (m *mocker) GlobalSecretCreate(*model.Secret) error {
+	return nil
+}
+func (m *mocker) GlobalSecretUpdate(*model.Secret) error {
+	return nil
+}
+func (m *mocker) GlobalSecretDelete(string) error {
+	return nil
+}
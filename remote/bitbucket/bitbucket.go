@@ -218,7 +218,7 @@ func (c *config) FileRef(u *model.User, r *model.Repo, ref, f string) ([]byte, e
 func (c *config) Status(u *model.User, r *model.Repo, b *model.Build, link string) error {
 	status := internal.BuildStatus{
 		State: convertStatus(b.Status),
-		Desc:  convertDesc(b.Status),
+		Desc:  remote.StatusDesc(b, convertDesc(b.Status)),
 		Key:   "Drone",
 		Url:   link,
 	}
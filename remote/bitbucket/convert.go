@@ -38,6 +38,7 @@ const (
 	descFailure  = "the build failed"
 	descBlocked  = "the build requires approval"
 	descDeclined = "the build was rejected"
+	descSkipped  = "the build was skipped"
 	descError    = "oops, something went wrong"
 )
 
@@ -47,7 +48,7 @@ func convertStatus(status string) string {
 	switch status {
 	case model.StatusPending, model.StatusRunning, model.StatusBlocked:
 		return statusPending
-	case model.StatusSuccess:
+	case model.StatusSuccess, model.StatusSkipped:
 		return statusSuccess
 	default:
 		return statusFailure
@@ -68,6 +69,8 @@ func convertDesc(status string) string {
 		return descBlocked
 	case model.StatusDeclined:
 		return descDeclined
+	case model.StatusSkipped:
+		return descSkipped
 	default:
 		return descError
 	}
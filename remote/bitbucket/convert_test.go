@@ -34,6 +34,11 @@ func Test_helper(t *testing.T) {
 			g.Assert(convertStatus(model.StatusSuccess)).Equal(statusSuccess)
 		})
 
+		g.It("should convert skipped status", func() {
+			g.Assert(convertStatus(model.StatusSkipped)).Equal(statusSuccess)
+			g.Assert(convertDesc(model.StatusSkipped)).Equal(descSkipped)
+		})
+
 		g.It("should convert pending status", func() {
 			g.Assert(convertStatus(model.StatusPending)).Equal(statusPending)
 			g.Assert(convertStatus(model.StatusRunning)).Equal(statusPending)
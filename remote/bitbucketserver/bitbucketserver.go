@@ -189,7 +189,7 @@ func (c *Config) FileRef(u *model.User, r *model.Repo, ref, f string) ([]byte, e
 func (c *Config) Status(u *model.User, r *model.Repo, b *model.Build, link string) error {
 	status := internal.BuildStatus{
 		State: convertStatus(b.Status),
-		Desc:  convertDesc(b.Status),
+		Desc:  remote.StatusDesc(b, convertDesc(b.Status)),
 		Name:  fmt.Sprintf("Drone #%d - %s", b.Number, b.Branch),
 		Key:   "Drone",
 		Url:   link,
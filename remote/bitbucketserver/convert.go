@@ -37,6 +37,7 @@ const (
 	descPending = "this build is pending"
 	descSuccess = "the build was successful"
 	descFailure = "the build failed"
+	descSkipped = "the build was skipped"
 	descError   = "oops, something went wrong"
 )
 
@@ -46,7 +47,7 @@ func convertStatus(status string) string {
 	switch status {
 	case model.StatusPending, model.StatusRunning:
 		return statusPending
-	case model.StatusSuccess:
+	case model.StatusSuccess, model.StatusSkipped:
 		return statusSuccess
 	default:
 		return statusFailure
@@ -63,6 +64,8 @@ func convertDesc(status string) string {
 		return descSuccess
 	case model.StatusFailure:
 		return descFailure
+	case model.StatusSkipped:
+		return descSkipped
 	default:
 		return descError
 	}
@@ -14,6 +14,12 @@
 
 package remote
 
+import "errors"
+
+// ErrFileNotFound is returned by the remotes when the requested file
+// does not exist in the repository.
+var ErrFileNotFound = errors.New("file not found")
+
 // AuthError represents remote authentication error.
 type AuthError struct {
 	Err         string
@@ -54,6 +54,7 @@ const (
 	DescCanceled = "the build canceled"
 	DescBlocked  = "the build is pending approval"
 	DescDeclined = "the build was rejected"
+	DescSkipped  = "the build was skipped"
 )
 
 // getStatus is a helper function that converts a Drone
@@ -64,7 +65,7 @@ func getStatus(status string) gitea.StatusState {
 		return gitea.StatusPending
 	case model.StatusRunning:
 		return gitea.StatusPending
-	case model.StatusSuccess:
+	case model.StatusSuccess, model.StatusSkipped:
 		return gitea.StatusSuccess
 	case model.StatusFailure, model.StatusError:
 		return gitea.StatusFailure
@@ -95,6 +96,8 @@ func getDesc(status string) string {
 		return DescBlocked
 	case model.StatusDeclined:
 		return DescDeclined
+	case model.StatusSkipped:
+		return DescSkipped
 	default:
 		return DescFailure
 	}
@@ -244,14 +247,28 @@ func (c *client) Perm(u *model.User, owner, name string) (*model.Perm, error) {
 
 // File fetches the file from the Gitea repository and returns its contents.
 func (c *client) File(u *model.User, r *model.Repo, b *model.Build, f string) ([]byte, error) {
-	client := c.newClientToken(u.Token)
-	cfg, err := client.GetFile(r.Owner, r.Name, b.Commit, f)
-	return cfg, err
+	return c.FileRef(u, r, b.Commit, f)
 }
 
 // FileRef fetches the file from the Gitea repository and returns its contents.
 func (c *client) FileRef(u *model.User, r *model.Repo, ref, f string) ([]byte, error) {
-	return c.newClientToken(u.Token).GetFile(r.Owner, r.Name, ref, f)
+	cfg, err := c.newClientToken(u.Token).GetFile(r.Owner, r.Name, ref, f)
+	if err != nil && err.Error() == "404 Not Found" {
+		return nil, remote.ErrFileNotFound
+	}
+	return cfg, err
+}
+
+// BranchHead returns the sha of the commit at the head of the branch.
+func (c *client) BranchHead(u *model.User, r *model.Repo, branch string) (string, error) {
+	out, err := c.newClientToken(u.Token).GetRepoBranch(r.Owner, r.Name, branch)
+	if err != nil {
+		return "", err
+	}
+	if out.Commit == nil {
+		return "", fmt.Errorf("branch %s has no commit", branch)
+	}
+	return out.Commit.ID, nil
 }
 
 // Status is supported by the Gitea driver.
@@ -259,7 +276,7 @@ func (c *client) Status(u *model.User, r *model.Repo, b *model.Build, link strin
 	client := c.newClientToken(u.Token)
 
 	status := getStatus(b.Status)
-	desc := getDesc(b.Status)
+	desc := remote.StatusDesc(b, getDesc(b.Status))
 
 	_, err := client.CreateStatus(
 		r.Owner,
@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
 	"github.com/drone/drone/remote/gitea/fixtures"
 	"github.com/franela/goblin"
 	"github.com/gin-gonic/gin"
@@ -148,6 +149,11 @@ func Test_gitea(t *testing.T) {
 			g.Assert(string(raw)).Equal("{ platform: linux/amd64 }")
 		})
 
+		g.It("Should return a file not found error", func() {
+			_, err := c.File(fakeUser, fakeRepo, fakeBuild, "file_not_found")
+			g.Assert(err == remote.ErrFileNotFound).IsTrue()
+		})
+
 		g.It("Should return nil from send build status", func() {
 			err := c.Status(fakeUser, fakeRepo, fakeBuild, "http://gitea.io")
 			g.Assert(err == nil).IsTrue()
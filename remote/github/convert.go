@@ -38,6 +38,7 @@ const (
 	descFailure  = "the build failed"
 	descBlocked  = "the build requires approval"
 	descDeclined = "the build was rejected"
+	descSkipped  = "the build was skipped"
 	descError    = "oops, something went wrong"
 )
 
@@ -55,7 +56,7 @@ func convertStatus(status string) string {
 		return statusPending
 	case model.StatusFailure, model.StatusDeclined:
 		return statusFailure
-	case model.StatusSuccess:
+	case model.StatusSuccess, model.StatusSkipped:
 		return statusSuccess
 	default:
 		return statusError
@@ -76,6 +77,8 @@ func convertDesc(status string) string {
 		return descBlocked
 	case model.StatusDeclined:
 		return descDeclined
+	case model.StatusSkipped:
+		return descSkipped
 	default:
 		return descError
 	}
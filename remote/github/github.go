@@ -234,13 +234,61 @@ func (c *client) FileRef(u *model.User, r *model.Repo, ref, f string) ([]byte, e
 
 	opts := new(github.RepositoryContentGetOptions)
 	opts.Ref = ref
-	data, _, _, err := client.Repositories.GetContents(r.Owner, r.Name, f, opts)
+	data, _, resp, err := client.Repositories.GetContents(r.Owner, r.Name, f, opts)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, remote.ErrFileNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	return data.Decode()
 }
 
+// BranchHead returns the sha of the commit at the head of the branch.
+func (c *client) BranchHead(u *model.User, r *model.Repo, branch string) (string, error) {
+	client := c.newClientToken(u.Token)
+	out, _, err := client.Repositories.GetBranch(r.Owner, r.Name, branch)
+	if err != nil {
+		return "", err
+	}
+	if out.Commit == nil || out.Commit.SHA == nil {
+		return "", fmt.Errorf("branch %s has no commit", branch)
+	}
+	return *out.Commit.SHA, nil
+}
+
+// Dir fetches the files in the directory of the GitHub repository. Sub
+// directories are not included.
+func (c *client) Dir(u *model.User, r *model.Repo, ref, dir string) ([]*remote.FileMeta, error) {
+	client := c.newClientToken(u.Token)
+
+	opts := new(github.RepositoryContentGetOptions)
+	opts.Ref = ref
+	_, list, resp, err := client.Repositories.GetContents(r.Owner, r.Name, dir, opts)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, remote.ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*remote.FileMeta
+	for _, item := range list {
+		if item.Type == nil || *item.Type != "file" {
+			continue
+		}
+		data, err := c.FileRef(u, r, ref, *item.Path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, &remote.FileMeta{
+			Name: *item.Name,
+			Data: data,
+		})
+	}
+	return files, nil
+}
+
 // Netrc returns a netrc file capable of authenticating GitHub requests and
 // cloning GitHub repositories. The netrc will use the global machine account
 // when configured.
@@ -398,7 +446,7 @@ func repoStatus(client *github.Client, r *model.Repo, b *model.Build, link, ctx
 	data := github.RepoStatus{
 		Context:     github.String(context),
 		State:       github.String(convertStatus(b.Status)),
-		Description: github.String(convertDesc(b.Status)),
+		Description: github.String(remote.StatusDesc(b, convertDesc(b.Status))),
 		TargetURL:   github.String(link),
 	}
 	_, _, err := client.Repositories.CreateStatus(r.Owner, r.Name, b.Commit, &data)
@@ -416,7 +464,7 @@ func deploymentStatus(client *github.Client, r *model.Repo, b *model.Build, link
 
 	data := github.DeploymentStatusRequest{
 		State:       github.String(convertStatus(b.Status)),
-		Description: github.String(convertDesc(b.Status)),
+		Description: github.String(remote.StatusDesc(b, convertDesc(b.Status))),
 		TargetURL:   github.String(link),
 	}
 	_, _, err := client.Repositories.CreateDeploymentStatus(r.Owner, r.Name, id, &data)
@@ -72,6 +72,17 @@ func (c *Client) ResourceUrl(u string, params, query QMap) (string, string) {
 	return u, opaque
 }
 
+// StatusError is returned by Do when the request fails with an error
+// status code.
+type StatusError struct {
+	Code int
+	URL  string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("*Gitlab.buildAndExecRequest failed: <%d> %s", e.Code, e.URL)
+}
+
 func (c *Client) Do(method, url, opaque string, body []byte) ([]byte, error) {
 	var req *http.Request
 	var err error
@@ -103,7 +114,7 @@ func (c *Client) Do(method, url, opaque string, body []byte) ([]byte, error) {
 	}
 
 	if resp.StatusCode >= 400 {
-		err = fmt.Errorf("*Gitlab.buildAndExecRequest failed: <%d> %s", resp.StatusCode, req.URL)
+		err = &StatusError{Code: resp.StatusCode, URL: req.URL.String()}
 	}
 
 	return contents, err
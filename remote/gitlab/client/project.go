@@ -26,6 +26,7 @@ const (
 	projectUrl        = "/projects/:id"
 	repoUrlRawFileRef = "/projects/:id/repository/files/:filepath"
 	commitStatusUrl   = "/projects/:id/statuses/:sha"
+	branchUrl         = "/projects/:id/repository/branches/:branch"
 )
 
 // Get a list of all projects owned by the authenticated user.
@@ -120,6 +121,27 @@ func (c *Client) RepoRawFileRef(id, ref, filepath string) ([]byte, error) {
 	return fileRawContent, err
 }
 
+// Get a single branch of a project.
+func (c *Client) Branch(id, branch string) (*Branch, error) {
+	url, opaque := c.ResourceUrl(
+		branchUrl,
+		QMap{
+			":id":     id,
+			":branch": branch,
+		},
+		nil,
+	)
+
+	var out *Branch
+
+	contents, err := c.Do("GET", url, opaque, nil)
+	if err == nil {
+		err = json.Unmarshal(contents, &out)
+	}
+
+	return out, err
+}
+
 //
 func (c *Client) SetStatus(id, sha, state, desc, ref, link string) error {
 	url, opaque := c.ResourceUrl(
@@ -101,6 +101,15 @@ type hRepository struct {
 	VisibilityLevel int    `json:"visibility_level,omitempty"`
 }
 
+type Branch struct {
+	Name   string        `json:"name"`
+	Commit *BranchCommit `json:"commit"`
+}
+
+type BranchCommit struct {
+	Id string `json:"id"`
+}
+
 type hCommit struct {
 	Id        string  `json:"id,omitempty"`
 	Message   string  `json:"message,omitempty"`
@@ -337,12 +337,40 @@ func (g *Gitlab) FileRef(u *model.User, r *model.Repo, ref, f string) ([]byte, e
 	}
 
 	out, err := client.RepoRawFileRef(id, ref, f)
+	if notFound(err) {
+		return nil, remote.ErrFileNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	return out, err
 }
 
+// notFound returns true if the request failed because the resource
+// does not exist.
+func notFound(err error) bool {
+	e, ok := err.(*client.StatusError)
+	return ok && e.Code == http.StatusNotFound
+}
+
+// BranchHead returns the sha of the commit at the head of the branch.
+func (g *Gitlab) BranchHead(u *model.User, r *model.Repo, branch string) (string, error) {
+	var client = NewClient(g.URL, u.Token, g.SkipVerify)
+	id, err := GetProjectId(g, client, r.Owner, r.Name)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := client.Branch(id, branch)
+	if err != nil {
+		return "", err
+	}
+	if out.Commit == nil {
+		return "", fmt.Errorf("branch %s has no commit", branch)
+	}
+	return out.Commit.Id, nil
+}
+
 // NOTE Currently gitlab doesn't support status for commits and events,
 //      also if we want get MR status in gitlab we need implement a special plugin for gitlab,
 //      gitlab uses API to fetch build status on client side. But for now we skip this.
@@ -350,7 +378,7 @@ func (g *Gitlab) Status(u *model.User, repo *model.Repo, b *model.Build, link st
 	client := NewClient(g.URL, u.Token, g.SkipVerify)
 
 	status := getStatus(b.Status)
-	desc := getDesc(b.Status)
+	desc := remote.StatusDesc(b, getDesc(b.Status))
 
 	client.SetStatus(
 		ns(repo.Owner, repo.Name),
@@ -658,6 +686,7 @@ const (
 	DescCanceled = "the build canceled"
 	DescBlocked  = "the build is pending approval"
 	DescDeclined = "the build was rejected"
+	DescSkipped  = "the build was skipped"
 )
 
 // getStatus is a helper functin that converts a Drone
@@ -668,7 +697,7 @@ func getStatus(status string) string {
 		return StatusPending
 	case model.StatusRunning:
 		return StatusRunning
-	case model.StatusSuccess:
+	case model.StatusSuccess, model.StatusSkipped:
 		return StatusSuccess
 	case model.StatusFailure, model.StatusError:
 		return StatusFailure
@@ -697,6 +726,8 @@ func getDesc(status string) string {
 		return DescBlocked
 	case model.StatusDeclined:
 		return DescDeclined
+	case model.StatusSkipped:
+		return DescSkipped
 	default:
 		return DescFailure
 	}
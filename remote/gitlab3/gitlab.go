@@ -360,7 +360,7 @@ func (g *Gitlab) Status(u *model.User, repo *model.Repo, b *model.Build, link st
 	client := NewClient(g.URL, u.Token, g.SkipVerify)
 
 	status := getStatus(b.Status)
-	desc := getDesc(b.Status)
+	desc := remote.StatusDesc(b, getDesc(b.Status))
 
 	client.SetStatus(
 		ns(repo.Owner, repo.Name),
@@ -668,6 +668,7 @@ const (
 	DescCanceled = "the build canceled"
 	DescBlocked  = "the build is pending approval"
 	DescDeclined = "the build was rejected"
+	DescSkipped  = "the build was skipped"
 )
 
 // getStatus is a helper functin that converts a Drone
@@ -678,7 +679,7 @@ func getStatus(status string) string {
 		return StatusPending
 	case model.StatusRunning:
 		return StatusRunning
-	case model.StatusSuccess:
+	case model.StatusSuccess, model.StatusSkipped:
 		return StatusSuccess
 	case model.StatusFailure, model.StatusError:
 		return StatusFailure
@@ -707,6 +708,8 @@ func getDesc(status string) string {
 		return DescBlocked
 	case model.StatusDeclined:
 		return DescDeclined
+	case model.StatusSkipped:
+		return DescSkipped
 	default:
 		return DescFailure
 	}
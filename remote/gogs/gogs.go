@@ -199,12 +199,31 @@ func (c *client) File(u *model.User, r *model.Repo, b *model.Build, f string) ([
 		)
 	}
 	cfg, err := client.GetFile(r.Owner, r.Name, ref, f)
+	if err != nil && err.Error() == "404 Not Found" {
+		return nil, remote.ErrFileNotFound
+	}
 	return cfg, err
 }
 
 // FileRef fetches the file from the Gogs repository and returns its contents.
 func (c *client) FileRef(u *model.User, r *model.Repo, ref, f string) ([]byte, error) {
-	return c.newClientToken(u.Token).GetFile(r.Owner, r.Name, ref, f)
+	cfg, err := c.newClientToken(u.Token).GetFile(r.Owner, r.Name, ref, f)
+	if err != nil && err.Error() == "404 Not Found" {
+		return nil, remote.ErrFileNotFound
+	}
+	return cfg, err
+}
+
+// BranchHead returns the sha of the commit at the head of the branch.
+func (c *client) BranchHead(u *model.User, r *model.Repo, branch string) (string, error) {
+	out, err := c.newClientToken(u.Token).GetRepoBranch(r.Owner, r.Name, branch)
+	if err != nil {
+		return "", err
+	}
+	if out.Commit == nil {
+		return "", fmt.Errorf("branch %s has no commit", branch)
+	}
+	return out.Commit.ID, nil
 }
 
 // Status is not supported by the Gogs driver.
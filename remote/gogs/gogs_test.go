@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
 	"github.com/drone/drone/remote/gogs/fixtures"
 
 	"github.com/franela/goblin"
@@ -148,6 +149,11 @@ func Test_gogs(t *testing.T) {
 			g.Assert(string(raw)).Equal("{ platform: linux/amd64 }")
 		})
 
+		g.It("Should return a file not found error", func() {
+			_, err := c.File(fakeUser, fakeRepo, fakeBuild, "file_not_found")
+			g.Assert(err == remote.ErrFileNotFound).IsTrue()
+		})
+
 		g.Describe("Given an authentication request", func() {
 			g.It("Should redirect to login form")
 			g.It("Should create an access token")
@@ -17,6 +17,7 @@ package remote
 //go:generate mockery -name Remote -output mock -case=underscore
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -82,6 +83,26 @@ type Refresher interface {
 	Refresh(*model.User) (bool, error)
 }
 
+// DirLister lists the files of a directory in the remote repository for
+// the given ref. It is used to fetch the pipeline configuration of
+// repositories configured with a directory.
+type DirLister interface {
+	Dir(u *model.User, r *model.Repo, ref, dir string) ([]*FileMeta, error)
+}
+
+// BranchResolver resolves the sha of the commit at the head of a branch
+// in the remote repository. It is used to build a branch when no commit
+// is given, for example by the cron scheduler.
+type BranchResolver interface {
+	BranchHead(u *model.User, r *model.Repo, branch string) (string, error)
+}
+
+// FileMeta represents a file in a remote repository.
+type FileMeta struct {
+	Name string
+	Data []byte
+}
+
 // Login authenticates the session and returns the
 // remote user details.
 func Login(c context.Context, w http.ResponseWriter, r *http.Request) (*model.User, error) {
@@ -169,6 +190,16 @@ func Refresh(c context.Context, u *model.User) (bool, error) {
 	return refresher.Refresh(u)
 }
 
+// BranchHead returns the sha of the commit at the head of the branch. It
+// returns an error if the remote cannot resolve branches.
+func BranchHead(remote Remote, u *model.User, r *model.Repo, branch string) (string, error) {
+	resolver, ok := remote.(BranchResolver)
+	if !ok {
+		return "", fmt.Errorf("cannot resolve the head of branch %s: not supported by the remote", branch)
+	}
+	return resolver.BranchHead(u, r, branch)
+}
+
 // FileBackoff fetches the file using an exponential backoff.
 // TODO replace this with a proper backoff
 func FileBackoff(remote Remote, u *model.User, r *model.Repo, b *model.Build, f string) (out []byte, err error) {
@@ -183,3 +214,20 @@ func FileBackoff(remote Remote, u *model.User, r *model.Repo, b *model.Build, f
 	}
 	return
 }
+
+// maxStatusDesc is the maximum length of a commit status description.
+// GitHub rejects longer descriptions.
+const maxStatusDesc = 140
+
+// StatusDesc returns the commit status description for the build. The
+// reason is appended to the description of declined builds, and the
+// description is truncated to the maximum length.
+func StatusDesc(b *model.Build, desc string) string {
+	if b.Status == model.StatusDeclined && b.DeclineReason != "" {
+		desc = desc + ": " + b.DeclineReason
+	}
+	if runes := []rune(desc); len(runes) > maxStatusDesc {
+		desc = string(runes[:maxStatusDesc-3]) + "..."
+	}
+	return desc
+}
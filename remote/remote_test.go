@@ -0,0 +1,43 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+func TestStatusDesc(t *testing.T) {
+	build := &model.Build{Status: model.StatusDeclined, DeclineReason: "missing tests"}
+	if got, want := StatusDesc(build, "the build was declined"), "the build was declined: missing tests"; got != want {
+		t.Errorf("Want description %q, got %q", want, got)
+	}
+
+	build.DeclineReason = strings.Repeat("x", 500)
+	got := StatusDesc(build, "the build was declined")
+	if n := len([]rune(got)); n != 140 {
+		t.Errorf("Want description truncated to 140 characters, got %d", n)
+	}
+	if !strings.HasPrefix(got, "the build was declined: ") || !strings.HasSuffix(got, "...") {
+		t.Errorf("Want truncated description marked with an ellipsis, got %q", got)
+	}
+
+	build.Status = model.StatusSuccess
+	if got, want := StatusDesc(build, "the build was successful"), "the build was successful"; got != want {
+		t.Errorf("Want description %q, got %q", want, got)
+	}
+}
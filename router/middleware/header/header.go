@@ -51,6 +51,7 @@ func Options(c *gin.Context) {
 // and resource access headers.
 func Secure(c *gin.Context) {
 	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Access-Control-Expose-Headers", "Link, X-Total-Count, X-Next-Cursor")
 	c.Header("X-Frame-Options", "DENY")
 	c.Header("X-Content-Type-Options", "nosniff")
 	c.Header("X-XSS-Protection", "1; mode=block")
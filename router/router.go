@@ -85,8 +85,19 @@ func Load(mux *httptreemux.ContextMux, middleware ...gin.HandlerFunc) http.Handl
 		repo.GET("", server.GetRepo)
 		repo.GET("/builds", server.GetBuilds)
 		repo.GET("/builds/:number", server.GetBuild)
+		repo.GET("/builds/:number/logs/archive", server.GetBuildLogsArchive)
+		repo.GET("/builds/:number/logs.zip", server.GetBuildLogsArchive)
+		repo.GET("/builds/:number/procs/:pid", server.GetProc)
+		repo.GET("/builds/:number/timings", server.GetBuildTimings)
+		repo.GET("/builds/:number/config", server.GetBuildConfig)
+		repo.GET("/builds/:number/env", session.MustPush, server.GetBuildEnviron)
+		repo.GET("/builds/:number/events", server.GetBuildEvents)
+		repo.GET("/compare/:a/:b", server.GetBuildCompare)
+		repo.POST("/lint", server.PostLint)
+		repo.GET("/stats", server.GetRepoStats)
 		repo.GET("/logs/:number/:pid", server.GetProcLogs)
 		repo.GET("/logs/:number/:pid/:proc", server.GetBuildLogs)
+		repo.GET("/logstream/:number/:pid", server.GetProcLogStream)
 
 		repo.GET("/files/:number", server.FileList)
 		repo.GET("/files/:number/:proc/*file", server.FileGet)
@@ -98,6 +109,20 @@ func Load(mux *httptreemux.ContextMux, middleware ...gin.HandlerFunc) http.Handl
 		repo.PATCH("/secrets/:secret", session.MustPush, server.PatchSecret)
 		repo.DELETE("/secrets/:secret", session.MustPush, server.DeleteSecret)
 
+		// requires push permissions
+		repo.GET("/cron", session.MustPush, server.GetCronList)
+		repo.POST("/cron", session.MustPush, server.PostCron)
+		repo.GET("/cron/:cron", session.MustPush, server.GetCron)
+		repo.PATCH("/cron/:cron", session.MustPush, server.PatchCron)
+		repo.DELETE("/cron/:cron", session.MustPush, server.DeleteCron)
+
+		// requires push permissions, changes require admin permissions
+		repo.GET("/environment", session.MustPush, server.GetEnvironList)
+		repo.POST("/environment", session.MustRepoAdmin(), server.PostEnviron)
+		repo.GET("/environment/:environ", session.MustPush, server.GetEnviron)
+		repo.PATCH("/environment/:environ", session.MustRepoAdmin(), server.PatchEnviron)
+		repo.DELETE("/environment/:environ", session.MustRepoAdmin(), server.DeleteEnviron)
+
 		// requires push permissions
 		repo.GET("/registry", session.MustPush, server.GetRegistryList)
 		repo.POST("/registry", session.MustPush, server.PostRegistry)
@@ -111,13 +136,31 @@ func Load(mux *httptreemux.ContextMux, middleware ...gin.HandlerFunc) http.Handl
 		repo.POST("/chown", session.MustRepoAdmin(), server.ChownRepo)
 		repo.POST("/repair", session.MustRepoAdmin(), server.RepairRepo)
 		repo.POST("/move", session.MustRepoAdmin(), server.MoveRepo)
+		repo.GET("/audit", session.MustRepoAdmin(), server.GetAuditList)
+		repo.GET("/hooks", session.MustPush, server.GetHookList)
+		repo.POST("/hooks/:id/replay", session.MustRepoAdmin(), server.PostHookReplay)
 
+		repo.POST("/builds", session.MustPush, server.TriggerBuild)
 		repo.POST("/builds/:number", session.MustPush, server.PostBuild)
 		repo.DELETE("/builds/:number", session.MustRepoAdmin(), server.ZombieKill)
+		repo.POST("/builds/:number/cancel", session.MustPush, server.CancelBuild)
+		repo.POST("/builds/:number/procs/:pid/requeue", session.MustRepoAdmin(), server.PostProcRequeue)
 		repo.POST("/builds/:number/approve", session.MustPush, server.PostApproval)
+		// not /builds/approve, a static segment cannot be registered
+		// next to the /builds/:number wildcard.
+		repo.POST("/approve", session.MustPush, server.PostApprovalList)
+		// not /builds/prune, for the same reason as /approve.
+		repo.POST("/prune", session.MustRepoAdmin(), server.PostPrune)
+		// not /builds/cancel-all, for the same reason as /approve.
+		repo.POST("/cancel", session.MustRepoAdmin(), server.PostBuildCancelAll)
 		repo.POST("/builds/:number/decline", session.MustPush, server.PostDecline)
+		repo.POST("/builds/:number/promote", session.MustPush, server.PostPromote)
+		repo.POST("/builds/:number/dryrun", session.MustPush, server.PostBuildDryRun)
 		repo.DELETE("/builds/:number/:job", session.MustPush, server.DeleteBuild)
 		repo.DELETE("/logs/:number", session.MustPush, server.DeleteBuildLogs)
+		// not /builds/:number/procs/:pid/logs, which conflicts with the
+		// /builds/:number/:job wildcard above.
+		repo.DELETE("/logs/:number/:pid", session.MustPush, server.DeleteProcLogs)
 	}
 
 	badges := e.Group("/api/badges/:owner/:name")
@@ -148,6 +191,13 @@ func Load(mux *httptreemux.ContextMux, middleware ...gin.HandlerFunc) http.Handl
 		)
 	}
 
+	queue := e.Group("/api/queue")
+	{
+		queue.Use(session.MustAdmin())
+		queue.POST("/pause", server.PostQueuePause)
+		queue.POST("/resume", server.PostQueueResume)
+	}
+
 	auth := e.Group("/authorize")
 	{
 		auth.GET("", server.HandleAuth)
@@ -159,6 +209,18 @@ func Load(mux *httptreemux.ContextMux, middleware ...gin.HandlerFunc) http.Handl
 	{
 		builds.Use(session.MustAdmin())
 		builds.GET("", server.GetBuildQueue)
+		builds.GET("/running", server.GetRunningBuilds)
+		builds.GET("/recent", server.GetRecentBuilds)
+	}
+
+	secrets := e.Group("/api/secrets")
+	{
+		secrets.Use(session.MustAdmin())
+		secrets.GET("", server.GetGlobalSecretList)
+		secrets.POST("", server.PostGlobalSecret)
+		secrets.GET("/:secret", server.GetGlobalSecret)
+		secrets.PATCH("/:secret", server.PatchGlobalSecret)
+		secrets.DELETE("/:secret", server.DeleteGlobalSecret)
 	}
 
 	debugger := e.Group("/api/debug")
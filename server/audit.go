@@ -0,0 +1,83 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/router/middleware/session"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAuditList gets the audit trail for the repository and writes
+// to the response in json format.
+func GetAuditList(c *gin.Context) {
+	repo := session.Repo(c)
+	list, err := store.FromContext(c).AuditList(repo)
+	if err != nil {
+		c.String(500, "Error getting audit list. %s", err)
+		return
+	}
+	c.JSON(200, list)
+}
+
+// writeAudit records the action taken on the build by the current
+// user. Failures are logged but do not fail the request.
+func writeAudit(c *gin.Context, repo *model.Repo, build *model.Build, action string) {
+	writeBuildAudit(c, repo, build, action, "")
+}
+
+// writeProcAudit records the action taken on a single proc of the build
+// by the current user, with the proc number as the audit target.
+func writeProcAudit(c *gin.Context, repo *model.Repo, build *model.Build, proc *model.Proc, action string) {
+	writeBuildAudit(c, repo, build, action, strconv.Itoa(proc.PID))
+}
+
+func writeBuildAudit(c *gin.Context, repo *model.Repo, build *model.Build, action, target string) {
+	audit := &model.Audit{
+		RepoID:  repo.ID,
+		Build:   build.Number,
+		Action:  action,
+		Target:  target,
+		Created: time.Now().Unix(),
+	}
+	if user := session.User(c); user != nil {
+		audit.Actor = user.Login
+	}
+	if err := store.FromContext(c).AuditCreate(audit); err != nil {
+		logrus.Errorf("error: cannot record %s audit for %s#%d: %s", action, repo.FullName, build.Number, err)
+	}
+}
+
+// writeSecretAudit records the action taken on the global secret by the
+// current user. Failures are logged but do not fail the request.
+func writeSecretAudit(c *gin.Context, action, name string) {
+	audit := &model.Audit{
+		Action:  action,
+		Target:  name,
+		Created: time.Now().Unix(),
+	}
+	if user := session.User(c); user != nil {
+		audit.Actor = user.Login
+	}
+	if err := store.FromContext(c).AuditCreate(audit); err != nil {
+		logrus.Errorf("error: cannot record %s audit for global secret %s: %s", action, name, err)
+	}
+}
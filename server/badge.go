@@ -31,6 +31,7 @@ var (
 	badgeStarted = `<svg xmlns="http://www.w3.org/2000/svg" width="87" height="20"><linearGradient id="a" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient><rect rx="3" width="87" height="20" fill="#555"/><rect rx="3" x="37" width="50" height="20" fill="#dfb317"/><path fill="#dfb317" d="M37 0h4v20h-4z"/><rect rx="3" width="87" height="20" fill="url(#a)"/><g fill="#fff" text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="11"><text x="19.5" y="15" fill="#010101" fill-opacity=".3">build</text><text x="19.5" y="14">build</text><text x="61" y="15" fill="#010101" fill-opacity=".3">started</text><text x="61" y="14">started</text></g></svg>`
 	badgeError   = `<svg xmlns="http://www.w3.org/2000/svg" width="76" height="20"><linearGradient id="a" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient><rect rx="3" width="76" height="20" fill="#555"/><rect rx="3" x="37" width="39" height="20" fill="#9f9f9f"/><path fill="#9f9f9f" d="M37 0h4v20h-4z"/><rect rx="3" width="76" height="20" fill="url(#a)"/><g fill="#fff" text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="11"><text x="19.5" y="15" fill="#010101" fill-opacity=".3">build</text><text x="19.5" y="14">build</text><text x="55.5" y="15" fill="#010101" fill-opacity=".3">error</text><text x="55.5" y="14">error</text></g></svg>`
 	badgeNone    = `<svg xmlns="http://www.w3.org/2000/svg" width="75" height="20"><linearGradient id="a" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient><rect rx="3" width="75" height="20" fill="#555"/><rect rx="3" x="37" width="38" height="20" fill="#9f9f9f"/><path fill="#9f9f9f" d="M37 0h4v20h-4z"/><rect rx="3" width="75" height="20" fill="url(#a)"/><g fill="#fff" text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="11"><text x="19.5" y="15" fill="#010101" fill-opacity=".3">build</text><text x="19.5" y="14">build</text><text x="55" y="15" fill="#010101" fill-opacity=".3">none</text><text x="55" y="14">none</text></g></svg>`
+	badgeSkipped = `<svg xmlns="http://www.w3.org/2000/svg" width="91" height="20"><linearGradient id="a" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient><rect rx="3" width="91" height="20" fill="#555"/><rect rx="3" x="37" width="54" height="20" fill="#9f9f9f"/><path fill="#9f9f9f" d="M37 0h4v20h-4z"/><rect rx="3" width="91" height="20" fill="url(#a)"/><g fill="#fff" text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="11"><text x="19.5" y="15" fill="#010101" fill-opacity=".3">build</text><text x="19.5" y="14">build</text><text x="63" y="15" fill="#010101" fill-opacity=".3">skipped</text><text x="63" y="14">skipped</text></g></svg>`
 )
 
 func GetBadge(c *gin.Context) {
@@ -61,18 +62,24 @@ func GetBadge(c *gin.Context) {
 		c.String(200, badgeNone)
 		return
 	}
+	c.String(200, badgeStatus(build.Status))
+}
 
-	switch build.Status {
+// badgeStatus returns the badge for the build status.
+func badgeStatus(status string) string {
+	switch status {
 	case model.StatusSuccess:
-		c.String(200, badgeSuccess)
+		return badgeSuccess
 	case model.StatusFailure:
-		c.String(200, badgeFailure)
+		return badgeFailure
 	case model.StatusError, model.StatusKilled:
-		c.String(200, badgeError)
+		return badgeError
 	case model.StatusPending, model.StatusRunning:
-		c.String(200, badgeStarted)
+		return badgeStarted
+	case model.StatusSkipped:
+		return badgeSkipped
 	default:
-		c.String(200, badgeNone)
+		return badgeNone
 	}
 }
 
@@ -86,13 +93,20 @@ func GetCC(c *gin.Context) {
 		return
 	}
 
-	builds, err := store.GetBuildList(c, repo, 1)
-	if err != nil || len(builds) == 0 {
+	// the feed reports the same branch as the status
+	// badge so that both are always in agreement.
+	branch := c.Query("branch")
+	if len(branch) == 0 {
+		branch = repo.Branch
+	}
+
+	build, err := store.GetBuildLast(c, repo, branch)
+	if err != nil {
 		c.AbortWithStatus(404)
 		return
 	}
 
-	url := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, builds[0].Number)
-	cc := model.NewCC(repo, builds[0], url)
+	url := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, build.Number)
+	cc := model.NewCC(repo, build, url)
 	c.XML(200, cc)
 }
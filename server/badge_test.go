@@ -0,0 +1,141 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// badgeStore is a store that returns a repository without builds.
+type badgeStore struct {
+	store.Store
+}
+
+func (s *badgeStore) GetRepoName(string) (*model.Repo, error) {
+	return &model.Repo{FullName: "octocat/hello-world", Branch: "master"}, nil
+}
+
+func (s *badgeStore) GetBuildLast(*model.Repo, string) (*model.Build, error) {
+	return nil, sql.ErrNoRows
+}
+
+func TestBadgeStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{model.StatusSuccess, badgeSuccess},
+		{model.StatusFailure, badgeFailure},
+		{model.StatusError, badgeError},
+		{model.StatusKilled, badgeError},
+		{model.StatusPending, badgeStarted},
+		{model.StatusRunning, badgeStarted},
+		{model.StatusSkipped, badgeSkipped},
+		{model.StatusBlocked, badgeNone},
+		{"", badgeNone},
+	}
+	for _, test := range tests {
+		if got := badgeStatus(test.status); got != test.want {
+			t.Errorf("Want %q build to render the expected badge", test.status)
+		}
+	}
+}
+
+func TestGetBadgeWithoutBuilds(t *testing.T) {
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "/api/badges/octocat/hello-world/status.svg", nil)
+	c.Params = gin.Params{
+		{Key: "owner", Value: "octocat"},
+		{Key: "name", Value: "hello-world"},
+	}
+	store.ToContext(c, new(badgeStore))
+
+	GetBadge(c)
+
+	if w.Code != 200 {
+		t.Errorf("Want status 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "image/svg+xml" {
+		t.Errorf("Want svg content type, got %q", got)
+	}
+	if w.Body.String() != badgeNone {
+		t.Errorf("Want the none badge for a repository without builds")
+	}
+}
+
+// ccStore is a store that returns a repository with a single build.
+type ccStore struct {
+	badgeStore
+	build  *model.Build
+	branch string
+}
+
+func (s *ccStore) GetBuildLast(repo *model.Repo, branch string) (*model.Build, error) {
+	s.branch = branch
+	return s.build, nil
+}
+
+func TestGetCC(t *testing.T) {
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "http://drone.example.com/api/badges/octocat/hello-world/cc.xml", nil)
+	c.Params = gin.Params{
+		{Key: "owner", Value: "octocat"},
+		{Key: "name", Value: "hello-world"},
+	}
+	s := &ccStore{build: &model.Build{Number: 42, Status: model.StatusDeclined, Created: 1257894000}}
+	store.ToContext(c, s)
+
+	GetCC(c)
+
+	if w.Code != 200 {
+		t.Errorf("Want status 200, got %d", w.Code)
+	}
+	if s.branch != "master" {
+		t.Errorf("Want the default branch, got %q", s.branch)
+	}
+	for _, want := range []string{
+		`lastBuildStatus="Failure"`,
+		`activity="Sleeping"`,
+		`webUrl="http://drone.example.com/octocat/hello-world/42"`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Want %s in the feed, got %s", want, w.Body.String())
+		}
+	}
+}
+
+func TestGetCCWithoutBuilds(t *testing.T) {
+	c, _, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "/api/badges/octocat/hello-world/cc.xml", nil)
+	c.Params = gin.Params{
+		{Key: "owner", Value: "octocat"},
+		{Key: "name", Value: "hello-world"},
+	}
+	store.ToContext(c, new(badgeStore))
+
+	GetCC(c)
+
+	if got := c.Writer.Status(); got != 404 {
+		t.Errorf("Want status 404, got %d", got)
+	}
+}
@@ -15,13 +15,21 @@
 package server
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -37,22 +45,193 @@ import (
 	"github.com/drone/drone/router/middleware/session"
 )
 
+// default and maximum number of builds returned per page
+// when listing the build history for a repository.
+const (
+	defaultPerPage = 25
+	maxPerPage     = 100
+)
+
 func GetBuilds(c *gin.Context) {
+	if _, ok := c.GetQuery("before"); ok {
+		GetBuildsCursor(c)
+		return
+	}
+	if _, ok := c.GetQuery("commit"); ok {
+		GetBuildCommit(c)
+		return
+	}
+
 	repo := session.Repo(c)
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "Invalid page. Must be a positive integer")
+		return
+	}
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(defaultPerPage)))
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "Invalid per_page. Must be between 1 and %d", maxPerPage)
+		return
+	}
+
+	filter := &model.BuildFilter{
+		Status: c.Query("status"),
+		Event:  c.Query("event"),
+		Branch: c.Query("branch"),
+		Author: c.Query("author"),
+		Ref:    c.Query("ref"),
+	}
+	if err := filter.Validate(); err != nil {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "%s", err)
+		return
+	}
+	if pr := c.Query("pr"); pr != "" {
+		number, err := strconv.Atoi(pr)
+		if err != nil || number < 1 {
+			writeError(c, http.StatusBadRequest, errInvalidParam, "Invalid pr. Must be a pull request number")
+			return
+		}
+		filter.Refs = model.PullRequestRefs(number)
+	}
+
+	total, err := store.GetBuildListCount(c, repo, filter)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, errStore, "Error counting builds. %s", err)
+		return
+	}
+	builds, err := store.GetBuildListFiltered(c, repo, page, perPage, filter)
 	if err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
+		writeError(c, http.StatusInternalServerError, errStore, "Error getting builds. %s", err)
+		return
+	}
+	writePageHeaders(c, page, perPage, total)
+	c.JSON(http.StatusOK, builds)
+}
+
+// GetBuildsCursor returns the builds with a number lower than the
+// before cursor, newest first. Unlike offset pagination the results
+// do not shift when new builds are created, which makes it suitable
+// for walking the full history of large repositories.
+func GetBuildsCursor(c *gin.Context) {
+	repo := session.Repo(c)
+	before, err := strconv.Atoi(c.Query("before"))
+	if err != nil || before < 0 {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "Invalid before. Must be a build number")
+		return
+	}
+	if before == 0 {
+		before = math.MaxInt32
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPerPage)))
+	if err != nil || limit < 1 || limit > maxPerPage {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "Invalid limit. Must be between 1 and %d", maxPerPage)
 		return
 	}
 
-	builds, err := store.GetBuildList(c, repo, page)
+	builds, err := store.GetBuildListBefore(c, repo, before, limit)
 	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
+		writeError(c, http.StatusInternalServerError, errStore, "Error getting builds. %s", err)
 		return
 	}
+
+	// the next cursor is the lowest build number in this page. It
+	// is omitted once the end of the build history is reached.
+	if len(builds) == limit && builds[len(builds)-1].Number > 1 {
+		next := builds[len(builds)-1].Number
+		params := c.Request.URL.Query()
+		params.Set("before", strconv.Itoa(next))
+		params.Set("limit", strconv.Itoa(limit))
+		c.Header("X-Next-Cursor", strconv.Itoa(next))
+		c.Header("Link", fmt.Sprintf(`<%s%s?%s>; rel="next"`,
+			httputil.GetURL(c.Request),
+			c.Request.URL.Path,
+			params.Encode(),
+		))
+	}
 	c.JSON(http.StatusOK, builds)
 }
 
+// commitCandidates is the maximum number of commits returned when a
+// commit sha prefix is ambiguous.
+const commitCandidates = 10
+
+var commitRegexp = regexp.MustCompile("^[0-9a-f]{7,40}$")
+
+// GetBuildCommit returns the most recent build of the commit given by
+// the commit query parameter. The commit can be a full sha or a unique
+// prefix of at least 7 characters. An ambiguous prefix returns 409
+// with the matching commits.
+func GetBuildCommit(c *gin.Context) {
+	repo := session.Repo(c)
+	sha := strings.ToLower(c.Query("commit"))
+	if !commitRegexp.MatchString(sha) {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "Invalid commit. Must be a sha or a prefix of at least 7 characters")
+		return
+	}
+
+	commits, err := store.FromContext(c).GetBuildCommitList(repo, sha, commitCandidates)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, errStore, "Error getting commits. %s", err)
+		return
+	}
+	switch len(commits) {
+	case 0:
+		writeError(c, http.StatusNotFound, errNotFound, "Cannot find a build of commit %s", sha)
+		return
+	case 1:
+	default:
+		c.JSON(http.StatusConflict, struct {
+			errorResponse
+			Candidates []string `json:"candidates"`
+		}{
+			errorResponse{errAmbiguous, fmt.Sprintf("Commit %s is ambiguous", sha)},
+			commits,
+		})
+		return
+	}
+
+	build, err := store.FromContext(c).GetBuildLastCommit(repo, commits[0])
+	if err != nil {
+		writeError(c, http.StatusNotFound, errNotFound, "Cannot find a build of commit %s. %s", sha, err)
+		return
+	}
+	c.JSON(http.StatusOK, build)
+}
+
+// writePageHeaders writes the X-Total-Count and Link headers
+// so that clients can navigate a paginated listing.
+func writePageHeaders(c *gin.Context, page, perPage, total int) {
+	last := (total + perPage - 1) / perPage
+	if last < 1 {
+		last = 1
+	}
+
+	link := func(page int, rel string) string {
+		params := c.Request.URL.Query()
+		params.Set("page", strconv.Itoa(page))
+		params.Set("per_page", strconv.Itoa(perPage))
+		return fmt.Sprintf(`<%s%s?%s>; rel="%s"`,
+			httputil.GetURL(c.Request),
+			c.Request.URL.Path,
+			params.Encode(),
+			rel,
+		)
+	}
+
+	var links []string
+	if page < last {
+		links = append(links, link(page+1, "next"), link(last, "last"))
+	}
+	if page > 1 {
+		links = append(links, link(1, "first"), link(page-1, "prev"))
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	if len(links) != 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+}
+
 func GetBuild(c *gin.Context) {
 	if c.Param("number") == "latest" {
 		GetBuildLast(c)
@@ -60,445 +239,2233 @@ func GetBuild(c *gin.Context) {
 	}
 
 	repo := session.Repo(c)
-	num, err := strconv.Atoi(c.Param("number"))
-	if err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+
+	include, ok := parseInclude(c, "files", "procs")
+	if !ok {
 		return
 	}
 
 	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+		writeError(c, http.StatusInternalServerError, errStore, "%s", err)
 		return
 	}
-	files, _ := store.FromContext(c).FileList(build)
-	procs, _ := store.FromContext(c).ProcList(build)
+	// the store returns an empty list when the build has no procs or
+	// files, so any error is a failure that must not be hidden from
+	// the client.
+	if include["files"] {
+		build.Files, err = store.FromContext(c).FileList(build)
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, errStore, "Error getting files for build %d. %s", num, err)
+			return
+		}
+	}
+	var procs []*model.Proc
+	if include["procs"] {
+		procs, err = store.FromContext(c).ProcList(build)
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, errStore, "Error getting procs for build %d. %s", num, err)
+			return
+		}
+	}
+	build.SetTimings(procs, time.Now().Unix())
+	build.SetAwaiting(procs)
+	build.SetActions()
 	build.Procs = model.Tree(procs)
-	build.Files = files
+
+	// the configuration files are listed for builds created from a
+	// configuration directory.
+	confs, err := store.FromContext(c).BuildConfigFind(build.ID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, errStore, "Error getting configurations for build %d. %s", num, err)
+		return
+	}
+	build.Configs = configNames(confs)
+
+	// the parameters and environment the build ran with are only
+	// visible to users with push access, like the build environment
+	// endpoint. Secrets are never part of the parameters, and are
+	// masked in the environment.
+	if perm := session.Perm(c); perm != nil && perm.Push {
+		build.Params, err = store.FromContext(c).BuildParamsFind(build.ID)
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, errStore, "Error getting parameters for build %d. %s", num, err)
+			return
+		}
+		build.Environ, err = store.FromContext(c).BuildEnvironFind(build.ID)
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, errStore, "Error getting environment for build %d. %s", num, err)
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, build)
 }
 
-func GetBuildLast(c *gin.Context) {
+// parseInclude parses the comma separated include query parameter,
+// which selects the related records returned with a resource. All the
+// records are included when the parameter is missing. It writes a 400
+// error response and returns false if a record is not known.
+func parseInclude(c *gin.Context, records ...string) (map[string]bool, bool) {
+	known := map[string]bool{}
+	for _, record := range records {
+		known[record] = true
+	}
+	value, ok := c.GetQuery("include")
+	if !ok {
+		return known, true
+	}
+
+	include := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			writeError(c, http.StatusBadRequest, errInvalidParam, "invalid include %q, must be one of %s", name, strings.Join(records, ", "))
+			return nil, false
+		}
+		include[name] = true
+	}
+	return include, true
+}
+
+// GetBuildTimings returns the timing breakdown of the build and its
+// procs, without the logs and files of the build.
+func GetBuildTimings(c *gin.Context) {
 	repo := session.Repo(c)
-	branch := c.DefaultQuery("branch", repo.Branch)
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
 
-	build, err := store.GetBuildLast(c, repo, branch)
+	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		writeError(c, http.StatusNotFound, errNotFound, "%s", err)
 		return
 	}
-
-	procs, _ := store.FromContext(c).ProcList(build)
-	build.Procs = model.Tree(procs)
-	c.JSON(http.StatusOK, build)
+	procs, err := store.FromContext(c).ProcList(build)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, errStore, "%s", err)
+		return
+	}
+	c.JSON(http.StatusOK, build.Timings(procs, time.Now().Unix()))
 }
 
-func GetBuildLogs(c *gin.Context) {
+// GetBuildCompare compares two builds of the repository, returning the
+// status transitions and duration changes of their procs.
+func GetBuildCompare(c *gin.Context) {
 	repo := session.Repo(c)
+	a, ok := parseBuildParam(c, "a")
+	if !ok {
+		return
+	}
+	b, ok := parseBuildParam(c, "b")
+	if !ok {
+		return
+	}
 
-	// parse the build number and job sequence number from
-	// the repquest parameter.
-	num, _ := strconv.Atoi(c.Params.ByName("number"))
-	ppid, _ := strconv.Atoi(c.Params.ByName("pid"))
-	name := c.Params.ByName("proc")
+	base, baseProcs, ok := compareBuild(c, repo, a)
+	if !ok {
+		return
+	}
+	head, headProcs, ok := compareBuild(c, repo, b)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, model.Compare(base, baseProcs, head, headProcs, time.Now().Unix()))
+}
 
+// compareBuild loads the build and its procs, writing an error
+// response and returning false on failure.
+func compareBuild(c *gin.Context, repo *model.Repo, num int) (*model.Build, []*model.Proc, bool) {
 	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, http.StatusNotFound, errNotFound, "Error getting build %d. %s", num, err)
+		return nil, nil, false
+	}
+	procs, err := store.FromContext(c).ProcList(build)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, errStore, "Error getting procs for build %d. %s", num, err)
+		return nil, nil, false
+	}
+	return build, procs, true
+}
+
+// GetBuildConfig returns the pipeline configuration the build was
+// created with, which may differ from the configuration currently in
+// the repository.
+func GetBuildConfig(c *gin.Context) {
+	repo := session.Repo(c)
+	num, ok := parseBuildNumber(c)
+	if !ok {
 		return
 	}
 
-	proc, err := store.FromContext(c).ProcChild(build, ppid, name)
+	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, http.StatusNotFound, errNotFound, "%s", err)
 		return
 	}
-
-	rc, err := store.FromContext(c).LogFind(proc)
+	conf, err := Config.Storage.Config.ConfigLoad(build.ConfigID)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, http.StatusNotFound, errNotFound,
+			"Error getting the configuration of build %d. %s", num, err)
 		return
 	}
+	c.JSON(http.StatusOK, conf)
+}
 
-	defer rc.Close()
+// GetBuildEnviron returns the global environment and build parameters
+// the build was dispatched with. Secret values are masked.
+func GetBuildEnviron(c *gin.Context) {
+	repo := session.Repo(c)
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
 
-	c.Header("Content-Type", "application/json")
-	io.Copy(c.Writer, rc)
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		writeError(c, http.StatusNotFound, errNotFound, "%s", err)
+		return
+	}
+	environ, err := store.FromContext(c).BuildEnvironFind(build.ID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, errStore,
+			"Error getting build environment. %s", err)
+		return
+	}
+	c.JSON(http.StatusOK, environ)
 }
 
-func GetProcLogs(c *gin.Context) {
+// GetProc returns a single proc of the build by process id.
+func GetProc(c *gin.Context) {
 	repo := session.Repo(c)
-
-	// parse the build number and job sequence number from
-	// the repquest parameter.
-	num, _ := strconv.Atoi(c.Params.ByName("number"))
-	pid, _ := strconv.Atoi(c.Params.ByName("pid"))
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "%s", err)
+		return
+	}
 
 	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, http.StatusNotFound, errNotFound, "%s", err)
 		return
 	}
-
 	proc, err := store.FromContext(c).ProcFind(build, pid)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, http.StatusNotFound, errNotFound, "%s", err)
 		return
 	}
+	c.JSON(http.StatusOK, proc)
+}
 
-	rc, err := store.FromContext(c).LogFind(proc)
+func GetBuildLast(c *gin.Context) {
+	repo := session.Repo(c)
+	branch := c.DefaultQuery("branch", repo.Branch)
+
+	var (
+		build *model.Build
+		err   error
+	)
+	if c.Query("event") != "" || c.Query("status") != "" {
+		// the branch is optional when filtering by event or status,
+		// for example to get the last successful deployment.
+		filter := &model.BuildFilter{
+			Status: c.Query("status"),
+			Event:  c.Query("event"),
+			Branch: c.Query("branch"),
+		}
+		if err := filter.Validate(); err != nil {
+			writeError(c, http.StatusBadRequest, errInvalidParam, "%s", err)
+			return
+		}
+		build, err = store.FromContext(c).GetBuildLastFiltered(repo, filter)
+	} else {
+		build, err = store.GetBuildLast(c, repo, branch)
+	}
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, http.StatusInternalServerError, errStore, "%s", err)
 		return
 	}
 
-	defer rc.Close()
-
-	c.Header("Content-Type", "application/json")
-	io.Copy(c.Writer, rc)
+	procs, err := store.FromContext(c).ProcList(build)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, errStore, "Error getting procs for build %d. %s", build.Number, err)
+		return
+	}
+	build.SetTimings(procs, time.Now().Unix())
+	build.SetAwaiting(procs)
+	build.SetActions()
+	build.Procs = model.Tree(procs)
+	c.JSON(http.StatusOK, build)
 }
 
-func DeleteBuild(c *gin.Context) {
+func GetBuildLogs(c *gin.Context) {
 	repo := session.Repo(c)
 
 	// parse the build number and job sequence number from
 	// the repquest parameter.
-	num, _ := strconv.Atoi(c.Params.ByName("number"))
-	seq, _ := strconv.Atoi(c.Params.ByName("job"))
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+	ppid, _ := strconv.Atoi(c.Params.ByName("pid"))
+	name := c.Params.ByName("proc")
 
 	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, 404, errNotFound, "%s", err)
 		return
 	}
 
-	proc, err := store.FromContext(c).ProcFind(build, seq)
+	proc, err := store.FromContext(c).ProcChild(build, ppid, name)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, 404, errNotFound, "%s", err)
 		return
 	}
 
-	if proc.State != model.StatusRunning {
-		c.String(400, "Cannot cancel a non-running build")
+	if follow, _ := strconv.ParseBool(c.Query("follow")); follow && proc.Running() {
+		streamProcLogs(c, build, proc)
 		return
 	}
 
-	proc.State = model.StatusKilled
-	proc.Stopped = time.Now().Unix()
-	if proc.Started == 0 {
-		proc.Started = proc.Stopped
-	}
-	proc.ExitCode = 137
-	// TODO cancel child procs
-	store.FromContext(c).ProcUpdate(proc)
-
-	Config.Services.Queue.Error(context.Background(), fmt.Sprint(proc.ID), queue.ErrCancel)
-	c.String(204, "")
+	serveProcLogs(c, repo, build, proc)
 }
 
-// ZombieKill kills zombie processes stuck in an infinite pending
-// or running state. This can only be invoked by administrators and
-// may have negative effects.
-func ZombieKill(c *gin.Context) {
+func GetProcLogs(c *gin.Context) {
 	repo := session.Repo(c)
 
 	// parse the build number and job sequence number from
 	// the repquest parameter.
-	num, _ := strconv.Atoi(c.Params.ByName("number"))
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+	pid, _ := strconv.Atoi(c.Params.ByName("pid"))
 
 	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, 404, errNotFound, "%s", err)
 		return
 	}
 
-	procs, err := store.FromContext(c).ProcList(build)
+	proc, err := store.FromContext(c).ProcFind(build, pid)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, 404, errNotFound, "%s", err)
 		return
 	}
 
-	if build.Status != model.StatusRunning {
-		c.String(400, "Cannot force cancel a non-running build")
+	if follow, _ := strconv.ParseBool(c.Query("follow")); follow && proc.Running() {
+		streamProcLogs(c, build, proc)
 		return
 	}
 
-	for _, proc := range procs {
-		if proc.Running() {
-			proc.State = model.StatusKilled
-			proc.ExitCode = 137
-			proc.Stopped = time.Now().Unix()
-			if proc.Started == 0 {
-				proc.Started = proc.Stopped
-			}
+	serveProcLogs(c, repo, build, proc)
+}
+
+// serveProcLogs writes the stored logs of the proc. The logs of
+// completed procs do not change, so they are served with an etag that
+// clients can send to avoid downloading the logs again.
+func serveProcLogs(c *gin.Context, repo *model.Repo, build *model.Build, proc *model.Proc) {
+	rc, err := store.FromContext(c).LogFind(proc)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	defer rc.Close()
+
+	if etag := logETag(proc, wantsLogText(c)); etag != "" {
+		c.Header("ETag", etag)
+		if etagMatch(c.Request.Header.Get("If-None-Match"), etag) {
+			c.String(http.StatusNotModified, "")
+			return
 		}
 	}
 
-	for _, proc := range procs {
-		store.FromContext(c).ProcUpdate(proc)
-		Config.Services.Queue.Error(context.Background(), fmt.Sprint(proc.ID), queue.ErrCancel)
+	replacer, err := buildMask(repo, build)
+	if err != nil {
+		logrus.Errorf("error: cannot list secrets to mask the logs of %s#%d: %s", repo.FullName, build.Number, err)
+		writeError(c, 500, errStore, "Cannot list the secrets to mask the logs. %s", err)
+		return
+	}
+	r, err := maskLog(replacer, rc)
+	if err != nil {
+		writeError(c, 500, errStore, "%s", err)
+		return
 	}
 
-	build.Status = model.StatusKilled
-	build.Finished = time.Now().Unix()
-	store.FromContext(c).UpdateBuild(build)
+	if wantsLogText(c) {
+		writeLogText(c, repo, build, proc, r)
+		return
+	}
 
-	c.String(204, "")
+	serveLog(c, r)
 }
 
-func PostApproval(c *gin.Context) {
-	var (
-		remote_ = remote.FromContext(c)
-		repo    = session.Repo(c)
-		user    = session.User(c)
-		num, _  = strconv.Atoi(
-			c.Params.ByName("number"),
-		)
-	)
+// logETag returns the etag of the logs of a completed proc, computed
+// from the proc, its state, the time it stopped and the format of the
+// response. It returns an empty string for running procs.
+func logETag(proc *model.Proc, text bool) string {
+	if proc.Running() || proc.Stopped == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%d:%v", proc.ID, proc.State, proc.Stopped, text)))
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
 
-	build, err := store.GetBuildNumber(c, repo, num)
-	if err != nil {
-		c.AbortWithError(404, err)
-		return
+// etagMatch returns true if the If-None-Match header value matches
+// the etag.
+func etagMatch(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == etag || v == "*" {
+			return true
+		}
 	}
-	if build.Status != model.StatusBlocked {
-		c.String(500, "cannot decline a build with status %s", build.Status)
+	return false
+}
+
+// GetBuildLogsArchive streams the logs of every proc in the build as
+// a single zip archive, with one file per proc named after its path
+// in the proc tree. Procs without logs are omitted.
+func GetBuildLogsArchive(c *gin.Context) {
+	repo := session.Repo(c)
+
+	num, ok := parseBuildNumber(c)
+	if !ok {
 		return
 	}
-	build.Status = model.StatusPending
-	build.Reviewed = time.Now().Unix()
-	build.Reviewer = user.Login
-
-	//
-	//
-	// This code is copied pasted until I have a chance
-	// to refactor into a proper function. Lots of changes
-	// and technical debt. No judgement please!
-	//
-	//
 
-	// fetch the build file from the database
-	conf, err := Config.Storage.Config.ConfigLoad(build.ConfigID)
+	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		logrus.Errorf("failure to get build config for %s. %s", repo.FullName, err)
-		c.AbortWithError(404, err)
+		writeError(c, 404, errNotFound, "%s", err)
 		return
 	}
 
-	netrc, err := remote_.Netrc(user, repo)
+	procs, err := store.FromContext(c).ProcList(build)
 	if err != nil {
-		c.String(500, "Failed to generate netrc file. %s", err)
+		writeError(c, 404, errNotFound, "%s", err)
 		return
 	}
 
-	if uerr := store.UpdateBuild(c, build); err != nil {
-		c.String(500, "error updating build. %s", uerr)
+	parents := map[int]*model.Proc{}
+	for _, proc := range procs {
+		if proc.PPID == 0 {
+			parents[proc.PID] = proc
+		}
+	}
+
+	replacer, err := buildMask(repo, build)
+	if err != nil {
+		logrus.Errorf("error: cannot list secrets to mask the logs of %s#%d: %s", repo.FullName, build.Number, err)
+		writeError(c, 500, errStore, "Cannot list the secrets to mask the logs. %s", err)
 		return
 	}
 
-	c.JSON(200, build)
+	filename := fmt.Sprintf("build-%d-logs.zip", build.Number)
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(200)
 
-	// get the previous build so that we can send
-	// on status change notifications
-	last, _ := store.GetBuildLastBefore(c, repo, build.Branch, build.ID)
-	secs, err := Config.Services.Secrets.SecretListBuild(repo, build)
-	if err != nil {
-		logrus.Debugf("Error getting secrets for %s#%d. %s", repo.FullName, build.Number, err)
+	zw := zip.NewWriter(c.Writer)
+	defer zw.Close()
+
+	for _, proc := range procs {
+		rc, err := store.FromContext(c).LogFind(proc)
+		if err != nil {
+			continue
+		}
+		name := procPath(proc) + ".log"
+		if parent, ok := parents[proc.PPID]; ok {
+			name = procPath(parent) + "/" + name
+		}
+		w, err := zw.Create(name)
+		if err == nil {
+			var r io.Reader
+			if r, err = maskLog(replacer, rc); err == nil {
+				err = copyLogText(w, r)
+			}
+		}
+		rc.Close()
+		if err != nil {
+			logrus.Errorf("error: cannot archive log %s for %s#%d: %s", name, repo.FullName, build.Number, err)
+		}
+		c.Writer.Flush()
 	}
-	regs, err := Config.Services.Registries.RegistryList(repo)
-	if err != nil {
-		logrus.Debugf("Error getting registry credentials for %s#%d. %s", repo.FullName, build.Number, err)
+}
+
+// procPath returns the name of the proc used as a path segment,
+// falling back to the pid for unnamed top-level procs.
+func procPath(proc *model.Proc) string {
+	if proc.Name != "" {
+		return proc.Name
 	}
-	envs := map[string]string{}
-	if Config.Services.Environ != nil {
-		globals, _ := Config.Services.Environ.EnvironList(repo)
-		for _, global := range globals {
-			envs[global.Name] = global.Value
+	return strconv.Itoa(proc.PID)
+}
+
+// maxLogRangeSize is the largest log that is buffered in memory to
+// serve a byte-range request when the log store cannot seek.
+const maxLogRangeSize = 50 << 20
+
+// serveLog writes the stored log to the client, honoring the Range
+// header so that clients can seek into large logs.
+func serveLog(c *gin.Context, r io.Reader) {
+	c.Header("Content-Type", "application/json")
+	c.Header("Accept-Ranges", "bytes")
+
+	if c.Request.Header.Get("Range") == "" {
+		c.Header("Vary", "Accept-Encoding")
+		if !acceptsGzip(c.Request) {
+			io.Copy(c.Writer, r)
+			return
+		}
+		c.Header("Content-Encoding", "gzip")
+		if gz, ok := r.(model.GzipLog); ok {
+			io.Copy(c.Writer, gz.Gzip())
+			return
 		}
+		zw := gzip.NewWriter(c.Writer)
+		io.Copy(zw, r)
+		zw.Close()
+		return
 	}
 
-	defer func() {
-		uri := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, build.Number)
-		err = remote_.Status(user, repo, build, uri)
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		buf, err := ioutil.ReadAll(io.LimitReader(r, maxLogRangeSize+1))
 		if err != nil {
-			logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
+			writeError(c, 500, errStore, "%s", err)
+			return
 		}
-	}()
+		// the log is too large to buffer, so the range is
+		// ignored and the full log is returned instead.
+		if len(buf) > maxLogRangeSize {
+			c.Writer.Write(buf)
+			io.Copy(c.Writer, r)
+			return
+		}
+		rs = bytes.NewReader(buf)
+	}
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, rs)
+}
 
-	b := builder{
-		Repo:  repo,
-		Curr:  build,
-		Last:  last,
-		Netrc: netrc,
-		Secs:  secs,
-		Regs:  regs,
-		Link:  httputil.GetURL(c.Request),
-		Yaml:  conf.Data,
-		Envs:  envs,
+// acceptsGzip returns true if the client accepts gzip encoded
+// responses.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc = strings.TrimSpace(enc)
+		if enc == "gzip" || (strings.HasPrefix(enc, "gzip;") && !strings.HasSuffix(enc, "q=0")) {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsLogText returns true if the client asked for plain-text logs,
+// either with the format query parameter or the Accept header. JSON
+// remains the default.
+func wantsLogText(c *gin.Context) bool {
+	if c.Query("format") == "text" {
+		return true
+	}
+	return c.NegotiateFormat(gin.MIMEJSON, gin.MIMEPlain) == gin.MIMEPlain
+}
+
+// writeLogText writes the output of the stored log entries as plain
+// text, which is easier to read in a terminal or attach to a bug
+// report. Entries that cannot be decoded are skipped.
+func writeLogText(c *gin.Context, repo *model.Repo, build *model.Build, proc *model.Proc, r io.Reader) {
+	var entries []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		writeError(c, 500, errStore, "%s", err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s_%s_%d_%s.log", repo.Owner, repo.Name, build.Number, procPath(proc))
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(200)
+
+	writeLogLines(c.Writer, entries)
+}
+
+// copyLogText decodes the stored log entries and writes their output
+// as plain text. Entries that cannot be decoded are skipped.
+func copyLogText(w io.Writer, r io.Reader) error {
+	var entries []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+	return writeLogLines(w, entries)
+}
+
+func writeLogLines(w io.Writer, entries []json.RawMessage) error {
+	for _, entry := range entries {
+		line := new(rpc.Line)
+		if err := json.Unmarshal(entry, line); err != nil {
+			continue
+		}
+		if _, err := io.WriteString(w, line.Out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func DeleteBuild(c *gin.Context) {
+	repo := session.Repo(c)
+
+	// parse the build number and job sequence number from
+	// the repquest parameter.
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
 	}
-	items, err := b.Build()
+	seq, _ := strconv.Atoi(c.Params.ByName("job"))
+
+	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		build.Status = model.StatusError
-		build.Started = time.Now().Unix()
-		build.Finished = build.Started
-		build.Error = err.Error()
-		store.UpdateBuild(c, build)
+		writeError(c, 404, errNotFound, "%s", err)
 		return
 	}
 
-	var pcounter = len(items)
-	for _, item := range items {
-		build.Procs = append(build.Procs, item.Proc)
-		item.Proc.BuildID = build.ID
+	proc, err := store.FromContext(c).ProcFind(build, seq)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
 
-		for _, stage := range item.Config.Stages {
-			var gid int
-			for _, step := range stage.Steps {
-				pcounter++
-				if gid == 0 {
-					gid = pcounter
-				}
-				proc := &model.Proc{
-					BuildID: build.ID,
-					Name:    step.Alias,
-					PID:     pcounter,
-					PPID:    item.Proc.PID,
-					PGID:    gid,
-					State:   model.StatusPending,
-				}
-				build.Procs = append(build.Procs, proc)
-			}
+	if proc.State != model.StatusRunning {
+		writeError(c, 400, errInvalidStatus, "Cannot cancel a non-running build")
+		return
+	}
+
+	procs, err := store.FromContext(c).ProcList(build)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	// kill the proc and cascade to all of its descendants
+	// so that child procs do not keep running.
+	stopped := time.Now().Unix()
+	for _, p := range append([]*model.Proc{proc}, descendants(procs, proc)...) {
+		if p != proc && !p.Running() {
+			continue
 		}
+		p.State = model.StatusKilled
+		p.Stopped = stopped
+		if p.Started == 0 {
+			p.Started = p.Stopped
+		}
+		p.ExitCode = 137
+		store.FromContext(c).ProcUpdate(p)
+
+		Config.Services.Queue.Error(context.Background(), fmt.Sprint(p.ID), queue.ErrCancel)
 	}
-	store.FromContext(c).ProcCreate(build.Procs)
+	writeAudit(c, repo, build, model.AuditCancel)
+	c.String(204, "")
 
-	//
-	// publish topic
-	//
-	buildCopy := *build
-	buildCopy.Procs = model.Tree(buildCopy.Procs)
+	procs, _ = store.FromContext(c).ProcList(build)
+	build.Procs = model.Tree(procs)
+	publishEvent(c, model.Cancelled, repo, build, proc)
+}
+
+// parseBuildNumber parses the build number path parameter. It writes
+// a 400 error response and returns false if the number is invalid.
+func parseBuildNumber(c *gin.Context) (int, bool) {
+	return parseBuildParam(c, "number")
+}
+
+// parseBuildParam parses the named build number path parameter.
+func parseBuildParam(c *gin.Context, name string) (int, bool) {
+	num, err := strconv.Atoi(c.Param(name))
+	if err != nil || num < 1 {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "invalid build number %q", c.Param(name))
+		return 0, false
+	}
+	return num, true
+}
+
+// descendants returns all procs descending from the parent proc.
+func descendants(procs []*model.Proc, parent *model.Proc) []*model.Proc {
+	var children []*model.Proc
+	for _, proc := range procs {
+		if proc.PPID == parent.PID && proc.PID != parent.PID {
+			children = append(children, proc)
+			children = append(children, descendants(procs, proc)...)
+		}
+	}
+	return children
+}
+
+// publishEvent publishes the build event to the events topic so
+// that subscribed clients can update without refreshing.
+func publishEvent(c context.Context, kind model.EventType, repo *model.Repo, build *model.Build, proc *model.Proc) {
+	event := model.Event{
+		Type:  kind,
+		Repo:  *repo,
+		Build: *build,
+	}
+	if proc != nil {
+		event.Proc = *proc
+	}
 	message := pubsub.Message{
 		Labels: map[string]string{
 			"repo":    repo.FullName,
 			"private": strconv.FormatBool(repo.IsPrivate),
 		},
 	}
-	message.Data, _ = json.Marshal(model.Event{
-		Type:  model.Enqueued,
-		Repo:  *repo,
-		Build: buildCopy,
-	})
+	message.Data, _ = json.Marshal(event)
 	// TODO remove global reference
 	Config.Services.Pubsub.Publish(c, "topic/events", message)
+}
 
-	//
-	// end publish topic
-	//
+// CancelBuild cancels a pending or running build, killing every
+// running proc and marking the build as killed.
+func CancelBuild(c *gin.Context) {
+	repo := session.Repo(c)
 
-	for _, item := range items {
-		task := new(queue.Task)
-		task.ID = fmt.Sprint(item.Proc.ID)
-		task.Labels = map[string]string{}
-		task.Labels["platform"] = item.Platform
-		for k, v := range item.Labels {
-			task.Labels[k] = v
-		}
-
-		task.Data, _ = json.Marshal(rpc.Pipeline{
-			ID:      fmt.Sprint(item.Proc.ID),
-			Config:  item.Config,
-			Timeout: b.Repo.Timeout,
-		})
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	if !build.CanCancel() {
+		writeError(c, 400, errInvalidStatus, "Cannot cancel a build with status %s", build.Status)
+		return
+	}
+
+	procs, err := store.FromContext(c).ProcList(build)
+	if err != nil {
+		writeError(c, 500, errStore, "error getting procs. %s", err)
+		return
+	}
+
+	// the procs and the build are updated together so that a failure
+	// does not leave killed procs in a running build.
+	now := time.Now().Unix()
+	var killed []*model.Proc
+	for _, proc := range procs {
+		if !proc.Running() {
+			continue
+		}
+		proc.State = model.StatusKilled
+		proc.ExitCode = 137
+		proc.Stopped = now
+		if proc.Started == 0 {
+			proc.Started = proc.Stopped
+		}
+		killed = append(killed, proc)
+	}
+
+	build.Status = model.StatusKilled
+	build.Held = false
+	build.Finished = now
+	if build.Started == 0 {
+		build.Started = build.Finished
+	}
+	if err := store.FromContext(c).UpdateBuildProcs(build, killed); err != nil {
+		writeError(c, 500, errStore, "error updating build. %s", err)
+		return
+	}
+	for _, proc := range killed {
+		Config.Services.Queue.Error(context.Background(), fmt.Sprint(proc.ID), queue.ErrCancel)
+	}
+	buildFinished(repo, build)
+
+	writeAudit(c, repo, build, model.AuditCancel)
+	c.String(204, "")
+
+	build.Procs = model.Tree(procs)
+	publishEvent(c, model.Cancelled, repo, build, nil)
 
-		Config.Services.Logs.Open(context.Background(), task.ID)
-		Config.Services.Queue.Push(context.Background(), task)
+	l := &launcher{
+		store:  store.FromContext(c),
+		remote: remote.FromContext(c),
+		link:   httputil.GetURL(c.Request),
 	}
+	l.release(repo)
 }
 
-func PostDecline(c *gin.Context) {
-	var (
-		remote_ = remote.FromContext(c)
-		repo    = session.Repo(c)
-		user    = session.User(c)
-		num, _  = strconv.Atoi(
-			c.Params.ByName("number"),
-		)
-	)
+// PostBuildCancelAll kills every pending and running build of the
+// repository, and returns the number of builds and procs killed. This
+// can only be invoked by repository administrators.
+func PostBuildCancelAll(c *gin.Context) {
+	repo := session.Repo(c)
+	user := session.User(c)
+
+	builds, err := store.FromContext(c).GetBuildActiveList(repo)
+	if err != nil {
+		writeError(c, 500, errStore, "Error getting active builds. %s", err)
+		return
+	}
+
+	var killed int
+	for _, build := range builds {
+		procs, err := store.FromContext(c).ProcList(build)
+		if err != nil {
+			logrus.Errorf("error: cannot list procs of %s#%d: %s", repo.FullName, build.Number, err)
+			continue
+		}
+		for _, proc := range procs {
+			if proc.Running() {
+				killed++
+			}
+		}
+
+		build.Error = fmt.Sprintf("force-cancelled by %s", user.Login)
+		killBuild(store.FromContext(c), repo, build, procs)
+		writeAudit(c, repo, build, model.AuditCancelAll)
+
+		build.Procs = model.Tree(procs)
+		publishEvent(c, model.Cancelled, repo, build, nil)
+
+		uri := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, build.Number)
+		if err := remote.FromContext(c).Status(user, repo, build, uri); err != nil {
+			logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
+		}
+	}
+
+	l := &launcher{
+		store:  store.FromContext(c),
+		remote: remote.FromContext(c),
+		link:   httputil.GetURL(c.Request),
+	}
+	l.release(repo)
+
+	c.JSON(200, gin.H{
+		"builds": len(builds),
+		"procs":  killed,
+	})
+}
+
+// ZombieKill kills zombie processes stuck in an infinite pending
+// or running state. This can only be invoked by administrators and
+// may have negative effects.
+func ZombieKill(c *gin.Context) {
+	repo := session.Repo(c)
+	user := session.User(c)
+
+	// parse the build number and job sequence number from
+	// the repquest parameter.
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	procs, err := store.FromContext(c).ProcList(build)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	if build.Status != model.StatusRunning {
+		writeError(c, 400, errInvalidStatus, "Cannot force cancel a non-running build")
+		return
+	}
+
+	build.Error = fmt.Sprintf("force-cancelled by %s", user.Login)
+	killBuild(store.FromContext(c), repo, build, procs)
+
+	writeAudit(c, repo, build, model.AuditKill)
+	c.String(204, "")
+
+	build.Procs = model.Tree(procs)
+	publishEvent(c, model.Cancelled, repo, build, nil)
+
+	uri := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, build.Number)
+	if err := remote.FromContext(c).Status(user, repo, build, uri); err != nil {
+		logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
+	}
+
+	l := &launcher{
+		store:  store.FromContext(c),
+		remote: remote.FromContext(c),
+		link:   httputil.GetURL(c.Request),
+	}
+	l.release(repo)
+}
+
+// killBuild marks the running procs of the build as killed with exit
+// code 137, releases them from the queue and marks the build as killed.
+func killBuild(s store.Store, repo *model.Repo, build *model.Build, procs []*model.Proc) {
+	for _, proc := range procs {
+		// pending procs are killed as well, otherwise children that
+		// never started would keep the build from completing.
+		if proc.Running() {
+			proc.State = model.StatusKilled
+			proc.ExitCode = 137
+			proc.Stopped = time.Now().Unix()
+			if proc.Started == 0 {
+				proc.Started = proc.Stopped
+			}
+		}
+	}
+
+	for _, proc := range procs {
+		s.ProcUpdate(proc)
+		Config.Services.Queue.Error(context.Background(), fmt.Sprint(proc.ID), queue.ErrCancel)
+	}
+
+	build.Status = model.StatusKilled
+	build.Held = false
+	build.Finished = time.Now().Unix()
+	s.UpdateBuild(build)
+	buildFinished(repo, build)
+}
+
+// dryrunPipeline is a compiled pipeline of a dry run. Only the names
+// and images of the steps are included, since the compiled steps hold
+// secrets and credentials.
+type dryrunPipeline struct {
+	PID      int               `json:"pid"`
+	Name     string            `json:"name"`
+	Platform string            `json:"platform"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Stages   []*dryrunStage    `json:"stages"`
+}
+
+type dryrunStage struct {
+	Name  string        `json:"name"`
+	Steps []*dryrunStep `json:"steps"`
+}
+
+type dryrunStep struct {
+	Name      string `json:"name"`
+	Image     string `json:"image"`
+	Detached  bool   `json:"detach,omitempty"`
+	OnSuccess bool   `json:"on_success,omitempty"`
+	OnFailure bool   `json:"on_failure,omitempty"`
+}
+
+// PostBuildDryRun compiles the build configuration and returns the
+// pipelines and proc tree of the build, without creating the procs or
+// queueing the build. The configuration of the build is compiled unless
+// a configuration is given in the request body.
+func PostBuildDryRun(c *gin.Context) {
+	repo := session.Repo(c)
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+	user, err := store.GetUser(c, repo.UserID)
+	if err != nil {
+		logrus.Errorf("failure to find repo owner %s. %s", repo.FullName, err)
+		writeError(c, 500, errStore, "%s", err)
+		return
+	}
+
+	data, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		writeError(c, 400, errInvalidBody, "Error reading request body. %s", err)
+		return
+	}
+	confs := []*model.Config{{Data: string(data)}}
+	if len(bytes.TrimSpace(data)) == 0 {
+		confs, err = buildConfigs(store.FromContext(c), build)
+		if err != nil {
+			logrus.Errorf("failure to get build config for %s. %s", repo.FullName, err)
+			writeError(c, 404, errNotFound, "%s", err)
+			return
+		}
+	}
+	params, err := store.FromContext(c).BuildParamsFind(build.ID)
+	if err != nil {
+		logrus.Errorf("failure to get build params for %s#%d. %s", repo.FullName, num, err)
+		writeError(c, 500, errStore, "%s", err)
+		return
+	}
+
+	l := &launcher{
+		store:  store.FromContext(c),
+		remote: remote.FromContext(c),
+		link:   httputil.GetURL(c.Request),
+	}
+	dry := *build
+	dry.Procs = nil
+	items, err := l.compile(repo, user, &dry, confs, params)
+	if err != nil {
+		writeError(c, 400, errInvalidBody, "Error compiling the build configuration. %s", err)
+		return
+	}
+	buildProcs(&dry, items)
+
+	pipelines := make([]*dryrunPipeline, 0, len(items))
+	for _, item := range items {
+		pipeline := &dryrunPipeline{
+			PID:      item.Proc.PID,
+			Name:     item.Proc.Name,
+			Platform: item.Platform,
+			Labels:   item.Labels,
+		}
+		for _, stage := range item.Config.Stages {
+			out := &dryrunStage{Name: stage.Alias}
+			for _, step := range stage.Steps {
+				out.Steps = append(out.Steps, &dryrunStep{
+					Name:      step.Alias,
+					Image:     step.Image,
+					Detached:  step.Detached,
+					OnSuccess: step.OnSuccess,
+					OnFailure: step.OnFailure,
+				})
+			}
+			pipeline.Stages = append(pipeline.Stages, out)
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+
+	c.JSON(200, gin.H{
+		"pipelines": pipelines,
+		"procs":     model.Tree(dry.Procs),
+	})
+}
+
+// PostProcRequeue pushes the queue task of a pending pipeline whose
+// task was lost, without restarting the build. This can only be
+// invoked by administrators.
+func PostProcRequeue(c *gin.Context) {
+	repo := session.Repo(c)
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeError(c, 400, errInvalidParam, "Invalid proc number %q", c.Param("pid"))
+		return
+	}
+
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+	proc, err := store.FromContext(c).ProcFind(build, pid)
+	if err != nil {
+		writeError(c, 404, errNotFound, "Cannot find proc %d. %s", pid, err)
+		return
+	}
+	if proc.PPID != 0 {
+		writeError(c, 400, errInvalidParam, "Cannot requeue step %d, requeue its pipeline instead", pid)
+		return
+	}
+	if proc.State != model.StatusPending {
+		writeError(c, 409, errInvalidStatus, "Cannot requeue a proc with status %s", proc.State)
+		return
+	}
+	if activeTasks()[fmt.Sprint(proc.ID)] {
+		writeError(c, 409, errInvalidStatus, "Cannot requeue proc %d, its task is still queued", pid)
+		return
+	}
+
+	user, err := store.GetUser(c, repo.UserID)
+	if err != nil {
+		logrus.Errorf("failure to find repo owner %s. %s", repo.FullName, err)
+		writeError(c, 500, errStore, "%s", err)
+		return
+	}
+	confs, err := buildConfigs(store.FromContext(c), build)
+	if err != nil {
+		logrus.Errorf("failure to get build config for %s. %s", repo.FullName, err)
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+	params, err := store.FromContext(c).BuildParamsFind(build.ID)
+	if err != nil {
+		logrus.Errorf("failure to get build params for %s#%d. %s", repo.FullName, num, err)
+		writeError(c, 500, errStore, "%s", err)
+		return
+	}
+
+	l := &launcher{
+		store:  store.FromContext(c),
+		remote: remote.FromContext(c),
+		link:   httputil.GetURL(c.Request),
+	}
+	items, err := l.compile(repo, user, build, confs, params)
+	if err != nil {
+		writeError(c, 500, errInvalidConfig, "%s", err)
+		return
+	}
+	for _, item := range items {
+		if item.Proc.PID == proc.PID {
+			item.Proc = proc
+			if err := pushItem(repo, item); err != nil {
+				logrus.Errorf("cannot requeue %s#%d: %s", repo.FullName, build.Number, err)
+				writeError(c, 500, errStore, "%s", err)
+				return
+			}
+			c.JSON(200, proc)
+			return
+		}
+	}
+	writeError(c, 404, errNotFound, "Cannot find pipeline %d in the build configuration", pid)
+}
+
+func PostApproval(c *gin.Context) {
+	var (
+		repo = session.Repo(c)
+		user = session.User(c)
+	)
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+	if !canReview(c, repo, user) {
+		return
+	}
+
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	// a single gated pipeline can be approved while the rest of the
+	// build is still running.
+	var gated *model.Proc
+	if c.Query("proc") != "" {
+		if gated, ok = gatedProc(c, build); !ok {
+			return
+		}
+	} else if build.Status != model.StatusBlocked {
+		writeError(c, 409, errInvalidStatus, "cannot approve a build with status %s", build.Status)
+		return
+	}
+	if build.BlockReason != "" && !isAdmin(c, user) {
+		writeError(c, http.StatusForbidden, errForbidden, "%s", build.BlockReason)
+		return
+	}
+
+	// fetch the build file from the database
+	confs, err := buildConfigs(store.FromContext(c), build)
+	if err != nil {
+		logrus.Errorf("failure to get build config for %s. %s", repo.FullName, err)
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	params, err := store.FromContext(c).BuildParamsFind(build.ID)
+	if err != nil {
+		logrus.Errorf("failure to get build params for %s#%d. %s", repo.FullName, num, err)
+		writeError(c, 500, errStore, "%s", err)
+		return
+	}
+
+	// Read query string parameters into the build params, exclude reserved
+	// params. The build is approved with the stored params otherwise.
+	overrides := queryParams(c, "proc")
+	if !checkParams(c, repo, overrides) {
+		return
+	}
+	for key, val := range overrides {
+		params[key] = val
+	}
+	if len(overrides) != 0 {
+		err = store.FromContext(c).BuildParamsSave(build.ID, params)
+		if err != nil {
+			logrus.Errorf("failure to save build params for %s#%d. %s", repo.FullName, build.Number, err)
+		}
+	}
+
+	if gated != nil {
+		err = approveProcs(c, repo, user, build, confs, params, []*model.Proc{gated})
+	} else {
+		err = approveBuild(c, repo, user, build, confs, params)
+	}
+	if err != nil {
+		writeError(c, 500, errInternal, "Cannot approve build %d. %s", build.Number, err)
+		return
+	}
+	c.JSON(200, build)
+}
+
+// isAdmin returns true if the user is a system admin or an admin of
+// the repository.
+func isAdmin(c *gin.Context, user *model.User) bool {
+	if user != nil && user.Admin {
+		return true
+	}
+	perm := session.Perm(c)
+	return perm != nil && perm.Admin
+}
+
+// canReview returns true if the user may approve and decline builds of
+// the repository. The repository can require approvers to be admins of
+// the repository, or to be listed as approvers by login or by team. It
+// writes a forbidden error response and returns false otherwise.
+func canReview(c *gin.Context, repo *model.Repo, user *model.User) bool {
+	if user.Admin {
+		return true
+	}
+	if repo.ApproveAdmin {
+		if perm := session.Perm(c); perm == nil || !perm.Admin {
+			writeError(c, http.StatusForbidden, errForbidden, "%s requires builds to be reviewed by an admin", repo.FullName)
+			return false
+		}
+	}
+	if len(repo.Approvers) == 0 {
+		return true
+	}
+	approvers := map[string]bool{}
+	for _, approver := range repo.Approvers {
+		approvers[approver] = true
+	}
+	if approvers[user.Login] {
+		return true
+	}
+	teams, err := remote.Teams(c, user)
+	if err != nil {
+		logrus.Debugf("cannot get teams of %s. %s", user.Login, err)
+	}
+	for _, team := range teams {
+		if approvers[team.Login] {
+			return true
+		}
+	}
+	writeError(c, http.StatusForbidden, errForbidden, "%s is not an approver of %s", user.Login, repo.FullName)
+	return false
+}
+
+// gatedProc returns the gated pipeline with the pid given in the proc
+// query parameter. It writes an error response and returns false if
+// the pipeline does not exist or is not waiting for approval.
+func gatedProc(c *gin.Context, build *model.Build) (*model.Proc, bool) {
+	pid, err := strconv.Atoi(c.Query("proc"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "invalid proc %q", c.Query("proc"))
+		return nil, false
+	}
+	proc, err := store.FromContext(c).ProcFind(build, pid)
+	if err != nil {
+		writeError(c, http.StatusNotFound, errNotFound, "cannot find proc %d. %s", pid, err)
+		return nil, false
+	}
+	if proc.PPID != 0 || proc.State != model.StatusGated {
+		writeError(c, 409, errInvalidStatus, "cannot review a proc with status %s", proc.State)
+		return nil, false
+	}
+	return proc, true
+}
+
+// approveBuild approves the blocked build on behalf of the user and
+// starts it with the build params. If the build is blocked by gated
+// pipelines, only those pipelines are started.
+func approveBuild(c *gin.Context, repo *model.Repo, user *model.User, build *model.Build, confs []*model.Config, params map[string]string) error {
+	procs, err := store.FromContext(c).ProcList(build)
+	if err != nil {
+		return err
+	}
+	if gated := model.Gated(procs); len(gated) != 0 {
+		return approveProcs(c, repo, user, build, confs, params, gated)
+	}
+
+	build.Status = model.StatusPending
+	build.Reviewed = time.Now().Unix()
+	build.Reviewer = user.Login
+
+	if err := store.UpdateBuild(c, build); err != nil {
+		return err
+	}
+	writeAudit(c, repo, build, model.AuditApprove)
+
+	defer func() {
+		uri := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, build.Number)
+		err := remote.FromContext(c).Status(user, repo, build, uri)
+		if err != nil {
+			logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
+		}
+	}()
+
+	return startBuild(c, repo, user, build, confs, params, nil)
+}
+
+// approveProcs approves the gated pipelines on behalf of the user and
+// pushes them onto the queue. The pipelines are compiled again from
+// the build configuration since they were not queued when the build
+// was created.
+func approveProcs(c *gin.Context, repo *model.Repo, user *model.User, build *model.Build, confs []*model.Config, params map[string]string, gated []*model.Proc) error {
+	l := &launcher{
+		store:  store.FromContext(c),
+		remote: remote.FromContext(c),
+		link:   httputil.GetURL(c.Request),
+	}
+	items, err := l.compile(repo, user, build, confs, params)
+	if err != nil {
+		return err
+	}
+	compiled := map[int]*buildItem{}
+	for _, item := range items {
+		compiled[item.Proc.PID] = item
+	}
+
+	for _, proc := range gated {
+		item, ok := compiled[proc.PID]
+		if !ok {
+			return fmt.Errorf("cannot find pipeline %d in the build configuration", proc.PID)
+		}
+		proc.State = model.StatusPending
+		if err := l.store.ProcUpdate(proc); err != nil {
+			return err
+		}
+		item.Proc = proc
+		if err := pushItem(repo, item); err != nil {
+			failProcs(l.store, gated, err)
+			return l.fail(repo, build, err)
+		}
+	}
+
+	if build.Status == model.StatusBlocked {
+		build.Status = model.StatusPending
+	}
+	build.Reviewed = time.Now().Unix()
+	build.Reviewer = user.Login
+	if err := l.store.UpdateBuild(build); err != nil {
+		return err
+	}
+	writeAudit(c, repo, build, model.AuditApprove)
+
+	procs, _ := l.store.ProcList(build)
+	build.Procs = model.Tree(procs)
+	publishEvent(c, model.Enqueued, repo, build, nil)
+
+	uri := fmt.Sprintf("%s/%s/%d", l.link, repo.FullName, build.Number)
+	if err := l.remote.Status(user, repo, build, uri); err != nil {
+		logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
+	}
+	return nil
+}
+
+// declineProcs declines the gated pipelines and their steps, keeping
+// the state of the other pipelines, and finishes the build if no
+// pipeline is left to run.
+func declineProcs(c *gin.Context, build *model.Build, gated []*model.Proc) error {
+	s := store.FromContext(c)
+	procs, err := s.ProcList(build)
+	if err != nil {
+		return err
+	}
+	declined := map[int]bool{}
+	for _, proc := range gated {
+		declined[proc.PID] = true
+	}
+	for _, proc := range procs {
+		if !declined[proc.PID] && !declined[proc.PPID] {
+			continue
+		}
+		proc.State = model.StatusDeclined
+		if err := s.ProcUpdate(proc); err != nil {
+			return err
+		}
+	}
+	if status, done := procsStatus(procs); done {
+		build.Status = status
+		if status != model.StatusBlocked {
+			build.Finished = time.Now().Unix()
+		}
+	}
+	build.Procs = model.Tree(procs)
+	return nil
+}
+
+// PostApprovalList approves the blocked builds in the request body. The
+// builds are approved independently and the response lists the result
+// for each build.
+func PostApprovalList(c *gin.Context) {
+	var (
+		repo = session.Repo(c)
+		user = session.User(c)
+	)
+
+	if !canReview(c, repo, user) {
+		return
+	}
+
+	in := struct {
+		Builds []int `json:"builds"`
+	}{}
+	if err := c.Bind(&in); err != nil {
+		writeError(c, http.StatusBadRequest, errInvalidBody, "Error parsing request body. %s", err)
+		return
+	}
+
+	type result struct {
+		Number int    `json:"number"`
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+	out := make([]*result, 0, len(in.Builds))
+	for _, num := range in.Builds {
+		res := &result{Number: num}
+		out = append(out, res)
+
+		build, err := store.GetBuildNumber(c, repo, num)
+		if err != nil {
+			res.Error = fmt.Sprintf("cannot find build. %s", err)
+			continue
+		}
+		res.Status = build.Status
+		if build.Status != model.StatusBlocked {
+			res.Error = fmt.Sprintf("cannot approve a build with status %s", build.Status)
+			continue
+		}
+		if build.BlockReason != "" && !isAdmin(c, user) {
+			res.Error = build.BlockReason
+			continue
+		}
+		confs, err := buildConfigs(store.FromContext(c), build)
+		if err != nil {
+			res.Error = fmt.Sprintf("cannot find build config. %s", err)
+			continue
+		}
+		params, err := store.FromContext(c).BuildParamsFind(build.ID)
+		if err != nil {
+			res.Error = fmt.Sprintf("cannot find build params. %s", err)
+			continue
+		}
+		err = approveBuild(c, repo, user, build, confs, params)
+		res.Status = build.Status
+		if err != nil {
+			res.Error = err.Error()
+		}
+	}
+	c.JSON(200, out)
+}
+
+func PostDecline(c *gin.Context) {
+	var (
+		remote_ = remote.FromContext(c)
+		repo    = session.Repo(c)
+		user    = session.User(c)
+	)
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+	if !canReview(c, repo, user) {
+		return
+	}
+
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	// a single gated pipeline can be declined while the rest of the
+	// build is still running.
+	var gated []*model.Proc
+	if c.Query("proc") != "" {
+		proc, ok := gatedProc(c, build)
+		if !ok {
+			return
+		}
+		gated = append(gated, proc)
+	} else if build.Status != model.StatusBlocked {
+		writeError(c, 409, errInvalidStatus, "cannot decline a build with status %s", build.Status)
+		return
+	} else {
+		procs, err := store.FromContext(c).ProcList(build)
+		if err != nil {
+			writeError(c, 500, errStore, "Error getting procs for build %d. %s", num, err)
+			return
+		}
+		gated = model.Gated(procs)
+	}
+
+	// the reason is optional and can be provided in the query
+	// string or in the json request body.
+	in := struct {
+		Reason string `json:"reason"`
+	}{
+		Reason: c.Query("reason"),
+	}
+	if c.Request.Body != nil {
+		if err := json.NewDecoder(c.Request.Body).Decode(&in); err != nil && err != io.EOF {
+			writeError(c, 400, errInvalidBody, "Error parsing request body. %s", err)
+			return
+		}
+	}
+
+	if len(gated) != 0 {
+		if err := declineProcs(c, build, gated); err != nil {
+			writeError(c, 500, errStore, "error declining procs. %s", err)
+			return
+		}
+	} else {
+		build.Status = model.StatusDeclined
+		build.Finished = time.Now().Unix()
+	}
+	build.Reviewed = time.Now().Unix()
+	build.Reviewer = user.Login
+	build.DeclineReason = in.Reason
+	build.Trim()
+
+	err = store.UpdateBuild(c, build)
+	if err != nil {
+		writeError(c, 500, errStore, "error updating build. %s", err)
+		return
+	}
+	if build.Finished != 0 {
+		buildFinished(repo, build)
+	}
+	writeAudit(c, repo, build, model.AuditDecline)
+
+	uri := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, build.Number)
+	err = remote_.Status(user, repo, build, uri)
+	if err != nil {
+		logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
+	}
+
+	c.JSON(200, build)
+
+	// a declined build no longer counts towards the build concurrency
+	// limit of the repository.
+	if build.Finished != 0 {
+		l := &launcher{
+			store:  store.FromContext(c),
+			remote: remote_,
+			link:   httputil.GetURL(c.Request),
+		}
+		l.release(repo)
+	}
+}
+
+// queueDurationSamples is the number of recently finished pipelines
+// used to estimate when queued builds start.
+const queueDurationSamples = 50
+
+// queuedBuild is a build in the queue with its position in line and
+// the estimated time it starts. Running builds have position 0.
+type queuedBuild struct {
+	*model.Feed
+	Position  int   `json:"position"`
+	Estimated int64 `json:"estimated_start_at,omitempty"`
+}
+
+// GetBuildQueue gets the pending and running builds of all repositories.
+// Pending builds are ordered by creation time, and include an estimated
+// start time based on the recent average pipeline duration and the
+// number of agents. The builds can be filtered by repository with
+// ?repo=owner/name, and by task label with ?label=key:value.
+func GetBuildQueue(c *gin.Context) {
+	labels := map[string]string{}
+	for _, label := range c.Request.URL.Query()["label"] {
+		parts := strings.SplitN(label, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			writeError(c, 400, errInvalidParam, "Invalid label %q. Must be in the format key:value", label)
+			return
+		}
+		labels[parts[0]] = parts[1]
+	}
+
+	feed, err := store.GetBuildQueue(c)
+	if err != nil {
+		writeError(c, 500, errStore, "Error getting build queue. %s", err)
+		return
+	}
+	// a single snapshot of the queue is used for the labels and the
+	// number of agents, so that they agree with each other.
+	info := Config.Services.Queue.Info(c)
+	if repo := c.Query("repo"); repo != "" {
+		feed = filterFeed(feed, func(item *model.Feed) bool {
+			return item.FullName == repo
+		})
+	}
+	if len(labels) != 0 {
+		builds := labeledBuilds(store.FromContext(c), info, labels)
+		feed = filterFeed(feed, func(item *model.Feed) bool {
+			return builds[item.BuildID]
+		})
+	}
+	avg, err := store.FromContext(c).ProcAverageDuration(queueDurationSamples)
+	if err != nil {
+		logrus.Debugf("cannot get the average pipeline duration. %s", err)
+	}
+
+	var running, pending []*queuedBuild
+	for _, item := range feed {
+		if item.Status == model.StatusRunning {
+			running = append(running, &queuedBuild{Feed: item, Estimated: item.Started})
+		} else {
+			pending = append(pending, &queuedBuild{Feed: item})
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Created < pending[j].Created
+	})
+
+	estimateStart(pending, running, info.Stats.Workers+info.Stats.Running, avg, time.Now().Unix())
+	out := make([]*queuedBuild, 0, len(feed))
+	out = append(out, running...)
+	out = append(out, pending...)
+	c.JSON(200, out)
+}
+
+// estimateStart sets the position and the estimated start time of the
+// pending builds. A build starts on the first slot that frees up,
+// assuming every build takes the average duration. The running builds
+// free their slot once they have run for the average duration.
+func estimateStart(pending, running []*queuedBuild, slots int, avg, now int64) {
+	for i, item := range pending {
+		item.Position = i + 1
+	}
+	if avg == 0 || slots == 0 {
+		return
+	}
+
+	free := make([]int64, slots)
+	for i := range free {
+		free[i] = now
+	}
+	next := func() int {
+		min := 0
+		for i := range free {
+			if free[i] < free[min] {
+				min = i
+			}
+		}
+		return min
+	}
+	for _, item := range running {
+		i := next()
+		if done := item.Started + avg; done > free[i] {
+			free[i] = done
+		}
+	}
+	for _, item := range pending {
+		i := next()
+		item.Estimated = free[i]
+		free[i] += avg
+	}
+}
+
+// filterFeed returns the feed items matching the filter.
+func filterFeed(feed []*model.Feed, match func(*model.Feed) bool) []*model.Feed {
+	out := feed[:0]
+	for _, item := range feed {
+		if match(item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// labeledBuilds returns the identifiers of the builds with a pending or
+// running task that has all the labels.
+func labeledBuilds(s store.Store, info queue.InfoT, labels map[string]string) map[int64]bool {
+	builds := map[int64]bool{}
+	var tasks []*queue.Task
+	tasks = append(tasks, info.Pending...)
+	tasks = append(tasks, info.Running...)
+	for _, task := range tasks {
+		if !matchLabels(task.Labels, labels) {
+			continue
+		}
+		id, err := strconv.ParseInt(task.ID, 10, 64)
+		if err != nil {
+			continue
+		}
+		proc, err := s.ProcLoad(id)
+		if err != nil {
+			logrus.Debugf("cannot find proc of queued task %s. %s", task.ID, err)
+			continue
+		}
+		builds[proc.BuildID] = true
+	}
+	return builds
+}
+
+func matchLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// GetRecentBuilds gets the most recent builds of all repositories,
+// optionally filtered by status and by the before and after creation
+// timestamps.
+func GetRecentBuilds(c *gin.Context) {
+	status := c.Query("status")
+	if err := (&model.BuildFilter{Status: status}).Validate(); err != nil {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "%s", err)
+		return
+	}
+	after, ok := parseTimestamp(c, "after")
+	if !ok {
+		return
+	}
+	before, ok := parseTimestamp(c, "before")
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPerPage)))
+	if err != nil || limit < 1 || limit > maxPerPage {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "Invalid limit. Must be between 1 and %d", maxPerPage)
+		return
+	}
+
+	feed, err := store.FromContext(c).GetBuildRecent(status, after, before, limit)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, errStore, "Error getting recent builds. %s", err)
+		return
+	}
+	c.JSON(http.StatusOK, feed)
+}
+
+// parseTimestamp parses the optional unix timestamp query parameter. It
+// writes a 400 error response and returns false if the value is invalid.
+func parseTimestamp(c *gin.Context, name string) (int64, bool) {
+	param := c.Query(name)
+	if param == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || n < 0 {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "Invalid %s. Must be a unix timestamp", name)
+		return 0, false
+	}
+	return n, true
+}
+
+// GetRunningBuilds gets the running builds of all repositories and
+// writes to the response in json format, including how long each
+// build has been running in seconds.
+func GetRunningBuilds(c *gin.Context) {
+	feed, err := store.FromContext(c).GetBuildRunning()
+	if err != nil {
+		writeError(c, 500, errStore, "Error getting running builds. %s", err)
+		return
+	}
+	type runningBuild struct {
+		*model.Feed
+		Elapsed int64 `json:"elapsed"`
+	}
+	now := time.Now().Unix()
+	out := make([]*runningBuild, 0, len(feed))
+	for _, item := range feed {
+		out = append(out, &runningBuild{
+			Feed:    item,
+			Elapsed: now - item.Started,
+		})
+	}
+	c.JSON(200, out)
+}
+
+//
+//
+//
+//
+//
+//
+
+func PostBuild(c *gin.Context) {
+	remote_ := remote.FromContext(c)
+	repo := session.Repo(c)
+
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+
+	user, err := store.GetUser(c, repo.UserID)
+	if err != nil {
+		logrus.Errorf("failure to find repo owner %s. %s", repo.FullName, err)
+		writeError(c, 500, errStore, "%s", err)
+		return
+	}
+
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		logrus.Errorf("failure to get build %d. %s", num, err)
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	// only finished builds can be restarted. Pending and running builds
+	// must be cancelled first, and blocked or declined builds must be
+	// reviewed instead.
+	switch {
+	case build.CanRestart():
+	case build.CanCancel():
+		writeError(c, 409, errInvalidStatus, "cannot restart a build with status %s, cancel the build first", build.Status)
+		return
+	default:
+		writeError(c, 409, errInvalidStatus, "cannot restart a build with status %s", build.Status)
+		return
+	}
+
+	// an exact restart re-runs the build with the stored event, deploy
+	// target and parameters, ignoring any overrides in the query string.
+	// A failed restart only re-runs the failed pipelines, and is also
+	// accepted as ?failed=true.
+	var exact bool
+	failedOnly, _ := strconv.ParseBool(c.Query("failed"))
+	switch mode := c.Query("mode"); mode {
+	case "", "override":
+	case "exact":
+		exact = true
+	case "failed":
+		failedOnly = true
+	default:
+		writeError(c, 400, errInvalidParam, "invalid restart mode %q", mode)
+		return
+	}
+
+	// a reproduction is an exact restart that also requires the stored
+	// configuration. Any other query string parameter would change the
+	// build, so it is refused instead of ignored.
+	reproduce, _ := strconv.ParseBool(c.Query("reproduce"))
+	if reproduce {
+		for key := range c.Request.URL.Query() {
+			if key != "reproduce" {
+				writeError(c, 400, errInvalidParam, "cannot use parameter %q when reproducing a build", key)
+				return
+			}
+		}
+		exact = true
+	}
+
+	// Read query string parameters into overrides, exclude reserved params.
+	// An exact restart does not accept parameters from the query string.
+	overrides := map[string]string{}
+	if !exact {
+		overrides = queryParams(c, "fork", "event", "deploy_to", "failed", "mode", "refresh_config", "reproduce")
+	}
+	if !checkParams(c, repo, overrides) {
+		return
+	}
+	if !limitBuildRate(c, repo) {
+		return
+	}
+
+	// when restarting only the failed procs we need the procs of
+	// the previous build to carry over the ones that succeeded.
+	var prev []*model.Proc
+	if failedOnly {
+		prev, err = store.FromContext(c).ProcList(build)
+		if err != nil {
+			writeError(c, 500, errStore, "%s", err)
+			return
+		}
+		if !hasFailedProcs(prev) {
+			writeError(c, 400, errInvalidStatus, "cannot restart failed procs, build has no failed procs")
+			return
+		}
+	}
+
+	// if the remote has a refresh token, the current access token
+	// may be stale. Therefore, we should refresh prior to dispatching
+	// the job.
+	if refresher, ok := remote_.(remote.Refresher); ok {
+		ok, _ := refresher.Refresh(user)
+		if ok {
+			store.UpdateUser(c, user)
+		}
+	}
+
+	// fetch the .drone.yml file from the database. The file is fetched
+	// from the remote when it is missing, or when a refresh is requested.
+	// Every configuration file of a build created from a configuration
+	// directory is run again.
+	refresh, _ := strconv.ParseBool(c.Query("refresh_config"))
+	confs, err := buildConfigs(store.FromContext(c), build)
+	if err != nil && reproduce {
+		writeError(c, 404, errNotFound, "cannot reproduce build %d, its configuration is not available. %s", num, err)
+		return
+	}
+	if err != nil || refresh {
+		if err != nil {
+			logrus.Warnf("failure to get build config for %s, fetching from remote. %s", repo.FullName, err)
+		}
+		confs, err = fetchBuildConfigs(remote_, user, repo, build, refresh)
+		if err != nil {
+			logrus.Errorf("failure to fetch build config for %s. %s", repo.FullName, err)
+			writeError(c, 404, errNotFound, "%s", err)
+			return
+		}
+		build.ConfigID = confs[0].ID
+	}
+
+	// the custom parameters of the original build are carried over
+	// to the restarted build.
+	params, err := store.FromContext(c).BuildParamsFind(build.ID)
+	if err != nil {
+		logrus.Errorf("failure to get build params for %s#%d. %s", repo.FullName, num, err)
+		writeError(c, 500, errStore, "%s", err)
+		return
+	}
+
+	build.ID = 0
+	build.Number = 0
+	build.Parent = num
+	build.Status = model.StatusPending
+	build.Started = 0
+	build.Finished = 0
+	build.Enqueued = time.Now().UTC().Unix()
+	build.Error = ""
+	build.Reviewer = ""
+	build.Reviewed = 0
+	build.DeclineReason = ""
+	build.BlockReason = ""
+	build.Verified = false
+	build.Reproduction = reproduce
+	build.Trigger = model.TriggerRestart
+	build.Held = false
+
+	if !exact {
+		build.Deploy = c.DefaultQuery("deploy_to", build.Deploy)
+
+		event := c.DefaultQuery("event", build.Event)
+		if event == model.EventPush ||
+			event == model.EventPull ||
+			event == model.EventTag ||
+			event == model.EventDeploy {
+			if event != build.Event && !repo.AllowEvent(event) {
+				writeError(c, http.StatusForbidden, errForbidden, "Event %s not enabled for %s", event, repo.FullName)
+				return
+			}
+			build.Event = event
+		}
+	}
+	if reason := repo.Protected(build); reason != "" {
+		if perm := session.Perm(c); perm == nil || !perm.Admin {
+			build.Status = model.StatusBlocked
+			build.BlockReason = reason
+		}
+	}
+
+	err = store.CreateBuild(c, build)
+	if err != nil {
+		writeError(c, 500, errStore, "%s", err)
+		return
+	}
+
+	if err := saveBuildConfigs(store.FromContext(c), build, confs); err != nil {
+		logrus.Errorf("failure to save build configs for %s#%d. %s", repo.FullName, build.Number, err)
+	}
+
+	var buildParams = params
+	for key, val := range overrides {
+		buildParams[key] = val
+	}
+
+	if len(buildParams) != 0 {
+		err = store.FromContext(c).BuildParamsSave(build.ID, buildParams)
+		if err != nil {
+			logrus.Errorf("failure to save build params for %s#%d. %s", repo.FullName, build.Number, err)
+		}
+	}
+
+	if build.Status == model.StatusBlocked {
+		c.JSON(202, build)
+		return
+	}
+
+	if err := startBuild(c, repo, user, build, confs, buildParams, prev); err != nil {
+		logrus.Errorf("cannot restart %s#%d: %s", repo.FullName, build.Number, err)
+		writeError(c, 500, errInternal, "Cannot start build %d. %s", build.Number, err)
+		return
+	}
+	c.JSON(202, build)
+}
+
+// queryParams returns the query string parameters of the request as
+// build parameters, excluding the reserved parameters.
+func queryParams(c *gin.Context, reserved ...string) map[string]string {
+	skip := map[string]bool{}
+	for _, key := range reserved {
+		skip[key] = true
+	}
+	params := map[string]string{}
+	for key, val := range c.Request.URL.Query() {
+		if skip[key] {
+			continue
+		}
+		// We only accept string literals, because build parameters will be
+		// injected as environment variables
+		params[key] = val[0]
+	}
+	return params
+}
+
+// checkParams returns true if the repository permits the build
+// parameters. It writes a bad request error response naming the first
+// parameter that is not permitted and returns false otherwise.
+func checkParams(c *gin.Context, repo *model.Repo, params map[string]string) bool {
+	var keys []string
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !repo.ParamAllowed(key) {
+			writeError(c, http.StatusBadRequest, errInvalidParam, "build parameter %q is not permitted", key)
+			return false
+		}
+	}
+	return true
+}
+
+// PostPromote promotes a successful build to the target environment
+// in the request by creating and starting a new deployment build with
+// the source build as its parent.
+func PostPromote(c *gin.Context) {
+	remote_ := remote.FromContext(c)
+	repo := session.Repo(c)
+
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+
+	in := struct {
+		Target string            `json:"target"`
+		Params map[string]string `json:"params"`
+	}{
+		Target: c.Query("target"),
+	}
+	if c.Request.Body != nil {
+		if err := json.NewDecoder(c.Request.Body).Decode(&in); err != nil && err != io.EOF {
+			writeError(c, 400, errInvalidBody, "Error parsing request body. %s", err)
+			return
+		}
+	}
+	if in.Target == "" {
+		writeError(c, 400, errInvalidParam, "cannot promote a build without a target")
+		return
+	}
+	if !repo.AllowEvent(model.EventDeploy) {
+		writeError(c, http.StatusForbidden, errForbidden, "Event %s not enabled for %s", model.EventDeploy, repo.FullName)
+		return
+	}
+
+	// Read query string parameters into buildParams, exclude reserved params.
+	buildParams := map[string]string{}
+	for key, val := range in.Params {
+		buildParams[key] = val
+	}
+	for key, val := range queryParams(c, "target") {
+		buildParams[key] = val
+	}
+	if !checkParams(c, repo, buildParams) {
+		return
+	}
+	if !limitBuildRate(c, repo) {
+		return
+	}
 
 	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		c.AbortWithError(404, err)
+		logrus.Errorf("failure to get build %d. %s", num, err)
+		writeError(c, 404, errNotFound, "%s", err)
 		return
 	}
-	if build.Status != model.StatusBlocked {
-		c.String(500, "cannot decline a build with status %s", build.Status)
+	if build.Status != model.StatusSuccess {
+		writeError(c, 409, errInvalidStatus, "cannot promote a build with status %s", build.Status)
 		return
 	}
-	build.Status = model.StatusDeclined
-	build.Reviewed = time.Now().Unix()
-	build.Reviewer = user.Login
 
-	err = store.UpdateBuild(c, build)
+	user, err := store.GetUser(c, repo.UserID)
 	if err != nil {
-		c.String(500, "error updating build. %s", err)
+		logrus.Errorf("failure to find repo owner %s. %s", repo.FullName, err)
+		writeError(c, 500, errStore, "%s", err)
 		return
 	}
 
-	uri := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, build.Number)
-	err = remote_.Status(user, repo, build, uri)
+	// if the remote has a refresh token, the current access token
+	// may be stale. Therefore, we should refresh prior to dispatching
+	// the job.
+	if refresher, ok := remote_.(remote.Refresher); ok {
+		ok, _ := refresher.Refresh(user)
+		if ok {
+			store.UpdateUser(c, user)
+		}
+	}
+
+	confs, err := buildConfigs(store.FromContext(c), build)
 	if err != nil {
-		logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
+		logrus.Errorf("failure to get build config for %s. %s", repo.FullName, err)
+		writeError(c, 404, errNotFound, "%s", err)
+		return
 	}
 
-	c.JSON(200, build)
-}
+	build.ID = 0
+	build.Number = 0
+	build.Parent = num
+	build.Event = model.EventDeploy
+	build.Trigger = model.TriggerAPI
+	build.Deploy = in.Target
+	build.Status = model.StatusPending
+	build.Held = false
+	build.Started = 0
+	build.Finished = 0
+	build.Enqueued = time.Now().UTC().Unix()
+	build.Error = ""
+	build.Reviewer = ""
+	build.Reviewed = 0
+	build.DeclineReason = ""
+	build.BlockReason = ""
+	build.Verified = false
+	if sender := session.User(c); sender != nil {
+		build.Sender = sender.Login
+	}
+	if reason := repo.Protected(build); reason != "" {
+		if perm := session.Perm(c); perm == nil || !perm.Admin {
+			build.Status = model.StatusBlocked
+			build.BlockReason = reason
+		}
+	}
 
-func GetBuildQueue(c *gin.Context) {
-	out, err := store.GetBuildQueue(c)
-	if err != nil {
-		c.String(500, "Error getting build queue. %s", err)
+	if err := store.CreateBuild(c, build); err != nil {
+		writeError(c, 500, errStore, "%s", err)
 		return
 	}
-	c.JSON(200, out)
-}
 
-//
-//
-//
-//
-//
-//
+	if err := saveBuildConfigs(store.FromContext(c), build, confs); err != nil {
+		logrus.Errorf("failure to save build configs for %s#%d. %s", repo.FullName, build.Number, err)
+	}
 
-func PostBuild(c *gin.Context) {
+	if len(buildParams) != 0 {
+		err = store.FromContext(c).BuildParamsSave(build.ID, buildParams)
+		if err != nil {
+			logrus.Errorf("failure to save build params for %s#%d. %s", repo.FullName, build.Number, err)
+		}
+	}
+
+	if build.Status == model.StatusBlocked {
+		writeAudit(c, repo, build, model.AuditPromote)
+		c.JSON(202, build)
+		return
+	}
 
+	if err := startBuild(c, repo, user, build, confs, buildParams, nil); err != nil {
+		logrus.Errorf("cannot promote %s#%d: %s", repo.FullName, num, err)
+		writeError(c, 500, errInternal, "Cannot start build %d. %s", build.Number, err)
+		return
+	}
+
+	writeAudit(c, repo, build, model.AuditPromote)
+	publishEvent(c, model.Deployed, repo, build, nil)
+	c.JSON(202, build)
+}
+
+// TriggerBuild creates and starts a new build for the branch or ref,
+// and optionally the commit, in the request body. The commit defaults
+// to the head of the branch, resolved through the remote. The params in the
+// request body and the query string parameters are passed to the build
+// as environment variables.
+func TriggerBuild(c *gin.Context) {
 	remote_ := remote.FromContext(c)
 	repo := session.Repo(c)
 
-	num, err := strconv.Atoi(c.Param("number"))
-	if err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
+	in := struct {
+		Branch string            `json:"branch"`
+		Ref    string            `json:"ref"`
+		Commit string            `json:"commit"`
+		Params map[string]string `json:"params"`
+	}{
+		Branch: c.Query("branch"),
+		Ref:    c.Query("ref"),
+		Commit: c.Query("commit"),
+	}
+	if c.Request.Body != nil {
+		if err := json.NewDecoder(c.Request.Body).Decode(&in); err != nil && err != io.EOF {
+			writeError(c, 400, errInvalidBody, "Error parsing request body. %s", err)
+			return
+		}
+	}
+
+	// the ref allows building tags and other refs that are not
+	// branches. It defaults to the head of the branch, which defaults
+	// to the branch of the ref or the default branch.
+	if in.Ref != "" && !strings.HasPrefix(in.Ref, "refs/") {
+		writeError(c, 400, errInvalidParam, "invalid ref %q, must start with refs/", in.Ref)
 		return
 	}
+	if in.Branch == "" && strings.HasPrefix(in.Ref, "refs/heads/") {
+		in.Branch = strings.TrimPrefix(in.Ref, "refs/heads/")
+	}
+	if in.Branch == "" {
+		in.Branch = repo.Branch
+	}
+	if in.Ref == "" {
+		in.Ref = "refs/heads/" + in.Branch
+	}
 
-	user, err := store.GetUser(c, repo.UserID)
-	if err != nil {
-		logrus.Errorf("failure to find repo owner %s. %s", repo.FullName, err)
-		c.AbortWithError(500, err)
+	// the head commit can only be resolved for branches, the commit
+	// is required to build any other ref.
+	if in.Commit == "" && !strings.HasPrefix(in.Ref, "refs/heads/") {
+		writeError(c, 400, errInvalidParam, "A commit is required to build %s", in.Ref)
 		return
 	}
 
-	build, err := store.GetBuildNumber(c, repo, num)
-	if err != nil {
-		logrus.Errorf("failure to get build %d. %s", num, err)
-		c.AbortWithError(404, err)
+	// Read query string parameters into buildParams, exclude reserved params.
+	buildParams := map[string]string{}
+	for key, val := range in.Params {
+		buildParams[key] = val
+	}
+	for key, val := range queryParams(c, "branch", "ref", "commit") {
+		buildParams[key] = val
+	}
+	if !checkParams(c, repo, buildParams) {
 		return
 	}
 
-	switch build.Status {
-	case model.StatusDeclined,
-		model.StatusBlocked:
-		c.String(500, "cannot restart a build with status %s", build.Status)
+	// manual builds of a tag are permitted like tag events, and
+	// manual builds of any other ref like push events.
+	event := model.EventPush
+	if strings.HasPrefix(in.Ref, "refs/tags/") {
+		event = model.EventTag
+	}
+	if !repo.AllowEvent(event) {
+		writeError(c, http.StatusForbidden, errForbidden, "Event %s not enabled for %s", event, repo.FullName)
+		return
+	}
+
+	if !limitBuildRate(c, repo) {
+		return
+	}
+
+	user, err := store.GetUser(c, repo.UserID)
+	if err != nil {
+		logrus.Errorf("failure to find repo owner %s. %s", repo.FullName, err)
+		writeError(c, 500, errStore, "%s", err)
 		return
 	}
 
@@ -512,60 +2479,193 @@ func PostBuild(c *gin.Context) {
 		}
 	}
 
-	// fetch the .drone.yml file from the database
-	conf, err := Config.Storage.Config.ConfigLoad(build.ConfigID)
+	// the build is pinned to the commit at the head of the branch when
+	// no commit is given, so that the configuration, the clone and the
+	// commit status all refer to the same revision.
+	if in.Commit == "" {
+		if _, ok := remote_.(remote.BranchResolver); !ok {
+			writeError(c, 400, errInvalidParam, "A commit is required, the remote cannot resolve the head of branch %s", in.Branch)
+			return
+		}
+		in.Commit, err = remote.BranchHead(remote_, user, repo, in.Branch)
+		if err != nil {
+			logrus.Errorf("error: %s: cannot resolve the head of branch %s: %s", repo.FullName, in.Branch, err)
+			writeError(c, 404, errNotFound, "Error resolving the head of branch %s. %s", in.Branch, err)
+			return
+		}
+	}
+
+	files, err := fetchConfigFiles(remote_, user, repo, in.Commit, func(f string) ([]byte, error) {
+		return remote_.FileRef(user, repo, in.Commit, f)
+	})
 	if err != nil {
-		logrus.Errorf("failure to get build config for %s. %s", repo.FullName, err)
-		c.AbortWithError(404, err)
+		logrus.Errorf("error: %s: cannot find %s in %s: %s", repo.FullName, repo.Config, in.Commit, err)
+		writeError(c, 404, errNotFound, "Error getting %s for %s. %s", repo.Config, in.Commit, err)
 		return
 	}
-
-	netrc, err := remote_.Netrc(user, repo)
+	confs, err := persistConfigs(repo, files)
 	if err != nil {
-		logrus.Errorf("failure to generate netrc for %s. %s", repo.FullName, err)
-		c.AbortWithError(500, err)
+		logrus.Errorf("failure to find or persist build config for %s. %s", repo.FullName, err)
+		writeError(c, 500, errStore, "%s", err)
 		return
 	}
 
-	build.ID = 0
-	build.Number = 0
-	build.Parent = num
-	build.Status = model.StatusPending
-	build.Started = 0
-	build.Finished = 0
-	build.Enqueued = time.Now().UTC().Unix()
-	build.Error = ""
-	build.Deploy = c.DefaultQuery("deploy_to", build.Deploy)
+	sender := session.User(c)
+	build := &model.Build{
+		RepoID:    repo.ID,
+		ConfigID:  confs[0].ID,
+		Event:     model.EventManual,
+		Trigger:   model.TriggerAPI,
+		Status:    model.StatusPending,
+		Branch:    in.Branch,
+		Commit:    in.Commit,
+		Ref:       in.Ref,
+		Link:      repo.Link,
+		Message:   "Triggered by " + sender.Login,
+		Author:    sender.Login,
+		Avatar:    sender.Avatar,
+		Email:     sender.Email,
+		Sender:    sender.Login,
+		Timestamp: time.Now().Unix(),
+		Enqueued:  time.Now().UTC().Unix(),
+	}
+	if reason := repo.Protected(build); reason != "" {
+		if perm := session.Perm(c); perm == nil || !perm.Admin {
+			build.Status = model.StatusBlocked
+			build.BlockReason = reason
+		}
+	}
+	if err := store.CreateBuild(c, build); err != nil {
+		writeError(c, 500, errStore, "%s", err)
+		return
+	}
 
-	event := c.DefaultQuery("event", build.Event)
-	if event == model.EventPush ||
-		event == model.EventPull ||
-		event == model.EventTag ||
-		event == model.EventDeploy {
-		build.Event = event
+	if err := saveBuildConfigs(store.FromContext(c), build, confs); err != nil {
+		logrus.Errorf("failure to save build configs for %s#%d. %s", repo.FullName, build.Number, err)
 	}
 
-	err = store.CreateBuild(c, build)
-	if err != nil {
-		c.String(500, err.Error())
+	if len(buildParams) != 0 {
+		err = store.FromContext(c).BuildParamsSave(build.ID, buildParams)
+		if err != nil {
+			logrus.Errorf("failure to save build params for %s#%d. %s", repo.FullName, build.Number, err)
+		}
+	}
+
+	if build.Status == model.StatusBlocked {
+		c.JSON(202, build)
 		return
 	}
 
-	// Read query string parameters into buildParams, exclude reserved params
-	var buildParams = map[string]string{}
-	for key, val := range c.Request.URL.Query() {
-		switch key {
-		case "fork", "event", "deploy_to":
-		default:
-			// We only accept string literals, because build parameters will be
-			// injected as environment variables
-			buildParams[key] = val[0]
+	if err := startBuild(c, repo, user, build, confs, buildParams, nil); err != nil {
+		logrus.Errorf("cannot start %s#%d: %s", repo.FullName, build.Number, err)
+		writeError(c, 500, errInternal, "Cannot start build %d. %s", build.Number, err)
+		return
+	}
+	c.JSON(202, build)
+}
+
+// fetchBuildConfigs fetches the configuration files of the build from
+// the remote and stores them. The files are fetched at the commit of
+// the build, or at the head of the build branch when head is true.
+func fetchBuildConfigs(r remote.Remote, user *model.User, repo *model.Repo, build *model.Build, head bool) ([]*model.Config, error) {
+	ref := build.Commit
+	file := func(f string) ([]byte, error) {
+		return r.File(user, repo, build, f)
+	}
+	if head {
+		ref = "refs/heads/" + build.Branch
+		file = func(f string) ([]byte, error) {
+			return r.FileRef(user, repo, ref, f)
 		}
 	}
+	files, err := fetchConfigFiles(r, user, repo, ref, file)
+	if err != nil {
+		return nil, err
+	}
+	return persistConfigs(repo, files)
+}
+
+// startBuild compiles the build configuration, stores the resulting
+// procs and pushes the pipelines onto the queue. The build parameters
+// are merged with the environment of the repository and the global
+// environment, see buildEnviron. If prev
+// is not empty, the procs that did not fail in prev are carried over
+// and only the failed pipelines are enqueued. On failure the build is
+// updated with the error before it is returned.
+func startBuild(c *gin.Context, repo *model.Repo, user *model.User, build *model.Build, confs []*model.Config, params map[string]string, prev []*model.Proc) error {
+	l := &launcher{
+		store:  store.FromContext(c),
+		remote: remote.FromContext(c),
+		link:   httputil.GetURL(c.Request),
+	}
+	return l.start(repo, user, build, confs, params, prev)
+}
+
+// launcher starts builds outside of the request that triggered them,
+// such as scheduled builds.
+type launcher struct {
+	store  store.Store
+	remote remote.Remote
+	link   string
+}
+
+// start starts the build, unless it is held back by the build
+// concurrency limit of the repository. See startBuild.
+func (l *launcher) start(repo *model.Repo, user *model.User, build *model.Build, confs []*model.Config, params map[string]string, prev []*model.Proc) error {
+	held, err := holdBuild(l.store, repo, build)
+	if err != nil {
+		logrus.Errorf("cannot check the build concurrency of %s. %s", repo.FullName, err)
+	}
+	if held {
+		return nil
+	}
+	return l.launch(repo, user, build, confs, params, prev)
+}
+
+// launch compiles and dispatches the build.
+func (l *launcher) launch(repo *model.Repo, user *model.User, build *model.Build, confs []*model.Config, params map[string]string, prev []*model.Proc) error {
+	items, err := l.compile(repo, user, build, confs, params)
+	if err != nil {
+		return l.fail(repo, build, err)
+	}
+
+	buildProcs(build, items)
+
+	if len(prev) != 0 {
+		items = carryOverProcs(items, build.Procs, prev)
+	}
+
+	if err := dispatchBuild(context.Background(), l.store, repo, build, items); err != nil {
+		return l.fail(repo, build, err)
+	}
+	return nil
+}
+
+// fail updates the build with the error that prevented it from being
+// started, and returns the error.
+func (l *launcher) fail(repo *model.Repo, build *model.Build, err error) error {
+	build.Status = model.StatusError
+	build.Started = time.Now().Unix()
+	build.Finished = build.Started
+	build.Error = err.Error()
+	l.store.UpdateBuild(build)
+	buildFinished(repo, build)
+	l.release(repo)
+	return err
+}
+
+// compile compiles the build configuration into the pipelines of the
+// build.
+func (l *launcher) compile(repo *model.Repo, user *model.User, build *model.Build, confs []*model.Config, params map[string]string) ([]*buildItem, error) {
+	netrc, err := l.remote.Netrc(user, repo)
+	if err != nil {
+		logrus.Errorf("failure to generate netrc for %s. %s", repo.FullName, err)
+		return nil, err
+	}
 
 	// get the previous build so that we can send
 	// on status change notifications
-	last, _ := store.GetBuildLastBefore(c, repo, build.Branch, build.ID)
+	last, _ := l.store.GetBuildLastBefore(repo, build.Branch, build.ID)
 	secs, err := Config.Services.Secrets.SecretListBuild(repo, build)
 	if err != nil {
 		logrus.Debugf("Error getting secrets for %s#%d. %s", repo.FullName, build.Number, err)
@@ -574,12 +2674,6 @@ func PostBuild(c *gin.Context) {
 	if err != nil {
 		logrus.Debugf("Error getting registry credentials for %s#%d. %s", repo.FullName, build.Number, err)
 	}
-	if Config.Services.Environ != nil {
-		globals, _ := Config.Services.Environ.EnvironList(repo)
-		for _, global := range globals {
-			buildParams[global.Name] = global.Value
-		}
-	}
 
 	b := builder{
 		Repo:  repo,
@@ -588,20 +2682,15 @@ func PostBuild(c *gin.Context) {
 		Netrc: netrc,
 		Secs:  secs,
 		Regs:  regs,
-		Link:  httputil.GetURL(c.Request),
-		Yaml:  conf.Data,
-		Envs:  buildParams,
-	}
-	items, err := b.Build()
-	if err != nil {
-		build.Status = model.StatusError
-		build.Started = time.Now().Unix()
-		build.Finished = build.Started
-		build.Error = err.Error()
-		c.JSON(500, build)
-		return
+		Link:  l.link,
+		Envs:  buildEnviron(l.store, repo, params),
 	}
+	return b.BuildAll(confs)
+}
 
+// buildProcs adds the procs of the compiled pipelines and their steps
+// to the build.
+func buildProcs(build *model.Build, items []*buildItem) {
 	var pcounter = len(items)
 	for _, item := range items {
 		build.Procs = append(build.Procs, item.Proc)
@@ -625,20 +2714,31 @@ func PostBuild(c *gin.Context) {
 				build.Procs = append(build.Procs, proc)
 			}
 		}
-	}
 
-	err = store.FromContext(c).ProcCreate(build.Procs)
-	if err != nil {
-		logrus.Errorf("cannot restart %s#%d: %s", repo.FullName, build.Number, err)
-		build.Status = model.StatusError
-		build.Started = time.Now().Unix()
-		build.Finished = build.Started
-		build.Error = err.Error()
-		c.JSON(500, build)
-		return
+		// steps excluded by their when conditions never run, and
+		// are recorded as skipped so they do not appear pending.
+		for _, name := range item.Skipped {
+			pcounter++
+			proc := &model.Proc{
+				BuildID: build.ID,
+				Name:    name,
+				PID:     pcounter,
+				PPID:    item.Proc.PID,
+				PGID:    pcounter,
+				State:   model.StatusSkipped,
+			}
+			build.Procs = append(build.Procs, proc)
+		}
 	}
+}
 
-	c.JSON(202, build)
+// dispatchBuild stores the procs of the build, publishes the enqueued
+// event and pushes the pipelines of the items onto the queue.
+func dispatchBuild(c context.Context, s store.Store, repo *model.Repo, build *model.Build, items []*buildItem) error {
+	if err := s.ProcCreate(build.Procs); err != nil {
+		logrus.Errorf("error persisting procs %s/%d: %s", repo.FullName, build.Number, err)
+		return err
+	}
 
 	//
 	// publish topic
@@ -662,24 +2762,212 @@ func PostBuild(c *gin.Context) {
 	// end publish topic
 	//
 
+	// the environment is the same for every pipeline of the build.
+	if len(items) != 0 {
+		if err := s.BuildEnvironSave(build.ID, items[0].Environ); err != nil {
+			logrus.Errorf("error persisting environ %s/%d: %s", repo.FullName, build.Number, err)
+		}
+	}
+
+	var pushed int
 	for _, item := range items {
-		task := new(queue.Task)
-		task.ID = fmt.Sprint(item.Proc.ID)
-		task.Labels = map[string]string{}
-		task.Labels["platform"] = item.Platform
-		for k, v := range item.Labels {
-			task.Labels[k] = v
-		}
-
-		task.Data, _ = json.Marshal(rpc.Pipeline{
-			ID:      fmt.Sprint(item.Proc.ID),
-			Config:  item.Config,
-			Timeout: b.Repo.Timeout,
-		})
+		// gated pipelines are pushed when they are approved.
+		if item.Proc.State == model.StatusGated {
+			continue
+		}
+		if err := pushItem(repo, item); err != nil {
+			failProcs(s, build.Procs, err)
+			return err
+		}
+		pushed++
+	}
+
+	// the build is blocked when all of its pipelines are gated.
+	if pushed == 0 && len(model.Gated(build.Procs)) != 0 {
+		build.Status = model.StatusBlocked
+		return s.UpdateBuild(build)
+	}
+	return nil
+}
+
+// pushAttempts is the number of times a pipeline is pushed onto the
+// queue before the build is errored. The delay between the attempts
+// starts at pushBackoff and doubles after each attempt. The delays are
+// kept short since the push happens while handling a request or while
+// a finished build releases the next one.
+var (
+	pushAttempts = 3
+	pushBackoff  = 100 * time.Millisecond
+)
+
+// pushItem pushes the pipeline onto the queue. A failed push is retried
+// with exponential backoff, so that a pipeline is not dropped when the
+// queue is briefly unavailable.
+func pushItem(repo *model.Repo, item *buildItem) error {
+	task := new(queue.Task)
+	task.ID = fmt.Sprint(item.Proc.ID)
+	task.Labels = map[string]string{}
+	for k, v := range item.Labels {
+		task.Labels[k] = v
+	}
+	task.Labels["platform"] = item.Platform
+	task.Labels["repo"] = repo.FullName
+
+	task.Data, _ = json.Marshal(rpc.Pipeline{
+		ID:      fmt.Sprint(item.Proc.ID),
+		Config:  item.Config,
+		Timeout: repo.Timeout,
+	})
+
+	masks.add(task.ID, item.Config.Secrets)
+	Config.Services.Logs.Open(context.Background(), task.ID)
+
+	var err error
+	delay := pushBackoff
+	for i := 0; i < pushAttempts; i++ {
+		if i != 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = Config.Services.Queue.Push(context.Background(), task); err == nil {
+			return nil
+		}
+		logrus.Warnf("failure to push pipeline %s of %s onto the queue, attempt %d of %d. %s", task.ID, repo.FullName, i+1, pushAttempts, err)
+	}
+	masks.forget(task.ID)
+	Config.Services.Logs.Close(context.Background(), task.ID)
+	return fmt.Errorf("cannot push pipeline %d onto the queue. %s", item.Proc.PID, err)
+}
+
+// failProcs marks the procs that did not finish as errored, and evicts
+// the pipelines that were already pushed onto the queue, after a
+// pipeline of the build could not be pushed.
+func failProcs(s store.Store, procs []*model.Proc, err error) {
+	now := time.Now().Unix()
+	for _, proc := range procs {
+		if !proc.Running() && proc.State != model.StatusGated {
+			continue
+		}
+		if proc.PPID == 0 {
+			Config.Services.Queue.Evict(context.Background(), fmt.Sprint(proc.ID))
+		}
+		proc.State = model.StatusError
+		proc.Error = err.Error()
+		proc.Stopped = now
+		if uerr := s.ProcUpdate(proc); uerr != nil {
+			logrus.Errorf("error updating proc %d. %s", proc.ID, uerr)
+		}
+	}
+}
+
+// procsStatus returns the status of the build derived from the state
+// of its pipelines, and false if a pipeline is pending or running. The
+// build is blocked while a pipeline waits for approval, and otherwise
+// takes the state of a failing or declined pipeline.
+func procsStatus(procs []*model.Proc) (string, bool) {
+	status := model.StatusSuccess
+	for _, proc := range procs {
+		if proc.PPID != 0 {
+			continue
+		}
+		switch {
+		case proc.Running():
+			return "", false
+		case proc.State == model.StatusGated:
+			status = model.StatusBlocked
+		case proc.Failing() && status != model.StatusBlocked:
+			status = proc.State
+		case proc.State == model.StatusDeclined && status == model.StatusSuccess:
+			status = model.StatusDeclined
+		}
+	}
+	return status, true
+}
+
+// hasFailedProcs returns true if any top-level proc failed.
+func hasFailedProcs(procs []*model.Proc) bool {
+	for _, proc := range procs {
+		if proc.PPID == 0 && proc.Failing() {
+			return true
+		}
+	}
+	return false
+}
+
+// carryOverProcs copies the final state of the procs that did not
+// fail in the previous build into the new build, and returns only
+// the items whose top-level proc failed so they alone are enqueued.
+//
+// A pipeline is reusable when its top-level proc finished with the
+// success or skipped state. Pipelines that failed, were killed,
+// errored, or never finished are enqueued again with all of their
+// steps, since the steps of a pipeline share a workspace and cannot
+// be re-run on their own. The configuration may have changed since
+// the previous build, so a pipeline is only reused if the previous
+// build ran a pipeline with the same number, name and matrix axis,
+// and every one of its steps.
+func carryOverProcs(items []*buildItem, procs, prev []*model.Proc) []*buildItem {
+	prevByPID := map[int]*model.Proc{}
+	for _, proc := range prev {
+		prevByPID[proc.PID] = proc
+	}
+
+	var retry []*buildItem
+	for _, item := range items {
+		from, ok := prevByPID[item.Proc.PID]
+		if !ok || from.PPID != 0 || from.Name != item.Proc.Name || !sameEnviron(from.Environ, item.Proc.Environ) || from.Failing() || from.Running() {
+			retry = append(retry, item)
+			continue
+		}
+
+		steps := map[string]*model.Proc{}
+		for _, proc := range prev {
+			if proc.PPID == from.PID {
+				steps[proc.Name] = proc
+			}
+		}
+		reuse := true
+		for _, proc := range procs {
+			if _, ok := steps[proc.Name]; proc.PPID == item.Proc.PID && !ok {
+				reuse = false
+			}
+		}
+		if !reuse {
+			retry = append(retry, item)
+			continue
+		}
+
+		for _, proc := range procs {
+			src := from
+			if proc.PPID == item.Proc.PID {
+				src = steps[proc.Name]
+			} else if proc.PID != item.Proc.PID {
+				continue
+			}
+			proc.State = src.State
+			proc.ExitCode = src.ExitCode
+			proc.Error = src.Error
+			proc.Started = src.Started
+			proc.Stopped = src.Stopped
+			proc.Machine = src.Machine
+			proc.Platform = src.Platform
+		}
+	}
+	return retry
+}
 
-		Config.Services.Logs.Open(context.Background(), task.ID)
-		Config.Services.Queue.Push(context.Background(), task)
+// sameEnviron returns true if the matrix axes of two pipelines are
+// equal.
+func sameEnviron(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
 	}
+	return true
 }
 
 //
@@ -689,46 +2977,119 @@ func PostBuild(c *gin.Context) {
 func DeleteBuildLogs(c *gin.Context) {
 	repo := session.Repo(c)
 	user := session.User(c)
-	num, _ := strconv.Atoi(c.Params.ByName("number"))
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
 
 	build, err := store.GetBuildNumber(c, repo, num)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, 404, errNotFound, "%s", err)
 		return
 	}
 
 	procs, err := store.FromContext(c).ProcList(build)
 	if err != nil {
-		c.AbortWithError(404, err)
+		writeError(c, 404, errNotFound, "%s", err)
 		return
 	}
 
 	switch build.Status {
 	case model.StatusRunning, model.StatusPending:
-		c.String(400, "Cannot delete logs for a pending or running build")
+		writeError(c, 400, errInvalidStatus, "Cannot delete logs for a pending or running build")
 		return
 	}
 
 	for _, proc := range procs {
-		t := time.Now().UTC()
-		buf := bytes.NewBufferString(fmt.Sprintf(deleteStr, proc.Name, user.Login, t.Format(time.UnixDate)))
-		lerr := store.FromContext(c).LogSave(proc, buf)
+		lerr := purgeLog(store.FromContext(c), proc, user)
 		if lerr != nil {
 			err = lerr
 		}
 	}
 	if err != nil {
-		c.String(400, "There was a problem deleting your logs. %s", err)
+		writeError(c, 400, errStore, "There was a problem deleting your logs. %s", err)
+		return
+	}
+
+	writeAudit(c, repo, build, model.AuditPurgeLogs)
+	c.String(204, "")
+}
+
+// DeleteProcLogs replaces the logs of a single proc with a placeholder
+// recording who purged them and when.
+func DeleteProcLogs(c *gin.Context) {
+	repo := session.Repo(c)
+	user := session.User(c)
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		writeError(c, 400, errInvalidParam, "Invalid proc number %q", c.Param("pid"))
+		return
+	}
+
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	proc, err := store.FromContext(c).ProcFind(build, pid)
+	if err != nil {
+		writeError(c, 404, errNotFound, "%s", err)
+		return
+	}
+
+	switch build.Status {
+	case model.StatusRunning, model.StatusPending:
+		writeError(c, 400, errInvalidStatus, "Cannot delete logs for a pending or running build")
+		return
+	}
+
+	if err := purgeLog(store.FromContext(c), proc, user); err != nil {
+		writeError(c, 400, errStore, "There was a problem deleting your logs. %s", err)
 		return
 	}
 
+	writeProcAudit(c, repo, build, proc, model.AuditPurgeLogs)
 	c.String(204, "")
 }
 
+// purgeLog replaces the logs of the proc with the deleteStr placeholder.
+// The placeholder records the size of the purged logs, which proves
+// they existed and were intentionally removed.
+func purgeLog(s store.Store, proc *model.Proc, user *model.User) error {
+	var size int64
+	if rc, err := s.LogFind(proc); err == nil {
+		size, _ = io.Copy(ioutil.Discard, rc)
+		rc.Close()
+	}
+	t := time.Now().UTC()
+	buf := bytes.NewBufferString(fmt.Sprintf(deleteStr, proc.Name, user.Login, t.Format(time.UnixDate), formatBytes(size)))
+	return s.LogSave(proc, buf)
+}
+
 var deleteStr = `[
 	{
 	  "proc": %q,
 	  "pos": 0,
-	  "out": "logs purged by %s on %s\n"
+	  "out": "logs purged by %s on %s (was %s)\n"
 	}
 ]`
+
+// formatBytes formats the byte count in binary units, eg 42KB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	size := strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/float64(div)), ".0")
+	return fmt.Sprintf("%s%cB", size, "KMGTPE"[exp])
+}
@@ -0,0 +1,455 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cncd/pipeline/pipeline/rpc"
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReviewNonBlockedBuild(t *testing.T) {
+	handlers := []struct {
+		action  string
+		handler gin.HandlerFunc
+	}{
+		{"approve", PostApproval},
+		{"decline", PostDecline},
+	}
+	statuses := []string{
+		model.StatusSkipped,
+		model.StatusPending,
+		model.StatusRunning,
+		model.StatusSuccess,
+		model.StatusFailure,
+		model.StatusKilled,
+		model.StatusError,
+		model.StatusDeclined,
+	}
+	for _, h := range handlers {
+		for _, status := range statuses {
+			c, w, _ := gin.CreateTestContext()
+			c.Request, _ = http.NewRequest("POST", "/", nil)
+			c.Params = gin.Params{{Key: "number", Value: "1"}}
+			c.Set("repo", &model.Repo{FullName: "octocat/hello-world"})
+			c.Set("user", &model.User{Login: "octocat"})
+			remote.ToContext(c, new(nopRemote))
+			store.ToContext(c, &buildStore{build: &model.Build{Number: 1, Status: status}})
+
+			h.handler(c)
+
+			if w.Code != 409 {
+				t.Errorf("Want %s of %s build to return 409, got %d", h.action, status, w.Code)
+			}
+			out := errorResponse{}
+			json.NewDecoder(w.Body).Decode(&out)
+			if want := "cannot " + h.action + " a build with status " + status; out.Message != want {
+				t.Errorf("Want error %q, got %q", want, out.Message)
+			}
+			if out.Code != errInvalidStatus {
+				t.Errorf("Want error code %q, got %q", errInvalidStatus, out.Code)
+			}
+		}
+	}
+}
+
+// gateStore is a store with a build of two pipelines, the second of
+// which is waiting for approval.
+type gateStore struct {
+	buildStore
+	list []*model.Proc
+}
+
+func (s *gateStore) ProcList(*model.Build) ([]*model.Proc, error) {
+	return s.list, nil
+}
+
+func (s *gateStore) ProcFind(build *model.Build, pid int) (*model.Proc, error) {
+	for _, proc := range s.list {
+		if proc.PID == pid {
+			return proc, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *gateStore) ProcUpdate(*model.Proc) error {
+	return nil
+}
+
+func (s *gateStore) ConfigLoad(int64) (*model.Config, error) {
+	return &model.Config{ID: 1, Data: `approval: ${GATED}
+pipeline:
+  deploy:
+    image: alpine
+    commands: [ echo deploy ]
+matrix:
+  GATED: [ false, true ]
+`}, nil
+}
+
+func newGateStore() *gateStore {
+	s := &gateStore{
+		list: []*model.Proc{
+			{ID: 1, PID: 1, State: model.StatusSuccess},
+			{ID: 2, PID: 2, State: model.StatusGated},
+			{ID: 3, PID: 3, PPID: 1, State: model.StatusSuccess},
+			{ID: 4, PID: 4, PPID: 2, State: model.StatusPending},
+		},
+	}
+	s.build = &model.Build{ID: 1, Number: 1, Status: model.StatusBlocked, ConfigID: 1}
+	return s
+}
+
+func TestPostApprovalProc(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := newGateStore()
+	configs := Config.Storage.Config
+	Config.Storage.Config = s
+	defer func() { Config.Storage.Config = configs }()
+
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/1/approve?proc=2", nil)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	PostApproval(c)
+
+	if got := c.Writer.Status(); got != 200 {
+		t.Fatalf("Want status 200, got %d", got)
+	}
+	if len(f.tasks) != 1 || f.tasks[0].ID != "2" {
+		t.Fatalf("Want only the gated pipeline queued, got %d tasks", len(f.tasks))
+	}
+	if s.list[1].State != model.StatusPending || s.list[0].State != model.StatusSuccess {
+		t.Errorf("Want only the gated pipeline pending, got %s and %s", s.list[0].State, s.list[1].State)
+	}
+	if s.build.Status != model.StatusPending || s.build.Reviewer != "octocat" {
+		t.Errorf("Want build approved by octocat and pending, got %s by %q", s.build.Status, s.build.Reviewer)
+	}
+
+	c = newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/1/approve?proc=2", nil)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	PostApproval(c)
+
+	if got := c.Writer.Status(); got != 409 {
+		t.Errorf("Want status 409 approving a pipeline twice, got %d", got)
+	}
+}
+
+func TestPostApprovalParams(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := newGateStore()
+	s.params = map[string]string{"REGION": "us-east-1", "TARGET": "production"}
+	configs := Config.Storage.Config
+	Config.Storage.Config = s
+	defer func() { Config.Storage.Config = configs }()
+
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/1/approve?proc=2&TARGET=staging", nil)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	PostApproval(c)
+
+	if got := c.Writer.Status(); got != 200 {
+		t.Fatalf("Want status 200, got %d", got)
+	}
+	want := map[string]string{"REGION": "us-east-1", "TARGET": "staging"}
+	if !reflect.DeepEqual(s.params, want) {
+		t.Errorf("Want build params %v saved, got %v", want, s.params)
+	}
+	if len(f.tasks) != 1 {
+		t.Fatalf("Want the gated pipeline queued, got %d tasks", len(f.tasks))
+	}
+	pipeline := new(rpc.Pipeline)
+	if err := json.Unmarshal(f.tasks[0].Data, pipeline); err != nil {
+		t.Fatal(err)
+	}
+	environ := pipeline.Config.Stages[len(pipeline.Config.Stages)-1].Steps[0].Environment
+	if environ["TARGET"] != "staging" || environ["REGION"] != "us-east-1" {
+		t.Errorf("Want the pipeline compiled with the build params, got TARGET=%q REGION=%q", environ["TARGET"], environ["REGION"])
+	}
+}
+
+func TestPostApprovalParamNotAllowed(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := newGateStore()
+	configs := Config.Storage.Config
+	Config.Storage.Config = s
+	defer func() { Config.Storage.Config = configs }()
+
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/1/approve?proc=2&REGION=eu-west-1", nil)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Params: []string{"TARGET"}})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	PostApproval(c)
+
+	if got := c.Writer.Status(); got != 400 {
+		t.Errorf("Want status 400 for a param that is not allowed, got %d", got)
+	}
+	if len(f.tasks) != 0 || s.params != nil {
+		t.Errorf("Want nothing queued or saved for a param that is not allowed")
+	}
+}
+
+// teamRemote is a remote that returns the same team memberships for
+// every user.
+type teamRemote struct {
+	nopRemote
+	teams []*model.Team
+}
+
+func (r *teamRemote) Teams(*model.User) ([]*model.Team, error) {
+	return r.teams, nil
+}
+
+func TestCanReview(t *testing.T) {
+	tests := []struct {
+		repo  *model.Repo
+		user  *model.User
+		perm  *model.Perm
+		allow bool
+	}{
+		{&model.Repo{}, &model.User{Login: "octocat"}, &model.Perm{Push: true}, true},
+		{&model.Repo{ApproveAdmin: true}, &model.User{Login: "octocat"}, &model.Perm{Push: true}, false},
+		{&model.Repo{ApproveAdmin: true}, &model.User{Login: "octocat"}, &model.Perm{Push: true, Admin: true}, true},
+		{&model.Repo{ApproveAdmin: true}, &model.User{Login: "octocat", Admin: true}, nil, true},
+		{&model.Repo{Approvers: []string{"octocat"}}, &model.User{Login: "octocat"}, &model.Perm{Push: true}, true},
+		{&model.Repo{Approvers: []string{"spaceghost"}}, &model.User{Login: "octocat"}, &model.Perm{Push: true}, false},
+		{&model.Repo{Approvers: []string{"github"}}, &model.User{Login: "octocat"}, &model.Perm{Push: true}, true},
+		{&model.Repo{ApproveAdmin: true, Approvers: []string{"octocat"}}, &model.User{Login: "octocat"}, &model.Perm{Push: true}, false},
+	}
+	for i, test := range tests {
+		c, w, _ := gin.CreateTestContext()
+		remote.ToContext(c, &teamRemote{teams: []*model.Team{{Login: "github"}}})
+		if test.perm != nil {
+			c.Set("perm", test.perm)
+		}
+
+		if got := canReview(c, test.repo, test.user); got != test.allow {
+			t.Errorf("Want review allowed %v for test %d, got %v", test.allow, i, got)
+		}
+		if !test.allow && w.Code != 403 {
+			t.Errorf("Want status 403 for test %d, got %d", i, w.Code)
+		}
+	}
+}
+
+func TestPostApprovalForbidden(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := newGateStore()
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/1/approve", nil)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", ApproveAdmin: true})
+	c.Set("user", &model.User{Login: "octocat"})
+	c.Set("perm", &model.Perm{Push: true})
+
+	PostApproval(c)
+
+	if got := c.Writer.Status(); got != 403 {
+		t.Errorf("Want status 403, got %d", got)
+	}
+	if len(f.tasks) != 0 || s.build.Status != model.StatusBlocked || s.build.Reviewer != "" {
+		t.Errorf("Want the build left blocked and unreviewed")
+	}
+}
+
+func TestPostApprovalProtected(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := newGateStore()
+	s.build.BlockReason = "builds of branch master require a repository admin"
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/1/approve", nil)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+	c.Set("perm", &model.Perm{Push: true})
+
+	PostApproval(c)
+
+	if got := c.Writer.Status(); got != 403 {
+		t.Errorf("Want status 403, got %d", got)
+	}
+	if len(f.tasks) != 0 || s.build.Status != model.StatusBlocked {
+		t.Errorf("Want the protected build left blocked")
+	}
+}
+
+// approvalStore is a store with multiple builds.
+type approvalStore struct {
+	buildStore
+	builds map[int]*model.Build
+}
+
+func (s *approvalStore) GetBuildNumber(repo *model.Repo, num int) (*model.Build, error) {
+	build, ok := s.builds[num]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return build, nil
+}
+
+func TestPostApprovalList(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := &approvalStore{builds: map[int]*model.Build{
+		1: {ID: 1, Number: 1, Status: model.StatusBlocked, ConfigID: 1},
+		2: {ID: 2, Number: 2, Status: model.StatusSuccess, ConfigID: 1},
+	}}
+	defer withConfigStore(&s.buildStore)()
+
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/approve",
+		strings.NewReader(`{"builds":[1,2,3]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	remote.ToContext(c, new(nopRemote))
+	store.ToContext(c, s)
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	PostApprovalList(c)
+
+	if w.Code != 200 {
+		t.Fatalf("Want status 200, got %d", w.Code)
+	}
+	var out []struct {
+		Number int    `json:"number"`
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("Want a result for each build, got %d", len(out))
+	}
+	if out[0].Status != model.StatusPending || out[0].Error != "" {
+		t.Errorf("Want build 1 approved, got %s %q", out[0].Status, out[0].Error)
+	}
+	if out[1].Status != model.StatusSuccess || out[1].Error == "" {
+		t.Errorf("Want build 2 rejected, got %s %q", out[1].Status, out[1].Error)
+	}
+	if out[2].Error == "" {
+		t.Errorf("Want build 3 not found")
+	}
+	if got := s.builds[1].Status; got != model.StatusPending {
+		t.Errorf("Want blocked build approved and pending, got %s", got)
+	}
+	if got := s.builds[1].Reviewer; got != "octocat" {
+		t.Errorf("Want build reviewed by octocat, got %q", got)
+	}
+	if got := s.builds[2].Status; got != model.StatusSuccess {
+		t.Errorf("Want successful build left untouched, got %s", got)
+	}
+}
+
+func TestPostDeclineReason(t *testing.T) {
+	tests := []struct {
+		url, body string
+		want      string
+	}{
+		{"/", "", ""},
+		{"/?reason=flaky", "", "flaky"},
+		{"/", `{"reason":"untrusted change"}`, "untrusted change"},
+	}
+	for _, test := range tests {
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("POST", "http://drone.example.com"+test.url, strings.NewReader(test.body))
+		c.Params = gin.Params{{Key: "number", Value: "1"}}
+		c.Set("repo", &model.Repo{FullName: "octocat/hello-world"})
+		c.Set("user", &model.User{Login: "octocat"})
+		r := new(nopRemote)
+		s := &buildStore{build: &model.Build{Number: 1, Status: model.StatusBlocked}}
+		remote.ToContext(c, r)
+		store.ToContext(c, s)
+
+		PostDecline(c)
+
+		if w.Code != 200 {
+			t.Errorf("Want decline to return 200, got %d", w.Code)
+		}
+		if got := s.build.DeclineReason; got != test.want {
+			t.Errorf("Want decline reason %q, got %q", test.want, got)
+		}
+		want := "the build was rejected"
+		if test.want != "" {
+			want += ": " + test.want
+		}
+		if r.desc != want {
+			t.Errorf("Want commit status description %q, got %q", want, r.desc)
+		}
+	}
+}
+
+func TestPostDeclineProc(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := newGateStore()
+	s.list[0].State = model.StatusRunning
+	s.build.Status = model.StatusRunning
+
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/1/decline?proc=2", nil)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	PostDecline(c)
+
+	if got := c.Writer.Status(); got != 200 {
+		t.Fatalf("Want status 200, got %d", got)
+	}
+	if s.list[1].State != model.StatusDeclined || s.list[3].State != model.StatusDeclined {
+		t.Errorf("Want the gated pipeline and its steps declined, got %s and %s", s.list[1].State, s.list[3].State)
+	}
+	if s.list[0].State != model.StatusRunning || s.list[2].State != model.StatusSuccess {
+		t.Errorf("Want the other procs left untouched")
+	}
+	if s.build.Status != model.StatusRunning {
+		t.Errorf("Want the build to keep running, got %s", s.build.Status)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cancelStore is a store that returns the procs of a single build,
+// and records the build and procs updated together.
+type cancelStore struct {
+	buildStore
+	listErr   error
+	updateErr error
+	killed    []*model.Proc
+}
+
+func (s *cancelStore) ProcList(*model.Build) ([]*model.Proc, error) {
+	return s.procs, s.listErr
+}
+
+func (s *cancelStore) UpdateBuildProcs(build *model.Build, procs []*model.Proc) error {
+	if s.updateErr != nil {
+		return s.updateErr
+	}
+	s.updated = append(s.updated, build)
+	s.killed = procs
+	return nil
+}
+
+func TestCancelBuild(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := new(cancelStore)
+	s.build = &model.Build{ID: 1, Number: 1, Status: model.StatusRunning}
+	s.procs = []*model.Proc{
+		{ID: 1, PID: 1, State: model.StatusRunning},
+		{ID: 2, PID: 2, PPID: 1, State: model.StatusSuccess},
+		{ID: 3, PID: 3, PPID: 1, State: model.StatusPending},
+	}
+	c := newStartContext(s)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	CancelBuild(c)
+
+	if got := c.Writer.Status(); got != 204 {
+		t.Fatalf("Want status 204, got %d", got)
+	}
+	if len(s.updated) != 1 || s.build.Status != model.StatusKilled {
+		t.Errorf("Want the build killed")
+	}
+	if len(s.killed) != 2 {
+		t.Errorf("Want the pending and running procs killed with the build, got %d procs", len(s.killed))
+	}
+	if len(f.errored) != 2 {
+		t.Errorf("Want the tasks of the killed procs cancelled, got %d", len(f.errored))
+	}
+}
+
+func TestCancelBuildStoreError(t *testing.T) {
+	tests := []struct {
+		listErr   error
+		updateErr error
+	}{
+		{listErr: errors.New("database is locked")},
+		{updateErr: errors.New("database is locked")},
+	}
+	for _, test := range tests {
+		f, restore := withFakeServices()
+
+		s := &cancelStore{listErr: test.listErr, updateErr: test.updateErr}
+		s.build = &model.Build{ID: 1, Number: 1, Status: model.StatusRunning}
+		s.procs = []*model.Proc{{ID: 1, PID: 1, State: model.StatusRunning}}
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("DELETE", "http://drone.example.com/", nil)
+		store.ToContext(c, s)
+		c.Params = gin.Params{{Key: "number", Value: "1"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+
+		CancelBuild(c)
+
+		out := errorResponse{}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		if w.Code != 500 || out.Code != errStore {
+			t.Errorf("Want store error, got %d %s", w.Code, w.Body.String())
+		}
+		if len(f.errored) != 0 {
+			t.Errorf("Want no tasks cancelled when the build is not updated")
+		}
+		restore()
+	}
+}
+
+// cancelAllStore is a store that returns the active builds of a
+// repository with their procs.
+type cancelAllStore struct {
+	reaperStore
+	active []*model.Build
+	procs  map[int][]*model.Proc
+}
+
+func (s *cancelAllStore) GetBuildActiveList(*model.Repo) ([]*model.Build, error) {
+	return s.active, nil
+}
+
+func (s *cancelAllStore) ProcList(build *model.Build) ([]*model.Proc, error) {
+	return s.procs[build.Number], nil
+}
+
+func TestPostBuildCancelAll(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := &cancelAllStore{
+		active: []*model.Build{
+			{Number: 1, Status: model.StatusRunning},
+			{Number: 2, Status: model.StatusPending, Held: true},
+		},
+		procs: map[int][]*model.Proc{
+			1: {
+				{ID: 1, PID: 1, State: model.StatusRunning},
+				{ID: 2, PID: 2, PPID: 1, State: model.StatusSuccess},
+			},
+			2: {
+				{ID: 3, PID: 1, State: model.StatusPending},
+			},
+		},
+	}
+
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/", nil)
+	remote.ToContext(c, new(nopRemote))
+	store.ToContext(c, s)
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	PostBuildCancelAll(c)
+
+	out := struct {
+		Builds int `json:"builds"`
+		Procs  int `json:"procs"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	if w.Code != 200 || out.Builds != 2 || out.Procs != 2 {
+		t.Errorf("Want 2 builds and 2 procs killed, got %d %q", w.Code, w.Body.String())
+	}
+	for _, build := range s.active {
+		if build.Status != model.StatusKilled || build.Held {
+			t.Errorf("Want build %d killed, got status %s", build.Number, build.Status)
+		}
+	}
+	if len(f.errored) != 3 {
+		t.Errorf("Want every proc cancelled in the queue, got %d", len(f.errored))
+	}
+	if len(f.messages) != 2 {
+		t.Errorf("Want a cancelled event per build, got %d messages", len(f.messages))
+	}
+}
+
+func TestPostBuildCancelAllNumber(t *testing.T) {
+	s := &cancelAllStore{active: []*model.Build{{Number: 1, Status: model.StatusRunning}}}
+
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/", nil)
+	remote.ToContext(c, new(nopRemote))
+	store.ToContext(c, s)
+	c.Params = gin.Params{{Key: "number", Value: "cancel-all"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	PostBuild(c)
+
+	if w.Code != 400 {
+		t.Errorf("Want status 400 for the cancel-all build number, got %d", w.Code)
+	}
+	if s.active[0].Status != model.StatusRunning {
+		t.Errorf("Want the build not cancelled")
+	}
+}
+
+func TestZombieKillPublishesEvent(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := &reaperStore{
+		running: []*model.Proc{
+			{ID: 1, PID: 1, State: model.StatusRunning},
+			{ID: 2, PID: 2, PPID: 1, State: model.StatusPending},
+		},
+	}
+	s.build = &model.Build{Number: 1, Status: model.StatusRunning}
+
+	rmt := new(nopRemote)
+	c := newStartContext(s)
+	remote.ToContext(c, rmt)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	ZombieKill(c)
+
+	if got, want := s.build.Error, "force-cancelled by octocat"; got != want {
+		t.Errorf("Want build error %q, got %q", want, got)
+	}
+	if rmt.desc == "" {
+		t.Errorf("Want commit status updated")
+	}
+
+	if len(f.messages) != 1 {
+		t.Fatalf("Want cancelled event published, got %d messages", len(f.messages))
+	}
+	event := model.Event{}
+	json.Unmarshal(f.messages[0].Data, &event)
+	if event.Type != model.Cancelled {
+		t.Errorf("Want event type %s, got %s", model.Cancelled, event.Type)
+	}
+	if event.Build.Status != model.StatusKilled || len(event.Build.Procs) != 1 {
+		t.Errorf("Want killed build with its procs in the payload")
+	}
+}
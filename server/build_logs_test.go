@@ -0,0 +1,337 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip", true},
+		{"gzip;q=0.8, br", true},
+		{"gzip;q=0", false},
+		{"br", false},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", test.header)
+		if got := acceptsGzip(r); got != test.want {
+			t.Errorf("Want acceptsGzip %v for %q, got %v", test.want, test.header, got)
+		}
+	}
+}
+
+func TestGetProcLogsInvalidNumber(t *testing.T) {
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/logs/foo/1", nil)
+	c.Params = gin.Params{{Key: "number", Value: "foo"}, {Key: "pid", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	store.ToContext(c, new(buildStore))
+
+	GetProcLogs(c)
+
+	out := errorResponse{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	if w.Code != 400 || out.Code != errInvalidParam {
+		t.Errorf("Want invalid build number error, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// gzipLog is a compressed log reader.
+type gzipLog struct {
+	io.Reader
+	data []byte
+}
+
+func (l *gzipLog) Gzip() io.Reader { return bytes.NewReader(l.data) }
+
+func TestServeLogGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("[]"))
+	zw.Close()
+
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("Accept-Encoding", "gzip")
+
+	serveLog(c, &gzipLog{Reader: strings.NewReader("[]"), data: buf.Bytes()})
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Want gzip content encoding, got %q", got)
+	}
+	if !bytes.Equal(w.Body.Bytes(), buf.Bytes()) {
+		t.Errorf("Want the compressed log passed through as is")
+	}
+}
+
+// archiveStore is a store that returns procs and their stored logs.
+type archiveStore struct {
+	buildStore
+	list   []*model.Proc
+	logs   map[int64]string
+	audits []*model.Audit
+}
+
+func (s *archiveStore) AuditCreate(audit *model.Audit) error {
+	s.audits = append(s.audits, audit)
+	return nil
+}
+
+func (s *archiveStore) ProcList(*model.Build) ([]*model.Proc, error) {
+	return s.list, nil
+}
+
+func (s *archiveStore) LogFind(proc *model.Proc) (io.ReadCloser, error) {
+	data, ok := s.logs[proc.ID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return ioutil.NopCloser(strings.NewReader(data)), nil
+}
+
+func (s *archiveStore) ProcFind(build *model.Build, pid int) (*model.Proc, error) {
+	for _, proc := range s.list {
+		if proc.PID == pid {
+			return proc, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *archiveStore) LogSave(proc *model.Proc, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.logs[proc.ID] = string(data)
+	return nil
+}
+
+func TestGetProcLogsETag(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := &archiveStore{}
+	s.list = []*model.Proc{
+		{ID: 2, PID: 2, PPID: 1, Name: "build", State: model.StatusSuccess, Stopped: 1500000000},
+		{ID: 3, PID: 3, PPID: 1, Name: "test", State: model.StatusRunning},
+	}
+	s.logs = map[int64]string{
+		2: `[{"proc":"build","pos":0,"out":"go build\n"}]`,
+		3: `[{"proc":"test","pos":0,"out":"go test\n"}]`,
+	}
+	s.build = &model.Build{ID: 1, Number: 5}
+
+	get := func(pid, etag string) *httptest.ResponseRecorder {
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/logs/5/"+pid, nil)
+		if etag != "" {
+			c.Request.Header.Set("If-None-Match", etag)
+		}
+		c.Params = gin.Params{{Key: "number", Value: "5"}, {Key: "pid", Value: pid}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, s)
+		GetProcLogs(c)
+		return w
+	}
+
+	w := get("2", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" {
+		t.Fatalf("Want the logs of a completed proc served with an etag, got %d %q", w.Code, etag)
+	}
+	if w = get("2", etag); w.Code != 304 || w.Body.Len() != 0 {
+		t.Errorf("Want status 304 for a matching etag, got %d", w.Code)
+	}
+	if w = get("2", `"stale"`); w.Code != 200 || w.Body.Len() == 0 {
+		t.Errorf("Want the logs served for a stale etag, got %d", w.Code)
+	}
+	if w = get("3", ""); w.Header().Get("ETag") != "" {
+		t.Errorf("Want no etag for the logs of a running proc")
+	}
+
+	s.list[0].State = model.StatusKilled
+	if w = get("2", etag); w.Code != 200 || w.Header().Get("ETag") == etag {
+		t.Errorf("Want a new etag once the state of the proc changes, got %d", w.Code)
+	}
+}
+
+func TestGetProcLogsMaskError(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+	f.secretsErr = errors.New("vault is sealed")
+
+	s := &archiveStore{}
+	s.list = []*model.Proc{{ID: 2, PID: 2, PPID: 1, Name: "build", State: model.StatusSuccess}}
+	s.logs = map[int64]string{2: `[{"proc":"build","pos":0,"out":"hunter2\n"}]`}
+	s.build = &model.Build{ID: 1, Number: 5}
+
+	for _, path := range []string{"/logs/5/2", "/logs/5/archive"} {
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world"+path, nil)
+		c.Params = gin.Params{{Key: "number", Value: "5"}, {Key: "pid", Value: "2"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, s)
+
+		if strings.HasSuffix(path, "archive") {
+			GetBuildLogsArchive(c)
+		} else {
+			GetProcLogs(c)
+		}
+
+		if w.Code != 500 || strings.Contains(w.Body.String(), "hunter2") {
+			t.Errorf("Want status 500 and no logs for %s when the secrets cannot be listed, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestDeleteProcLogs(t *testing.T) {
+	tests := []struct {
+		status string
+		code   int
+	}{
+		{model.StatusSuccess, 204},
+		{model.StatusRunning, 400},
+		{model.StatusPending, 400},
+	}
+	for _, test := range tests {
+		s := &archiveStore{
+			list: []*model.Proc{
+				{ID: 1, PID: 1},
+				{ID: 2, PID: 2, PPID: 1, Name: "clone"},
+				{ID: 3, PID: 3, PPID: 1, Name: "build"},
+			},
+			logs: map[int64]string{
+				2: `[{"proc":"clone","pos":0,"out":"git fetch\n"}]`,
+				3: `[{"proc":"build","pos":0,"out":"echo $SECRET\n"}]`,
+			},
+		}
+		s.build = &model.Build{ID: 1, Number: 5, Status: test.status}
+
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("DELETE", "/api/repos/octocat/hello-world/logs/5/3", nil)
+		c.Params = gin.Params{{Key: "number", Value: "5"}, {Key: "pid", Value: "3"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		c.Set("user", &model.User{Login: "octocat"})
+		store.ToContext(c, s)
+
+		DeleteProcLogs(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d for a %s build, got %d", test.code, test.status, w.Code)
+		}
+		purged := strings.Contains(s.logs[3], "logs purged by octocat") && strings.Contains(s.logs[3], "(was 49B)")
+		if purged != (test.code == 204) {
+			t.Errorf("Want build log purged %v for a %s build, got %q", !purged, test.status, s.logs[3])
+		}
+		if !strings.Contains(s.logs[2], "git fetch") {
+			t.Errorf("Want the logs of other procs kept, got %q", s.logs[2])
+		}
+		if test.code != 204 {
+			continue
+		}
+		if len(s.audits) != 1 {
+			t.Fatalf("Want 1 audit entry, got %d", len(s.audits))
+		}
+		if audit := s.audits[0]; audit.Action != model.AuditPurgeLogs || audit.Build != 5 || audit.Target != "3" {
+			t.Errorf("Want purge_logs audit of build 5 targeting proc 3, got %+v", audit)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1KB"},
+		{43008, "42KB"},
+		{1572864, "1.5MB"},
+		{5 << 30, "5GB"},
+	}
+	for _, test := range tests {
+		if got := formatBytes(test.size); got != test.want {
+			t.Errorf("Want %d bytes formatted as %s, got %s", test.size, test.want, got)
+		}
+	}
+}
+
+func TestGetBuildLogsArchive(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+	f.secrets = []*model.Secret{{Name: "token", Value: "s3cr3t"}}
+
+	s := &archiveStore{
+		list: []*model.Proc{
+			{ID: 1, PID: 1},
+			{ID: 2, PID: 2, PPID: 1, Name: "clone"},
+			{ID: 3, PID: 3, PPID: 1, Name: "build"},
+		},
+		logs: map[int64]string{
+			2: `[{"proc":"clone","pos":0,"out":"git fetch s3cr3t\n"}]`,
+		},
+	}
+	s.build = &model.Build{ID: 1, Number: 5}
+
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds/5/logs.zip", nil)
+	c.Params = gin.Params{{Key: "number", Value: "5"}}
+	c.Set("repo", &model.Repo{ID: 1, Owner: "octocat", Name: "hello-world"})
+	store.ToContext(c, s)
+
+	GetBuildLogsArchive(c)
+
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="build-5-logs.zip"`; got != want {
+		t.Errorf("Want content disposition %s, got %s", want, got)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "1/clone.log" {
+		t.Fatalf("Want only the clone log archived, got %d files", len(zr.File))
+	}
+	rc, _ := zr.File[0].Open()
+	out, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	if string(out) != "git fetch ********\n" {
+		t.Errorf("Want plain text log with secrets masked, got %q", out)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/drone/drone/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPostPromote(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := new(buildStore)
+	s.build = &model.Build{ID: 1, Number: 5, Event: model.EventPush, Status: model.StatusSuccess, ConfigID: 1}
+	defer withConfigStore(s)()
+
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/5/promote?target=production&VERSION=1.0", nil)
+	c.Params = gin.Params{{Key: "number", Value: "5"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", AllowDeploy: true})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	PostPromote(c)
+
+	if got := c.Writer.Status(); got != 202 {
+		t.Fatalf("Want status 202, got %d", got)
+	}
+	if len(s.created) != 1 {
+		t.Fatalf("Want deployment build created, got %d builds", len(s.created))
+	}
+	build := s.created[0]
+	if build.Event != model.EventDeploy || build.Deploy != "production" || build.Parent != 5 {
+		t.Errorf("Want deployment of build 5 to production, got %s of build %d to %s", build.Event, build.Parent, build.Deploy)
+	}
+	if build.Trigger != model.TriggerAPI {
+		t.Errorf("Want build trigger %s, got %s", model.TriggerAPI, build.Trigger)
+	}
+	if s.params["VERSION"] != "1.0" {
+		t.Errorf("Want query parameters saved, got %v", s.params)
+	}
+	var deployed bool
+	for _, message := range f.messages {
+		event := model.Event{}
+		json.Unmarshal(message.Data, &event)
+		if event.Type == model.Deployed {
+			deployed = true
+		}
+	}
+	if !deployed {
+		t.Errorf("Want deployed event published")
+	}
+}
+
+func TestPostPromoteEventNotEnabled(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := new(buildStore)
+	s.build = &model.Build{ID: 1, Number: 5, Event: model.EventPush, Status: model.StatusSuccess, ConfigID: 1}
+	defer withConfigStore(s)()
+
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/5/promote?target=production", nil)
+	c.Params = gin.Params{{Key: "number", Value: "5"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	PostPromote(c)
+
+	if got := c.Writer.Status(); got != 403 {
+		t.Errorf("Want status 403 with deploy events disabled, got %d", got)
+	}
+	if len(s.created) != 0 {
+		t.Errorf("Want no deployment build created")
+	}
+}
+
+func TestPostPromoteProtected(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := new(buildStore)
+	s.build = &model.Build{ID: 1, Number: 5, Event: model.EventPush, Status: model.StatusSuccess, ConfigID: 1}
+	defer withConfigStore(s)()
+
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/5/promote?target=production", nil)
+	c.Params = gin.Params{{Key: "number", Value: "5"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", AllowDeploy: true, ProtTargets: []string{"production"}})
+	c.Set("user", &model.User{Login: "octocat"})
+	c.Set("perm", &model.Perm{Push: true})
+
+	PostPromote(c)
+
+	if got := c.Writer.Status(); got != 202 {
+		t.Fatalf("Want status 202, got %d", got)
+	}
+	if len(s.created) != 1 {
+		t.Fatalf("Want deployment build created, got %d builds", len(s.created))
+	}
+	build := s.created[0]
+	if build.Status != model.StatusBlocked || build.BlockReason == "" {
+		t.Errorf("Want deployment blocked with a reason, got status %s reason %q", build.Status, build.BlockReason)
+	}
+	if len(f.tasks) != 0 {
+		t.Errorf("Want blocked deployment not queued")
+	}
+}
+
+func TestPostPromoteFailedBuild(t *testing.T) {
+	for _, status := range []string{model.StatusFailure, model.StatusBlocked} {
+		s := new(buildStore)
+		s.build = &model.Build{Number: 5, Status: status}
+
+		c := newStartContext(s)
+		c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/5/promote?target=production", nil)
+		c.Params = gin.Params{{Key: "number", Value: "5"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", AllowDeploy: true})
+
+		PostPromote(c)
+
+		if got := c.Writer.Status(); got != 409 {
+			t.Errorf("Want status 409 promoting a %s build, got %d", status, got)
+		}
+		if len(s.created) != 0 {
+			t.Errorf("Want no build created promoting a %s build", status)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cncd/queue"
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queueStore is a store that returns the build queue and a fixed
+// average pipeline duration.
+type queueStore struct {
+	buildStore
+	feed []*model.Feed
+}
+
+func (s *queueStore) GetBuildQueue() ([]*model.Feed, error) {
+	return s.feed, nil
+}
+
+func (s *queueStore) ProcAverageDuration(int) (int64, error) {
+	return 600, nil
+}
+
+func (s *queueStore) ProcLoad(id int64) (*model.Proc, error) {
+	// the builds in the queue have a single pipeline with the
+	// proc id ten times the build id.
+	return &model.Proc{ID: id, BuildID: id / 10}, nil
+}
+
+func TestGetBuildQueue(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+	f.info.Stats.Workers = 0
+	f.info.Stats.Running = 1
+
+	// the running build started 200 seconds ago, and is expected to
+	// run for another 400 seconds.
+	now := time.Now().Unix()
+	s := &queueStore{
+		feed: []*model.Feed{
+			{FullName: "octocat/hello-world", Number: 3, Status: model.StatusPending, Created: 300},
+			{FullName: "octocat/hello-world", Number: 1, Status: model.StatusRunning, Created: 100, Started: now - 200},
+			{FullName: "octocat/hello-world", Number: 2, Status: model.StatusPending, Created: 200},
+		},
+	}
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "/api/builds", nil)
+	store.ToContext(c, s)
+
+	GetBuildQueue(c)
+
+	var out []struct {
+		Number    int   `json:"number"`
+		Position  int   `json:"position"`
+		Estimated int64 `json:"estimated_start_at"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("Want 3 queued builds, got %d", len(out))
+	}
+	for i, want := range []struct {
+		number, position int
+		wait             int64
+	}{
+		{1, 0, 0},
+		{2, 1, 400},
+		{3, 2, 1000},
+	} {
+		got := out[i]
+		if got.Number != want.number || got.Position != want.position {
+			t.Errorf("Want build %d at position %d, got build %d at %d", want.number, want.position, got.Number, got.Position)
+		}
+		if want.position == 0 {
+			if got.Estimated != now-200 {
+				t.Errorf("Want running build started at %d, got %d", now-200, got.Estimated)
+			}
+			continue
+		}
+		if wait := got.Estimated - now; wait < want.wait || wait > want.wait+1 {
+			t.Errorf("Want build %d to start in %d seconds, got %d", want.number, want.wait, wait)
+		}
+	}
+}
+
+func TestEstimateStart(t *testing.T) {
+	running := []*queuedBuild{
+		{Feed: &model.Feed{Started: 1000 - 500}},
+		{Feed: &model.Feed{Started: 1000 - 100}},
+	}
+	pending := []*queuedBuild{{Feed: new(model.Feed)}, {Feed: new(model.Feed)}, {Feed: new(model.Feed)}, {Feed: new(model.Feed)}}
+
+	estimateStart(pending, running, 3, 600, 1000)
+
+	// one slot is free, the running builds free theirs in 100 and 500
+	// seconds.
+	for i, want := range []int64{1000, 1100, 1500, 1600} {
+		if pending[i].Position != i+1 || pending[i].Estimated != want {
+			t.Errorf("Want pending build %d to start at %d, got %d at position %d", i, want, pending[i].Estimated, pending[i].Position)
+		}
+	}
+
+	// builds that ran for longer than the average free their slot now.
+	running[0].Started = 0
+	estimateStart(pending, running[:1], 1, 600, 1000)
+	if pending[0].Estimated != 1000 {
+		t.Errorf("Want an overdue running build to free its slot now, got %d", pending[0].Estimated)
+	}
+}
+
+func TestGetBuildQueueFilter(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+	f.info.Pending = []*queue.Task{
+		{ID: "10", Labels: map[string]string{"platform": "linux/amd64", "repo": "octocat/hello-world"}},
+		{ID: "20", Labels: map[string]string{"platform": "windows/amd64", "repo": "octocat/spoon-knife"}},
+	}
+
+	tests := []struct {
+		query string
+		code  int
+		repos []string
+	}{
+		{"", 200, []string{"octocat/hello-world", "octocat/spoon-knife"}},
+		{"?repo=octocat/spoon-knife", 200, []string{"octocat/spoon-knife"}},
+		{"?label=platform:linux/amd64", 200, []string{"octocat/hello-world"}},
+		{"?label=platform:linux/amd64&label=repo:octocat/spoon-knife", 200, nil},
+		{"?label=platform:linux/amd64&repo=octocat/hello-world", 200, []string{"octocat/hello-world"}},
+		{"?label=platform", 400, nil},
+	}
+	for _, test := range tests {
+		s := &queueStore{
+			feed: []*model.Feed{
+				{FullName: "octocat/hello-world", BuildID: 1, Number: 1, Status: model.StatusPending, Created: 100},
+				{FullName: "octocat/spoon-knife", BuildID: 2, Number: 1, Status: model.StatusPending, Created: 200},
+			},
+		}
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/builds"+test.query, nil)
+		store.ToContext(c, s)
+
+		GetBuildQueue(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d for query %q, got %d", test.code, test.query, w.Code)
+			continue
+		}
+		if test.code != 200 {
+			continue
+		}
+		var out []*model.Feed
+		json.Unmarshal(w.Body.Bytes(), &out)
+		var repos []string
+		for _, item := range out {
+			repos = append(repos, item.FullName)
+		}
+		if !reflect.DeepEqual(repos, test.repos) {
+			t.Errorf("Want builds of %v for query %q, got %v", test.repos, test.query, repos)
+		}
+	}
+}
+
+// recentStore is a store that records the recent builds query.
+type recentStore struct {
+	buildStore
+	query recentQuery
+}
+
+func (s *recentStore) GetBuildRecent(status string, after, before int64, limit int) ([]*model.Feed, error) {
+	s.query = recentQuery{status, after, before, limit}
+	return []*model.Feed{}, nil
+}
+
+type recentQuery struct {
+	status        string
+	after, before int64
+	limit         int
+}
+
+func TestGetRecentBuilds(t *testing.T) {
+	tests := []struct {
+		query string
+		code  int
+		want  recentQuery
+	}{
+		{"", 200, recentQuery{limit: 25}},
+		{"?status=failure&after=100&before=200&limit=10", 200, recentQuery{status: "failure", after: 100, before: 200, limit: 10}},
+		{"?status=broken", 400, recentQuery{}},
+		{"?after=yesterday", 400, recentQuery{}},
+		{"?before=-1", 400, recentQuery{}},
+		{"?limit=1000", 400, recentQuery{}},
+	}
+	for _, test := range tests {
+		s := new(recentStore)
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/builds/recent"+test.query, nil)
+		store.ToContext(c, s)
+
+		GetRecentBuilds(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d for query %q, got %d", test.code, test.query, w.Code)
+		}
+		if s.query != test.want {
+			t.Errorf("Want recent builds query %+v for query %q, got %+v", test.want, test.query, s.query)
+		}
+	}
+}
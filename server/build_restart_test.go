@@ -0,0 +1,387 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cncd/queue"
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPostBuildConfigs(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := new(buildStore)
+	s.build = &model.Build{ID: 1, Number: 5, Event: model.EventPush, Status: model.StatusFailure, ConfigID: 1}
+	s.confs = []*model.Config{
+		{ID: 1, Name: "build.yml", Data: "pipeline:\n  build:\n    image: golang\n    commands: [ go build ]\n"},
+		{ID: 2, Name: "deploy.yml", Data: "pipeline:\n  deploy:\n    image: alpine\n    commands: [ echo deploy ]\n"},
+	}
+	defer withConfigStore(s)()
+
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/5", nil)
+	c.Params = gin.Params{{Key: "number", Value: "5"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Config: ".drone/"})
+
+	PostBuild(c)
+
+	if got := c.Writer.Status(); got != 202 {
+		t.Fatalf("Want status 202, got %d", got)
+	}
+	var names []string
+	for _, proc := range s.procs {
+		if proc.PPID == 0 {
+			names = append(names, proc.Name)
+		}
+	}
+	if want := []string{"build.yml", "deploy.yml"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Want the pipelines of every configuration %v restarted, got %v", want, names)
+	}
+	if len(s.confs) != 2 {
+		t.Errorf("Want the configurations of the restarted build saved, got %d", len(s.confs))
+	}
+}
+
+func TestPostBuildDryRun(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := newGateStore()
+	configs := Config.Storage.Config
+	Config.Storage.Config = s
+	defer func() { Config.Storage.Config = configs }()
+
+	tests := []struct {
+		body      string
+		code      int
+		pipelines int
+		steps     []string
+	}{
+		{"", 200, 2, []string{"clone", "deploy"}},
+		{"pipeline:\n  test:\n    image: golang\n    commands: [ go test ]\n  build:\n    image: golang\n    commands: [ go build ]\n", 200, 1, []string{"clone", "test", "build"}},
+		{"pipeline: [", 400, 0, nil},
+	}
+	for _, test := range tests {
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("POST", "/api/repos/octocat/hello-world/builds/1/dryrun", strings.NewReader(test.body))
+		c.Params = gin.Params{{Key: "number", Value: "1"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		remote.ToContext(c, new(nopRemote))
+		store.ToContext(c, s)
+
+		PostBuildDryRun(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d, got %d", test.code, w.Code)
+			continue
+		}
+		if test.code != 200 {
+			continue
+		}
+		var out struct {
+			Pipelines []*dryrunPipeline `json:"pipelines"`
+			Procs     []*model.Proc     `json:"procs"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		if len(out.Pipelines) != test.pipelines || len(out.Procs) != test.pipelines {
+			t.Errorf("Want %d pipelines, got %d", test.pipelines, len(out.Pipelines))
+			continue
+		}
+		var steps []string
+		for _, stage := range out.Pipelines[0].Stages {
+			for _, step := range stage.Steps {
+				steps = append(steps, step.Name)
+			}
+		}
+		if !reflect.DeepEqual(steps, test.steps) {
+			t.Errorf("Want steps %v, got %v", test.steps, steps)
+		}
+		if len(out.Procs[0].Children) != len(test.steps) {
+			t.Errorf("Want a proc per step, got %d", len(out.Procs[0].Children))
+		}
+	}
+	if len(f.tasks) != 0 || len(f.messages) != 0 {
+		t.Errorf("Want nothing queued or published on a dry run")
+	}
+}
+
+func TestPostProcRequeue(t *testing.T) {
+	tests := []struct {
+		pid    string
+		state  string
+		queued bool
+		code   int
+	}{
+		{"2", model.StatusPending, false, 200},
+		{"2", model.StatusPending, true, 409},
+		{"2", model.StatusRunning, false, 409},
+		{"1", model.StatusSuccess, false, 409},
+		{"4", model.StatusPending, false, 400},
+		{"5", model.StatusPending, false, 404},
+	}
+	for _, test := range tests {
+		f, restore := withFakeServices()
+		s := newGateStore()
+		s.build.Status = model.StatusRunning
+		s.list[1].State = test.state
+		if test.queued {
+			f.info.Pending = []*queue.Task{{ID: "2"}}
+		}
+		configs := Config.Storage.Config
+		Config.Storage.Config = s
+
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/1/procs/"+test.pid+"/requeue", nil)
+		c.Params = gin.Params{{Key: "number", Value: "1"}, {Key: "pid", Value: test.pid}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		remote.ToContext(c, new(nopRemote))
+		store.ToContext(c, s)
+
+		PostProcRequeue(c)
+
+		Config.Storage.Config = configs
+		restore()
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d requeueing proc %s, got %d", test.code, test.pid, w.Code)
+		}
+		if test.code != 200 {
+			if len(f.tasks) != 0 {
+				t.Errorf("Want no task pushed requeueing proc %s, got %d", test.pid, len(f.tasks))
+			}
+			continue
+		}
+		if len(f.tasks) != 1 || f.tasks[0].ID != "2" || len(f.logs) != 1 {
+			t.Errorf("Want the task and log of proc 2 reopened, got %d tasks and %d logs", len(f.tasks), len(f.logs))
+		}
+	}
+}
+
+func TestPostBuildMissingConfig(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := new(missingConfigStore)
+	s.build = &model.Build{ID: 1, Number: 5, Event: model.EventPush, Status: model.StatusFailure, Branch: "master", Commit: "a1b2c3", ConfigID: 7, Verified: true}
+	defer withConfigStore(&s.buildStore)()
+	Config.Storage.Config = s
+
+	rmt := new(nopRemote)
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/5", nil)
+	c.Params = gin.Params{{Key: "number", Value: "5"}}
+	remote.ToContext(c, rmt)
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Config: ".drone.yml"})
+
+	PostBuild(c)
+
+	if got := c.Writer.Status(); got != 202 {
+		t.Fatalf("Want status 202, got %d", got)
+	}
+	if rmt.ref != "a1b2c3" {
+		t.Errorf("Want configuration fetched at the build commit, got %q", rmt.ref)
+	}
+	if len(s.created) != 1 || s.created[0].ConfigID != 1 {
+		t.Fatalf("Want restarted build to use the fetched configuration")
+	}
+	if s.created[0].Verified {
+		t.Errorf("Want restarted build not verified")
+	}
+}
+
+func TestPostBuildRefreshConfig(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := new(missingConfigStore)
+	s.build = &model.Build{ID: 1, Number: 5, Event: model.EventPush, Status: model.StatusFailure, Branch: "master", Commit: "a1b2c3", ConfigID: 7}
+	defer withConfigStore(&s.buildStore)()
+
+	rmt := new(nopRemote)
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/5?refresh_config=true", nil)
+	c.Params = gin.Params{{Key: "number", Value: "5"}}
+	remote.ToContext(c, rmt)
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Config: ".drone.yml"})
+
+	PostBuild(c)
+
+	if got := c.Writer.Status(); got != 202 {
+		t.Fatalf("Want status 202, got %d", got)
+	}
+	if rmt.ref != "refs/heads/master" {
+		t.Errorf("Want configuration fetched at the branch head, got %q", rmt.ref)
+	}
+	if len(s.created) != 1 || s.created[0].ConfigID != 1 {
+		t.Errorf("Want restarted build to use the refreshed configuration")
+	}
+	if _, ok := s.params["refresh_config"]; ok {
+		t.Errorf("Want refresh_config excluded from the build parameters")
+	}
+}
+
+func TestPostBuildReproduce(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	tests := []struct {
+		url     string
+		missing bool
+		code    int
+	}{
+		{"/builds/5?reproduce=true", false, 202},
+		{"/builds/5?reproduce=true&deploy_to=staging", false, 400},
+		{"/builds/5?reproduce=true&VERSION=2.0", false, 400},
+		{"/builds/5?reproduce=true", true, 404},
+	}
+	for _, test := range tests {
+		s := new(missingConfigStore)
+		s.build = &model.Build{ID: 1, Number: 5, Event: model.EventDeploy, Deploy: "production", Status: model.StatusSuccess, ConfigID: 1}
+		s.params = map[string]string{"VERSION": "1.0"}
+		restoreStore := withConfigStore(&s.buildStore)
+		var cs store.Store = &s.buildStore
+		if test.missing {
+			cs = s
+			Config.Storage.Config = s
+		}
+
+		c := newStartContext(cs)
+		c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world"+test.url, nil)
+		c.Params = gin.Params{{Key: "number", Value: "5"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Config: ".drone.yml"})
+
+		PostBuild(c)
+		restoreStore()
+
+		if got := c.Writer.Status(); got != test.code {
+			t.Errorf("Want status %d for %s, got %d", test.code, test.url, got)
+			continue
+		}
+		if test.code != 202 {
+			if len(s.created) != 0 {
+				t.Errorf("Want no build created for %s", test.url)
+			}
+			continue
+		}
+		build := s.created[0]
+		if !build.Reproduction || build.Parent != 5 {
+			t.Errorf("Want a reproduction of build 5, got reproduction %v of build %d", build.Reproduction, build.Parent)
+		}
+		if build.Trigger != model.TriggerRestart {
+			t.Errorf("Want build trigger %s, got %s", model.TriggerRestart, build.Trigger)
+		}
+		if build.Event != model.EventDeploy || build.Deploy != "production" {
+			t.Errorf("Want the original event and deploy target, got %s to %s", build.Event, build.Deploy)
+		}
+		if s.params["VERSION"] != "1.0" {
+			t.Errorf("Want the original parameters, got %v", s.params)
+		}
+	}
+}
+
+// prevStore is a store that returns the procs of the previous build.
+type prevStore struct {
+	buildStore
+	prev []*model.Proc
+}
+
+func (s *prevStore) ProcList(*model.Build) ([]*model.Proc, error) {
+	return s.prev, nil
+}
+
+func TestPostBuildFailedModeWithoutFailures(t *testing.T) {
+	s := &prevStore{prev: []*model.Proc{
+		{PID: 1, Name: "linux/amd64", State: model.StatusSuccess},
+	}}
+	s.build = &model.Build{ID: 1, Number: 5, Status: model.StatusSuccess}
+
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/5?mode=failed", nil)
+	c.Params = gin.Params{{Key: "number", Value: "5"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+
+	PostBuild(c)
+
+	if got := c.Writer.Status(); got != 400 {
+		t.Errorf("Want status 400 restarting the failed procs of a successful build, got %d", got)
+	}
+	if len(s.created) != 0 {
+		t.Errorf("Want no build created")
+	}
+}
+
+func TestPostBuildUnfinished(t *testing.T) {
+	for _, status := range []string{
+		model.StatusPending,
+		model.StatusRunning,
+		model.StatusBlocked,
+		model.StatusDeclined,
+	} {
+		s := &prevStore{}
+		s.build = &model.Build{ID: 1, Number: 5, Status: status}
+
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/5", nil)
+		c.Params = gin.Params{{Key: "number", Value: "5"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		remote.ToContext(c, new(nopRemote))
+		store.ToContext(c, s)
+
+		PostBuild(c)
+
+		out := errorResponse{}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		if w.Code != 409 || out.Code != errInvalidStatus {
+			t.Errorf("Want status 409 restarting a %s build, got %d %s", status, w.Code, w.Body.String())
+		}
+		if len(s.created) != 0 {
+			t.Errorf("Want no build created restarting a %s build", status)
+		}
+	}
+}
+
+func TestPostBuildParamNotAllowed(t *testing.T) {
+	s := &prevStore{}
+	s.build = &model.Build{ID: 1, Number: 5, Status: model.StatusSuccess}
+
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds/5?event=deployment&TARGET=staging&REGION=eu-west-1", nil)
+	c.Params = gin.Params{{Key: "number", Value: "5"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Params: []string{"TARGET"}})
+	remote.ToContext(c, new(nopRemote))
+	store.ToContext(c, s)
+
+	PostBuild(c)
+
+	out := errorResponse{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	if w.Code != 400 || out.Code != errInvalidParam || !strings.Contains(out.Message, "REGION") {
+		t.Errorf("Want the param that is not allowed rejected, got %d %s", w.Code, w.Body.String())
+	}
+	if len(s.created) != 0 {
+		t.Errorf("Want no build created")
+	}
+}
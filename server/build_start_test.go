@@ -0,0 +1,331 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cncd/pipeline/pipeline/rpc"
+	"github.com/drone/drone/model"
+)
+
+func TestStartBuild(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+	f.globals = []*model.Environ{{Name: "GLOBAL", Value: "global"}, {Name: "SHARED", Value: "global"}}
+	f.secrets = []*model.Secret{{Name: "token", Value: "s3cr3t", Events: []string{model.EventPush}}}
+
+	s := new(buildStore)
+	s.envs = []*model.Environ{{Name: "SHARED", Value: "repo"}, {Name: "REPO", Value: "repo"}}
+	c := newStartContext(s)
+	build := &model.Build{ID: 1, Number: 1, Event: model.EventPush, Status: model.StatusPending}
+	conf := &model.Config{Data: "pipeline:\n  test:\n    image: golang\n    commands: [ go test ]\n"}
+	envs := map[string]string{"CUSTOM": "custom", "GLOBAL": "param", "URL": "https://s3cr3t@example.com"}
+
+	if err := startBuild(c, &model.Repo{FullName: "octocat/hello-world"}, &model.User{}, build, []*model.Config{conf}, envs, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the pipeline, the implicit clone step and the test step.
+	if len(s.procs) != 3 {
+		t.Errorf("Want 3 procs created, got %d", len(s.procs))
+	}
+	if len(f.messages) != 1 {
+		t.Errorf("Want 1 enqueued event published, got %d", len(f.messages))
+	}
+	if len(f.tasks) != 1 || len(f.logs) != 1 {
+		t.Fatalf("Want 1 task queued with an open log, got %d tasks and %d logs", len(f.tasks), len(f.logs))
+	}
+
+	pipeline := new(rpc.Pipeline)
+	if err := json.Unmarshal(f.tasks[0].Data, pipeline); err != nil {
+		t.Fatal(err)
+	}
+	environ := pipeline.Config.Stages[len(pipeline.Config.Stages)-1].Steps[0].Environment
+	if got := environ["CUSTOM"]; got != "custom" {
+		t.Errorf("Want build parameter CUSTOM=custom, got %q", got)
+	}
+	if got := environ["GLOBAL"]; got != "param" {
+		t.Errorf("Want build parameters to take precedence, got GLOBAL=%q", got)
+	}
+	if got := environ["SHARED"]; got != "repo" {
+		t.Errorf("Want the repository environment to take precedence over the global environment, got SHARED=%q", got)
+	}
+
+	want := map[string]string{
+		"CUSTOM": "custom",
+		"GLOBAL": "param",
+		"SHARED": "repo",
+		"REPO":   "repo",
+		"URL":    "https://********@example.com",
+	}
+	if !reflect.DeepEqual(s.environ, want) {
+		t.Errorf("Want the masked environment %v recorded, got %v", want, s.environ)
+	}
+}
+
+func TestStartBuildQueueRetry(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+	f.pushFails = 2
+
+	backoff := pushBackoff
+	pushBackoff = 10 * time.Millisecond
+	defer func() { pushBackoff = backoff }()
+
+	s := new(buildStore)
+	c := newStartContext(s)
+	build := &model.Build{ID: 1, Number: 1, Event: model.EventPush, Status: model.StatusPending}
+	conf := &model.Config{Data: "pipeline:\n  test:\n    image: golang\n    commands: [ go test ]\n"}
+
+	start := time.Now()
+	if err := startBuild(c, &model.Repo{FullName: "octocat/hello-world"}, &model.User{}, build, []*model.Config{conf}, nil, nil); err != nil {
+		t.Fatalf("Want the pipeline pushed after the queue recovers, got %s", err)
+	}
+	if f.pushes != 3 || len(f.tasks) != 1 {
+		t.Errorf("Want the pipeline pushed on the third attempt, got %d attempts", f.pushes)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Want the attempts delayed with exponential backoff, took %s", elapsed)
+	}
+	if build.Status == model.StatusError {
+		t.Errorf("Want build not errored")
+	}
+}
+
+func TestStartBuildQueueError(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+	f.pushErr = errors.New("queue unavailable")
+
+	backoff := pushBackoff
+	pushBackoff = 0
+	defer func() { pushBackoff = backoff }()
+
+	s := new(buildStore)
+	c := newStartContext(s)
+	build := &model.Build{ID: 1, Number: 1, Event: model.EventPush, Status: model.StatusPending}
+	conf := &model.Config{Data: "pipeline:\n  test:\n    image: golang\n    commands: [ go test ]\n"}
+
+	if err := startBuild(c, &model.Repo{FullName: "octocat/hello-world"}, &model.User{}, build, []*model.Config{conf}, nil, nil); err == nil {
+		t.Fatalf("Want error pushing the pipeline onto the queue")
+	}
+	if f.pushes != pushAttempts {
+		t.Errorf("Want %d push attempts, got %d", pushAttempts, f.pushes)
+	}
+	if build.Status != model.StatusError || !strings.Contains(build.Error, "queue unavailable") {
+		t.Errorf("Want build errored with the queue error, got status %s error %q", build.Status, build.Error)
+	}
+	for _, proc := range s.procs {
+		if proc.State != model.StatusError {
+			t.Errorf("Want proc %d errored, got %s", proc.PID, proc.State)
+		}
+	}
+}
+
+func TestStartBuildConfigs(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := new(buildStore)
+	c := newStartContext(s)
+	build := &model.Build{ID: 1, Number: 1, Event: model.EventPush, Status: model.StatusPending}
+	confs := []*model.Config{
+		{Name: "build.yml", Data: "pipeline:\n  build:\n    image: golang\n    commands: [ go build ]\n"},
+		{Name: "deploy.yml", Data: "pipeline:\n  deploy:\n    image: alpine\n    commands: [ echo deploy ]\n"},
+	}
+
+	if err := startBuild(c, &model.Repo{FullName: "octocat/hello-world"}, &model.User{}, build, confs, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	var pipelines []*model.Proc
+	for _, proc := range s.procs {
+		if proc.PPID == 0 {
+			pipelines = append(pipelines, proc)
+		}
+	}
+	if len(pipelines) != 2 {
+		t.Fatalf("Want a pipeline for each configuration, got %d", len(pipelines))
+	}
+	for i, want := range []string{"build.yml", "deploy.yml"} {
+		if got := pipelines[i]; got.Name != want || got.PID != i+1 {
+			t.Errorf("Want pipeline %d named %s, got pipeline %d named %s", i+1, want, got.PID, got.Name)
+		}
+	}
+}
+
+func TestStartBuildError(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := new(buildStore)
+	c := newStartContext(s)
+	build := &model.Build{ID: 1, Number: 1, Event: model.EventPush, Status: model.StatusPending}
+	conf := &model.Config{Data: "pipeline: [ invalid"}
+
+	if err := startBuild(c, &model.Repo{}, &model.User{}, build, []*model.Config{conf}, nil, nil); err == nil {
+		t.Fatal("Want error compiling an invalid configuration")
+	}
+	if build.Status != model.StatusError || build.Error == "" {
+		t.Errorf("Want build status error with a message, got %q", build.Status)
+	}
+	if len(s.updated) != 1 {
+		t.Errorf("Want the failed build to be updated")
+	}
+	if len(f.tasks) != 0 || len(f.messages) != 0 {
+		t.Errorf("Want nothing queued or published for a failed build")
+	}
+}
+
+func TestProcsStatus(t *testing.T) {
+	tests := []struct {
+		states []string
+		status string
+		done   bool
+	}{
+		{[]string{model.StatusSuccess, model.StatusRunning}, "", false},
+		{[]string{model.StatusSuccess, model.StatusSkipped}, model.StatusSuccess, true},
+		{[]string{model.StatusSuccess, model.StatusGated}, model.StatusBlocked, true},
+		{[]string{model.StatusFailure, model.StatusGated}, model.StatusBlocked, true},
+		{[]string{model.StatusSuccess, model.StatusDeclined}, model.StatusDeclined, true},
+		{[]string{model.StatusDeclined, model.StatusFailure}, model.StatusFailure, true},
+	}
+	for _, test := range tests {
+		var procs []*model.Proc
+		for i, state := range test.states {
+			procs = append(procs, &model.Proc{PID: i + 1, State: state})
+		}
+		// the state of steps is ignored.
+		procs = append(procs, &model.Proc{PID: 3, PPID: 1, State: model.StatusRunning})
+
+		status, done := procsStatus(procs)
+		if status != test.status || done != test.done {
+			t.Errorf("Want status %q and %v for %v, got %q and %v", test.status, test.done, test.states, status, done)
+		}
+	}
+}
+
+func TestDispatchBuildGated(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := new(buildStore)
+	build := &model.Build{ID: 1, Number: 1, Status: model.StatusPending}
+	items := []*buildItem{
+		{Proc: &model.Proc{ID: 1, PID: 1, State: model.StatusGated}},
+	}
+	build.Procs = []*model.Proc{items[0].Proc}
+
+	if err := dispatchBuild(context.Background(), s, &model.Repo{FullName: "octocat/hello-world"}, build, items); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.tasks) != 0 {
+		t.Errorf("Want gated pipelines left out of the queue, got %d tasks", len(f.tasks))
+	}
+	if build.Status != model.StatusBlocked {
+		t.Errorf("Want build status %s, got %s", model.StatusBlocked, build.Status)
+	}
+}
+
+func TestCarryOverProcs(t *testing.T) {
+	items := []*buildItem{
+		{Proc: &model.Proc{PID: 1, Name: "linux/amd64"}},
+		{Proc: &model.Proc{PID: 3, Name: "linux/arm"}},
+	}
+	procs := []*model.Proc{
+		items[0].Proc,
+		{PID: 2, PPID: 1, Name: "test"},
+		items[1].Proc,
+		{PID: 4, PPID: 3, Name: "test"},
+	}
+	prev := []*model.Proc{
+		{PID: 1, Name: "linux/amd64", State: model.StatusSuccess, Started: 1, Stopped: 2},
+		{PID: 2, PPID: 1, Name: "test", State: model.StatusSuccess, Started: 1, Stopped: 2},
+		{PID: 3, Name: "linux/arm", State: model.StatusFailure, ExitCode: 1},
+		{PID: 4, PPID: 3, Name: "test", State: model.StatusFailure, ExitCode: 1},
+	}
+
+	retry := carryOverProcs(items, procs, prev)
+
+	if len(retry) != 1 || retry[0].Proc.PID != 3 {
+		t.Fatalf("Want only the failed pipeline enqueued")
+	}
+	for _, proc := range procs[:2] {
+		if proc.State != model.StatusSuccess || proc.Stopped != 2 {
+			t.Errorf("Want proc %d carried over from the previous build", proc.PID)
+		}
+	}
+	for _, proc := range procs[2:] {
+		if proc.State != "" {
+			t.Errorf("Want proc %d of the failed pipeline reset, got %s", proc.PID, proc.State)
+		}
+	}
+}
+
+func TestCarryOverProcsChangedConfig(t *testing.T) {
+	items := []*buildItem{
+		{Proc: &model.Proc{PID: 1, Name: "backend.yml"}},
+		{Proc: &model.Proc{PID: 3, Name: "frontend.yml"}},
+		{Proc: &model.Proc{PID: 6, Name: "docs.yml"}},
+	}
+	procs := []*model.Proc{
+		items[0].Proc,
+		{PID: 2, PPID: 1, Name: "test"},
+		items[1].Proc,
+		{PID: 4, PPID: 3, Name: "build"},
+		{PID: 5, PPID: 3, Name: "test"},
+		items[2].Proc,
+		{PID: 7, PPID: 6, Name: "publish"},
+	}
+	// the previous build ran the frontend pipeline first, and the
+	// backend pipeline without the build step.
+	prev := []*model.Proc{
+		{PID: 1, Name: "frontend.yml", State: model.StatusSuccess},
+		{PID: 2, PPID: 1, Name: "test", State: model.StatusSuccess},
+		{PID: 3, Name: "backend.yml", State: model.StatusFailure},
+		{PID: 4, PPID: 3, Name: "test", State: model.StatusFailure},
+	}
+
+	retry := carryOverProcs(items, procs, prev)
+
+	if len(retry) != 3 {
+		t.Fatalf("Want every changed pipeline enqueued, got %d pipelines", len(retry))
+	}
+	for _, proc := range procs {
+		if proc.State != "" {
+			t.Errorf("Want proc %s of a changed pipeline not carried over, got %s", proc.Name, proc.State)
+		}
+	}
+
+	// the same pipeline with an added step runs again.
+	prev = []*model.Proc{
+		{PID: 1, Name: "backend.yml", State: model.StatusSuccess},
+		{PID: 2, PPID: 1, Name: "test", State: model.StatusSuccess},
+		{PID: 3, Name: "frontend.yml", State: model.StatusSuccess},
+		{PID: 4, PPID: 3, Name: "test", State: model.StatusSuccess},
+	}
+	retry = carryOverProcs(items, procs, prev)
+	if len(retry) != 2 || retry[0].Proc.Name != "frontend.yml" || retry[1].Proc.Name != "docs.yml" {
+		t.Errorf("Want the pipelines with new steps enqueued, got %d pipelines", len(retry))
+	}
+	if procs[0].State != model.StatusSuccess || procs[1].State != model.StatusSuccess {
+		t.Errorf("Want the unchanged pipeline carried over")
+	}
+}
@@ -0,0 +1,526 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDescendants(t *testing.T) {
+	procs := []*model.Proc{
+		{PID: 1, PPID: 0},
+		{PID: 2, PPID: 0},
+		{PID: 3, PPID: 1},
+		{PID: 4, PPID: 1},
+		{PID: 5, PPID: 2},
+	}
+
+	got := descendants(procs, procs[0])
+	if len(got) != 2 {
+		t.Fatalf("Want 2 descendants, got %d", len(got))
+	}
+	if got[0].PID != 3 || got[1].PID != 4 {
+		t.Errorf("Want descendants with pid 3 and 4, got %d and %d", got[0].PID, got[1].PID)
+	}
+}
+
+func TestParseBuildNumber(t *testing.T) {
+	tests := []struct {
+		param string
+		num   int
+		ok    bool
+	}{
+		{"1", 1, true},
+		{"42", 42, true},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"foo", 0, false},
+	}
+	for _, test := range tests {
+		c, w, _ := gin.CreateTestContext()
+		c.Params = gin.Params{{Key: "number", Value: test.param}}
+
+		num, ok := parseBuildNumber(c)
+		if num != test.num || ok != test.ok {
+			t.Errorf("Want build number %d and %v for %q, got %d and %v", test.num, test.ok, test.param, num, ok)
+		}
+		if !test.ok && w.Code != 400 {
+			t.Errorf("Want status 400 for %q, got %d", test.param, w.Code)
+		}
+	}
+}
+
+// missingProcStore is a store with a build without procs.
+type missingProcStore struct {
+	buildStore
+}
+
+func (s *missingProcStore) ProcFind(*model.Build, int) (*model.Proc, error) {
+	return nil, sql.ErrNoRows
+}
+
+func TestGetProcErrors(t *testing.T) {
+	tests := []struct {
+		pid  string
+		code int
+		err  string
+	}{
+		{"foo", 400, errInvalidParam},
+		{"1", 404, errNotFound},
+	}
+	for _, test := range tests {
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds/1/"+test.pid, nil)
+		c.Params = gin.Params{{Key: "number", Value: "1"}, {Key: "pid", Value: test.pid}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, &missingProcStore{buildStore{build: &model.Build{ID: 1, Number: 1}}})
+
+		GetProc(c)
+
+		out := errorResponse{}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		if w.Code != test.code || out.Code != test.err {
+			t.Errorf("Want %d %s error for proc %s, got %d %q", test.code, test.err, test.pid, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestGetBuildEnviron(t *testing.T) {
+	s := &buildStore{
+		build:   &model.Build{ID: 1, Number: 1},
+		environ: map[string]string{"GLOBAL": "global"},
+	}
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds/1/env", nil)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	store.ToContext(c, s)
+
+	GetBuildEnviron(c)
+
+	out := map[string]string{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	if w.Code != 200 || !reflect.DeepEqual(out, s.environ) {
+		t.Errorf("Want the build environment %v, got %d %s", s.environ, w.Code, w.Body.String())
+	}
+}
+
+// missingConfigStore is a store that lost the build configurations.
+type missingConfigStore struct {
+	buildStore
+}
+
+func (s *missingConfigStore) ConfigLoad(int64) (*model.Config, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *missingConfigStore) BuildParamsFind(int64) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func TestGetBuildConfig(t *testing.T) {
+	configs := Config.Storage.Config
+	defer func() { Config.Storage.Config = configs }()
+
+	missing := new(missingConfigStore)
+	missing.build = &model.Build{ID: 1, Number: 1, ConfigID: 7}
+
+	tests := []struct {
+		store interface {
+			store.Store
+			model.ConfigStore
+		}
+		code int
+	}{
+		{newGateStore(), 200},
+		{missing, 404},
+	}
+	for _, test := range tests {
+		Config.Storage.Config = test.store
+
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds/1/config", nil)
+		c.Params = gin.Params{{Key: "number", Value: "1"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, test.store)
+
+		GetBuildConfig(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d, got %d", test.code, w.Code)
+		}
+		if test.code == 200 {
+			out := new(model.Config)
+			json.Unmarshal(w.Body.Bytes(), out)
+			if !strings.HasPrefix(out.Data, "approval: ${GATED}") {
+				t.Errorf("Want the stored configuration, got %q", out.Data)
+			}
+		}
+	}
+}
+
+// listStore is a store that returns the procs and files of a build,
+// or the configured errors.
+type listStore struct {
+	buildStore
+	procErr error
+	fileErr error
+}
+
+func (s *listStore) ProcList(*model.Build) ([]*model.Proc, error) {
+	if s.procErr != nil {
+		return nil, s.procErr
+	}
+	return []*model.Proc{}, nil
+}
+
+func (s *listStore) FileList(*model.Build) ([]*model.File, error) {
+	if s.fileErr != nil {
+		return nil, s.fileErr
+	}
+	return []*model.File{}, nil
+}
+
+func TestGetBuildInclude(t *testing.T) {
+	tests := []struct {
+		query string
+		code  int
+		files bool
+		procs bool
+	}{
+		{"", 200, true, true},
+		{"?include=procs", 200, false, true},
+		{"?include=files,procs", 200, true, true},
+		{"?include=", 200, false, false},
+		{"?include=logs", 400, false, false},
+	}
+	for _, test := range tests {
+		// the store fails the queries that are not included.
+		s := &listStore{
+			procErr: errors.New("procs queried"),
+			fileErr: errors.New("files queried"),
+		}
+		if test.procs {
+			s.procErr = nil
+		}
+		if test.files {
+			s.fileErr = nil
+		}
+		s.build = &model.Build{ID: 1, Number: 1, Status: model.StatusSuccess}
+
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds/1"+test.query, nil)
+		c.Params = gin.Params{{Key: "number", Value: "1"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, s)
+
+		GetBuild(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d for %q, got %d: %s", test.code, test.query, w.Code, w.Body)
+		}
+	}
+}
+
+func TestGetBuildConfigs(t *testing.T) {
+	tests := []struct {
+		confs []*model.Config
+		want  []string
+	}{
+		{nil, nil},
+		{[]*model.Config{{Name: "build.yml"}, {Name: "deploy.yml"}}, []string{"build.yml", "deploy.yml"}},
+	}
+	for _, test := range tests {
+		s := new(listStore)
+		s.build = &model.Build{ID: 1, Number: 1, Status: model.StatusSuccess}
+		s.confs = test.confs
+
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds/1", nil)
+		c.Params = gin.Params{{Key: "number", Value: "1"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, s)
+
+		GetBuild(c)
+
+		out := new(model.Build)
+		json.Unmarshal(w.Body.Bytes(), out)
+		if w.Code != 200 || !reflect.DeepEqual(out.Configs, test.want) {
+			t.Errorf("Want build configs %v, got %d %s", test.want, w.Code, w.Body)
+		}
+	}
+}
+
+func TestGetBuildListErrors(t *testing.T) {
+	tests := []struct {
+		store *listStore
+		code  int
+	}{
+		{&listStore{}, 200},
+		{&listStore{procErr: errors.New("connection reset")}, 500},
+		{&listStore{fileErr: errors.New("connection reset")}, 500},
+	}
+	for _, test := range tests {
+		test.store.build = &model.Build{ID: 1, Number: 1, Status: model.StatusSuccess}
+
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds/1", nil)
+		c.Params = gin.Params{{Key: "number", Value: "1"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, test.store)
+
+		GetBuild(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d, got %d", test.code, w.Code)
+		}
+		if test.code != 500 {
+			continue
+		}
+		out := errorResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("Want a JSON error response, got %q", w.Body.String())
+		}
+		if out.Code != errStore || !strings.Contains(out.Message, "connection reset") {
+			t.Errorf("Want the store error in the response, got %q", w.Body.String())
+		}
+	}
+}
+
+// filterStore is a store that records the build list filter and
+// returns no builds, or the error.
+type filterStore struct {
+	buildStore
+	filter  *model.BuildFilter
+	perPage int
+	err     error
+}
+
+func (s *filterStore) GetBuildListCount(repo *model.Repo, filter *model.BuildFilter) (int, error) {
+	s.filter = filter
+	return 0, s.err
+}
+
+func (s *filterStore) GetBuildListFiltered(repo *model.Repo, page, perPage int, filter *model.BuildFilter) ([]*model.Build, error) {
+	s.perPage = perPage
+	return []*model.Build{}, s.err
+}
+
+func (s *filterStore) GetBuildListBefore(repo *model.Repo, before, limit int) ([]*model.Build, error) {
+	return []*model.Build{}, s.err
+}
+
+func TestGetBuildsStoreError(t *testing.T) {
+	s := &filterStore{err: errors.New("connection reset")}
+	for _, handler := range []gin.HandlerFunc{GetBuilds, GetBuildsCursor} {
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds?before=0", nil)
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, s)
+
+		handler(c)
+
+		out := errorResponse{}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		if w.Code != 500 || out.Code != errStore || !strings.Contains(out.Message, "connection reset") {
+			t.Errorf("Want the store error in the response, got %d %q", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestGetBuildsFilter(t *testing.T) {
+	s := new(filterStore)
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds?author=octocat&pr=123", nil)
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	store.ToContext(c, s)
+
+	GetBuilds(c)
+
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("Want status 200 with an empty list, got %d %s", w.Code, w.Body)
+	}
+	if s.perPage != 25 {
+		t.Errorf("Want the default of 25 builds per page, got %d", s.perPage)
+	}
+	if s.filter.Author != "octocat" {
+		t.Errorf("Want builds filtered by author octocat, got %q", s.filter.Author)
+	}
+	if len(s.filter.Refs) == 0 || s.filter.Refs[0] != "refs/pull/123/head" {
+		t.Errorf("Want builds filtered by pull request refs, got %v", s.filter.Refs)
+	}
+
+	for _, pr := range []string{"abc", "0", "-1"} {
+		c, w, _ = gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds?pr="+pr, nil)
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, s)
+
+		GetBuilds(c)
+
+		if w.Code != 400 {
+			t.Errorf("Want status 400 for pr %q, got %d", pr, w.Code)
+		}
+	}
+}
+
+// commitStore is a store with builds of the given commits.
+type commitStore struct {
+	buildStore
+	commits []string
+}
+
+func (s *commitStore) GetBuildCommitList(repo *model.Repo, prefix string, limit int) ([]string, error) {
+	commits := []string{}
+	for _, commit := range s.commits {
+		if strings.HasPrefix(commit, prefix) {
+			commits = append(commits, commit)
+		}
+	}
+	return commits, nil
+}
+
+func (s *commitStore) GetBuildLastCommit(repo *model.Repo, sha string) (*model.Build, error) {
+	return &model.Build{Number: 1, Commit: sha}, nil
+}
+
+func TestGetBuildCommit(t *testing.T) {
+	s := &commitStore{
+		commits: []string{
+			"85f8c029b902ed9400bc600bac301a0aadb144aa",
+			"85f8c029b902ed9400bc600bac301a0aadb144ac",
+			"d0a3e1b2c4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9",
+		},
+	}
+	tests := []struct {
+		commit string
+		code   int
+	}{
+		{"d0a3e1b", 200},
+		{"D0A3E1B", 200},
+		{"85f8c029b902ed9400bc600bac301a0aadb144ac", 200},
+		{"85f8c02", 409},
+		{"deadbeef", 404},
+		{"d0a3e1", 400},
+		{"d0a3e1b%", 400},
+	}
+	for _, test := range tests {
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds?commit="+url.QueryEscape(test.commit), nil)
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, s)
+
+		GetBuilds(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d for commit %s, got %d", test.code, test.commit, w.Code)
+		}
+		if w.Code == 409 {
+			out := struct {
+				Candidates []string `json:"candidates"`
+			}{}
+			json.Unmarshal(w.Body.Bytes(), &out)
+			if !reflect.DeepEqual(out.Candidates, s.commits[:2]) {
+				t.Errorf("Want the matching commits as candidates, got %v", out.Candidates)
+			}
+		}
+	}
+}
+
+func TestGetBuildCompare(t *testing.T) {
+	s := &buildStore{
+		build: &model.Build{ID: 1, Number: 1, Status: model.StatusSuccess},
+		procs: []*model.Proc{
+			{PID: 1, Name: "linux/amd64", State: model.StatusSuccess},
+			{PID: 2, PPID: 1, Name: "test", State: model.StatusSuccess},
+		},
+	}
+	tests := []struct {
+		a, b string
+		code int
+	}{
+		{"1", "1", 200},
+		{"1", "x", 400},
+	}
+	for _, test := range tests {
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/compare/"+test.a+"/"+test.b, nil)
+		c.Params = gin.Params{{Key: "a", Value: test.a}, {Key: "b", Value: test.b}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, s)
+
+		GetBuildCompare(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d comparing %s and %s, got %d", test.code, test.a, test.b, w.Code)
+		}
+		if test.code == 200 {
+			out := new(model.BuildComparison)
+			json.Unmarshal(w.Body.Bytes(), out)
+			if len(out.Procs) != 2 || out.Procs[1].Path != "linux/amd64/test" || out.Procs[1].Change != model.ProcUnchanged {
+				t.Errorf("Want the procs compared by path, got %+v", out.Procs)
+			}
+		}
+	}
+}
+
+// paramsStore is a list store that returns the build parameters.
+type paramsStore struct {
+	listStore
+	params map[string]string
+}
+
+func (s *paramsStore) BuildParamsFind(int64) (map[string]string, error) {
+	return s.params, nil
+}
+
+func TestGetBuildEnvironPerm(t *testing.T) {
+	for _, push := range []bool{true, false} {
+		s := new(paramsStore)
+		s.build = &model.Build{ID: 1, Number: 1, Status: model.StatusSuccess}
+		s.environ = map[string]string{"REPO": "repo"}
+		s.params = map[string]string{"deploy_to": "staging"}
+
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds/1", nil)
+		c.Params = gin.Params{{Key: "number", Value: "1"}}
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		c.Set("perm", &model.Perm{Pull: true, Push: push})
+		store.ToContext(c, s)
+
+		GetBuild(c)
+
+		out := new(model.Build)
+		json.Unmarshal(w.Body.Bytes(), out)
+		if got := out.Environ["REPO"] == "repo"; got != push {
+			t.Errorf("Want the build environment included %v for push access %v, got %v", push, push, out.Environ)
+		}
+		if got := out.Params["deploy_to"] == "staging"; got != push {
+			t.Errorf("Want the build parameters included %v for push access %v, got %v", push, push, out.Params)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+	"github.com/drone/drone/store"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTriggerBuild(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := new(buildStore)
+	defer withConfigStore(s)()
+
+	rmt := new(nopRemote)
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds?FOO=bar",
+		strings.NewReader(`{"branch":"develop","commit":"a1b2c3","params":{"BAZ":"qux"}}`))
+	remote.ToContext(c, rmt)
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Branch: "master", Config: ".drone.yml", AllowPush: true})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	TriggerBuild(c)
+
+	if got := c.Writer.Status(); got != 202 {
+		t.Fatalf("Want status 202, got %d", got)
+	}
+	if len(s.created) != 1 {
+		t.Fatalf("Want build created, got %d builds", len(s.created))
+	}
+	build := s.created[0]
+	if build.Event != model.EventManual {
+		t.Errorf("Want build event %s, got %s", model.EventManual, build.Event)
+	}
+	if build.Branch != "develop" || build.Commit != "a1b2c3" {
+		t.Errorf("Want branch and commit from the request, got %s and %s", build.Branch, build.Commit)
+	}
+	if build.Sender != "octocat" {
+		t.Errorf("Want build sender octocat, got %s", build.Sender)
+	}
+	if build.Verified {
+		t.Errorf("Want manually triggered build not verified")
+	}
+	if rmt.ref != "a1b2c3" {
+		t.Errorf("Want configuration fetched from the commit, got %s", rmt.ref)
+	}
+	if s.params["FOO"] != "bar" || s.params["BAZ"] != "qux" {
+		t.Errorf("Want query and body parameters saved, got %v", s.params)
+	}
+}
+
+func TestTriggerBuildEventNotEnabled(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := new(buildStore)
+	defer withConfigStore(s)()
+
+	c := newStartContext(s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds", strings.NewReader(`{"ref":"refs/tags/v1.0","commit":"a1b2c3"}`))
+	remote.ToContext(c, new(nopRemote))
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Branch: "master", Config: ".drone.yml", AllowPush: true})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	TriggerBuild(c)
+
+	if got := c.Writer.Status(); got != 403 {
+		t.Errorf("Want status 403 for a tag build with tag events disabled, got %d", got)
+	}
+	if len(s.created) != 0 {
+		t.Errorf("Want no build created")
+	}
+}
+
+func TestTriggerBuildQueueError(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+	f.pushErr = errors.New("queue unavailable")
+
+	backoff := pushBackoff
+	pushBackoff = 0
+	defer func() { pushBackoff = backoff }()
+
+	s := new(buildStore)
+	defer withConfigStore(s)()
+
+	c, w, _ := gin.CreateTestContext()
+	store.ToContext(c, s)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds", strings.NewReader(`{"commit":"a1b2c3"}`))
+	remote.ToContext(c, new(nopRemote))
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Branch: "master", Config: ".drone.yml", AllowPush: true})
+	c.Set("user", &model.User{Login: "octocat"})
+
+	TriggerBuild(c)
+
+	out := errorResponse{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	if w.Code != 500 || out.Code != errInternal || !strings.Contains(out.Message, "queue unavailable") {
+		t.Errorf("Want a JSON error when the build cannot start, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestTriggerBuildProtected(t *testing.T) {
+	for _, admin := range []bool{false, true} {
+		f, restore := withFakeServices()
+
+		s := new(buildStore)
+		restoreStore := withConfigStore(s)
+
+		c := newStartContext(s)
+		c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds",
+			strings.NewReader(`{"branch":"release/1.0","commit":"a1b2c3"}`))
+		remote.ToContext(c, new(nopRemote))
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Config: ".drone.yml", AllowPush: true, ProtBranches: []string{"release/*"}})
+		c.Set("user", &model.User{Login: "octocat"})
+		c.Set("perm", &model.Perm{Push: true, Admin: admin})
+
+		TriggerBuild(c)
+		restoreStore()
+		restore()
+
+		if got := c.Writer.Status(); got != 202 {
+			t.Fatalf("Want status 202, got %d", got)
+		}
+		if len(s.created) != 1 {
+			t.Fatalf("Want build created, got %d builds", len(s.created))
+		}
+		build := s.created[0]
+		if blocked := build.Status == model.StatusBlocked && build.BlockReason != ""; blocked == admin {
+			t.Errorf("Want build of a protected branch blocked %v for admin %v, got status %s", !admin, admin, build.Status)
+		}
+		if queued := len(f.tasks) != 0; queued != admin {
+			t.Errorf("Want build of a protected branch queued %v for admin %v", admin, admin)
+		}
+	}
+}
+
+func TestTriggerBuildRef(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	tests := []struct {
+		body   string
+		code   int
+		branch string
+		ref    string
+		commit string
+	}{
+		{`{"ref":"refs/tags/v1.0","commit":"a1b2c3"}`, 202, "master", "refs/tags/v1.0", "a1b2c3"},
+		{`{"ref":"refs/heads/develop"}`, 202, "develop", "refs/heads/develop", "9ecad50"},
+		{`{"branch":"develop"}`, 202, "develop", "refs/heads/develop", "9ecad50"},
+		{`{}`, 202, "master", "refs/heads/master", "9ecad50"},
+		{`{"ref":"refs/tags/v1.0"}`, 400, "", "", ""},
+		{`{"ref":"v1.0"}`, 400, "", "", ""},
+	}
+	for _, test := range tests {
+		s := new(buildStore)
+		restoreStore := withConfigStore(s)
+
+		rmt := new(nopRemote)
+		c := newStartContext(s)
+		c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds", strings.NewReader(test.body))
+		remote.ToContext(c, rmt)
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Branch: "master", Config: ".drone.yml", AllowPush: true, AllowTag: true})
+		c.Set("user", &model.User{Login: "octocat"})
+
+		TriggerBuild(c)
+		restoreStore()
+
+		if got := c.Writer.Status(); got != test.code {
+			t.Errorf("Want status %d for %s, got %d", test.code, test.body, got)
+			continue
+		}
+		if test.code != 202 {
+			continue
+		}
+		build := s.created[0]
+		if build.Branch != test.branch || build.Ref != test.ref {
+			t.Errorf("Want branch %s and ref %s for %s, got %s and %s", test.branch, test.ref, test.body, build.Branch, build.Ref)
+		}
+		if build.Commit != test.commit {
+			t.Errorf("Want commit %s for %s, got %s", test.commit, test.body, build.Commit)
+		}
+		if rmt.ref != test.commit {
+			t.Errorf("Want configuration fetched from %s, got %s", test.commit, rmt.ref)
+		}
+		if build.Trigger != model.TriggerAPI {
+			t.Errorf("Want build trigger %s, got %s", model.TriggerAPI, build.Trigger)
+		}
+	}
+}
+
+func TestTriggerBuildBranchHead(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	tests := []struct {
+		remote remote.Remote
+		code   int
+	}{
+		{&nopRemote{headErr: errors.New("branch not found")}, 404},
+		{struct{ remote.Remote }{}, 400},
+	}
+	for _, test := range tests {
+		s := new(buildStore)
+		restoreStore := withConfigStore(s)
+
+		c := newStartContext(s)
+		c.Request, _ = http.NewRequest("POST", "http://drone.example.com/api/repos/octocat/hello-world/builds", strings.NewReader(`{"branch":"deleted"}`))
+		remote.ToContext(c, test.remote)
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Branch: "master", Config: ".drone.yml", AllowPush: true})
+		c.Set("user", &model.User{Login: "octocat"})
+
+		TriggerBuild(c)
+		restoreStore()
+
+		if got := c.Writer.Status(); got != test.code {
+			t.Errorf("Want status %d when the branch head cannot be resolved, got %d", test.code, got)
+		}
+		if len(s.created) != 0 {
+			t.Errorf("Want no build created without a commit")
+		}
+	}
+}
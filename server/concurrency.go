@@ -0,0 +1,112 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store"
+)
+
+// concurrency serializes the build concurrency checks, so that two
+// builds of a repository are not started for the same free slot.
+var concurrency sync.Mutex
+
+// holdBuild holds the build back if the repository has reached its
+// build concurrency limit, and returns true if it was held. The build
+// must be stored as pending, it is counted as active until held.
+func holdBuild(s store.Store, repo *model.Repo, build *model.Build) (bool, error) {
+	if repo.MaxBuilds <= 0 {
+		return false, nil
+	}
+	concurrency.Lock()
+	defer concurrency.Unlock()
+
+	active, err := s.GetBuildActiveCount(repo)
+	if err != nil {
+		return false, err
+	}
+	if active <= repo.MaxBuilds {
+		return false, nil
+	}
+	build.Held = true
+	if err := s.UpdateBuild(build); err != nil {
+		build.Held = false
+		return false, err
+	}
+	logrus.Debugf("holding %s#%d: build concurrency limit reached", repo.FullName, build.Number)
+	return true, nil
+}
+
+// release starts the builds of the repository that are held back by
+// the build concurrency limit, oldest first, for as long as the
+// repository is below the limit.
+func (l *launcher) release(repo *model.Repo) {
+	for {
+		build := l.nextHeld(repo)
+		if build == nil {
+			return
+		}
+		logrus.Debugf("releasing %s#%d: build concurrency slot available", repo.FullName, build.Number)
+		if err := l.resume(repo, build); err != nil {
+			logrus.Errorf("cannot start held build %s#%d. %s", repo.FullName, build.Number, err)
+		}
+	}
+}
+
+// nextHeld returns the oldest held back build of the repository if the
+// repository is below its build concurrency limit, and counts it as
+// active. It returns nil otherwise.
+func (l *launcher) nextHeld(repo *model.Repo) *model.Build {
+	concurrency.Lock()
+	defer concurrency.Unlock()
+
+	if repo.MaxBuilds > 0 {
+		active, err := l.store.GetBuildActiveCount(repo)
+		if err != nil || active >= repo.MaxBuilds {
+			return nil
+		}
+	}
+	build, err := l.store.GetBuildHeld(repo)
+	if err != nil {
+		return nil
+	}
+	build.Held = false
+	if err := l.store.UpdateBuild(build); err != nil {
+		logrus.Errorf("cannot release held build %s#%d. %s", repo.FullName, build.Number, err)
+		return nil
+	}
+	return build
+}
+
+// resume starts a build that was held back with its configurations and
+// parameters.
+func (l *launcher) resume(repo *model.Repo, build *model.Build) error {
+	user, err := l.store.GetUser(repo.UserID)
+	if err != nil {
+		return l.fail(repo, build, err)
+	}
+	confs, err := buildConfigs(l.store, build)
+	if err != nil {
+		return l.fail(repo, build, err)
+	}
+	params, err := l.store.BuildParamsFind(build.ID)
+	if err != nil {
+		return l.fail(repo, build, err)
+	}
+	return l.launch(repo, user, build, confs, params, nil)
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitStore is a store that reports a fixed number of active builds
+// and returns the held builds in order.
+type limitStore struct {
+	buildStore
+	active int
+	held   []*model.Build
+}
+
+func (s *limitStore) GetBuildActiveCount(*model.Repo) (int, error) {
+	return s.active, nil
+}
+
+func (s *limitStore) GetBuildHeld(*model.Repo) (*model.Build, error) {
+	if len(s.held) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	build := s.held[0]
+	s.held = s.held[1:]
+	return build, nil
+}
+
+func TestHoldBuild(t *testing.T) {
+	tests := []struct {
+		limit  int
+		active int
+		held   bool
+	}{
+		{limit: 0, active: 5, held: false},
+		{limit: 2, active: 2, held: false},
+		{limit: 2, active: 3, held: true},
+	}
+	for _, test := range tests {
+		s := &limitStore{active: test.active}
+		repo := &model.Repo{FullName: "octocat/hello-world", MaxBuilds: test.limit}
+		build := &model.Build{Number: 3, Status: model.StatusPending}
+
+		held, err := holdBuild(s, repo, build)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if held != test.held || build.Held != test.held {
+			t.Errorf("Want build held %v with limit %d and %d active builds, got %v", test.held, test.limit, test.active, held)
+		}
+		if test.held && len(s.updated) != 1 {
+			t.Errorf("Want the held build updated")
+		}
+		if !test.held && len(s.updated) != 0 {
+			t.Errorf("Want the build not updated when not held")
+		}
+	}
+}
+
+func TestNextHeld(t *testing.T) {
+	s := &limitStore{
+		active: 1,
+		held:   []*model.Build{{Number: 2, Status: model.StatusPending, Held: true}},
+	}
+	repo := &model.Repo{FullName: "octocat/hello-world", MaxBuilds: 2}
+	l := &launcher{store: s}
+
+	build := l.nextHeld(repo)
+	if build == nil || build.Number != 2 {
+		t.Fatalf("Want the oldest held build released, got %v", build)
+	}
+	if build.Held {
+		t.Errorf("Want the released build no longer held")
+	}
+	if len(s.updated) != 1 {
+		t.Errorf("Want the released build updated")
+	}
+	if build := l.nextHeld(repo); build != nil {
+		t.Errorf("Want no build released without held builds")
+	}
+}
+
+func TestNextHeldLimitReached(t *testing.T) {
+	s := &limitStore{
+		active: 2,
+		held:   []*model.Build{{Number: 3, Status: model.StatusPending, Held: true}},
+	}
+	repo := &model.Repo{FullName: "octocat/hello-world", MaxBuilds: 2}
+	l := &launcher{store: s}
+
+	if build := l.nextHeld(repo); build != nil {
+		t.Errorf("Want no build released at the build concurrency limit, got #%d", build.Number)
+	}
+	if len(s.held) != 1 {
+		t.Errorf("Want the held build kept")
+	}
+}
+
+// releaseStore is a reaper store that counts the lookups of held
+// builds, made when a build concurrency slot is released.
+type releaseStore struct {
+	reaperStore
+	released int
+}
+
+func (s *releaseStore) GetBuildActiveCount(*model.Repo) (int, error) {
+	return 0, nil
+}
+
+func (s *releaseStore) GetBuildHeld(*model.Repo) (*model.Build, error) {
+	s.released++
+	return nil, sql.ErrNoRows
+}
+
+func TestReleaseOnFinish(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	started := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+	repo := &model.Repo{ID: 1, FullName: "octocat/hello-world", MaxBuilds: 1, Timeout: 60}
+
+	newContext := func(s *releaseStore) *gin.Context {
+		c := newStartContext(s)
+		c.Params = gin.Params{{Key: "number", Value: "1"}}
+		c.Set("repo", repo)
+		c.Set("user", &model.User{Login: "octocat", Admin: true})
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		finish func(s *releaseStore)
+	}{
+		{"fail", model.StatusPending, func(s *releaseStore) {
+			l := &launcher{store: s, remote: new(nopRemote)}
+			l.fail(repo, s.build, errors.New("cannot compile"))
+		}},
+		{"zombie kill", model.StatusRunning, func(s *releaseStore) {
+			ZombieKill(newContext(s))
+		}},
+		{"decline", model.StatusBlocked, func(s *releaseStore) {
+			c := newContext(s)
+			c.Request, _ = http.NewRequest("POST", "http://drone.example.com/", nil)
+			remote.ToContext(c, new(nopRemote))
+			PostDecline(c)
+		}},
+		{"reaper", model.StatusRunning, func(s *releaseStore) {
+			s.feed = []*model.Feed{{FullName: repo.FullName, Number: 1, Status: model.StatusRunning, Started: started.Unix()}}
+			reaper := &Reaper{Store: s, Remote: new(nopRemote)}
+			reaper.Reap(started.Add(2 * time.Hour))
+		}},
+	}
+	for _, test := range tests {
+		s := &releaseStore{}
+		s.repo = repo
+		s.running = []*model.Proc{{ID: 1, PID: 1, State: model.StatusRunning, Started: started.Unix()}}
+		s.build = &model.Build{Number: 1, Status: test.status, Started: started.Unix()}
+
+		test.finish(s)
+
+		if s.released == 0 {
+			t.Errorf("Want a concurrency slot released on %s", test.name)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cncd/pipeline/pipeline/frontend/yaml"
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+	"github.com/drone/drone/store"
+)
+
+// configDir returns true if the configuration path of the repository
+// names a directory, such as .drone/, in which case every yaml file in
+// the directory is a pipeline configuration.
+func configDir(repo *model.Repo) bool {
+	return strings.HasSuffix(repo.Config, "/")
+}
+
+// fetchConfigFiles fetches the configuration files of the repository.
+// The configuration file is fetched with file, and the files of a
+// configuration directory are listed at the given ref, ordered by name.
+func fetchConfigFiles(r remote.Remote, user *model.User, repo *model.Repo, ref string, file func(string) ([]byte, error)) ([]*remote.FileMeta, error) {
+	if !configDir(repo) {
+		data, err := file(repo.Config)
+		if err != nil {
+			return nil, err
+		}
+		return []*remote.FileMeta{{Name: repo.Config, Data: data}}, nil
+	}
+
+	lister, ok := r.(remote.DirLister)
+	if !ok {
+		return nil, fmt.Errorf("the remote does not support configuration directories")
+	}
+	list, err := lister.Dir(user, repo, ref, strings.TrimSuffix(repo.Config, "/"))
+	if err != nil {
+		return nil, err
+	}
+	var files []*remote.FileMeta
+	for _, f := range list {
+		switch path.Ext(f.Name) {
+		case ".yml", ".yaml":
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		return nil, remote.ErrFileNotFound
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// fetchFallbackConfig fetches the fallback configuration file from the
+// default branch of the fallback repository, for a repository that has
+// no configuration of its own. It returns the file and the source of
+// the configuration, see fallbackSource.
+func fetchFallbackConfig(r remote.Remote, user *model.User, repo *model.Repo) ([]*remote.FileMeta, string, error) {
+	if Config.Server.ConfigFallback == "" || repo.NoFallback {
+		return nil, "", fmt.Errorf("the configuration fallback is disabled")
+	}
+	parts := strings.Split(Config.Server.ConfigFallback, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, "", fmt.Errorf("invalid fallback repository %s", Config.Server.ConfigFallback)
+	}
+	from, err := r.Repo(user, parts[0], parts[1])
+	if err != nil {
+		return nil, "", err
+	}
+	file := Config.Server.ConfigFallbackPath
+	data, err := r.FileRef(user, from, "refs/heads/"+from.Branch, file)
+	if err != nil {
+		return nil, "", err
+	}
+	files := []*remote.FileMeta{{Name: path.Base(file), Data: data}}
+	return files, from.FullName + ":" + file, nil
+}
+
+// fetchHookConfigFiles fetches the configuration files of the hook
+// build. Repositories without a configuration of their own run the
+// fallback configuration, unless it is disabled, and the source of the
+// fallback is recorded in the build. Any other error, such as a timeout
+// or a rate limit, is returned so that the fallback never replaces the
+// configuration of the repository.
+func fetchHookConfigFiles(r remote.Remote, user *model.User, repo *model.Repo, build *model.Build, file func(string) ([]byte, error)) ([]*remote.FileMeta, error) {
+	files, err := fetchConfigFiles(r, user, repo, build.Commit, file)
+	if err != remote.ErrFileNotFound {
+		return files, err
+	}
+	fallback, source, ferr := fetchFallbackConfig(r, user, repo)
+	if ferr != nil {
+		return nil, err
+	}
+	logrus.Infof("%s: cannot find %s in %s, using the fallback configuration %s", repo.FullName, repo.Config, build.Ref, source)
+	build.Fallback = source
+	return fallback, nil
+}
+
+// fallbackSource splits the configuration source of a build that runs
+// the fallback configuration, in the form repository:path.
+func fallbackSource(build *model.Build) (repo, file string) {
+	parts := strings.SplitN(build.Fallback, ":", 2)
+	if len(parts) != 2 {
+		return build.Fallback, ""
+	}
+	return parts[0], parts[1]
+}
+
+// persistConfigs stores the configuration files of the repository. The
+// configurations of a configuration directory are named after their
+// file.
+func persistConfigs(repo *model.Repo, files []*remote.FileMeta) ([]*model.Config, error) {
+	var confs []*model.Config
+	for _, f := range files {
+		conf, err := findOrPersistConfig(repo, f.Data)
+		if err != nil {
+			return nil, err
+		}
+		if configDir(repo) {
+			conf.Name = f.Name
+		}
+		confs = append(confs, conf)
+	}
+	return confs, nil
+}
+
+// fetchConfigs fetches the configuration files of the repository at the
+// given ref and stores them.
+func fetchConfigs(r remote.Remote, user *model.User, repo *model.Repo, ref string) ([]*model.Config, error) {
+	files, err := fetchConfigFiles(r, user, repo, ref, func(f string) ([]byte, error) {
+		return r.FileRef(user, repo, ref, f)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return persistConfigs(repo, files)
+}
+
+// matchBranches returns the configurations that may run for the branch
+// of the build. Configurations without branch restrictions, and builds
+// for tags and deployments, always match.
+func matchBranches(confs []*model.Config, build *model.Build) []*model.Config {
+	if build.Event == model.EventTag || build.Event == model.EventDeploy {
+		return confs
+	}
+	var matched []*model.Config
+	for _, conf := range confs {
+		parsed, err := yaml.ParseString(conf.Data)
+		if err == nil && !parsed.Branches.Match(build.Branch) {
+			continue
+		}
+		matched = append(matched, conf)
+	}
+	return matched
+}
+
+// buildConfigs returns the configurations the build was created from.
+// A build created from a single configuration file has no stored build
+// configurations, its configuration is loaded by id instead.
+func buildConfigs(s store.Store, build *model.Build) ([]*model.Config, error) {
+	confs, err := s.BuildConfigFind(build.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(confs) != 0 {
+		return confs, nil
+	}
+	conf, err := Config.Storage.Config.ConfigLoad(build.ConfigID)
+	if err != nil {
+		return nil, err
+	}
+	return []*model.Config{conf}, nil
+}
+
+// saveBuildConfigs stores the configurations of a build created from a
+// configuration directory. The configuration of a build created from
+// a single configuration file is only referenced by the build.
+func saveBuildConfigs(s store.Store, build *model.Build, confs []*model.Config) error {
+	if len(confs) == 0 || confs[0].Name == "" {
+		return nil
+	}
+	return s.BuildConfigSave(build.ID, confs)
+}
+
+// configNames returns the names of the configurations, which are empty
+// for a single configuration file.
+func configNames(confs []*model.Config) []string {
+	var names []string
+	for _, conf := range confs {
+		if conf.Name != "" {
+			names = append(names, conf.Name)
+		}
+	}
+	return names
+}
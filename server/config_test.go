@@ -0,0 +1,108 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+)
+
+// fallbackRemote is a remote that has no configuration file, except in
+// the fallback repository.
+type fallbackRemote struct {
+	nopRemote
+	repo string
+	ref  string
+}
+
+func (r *fallbackRemote) Repo(u *model.User, owner, name string) (*model.Repo, error) {
+	return &model.Repo{Owner: owner, Name: name, FullName: owner + "/" + name, Branch: "main"}, nil
+}
+
+func (r *fallbackRemote) FileRef(u *model.User, repo *model.Repo, ref, f string) ([]byte, error) {
+	if repo.FullName != "platform/starter" {
+		return nil, sql.ErrNoRows
+	}
+	r.repo, r.ref = repo.FullName, ref
+	return []byte("pipeline:\n  test:\n    image: golang\n    commands: [ go test ]\n"), nil
+}
+
+func TestFetchHookConfigFiles(t *testing.T) {
+	server := Config.Server
+	defer func() {
+		Config.Server = server
+	}()
+	Config.Server.ConfigFallback = "platform/starter"
+	Config.Server.ConfigFallbackPath = ".drone.yml"
+
+	tests := []struct {
+		err      error
+		fallback bool
+	}{
+		{remote.ErrFileNotFound, true},
+		{errors.New("API rate limit exceeded"), false},
+	}
+	for _, test := range tests {
+		build := &model.Build{Commit: "9ecad50"}
+		files, err := fetchHookConfigFiles(new(fallbackRemote), new(model.User), &model.Repo{FullName: "octocat/hello-world", Config: ".drone.yml"}, build, func(string) ([]byte, error) {
+			return nil, test.err
+		})
+		if test.fallback && (err != nil || len(files) != 1 || build.Fallback == "") {
+			t.Errorf("Want the fallback configuration for a missing file, got %v", err)
+		}
+		if !test.fallback && (err != test.err || build.Fallback != "") {
+			t.Errorf("Want error %q returned without the fallback, got %v", test.err, err)
+		}
+	}
+}
+
+func TestFetchFallbackConfig(t *testing.T) {
+	server := Config.Server
+	defer func() {
+		Config.Server = server
+	}()
+	Config.Server.ConfigFallback = "platform/starter"
+	Config.Server.ConfigFallbackPath = "pipelines/service.yml"
+
+	r := new(fallbackRemote)
+	files, source, err := fetchFallbackConfig(r, new(model.User), &model.Repo{FullName: "octocat/hello-world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "service.yml" {
+		t.Errorf("Want the fallback configuration file, got %v", files)
+	}
+	if r.repo != "platform/starter" || r.ref != "refs/heads/main" {
+		t.Errorf("Want the file fetched from the default branch of the fallback repository, got %s at %s", r.repo, r.ref)
+	}
+	if want := "platform/starter:pipelines/service.yml"; source != want {
+		t.Errorf("Want configuration source %s, got %s", want, source)
+	}
+
+	_, _, err = fetchFallbackConfig(r, new(model.User), &model.Repo{FullName: "octocat/hello-world", NoFallback: true})
+	if err == nil {
+		t.Errorf("Want no fallback configuration for a repository that opted out")
+	}
+
+	Config.Server.ConfigFallback = ""
+	_, _, err = fetchFallbackConfig(r, new(model.User), &model.Repo{FullName: "octocat/hello-world"})
+	if err == nil {
+		t.Errorf("Want no fallback configuration when none is configured")
+	}
+}
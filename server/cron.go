@@ -0,0 +1,314 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+	"github.com/drone/drone/router/middleware/session"
+	"github.com/drone/drone/store"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+)
+
+// GetCron gets the named cron from the database and writes
+// to the response in json format.
+func GetCron(c *gin.Context) {
+	var (
+		repo = session.Repo(c)
+		name = c.Param("cron")
+	)
+	cron, err := store.FromContext(c).CronFind(repo, name)
+	if err != nil {
+		c.String(404, "Error getting cron %q. %s", name, err)
+		return
+	}
+	c.JSON(200, cron)
+}
+
+// GetCronList gets the cron list from the database and writes
+// to the response in json format.
+func GetCronList(c *gin.Context) {
+	repo := session.Repo(c)
+	list, err := store.FromContext(c).CronList(repo)
+	if err != nil {
+		c.String(500, "Error getting cron list. %s", err)
+		return
+	}
+	c.JSON(200, list)
+}
+
+// PostCron persists the cron to the database and schedules its
+// first execution.
+func PostCron(c *gin.Context) {
+	repo := session.Repo(c)
+	user := session.User(c)
+
+	in := new(model.Cron)
+	if err := c.Bind(in); err != nil {
+		c.String(http.StatusBadRequest, "Error parsing cron. %s", err)
+		return
+	}
+	cron := &model.Cron{
+		RepoID:  repo.ID,
+		Name:    in.Name,
+		Expr:    in.Expr,
+		Branch:  in.Branch,
+		Target:  in.Target,
+		Overlap: in.Overlap,
+		Creator: user.Login,
+		Created: time.Now().Unix(),
+	}
+	if cron.Branch == "" {
+		cron.Branch = repo.Branch
+	}
+	if err := cron.Validate(); err != nil {
+		c.String(400, "Error inserting cron. %s", err)
+		return
+	}
+	if err := cron.Schedule(time.Now()); err != nil {
+		c.String(400, "Error inserting cron. %s", err)
+		return
+	}
+	if err := store.FromContext(c).CronCreate(cron); err != nil {
+		c.String(500, "Error inserting cron %q. %s", in.Name, err)
+		return
+	}
+	c.JSON(200, cron)
+}
+
+// PatchCron updates the cron in the database. The user that updates
+// the cron becomes its creator, so that the builds of the cron are only
+// exempt from the protected branches and targets of the repository if
+// that user is a repository admin.
+func PatchCron(c *gin.Context) {
+	var (
+		repo = session.Repo(c)
+		user = session.User(c)
+		name = c.Param("cron")
+	)
+
+	in := new(model.CronPatch)
+	if err := c.Bind(in); err != nil {
+		c.String(http.StatusBadRequest, "Error parsing cron. %s", err)
+		return
+	}
+
+	cron, err := store.FromContext(c).CronFind(repo, name)
+	if err != nil {
+		c.String(404, "Error getting cron %q. %s", name, err)
+		return
+	}
+	if in.Expr != nil {
+		cron.Expr = *in.Expr
+	}
+	if in.Branch != nil {
+		cron.Branch = *in.Branch
+	}
+	if in.Target != nil {
+		cron.Target = *in.Target
+	}
+	if in.Overlap != nil {
+		cron.Overlap = *in.Overlap
+	}
+	cron.Creator = user.Login
+
+	if err := cron.Validate(); err != nil {
+		c.String(400, "Error updating cron. %s", err)
+		return
+	}
+	if err := cron.Schedule(time.Now()); err != nil {
+		c.String(400, "Error updating cron. %s", err)
+		return
+	}
+	if err := store.FromContext(c).CronUpdate(cron); err != nil {
+		c.String(500, "Error updating cron %q. %s", name, err)
+		return
+	}
+	c.JSON(200, cron)
+}
+
+// DeleteCron deletes the named cron from the database.
+func DeleteCron(c *gin.Context) {
+	var (
+		repo = session.Repo(c)
+		name = c.Param("cron")
+	)
+	cron, err := store.FromContext(c).CronFind(repo, name)
+	if err != nil {
+		c.String(404, "Error getting cron %q. %s", name, err)
+		return
+	}
+	if err := store.FromContext(c).CronDelete(cron); err != nil {
+		c.String(500, "Error deleting cron %q. %s", name, err)
+		return
+	}
+	c.String(204, "")
+}
+
+// CronScheduler starts the builds of the crons that are due.
+type CronScheduler struct {
+	Store  store.Store
+	Remote remote.Remote
+	Host   string
+}
+
+// Start runs the due crons at the given interval. It never returns
+// and should be invoked in a separate goroutine.
+func (s *CronScheduler) Start(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.Run(time.Now())
+	}
+}
+
+// Run starts the builds of the crons that are due at the given time
+// and schedules their next execution.
+func (s *CronScheduler) Run(now time.Time) {
+	crons, err := s.Store.CronListNext(now.Unix())
+	if err != nil {
+		logrus.Errorf("cron: cannot list due crons. %s", err)
+		return
+	}
+	for _, cron := range crons {
+		repo, err := s.Store.GetRepo(cron.RepoID)
+		if err != nil {
+			logrus.Errorf("cron: cannot find repository for %s. %s", cron.Name, err)
+			continue
+		}
+
+		// the next execution is scheduled before the build is
+		// started so that a failing cron does not run every minute.
+		if err := cron.Schedule(now); err != nil {
+			logrus.Errorf("cron: disabling %s for %s. %s", cron.Name, repo.FullName, err)
+			cron.Next = 0
+		}
+
+		build, err := s.trigger(repo, cron)
+		if err != nil {
+			logrus.Errorf("cron: cannot start %s for %s. %s", cron.Name, repo.FullName, err)
+		}
+		if build != nil {
+			cron.Build = build.Number
+		}
+		if err := s.Store.CronUpdate(cron); err != nil {
+			logrus.Errorf("cron: cannot update %s for %s. %s", cron.Name, repo.FullName, err)
+		}
+	}
+}
+
+// trigger creates and starts the build of the cron. It returns a nil
+// build if the cron was skipped.
+func (s *CronScheduler) trigger(repo *model.Repo, cron *model.Cron) (*model.Build, error) {
+	if !repo.IsActive {
+		return nil, nil
+	}
+
+	// a cron with a target deploys, which requires deploy events to be
+	// enabled as well.
+	if !repo.AllowEvent(model.EventCron) || (cron.Target != "" && !repo.AllowEvent(model.EventDeploy)) {
+		logrus.Infof("cron: skipping %s for %s, event not enabled", cron.Name, repo.FullName)
+		return nil, nil
+	}
+
+	if !cron.Overlap && cron.Build != 0 {
+		last, err := s.Store.GetBuildNumber(repo, cron.Build)
+		if err == nil {
+			switch last.Status {
+			case model.StatusPending, model.StatusRunning, model.StatusBlocked:
+				logrus.Infof("cron: skipping %s for %s, build %d has not finished", cron.Name, repo.FullName, last.Number)
+				return nil, nil
+			}
+		}
+	}
+
+	user, err := s.Store.GetUser(repo.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// if the remote has a refresh token, the current access token
+	// may be stale. Therefore, we should refresh prior to dispatching
+	// the build.
+	if refresher, ok := s.Remote.(remote.Refresher); ok {
+		ok, _ := refresher.Refresh(user)
+		if ok {
+			s.Store.UpdateUser(user)
+		}
+	}
+
+	// the build is pinned to the commit at the head of the branch so
+	// that the configuration, the clone and the commit status all
+	// refer to the same revision.
+	commit, err := remote.BranchHead(s.Remote, user, repo, cron.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	confs, err := fetchConfigs(s.Remote, user, repo, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	build := &model.Build{
+		RepoID:    repo.ID,
+		ConfigID:  confs[0].ID,
+		Event:     model.EventCron,
+		Trigger:   model.TriggerCron,
+		Status:    model.StatusPending,
+		Commit:    commit,
+		Branch:    cron.Branch,
+		Ref:       "refs/heads/" + cron.Branch,
+		Deploy:    cron.Target,
+		Link:      repo.Link,
+		Message:   "Cron: " + cron.Name,
+		Author:    cron.Creator,
+		Sender:    cron.Creator,
+		Timestamp: time.Now().Unix(),
+	}
+	if creator, err := s.Store.GetUserLogin(cron.Creator); err == nil {
+		build.Avatar = creator.Avatar
+		build.Email = creator.Email
+	}
+	if reason := repo.Protected(build); reason != "" && !isRepoAdmin(s.Store, s.Remote, repo, cron.Creator) {
+		build.Status = model.StatusBlocked
+		build.BlockReason = reason
+	}
+	if err := s.Store.CreateBuild(build); err != nil {
+		return nil, err
+	}
+	if err := saveBuildConfigs(s.Store, build, confs); err != nil {
+		logrus.Errorf("cron: failure to save build configs for %s#%d. %s", repo.FullName, build.Number, err)
+	}
+
+	if build.Status == model.StatusBlocked {
+		logrus.Infof("cron: blocked %s for %s, build %d, %s", cron.Name, repo.FullName, build.Number, build.BlockReason)
+		return build, nil
+	}
+
+	l := &launcher{
+		store:  s.Store,
+		remote: s.Remote,
+		link:   s.Host,
+	}
+	if err := l.start(repo, user, build, confs, map[string]string{}, nil); err != nil {
+		return build, err
+	}
+	logrus.Infof("cron: started %s for %s, build %d", cron.Name, repo.FullName, build.Number)
+	return build, nil
+}
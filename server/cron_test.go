@@ -0,0 +1,269 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store"
+	"github.com/gin-gonic/gin"
+)
+
+// cronStore is a store with a single due cron.
+type cronStore struct {
+	buildStore
+	cron  *model.Cron
+	saved []*model.Cron
+}
+
+func (s *cronStore) CronListNext(int64) ([]*model.Cron, error) {
+	return []*model.Cron{s.cron}, nil
+}
+
+func (s *cronStore) CronFind(*model.Repo, string) (*model.Cron, error) {
+	return s.cron, nil
+}
+
+func (s *cronStore) CronUpdate(cron *model.Cron) error {
+	s.saved = append(s.saved, cron)
+	return nil
+}
+
+func TestCronScheduler(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	now := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+	s := &cronStore{cron: &model.Cron{
+		Name:    "nightly",
+		Expr:    "@daily",
+		Branch:  "develop",
+		Target:  "staging",
+		Creator: "octocat",
+		Next:    now.Unix(),
+	}}
+	defer withConfigStore(&s.buildStore)()
+
+	rmt := new(nopRemote)
+	scheduler := &CronScheduler{Store: s, Remote: rmt, Host: "http://drone.example.com"}
+	scheduler.Run(now)
+
+	if len(s.created) != 1 {
+		t.Fatalf("Want cron build created, got %d builds", len(s.created))
+	}
+	build := s.created[0]
+	if build.Event != model.EventCron {
+		t.Errorf("Want build event %s, got %s", model.EventCron, build.Event)
+	}
+	if build.Trigger != model.TriggerCron {
+		t.Errorf("Want build trigger %s, got %s", model.TriggerCron, build.Trigger)
+	}
+	if build.Author != "octocat" {
+		t.Errorf("Want build author octocat, got %s", build.Author)
+	}
+	if build.Branch != "develop" || build.Deploy != "staging" {
+		t.Errorf("Want branch and target from the cron, got %s and %s", build.Branch, build.Deploy)
+	}
+	if rmt.branch != "develop" {
+		t.Errorf("Want head commit resolved for the cron branch, got %s", rmt.branch)
+	}
+	if build.Commit != "9ecad50" || build.Ref != "refs/heads/develop" {
+		t.Errorf("Want build of the branch head commit, got %s at %s", build.Commit, build.Ref)
+	}
+	if rmt.ref != "9ecad50" {
+		t.Errorf("Want configuration fetched at the head commit, got %s", rmt.ref)
+	}
+	if len(f.tasks) == 0 {
+		t.Errorf("Want cron build pushed to the queue")
+	}
+	if got, want := s.cron.Next, time.Date(2018, time.January, 2, 0, 0, 0, 0, time.UTC).Unix(); got != want {
+		t.Errorf("Want cron rescheduled at %d, got %d", want, got)
+	}
+	if s.cron.Build != 1 {
+		t.Errorf("Want cron build number recorded, got %d", s.cron.Build)
+	}
+}
+
+func TestCronSchedulerOverlap(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	now := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+	s := &cronStore{cron: &model.Cron{
+		Name:   "nightly",
+		Expr:   "@daily",
+		Branch: "master",
+		Next:   now.Unix(),
+		Build:  1,
+	}}
+	s.build = &model.Build{Number: 1, Status: model.StatusRunning}
+	defer withConfigStore(&s.buildStore)()
+
+	scheduler := &CronScheduler{Store: s, Remote: new(nopRemote)}
+	scheduler.Run(now)
+
+	if len(s.created) != 0 {
+		t.Errorf("Want cron skipped while the previous build is running")
+	}
+	if len(s.saved) != 1 || s.cron.Next <= now.Unix() {
+		t.Errorf("Want skipped cron rescheduled")
+	}
+
+	s.cron.Overlap = true
+	s.cron.Next = now.Unix()
+	scheduler.Run(now)
+	if len(s.created) != 1 {
+		t.Errorf("Want cron started when overlapping runs are allowed")
+	}
+}
+
+// deployStore is a cron store with deploy events disabled.
+type deployStore struct {
+	cronStore
+}
+
+func (s *deployStore) GetRepo(int64) (*model.Repo, error) {
+	return &model.Repo{ID: 1, FullName: "octocat/hello-world", IsActive: true, AllowPush: true}, nil
+}
+
+func TestCronSchedulerEventNotEnabled(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	now := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+	s := &deployStore{cronStore{cron: &model.Cron{
+		Name:   "nightly",
+		Expr:   "@daily",
+		Branch: "master",
+		Target: "production",
+		Next:   now.Unix(),
+	}}}
+	defer withConfigStore(&s.buildStore)()
+
+	scheduler := &CronScheduler{Store: s, Remote: new(nopRemote)}
+	scheduler.Run(now)
+
+	if len(s.created) != 0 || len(f.tasks) != 0 {
+		t.Errorf("Want no deployment from a cron with deploy events disabled")
+	}
+	if len(s.saved) != 1 || s.cron.Next <= now.Unix() {
+		t.Errorf("Want skipped cron rescheduled")
+	}
+
+	s.cron.Target = ""
+	s.cron.Next = now.Unix()
+	scheduler.Run(now)
+	if len(s.created) != 1 {
+		t.Errorf("Want cron without a target started")
+	}
+}
+
+// protStore is a cron store for a repository with protected targets.
+type protStore struct {
+	cronStore
+}
+
+func (s *protStore) GetRepo(int64) (*model.Repo, error) {
+	return &model.Repo{ID: 1, FullName: "octocat/hello-world", IsActive: true, AllowPush: true, AllowDeploy: true, ProtTargets: []string{"prod*"}}, nil
+}
+
+func TestCronSchedulerProtected(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	now := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+	s := &protStore{cronStore{cron: &model.Cron{
+		Name:    "nightly",
+		Expr:    "@daily",
+		Branch:  "master",
+		Target:  "production",
+		Creator: "octocat",
+		Next:    now.Unix(),
+	}}}
+	defer withConfigStore(&s.buildStore)()
+
+	scheduler := &CronScheduler{Store: s, Remote: new(nopRemote)}
+	scheduler.Run(now)
+
+	if len(s.created) != 1 {
+		t.Fatalf("Want cron build created, got %d builds", len(s.created))
+	}
+	build := s.created[0]
+	if build.Status != model.StatusBlocked || build.BlockReason == "" {
+		t.Errorf("Want cron deployment to a protected target blocked, got status %s", build.Status)
+	}
+	if len(f.tasks) != 0 {
+		t.Errorf("Want blocked cron build not queued")
+	}
+	if s.cron.Build != build.Number {
+		t.Errorf("Want blocked cron build recorded")
+	}
+}
+
+func TestCronSchedulerBranchHeadError(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	now := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+	s := &cronStore{cron: &model.Cron{
+		Name:   "nightly",
+		Expr:   "@daily",
+		Branch: "deleted",
+		Next:   now.Unix(),
+	}}
+	defer withConfigStore(&s.buildStore)()
+
+	rmt := &nopRemote{headErr: errors.New("branch not found")}
+	scheduler := &CronScheduler{Store: s, Remote: rmt}
+	scheduler.Run(now)
+
+	if len(s.created) != 0 || len(f.tasks) != 0 {
+		t.Errorf("Want no build when the branch head cannot be resolved")
+	}
+	if len(s.saved) != 1 || s.cron.Next <= now.Unix() {
+		t.Errorf("Want cron rescheduled after the failure")
+	}
+}
+
+func TestPatchCronCreator(t *testing.T) {
+	s := &cronStore{cron: &model.Cron{
+		Name:    "nightly",
+		Expr:    "@daily",
+		Branch:  "master",
+		Creator: "admin",
+	}}
+
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("PATCH", "/api/repos/octocat/hello-world/cron/nightly", strings.NewReader(`{"target":"production"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "cron", Value: "nightly"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	c.Set("user", &model.User{Login: "octocat"})
+	store.ToContext(c, s)
+
+	PatchCron(c)
+
+	if w.Code != 200 {
+		t.Fatalf("Want status 200, got %d", w.Code)
+	}
+	if s.cron.Target != "production" || s.cron.Creator != "octocat" {
+		t.Errorf("Want the patched cron owned by the user that patched it, got target %q creator %q", s.cron.Target, s.cron.Creator)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/router/middleware/session"
+	"github.com/drone/drone/shared/token"
+	"github.com/drone/drone/store"
+	"github.com/gin-gonic/gin"
+)
+
+// maxDeliveries is the number of webhook deliveries kept per
+// repository. Older deliveries are pruned.
+const maxDeliveries = 50
+
+// maxReason is the maximum length of the recorded rejection reason.
+const maxReason = 500
+
+// eventHeaders are the headers used by the remotes to send the webhook
+// event type.
+var eventHeaders = []string{
+	"X-GitHub-Event",
+	"X-Gitlab-Event",
+	"X-Gitea-Event",
+	"X-Gogs-Event",
+	"X-Event-Key",
+}
+
+// privateHeaders are the request headers that are not recorded,
+// because they carry credentials or the webhook secret.
+var privateHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"X-Gitlab-Token",
+	"X-Hub-Signature",
+	"X-Hub-Signature-256",
+	"X-Gogs-Signature",
+	"X-Gitea-Signature",
+}
+
+// GetHookList gets the recent webhook deliveries of the repository.
+func GetHookList(c *gin.Context) {
+	repo := session.Repo(c)
+	list, err := store.FromContext(c).DeliveryList(repo)
+	if err != nil {
+		writeError(c, 500, errStore, "Error getting hook deliveries. %s", err)
+		return
+	}
+	c.JSON(200, list)
+}
+
+// PostHookReplay processes a stored webhook delivery again as if it
+// had just been delivered by the remote. The resulting build is tagged
+// as a replay. Only deliveries whose hook token was verified can be
+// replayed, since the replayed delivery is signed by the server.
+func PostHookReplay(c *gin.Context) {
+	repo := session.Repo(c)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, errInvalidParam, "Invalid hook delivery id %q", c.Param("id"))
+		return
+	}
+	prev, err := store.FromContext(c).DeliveryFind(repo, id)
+	if err != nil {
+		writeError(c, http.StatusNotFound, errNotFound, "Cannot find hook delivery %d", id)
+		return
+	}
+	if !prev.Verified {
+		writeError(c, http.StatusConflict, errUnverified, "Cannot replay hook delivery %d, its hook token was not verified", id)
+		return
+	}
+
+	// the stored delivery does not include the hook token, the
+	// replayed delivery is signed for the repository instead.
+	sig, err := token.New(token.HookToken, repo.FullName).Sign(repo.Hash)
+	if err != nil {
+		writeError(c, 500, errInternal, "%s", err)
+		return
+	}
+	req, err := http.NewRequest("POST", "/hook?access_token="+sig, strings.NewReader(prev.Payload))
+	if err != nil {
+		writeError(c, 500, errInternal, "%s", err)
+		return
+	}
+	for k, v := range prev.Headers {
+		req.Header[k] = v
+	}
+	req.Host = c.Request.Host
+	req.TLS = c.Request.TLS
+
+	d := &model.Delivery{
+		Event:   prev.Event,
+		Headers: prev.Headers,
+		Payload: prev.Payload,
+		Replay:  prev.ID,
+		Created: time.Now().Unix(),
+	}
+	c.Request = req
+	defer saveDelivery(c, d)
+	postHook(c, d)
+}
+
+// newDelivery returns a delivery recording the webhook request. The
+// request body is read and replaced so that it can be parsed again.
+func newDelivery(r *http.Request) (*model.Delivery, error) {
+	var payload []byte
+	if r.Body != nil {
+		var err error
+		payload, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(payload))
+	}
+
+	headers := map[string][]string{}
+	for k, v := range r.Header {
+		headers[k] = v
+	}
+	for _, k := range privateHeaders {
+		delete(headers, http.CanonicalHeaderKey(k))
+	}
+
+	return &model.Delivery{
+		Event:   hookEvent(r.Header),
+		Headers: headers,
+		Payload: string(payload),
+		Created: time.Now().Unix(),
+	}, nil
+}
+
+// hookEvent returns the webhook event type sent by the remote.
+func hookEvent(h http.Header) string {
+	for _, k := range eventHeaders {
+		if v := h.Get(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// attachDelivery associates the delivery with the repository named in
+// the webhook, if the repository exists. It is used for deliveries
+// that are ignored before the repository is loaded.
+func attachDelivery(c *gin.Context, d *model.Delivery, tmprepo *model.Repo) {
+	if tmprepo == nil {
+		return
+	}
+	repo, err := store.GetRepoOwnerName(c, tmprepo.Owner, tmprepo.Name)
+	if err == nil {
+		d.RepoID = repo.ID
+	}
+}
+
+// saveDelivery records the delivery with the response status, and
+// prunes the older deliveries of the repository. Deliveries that
+// cannot be associated with a repository are not recorded.
+func saveDelivery(c *gin.Context, d *model.Delivery) {
+	if d.RepoID == 0 {
+		return
+	}
+	d.Status = c.Writer.Status()
+	if d.Reason == "" && len(c.Errors) != 0 {
+		d.Reason = c.Errors.Last().Error()
+	}
+	if len(d.Reason) > maxReason {
+		d.Reason = d.Reason[:maxReason]
+	}
+
+	s := store.FromContext(c)
+	if err := s.DeliveryCreate(d); err != nil {
+		logrus.Errorf("failure to save hook delivery. %s", err)
+		return
+	}
+	if err := s.DeliveryPrune(&model.Repo{ID: d.RepoID}, maxDeliveries); err != nil {
+		logrus.Errorf("failure to prune hook deliveries. %s", err)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+	"github.com/drone/drone/shared/token"
+	"github.com/drone/drone/store"
+	"github.com/gin-gonic/gin"
+)
+
+// deliveryStore is a store that returns a single repository and
+// records the created hook deliveries.
+type deliveryStore struct {
+	store.Store
+	repo       *model.Repo
+	deliveries []*model.Delivery
+	pruned     int
+}
+
+func (s *deliveryStore) GetRepoName(name string) (*model.Repo, error) {
+	if s.repo.FullName != name {
+		return nil, sql.ErrNoRows
+	}
+	return s.repo, nil
+}
+
+func (s *deliveryStore) DeliveryFind(repo *model.Repo, id int64) (*model.Delivery, error) {
+	for _, d := range s.deliveries {
+		if d.RepoID == repo.ID && d.ID == id {
+			return d, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *deliveryStore) DeliveryCreate(d *model.Delivery) error {
+	d.ID = int64(len(s.deliveries) + 1)
+	s.deliveries = append(s.deliveries, d)
+	return nil
+}
+
+func (s *deliveryStore) DeliveryPrune(repo *model.Repo, limit int) error {
+	s.pruned = limit
+	return nil
+}
+
+// hookRemote is a remote that records the parsed webhook request and
+// ignores the webhook.
+type hookRemote struct {
+	remote.Remote
+	payload string
+	event   string
+	token   string
+}
+
+func (r *hookRemote) Hook(req *http.Request) (*model.Repo, *model.Build, error) {
+	data, _ := ioutil.ReadAll(req.Body)
+	r.payload = string(data)
+	r.event = req.Header.Get("X-GitHub-Event")
+	r.token = req.FormValue("access_token")
+	return &model.Repo{Owner: "octocat", Name: "hello-world"}, nil, nil
+}
+
+func TestNewDelivery(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/hook?access_token=foo", strings.NewReader(`{"ref":"refs/heads/master"}`))
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	req.Header.Set("X-Hub-Signature-256", "sha256=s3cr3t")
+	req.Header.Set("X-Gitlab-Token", "s3cr3t")
+
+	d, err := newDelivery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Event != "push" {
+		t.Errorf("Want event push, got %q", d.Event)
+	}
+	if d.Payload != `{"ref":"refs/heads/master"}` {
+		t.Errorf("Want payload recorded, got %q", d.Payload)
+	}
+	for _, k := range []string{"Authorization", "X-Hub-Signature-256", "X-Gitlab-Token"} {
+		if _, ok := d.Headers[k]; ok {
+			t.Errorf("Want the %s header not recorded", k)
+		}
+	}
+	if data, _ := ioutil.ReadAll(req.Body); string(data) != d.Payload {
+		t.Errorf("Want the request body readable again, got %q", data)
+	}
+}
+
+func TestPostHookRecordsDelivery(t *testing.T) {
+	s := &deliveryStore{repo: &model.Repo{ID: 1, FullName: "octocat/hello-world"}}
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "/hook", strings.NewReader(`{"zen":"hello"}`))
+	c.Request.Header.Set("X-GitHub-Event", "ping")
+	remote.ToContext(c, new(hookRemote))
+	store.ToContext(c, s)
+
+	PostHook(c)
+
+	if w.Code != 200 {
+		t.Errorf("Want status 200, got %d", w.Code)
+	}
+	if len(s.deliveries) != 1 {
+		t.Fatalf("Want the delivery recorded, got %d deliveries", len(s.deliveries))
+	}
+	d := s.deliveries[0]
+	if d.RepoID != 1 || d.Event != "ping" || d.Status != 200 || d.Reason == "" {
+		t.Errorf("Want the ignored delivery recorded for the repository, got %+v", d)
+	}
+	if s.pruned != maxDeliveries {
+		t.Errorf("Want deliveries pruned to %d, got %d", maxDeliveries, s.pruned)
+	}
+}
+
+func TestPostHookReplay(t *testing.T) {
+	repo := &model.Repo{ID: 1, FullName: "octocat/hello-world", Hash: "hash"}
+	s := &deliveryStore{repo: repo}
+	s.DeliveryCreate(&model.Delivery{
+		RepoID:   1,
+		Event:    "push",
+		Headers:  map[string][]string{"X-Github-Event": {"push"}},
+		Payload:  `{"ref":"refs/heads/master"}`,
+		Status:   404,
+		Verified: true,
+	})
+	r := new(hookRemote)
+
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "/api/repos/octocat/hello-world/hooks/1/replay", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	c.Set("repo", repo)
+	remote.ToContext(c, r)
+	store.ToContext(c, s)
+
+	PostHookReplay(c)
+
+	if w.Code != 200 {
+		t.Errorf("Want status 200, got %d", w.Code)
+	}
+	if r.payload != `{"ref":"refs/heads/master"}` || r.event != "push" {
+		t.Errorf("Want the stored payload and headers replayed, got %q %q", r.payload, r.event)
+	}
+	parsed, err := token.Parse(r.token, func(*token.Token) (string, error) { return repo.Hash, nil })
+	if err != nil || parsed.Text != repo.FullName {
+		t.Errorf("Want the replay signed for the repository, got %v", err)
+	}
+	if len(s.deliveries) != 2 {
+		t.Fatalf("Want the replay recorded, got %d deliveries", len(s.deliveries))
+	}
+	if d := s.deliveries[1]; d.Replay != 1 || d.RepoID != 1 || d.Status != 200 {
+		t.Errorf("Want the replay recorded as a replay of delivery 1, got %+v", d)
+	}
+}
+
+func TestPostHookReplayUnverified(t *testing.T) {
+	repo := &model.Repo{ID: 1, FullName: "octocat/hello-world", Hash: "hash"}
+	s := &deliveryStore{repo: repo}
+	s.DeliveryCreate(&model.Delivery{
+		RepoID:  1,
+		Event:   "push",
+		Payload: `{"ref":"refs/heads/master"}`,
+		Status:  403,
+	})
+	r := new(hookRemote)
+
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "/api/repos/octocat/hello-world/hooks/1/replay", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	c.Set("repo", repo)
+	remote.ToContext(c, r)
+	store.ToContext(c, s)
+
+	PostHookReplay(c)
+
+	out := errorResponse{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	if w.Code != 409 || out.Code != errUnverified {
+		t.Errorf("Want unverified delivery error, got %d %q", w.Code, w.Body.String())
+	}
+	if r.payload != "" || len(s.deliveries) != 1 {
+		t.Errorf("Want the unverified delivery not replayed")
+	}
+}
+
+func TestPostHookReplayNotFound(t *testing.T) {
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "/api/repos/octocat/hello-world/hooks/2/replay", nil)
+	c.Params = gin.Params{{Key: "id", Value: "2"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	store.ToContext(c, &deliveryStore{repo: &model.Repo{ID: 1}})
+
+	PostHookReplay(c)
+
+	out := errorResponse{}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	if w.Code != 404 || out.Code != errNotFound {
+		t.Errorf("Want hook delivery not found error, got %d %q", w.Code, w.Body.String())
+	}
+}
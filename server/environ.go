@@ -0,0 +1,155 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/router/middleware/session"
+	"github.com/drone/drone/store"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+)
+
+// GetEnviron gets the named environment variable of the repository
+// from the database and writes to the response in json format.
+func GetEnviron(c *gin.Context) {
+	var (
+		repo = session.Repo(c)
+		name = c.Param("environ")
+	)
+	environ, err := store.FromContext(c).EnvironFind(repo, name)
+	if err != nil {
+		c.String(404, "Error getting environment variable %q. %s", name, err)
+		return
+	}
+	c.JSON(200, environ)
+}
+
+// GetEnvironList gets the environment variables of the repository from
+// the database and writes to the response in json format.
+func GetEnvironList(c *gin.Context) {
+	repo := session.Repo(c)
+	list, err := store.FromContext(c).EnvironList(repo)
+	if err != nil {
+		c.String(500, "Error getting environment list. %s", err)
+		return
+	}
+	c.JSON(200, list)
+}
+
+// PostEnviron persists the environment variable of the repository to
+// the database.
+func PostEnviron(c *gin.Context) {
+	repo := session.Repo(c)
+
+	in := new(model.Environ)
+	if err := c.Bind(in); err != nil {
+		c.String(http.StatusBadRequest, "Error parsing environment variable. %s", err)
+		return
+	}
+	environ := &model.Environ{
+		RepoID: repo.ID,
+		Name:   in.Name,
+		Value:  in.Value,
+	}
+	if err := environ.Validate(); err != nil {
+		c.String(400, "Error inserting environment variable. %s", err)
+		return
+	}
+	if err := store.FromContext(c).EnvironCreate(environ); err != nil {
+		c.String(500, "Error inserting environment variable %q. %s", in.Name, err)
+		return
+	}
+	c.JSON(200, environ)
+}
+
+// PatchEnviron updates the value of the environment variable of the
+// repository in the database.
+func PatchEnviron(c *gin.Context) {
+	var (
+		repo = session.Repo(c)
+		name = c.Param("environ")
+	)
+
+	in := new(model.Environ)
+	if err := c.Bind(in); err != nil {
+		c.String(http.StatusBadRequest, "Error parsing environment variable. %s", err)
+		return
+	}
+
+	environ, err := store.FromContext(c).EnvironFind(repo, name)
+	if err != nil {
+		c.String(404, "Error getting environment variable %q. %s", name, err)
+		return
+	}
+	environ.Value = in.Value
+
+	if err := environ.Validate(); err != nil {
+		c.String(400, "Error updating environment variable. %s", err)
+		return
+	}
+	if err := store.FromContext(c).EnvironUpdate(environ); err != nil {
+		c.String(500, "Error updating environment variable %q. %s", name, err)
+		return
+	}
+	c.JSON(200, environ)
+}
+
+// DeleteEnviron deletes the named environment variable of the
+// repository from the database.
+func DeleteEnviron(c *gin.Context) {
+	var (
+		repo = session.Repo(c)
+		name = c.Param("environ")
+	)
+	environ, err := store.FromContext(c).EnvironFind(repo, name)
+	if err != nil {
+		c.String(404, "Error getting environment variable %q. %s", name, err)
+		return
+	}
+	if err := store.FromContext(c).EnvironDelete(environ); err != nil {
+		c.String(500, "Error deleting environment variable %q. %s", name, err)
+		return
+	}
+	c.String(204, "")
+}
+
+// buildEnviron returns the environment variables of a build of the
+// repository. Build parameters take precedence over the environment
+// of the repository, which takes precedence over the global
+// environment.
+func buildEnviron(s store.Store, repo *model.Repo, params map[string]string) map[string]string {
+	environ := map[string]string{}
+	if Config.Services.Environ != nil {
+		globals, _ := Config.Services.Environ.EnvironList(repo)
+		for _, global := range globals {
+			environ[global.Name] = global.Value
+		}
+	}
+	envs, err := s.EnvironList(repo)
+	if err != nil {
+		logrus.Warnf("cannot get the environment of %s. %s", repo.FullName, err)
+	}
+	for _, env := range envs {
+		environ[env.Name] = env.Value
+	}
+	for k, v := range params {
+		environ[k] = v
+	}
+	return environ
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes returned in the body of failed requests, allowing
+// clients to handle failures without parsing the message.
+const (
+	errInvalidParam  = "invalid_parameter"
+	errInvalidBody   = "invalid_request_body"
+	errInvalidStatus = "invalid_build_status"
+	errNotFound      = "not_found"
+	errForbidden     = "forbidden"
+	errAmbiguous     = "ambiguous"
+	errStore         = "store_error"
+	errRateLimited   = "rate_limited"
+	errInvalidConfig = "invalid_config"
+	errUnverified    = "unverified_delivery"
+	errInternal      = "internal_error"
+)
+
+// errorResponse is the body of a failed request.
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError writes a JSON error response with the status code, the
+// error code and the formatted message.
+func writeError(c *gin.Context, status int, code, format string, args ...interface{}) {
+	c.JSON(status, errorResponse{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
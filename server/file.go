@@ -27,9 +27,8 @@ import (
 
 // FileList gets a list file by build.
 func FileList(c *gin.Context) {
-	num, err := strconv.Atoi(c.Param("number"))
-	if err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
+	num, ok := parseBuildNumber(c)
+	if !ok {
 		return
 	}
 
@@ -59,9 +58,8 @@ func FileGet(c *gin.Context) {
 		}()
 	)
 
-	num, err := strconv.Atoi(c.Param("number"))
-	if err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
+	num, ok := parseBuildNumber(c)
+	if !ok {
 		return
 	}
 
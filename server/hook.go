@@ -15,14 +15,11 @@
 package server
 
 import (
-	"context"
 	"crypto/sha256"
-	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/url"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -42,9 +39,8 @@ import (
 	"github.com/cncd/pipeline/pipeline/frontend/yaml/compiler"
 	"github.com/cncd/pipeline/pipeline/frontend/yaml/linter"
 	"github.com/cncd/pipeline/pipeline/frontend/yaml/matrix"
-	"github.com/cncd/pipeline/pipeline/rpc"
-	"github.com/cncd/pubsub"
 	"github.com/cncd/queue"
+	libyaml "gopkg.in/yaml.v2"
 )
 
 //
@@ -61,12 +57,38 @@ func init() {
 }
 
 func GetQueueInfo(c *gin.Context) {
-	c.IndentedJSON(200,
+	var paused bool
+	if q, ok := model.QueuePauser(Config.Services.Queue); ok {
+		paused = q.Paused()
+	}
+	c.IndentedJSON(200, struct {
+		queue.InfoT
+		Held   map[string]int `json:"held"`
+		Paused bool           `json:"paused"`
+	}{
 		Config.Services.Queue.Info(c),
-	)
+		model.QueueHeld(Config.Services.Queue),
+		paused,
+	})
 }
 
+// PostHook processes a webhook delivered by the remote, and records
+// the delivery for the repository.
 func PostHook(c *gin.Context) {
+	d, err := newDelivery(c.Request)
+	if err != nil {
+		logrus.Errorf("failure to read hook. %s", err)
+		c.AbortWithError(400, err)
+		return
+	}
+	defer saveDelivery(c, d)
+	postHook(c, d)
+}
+
+// postHook processes the webhook and records the outcome in the
+// delivery. A delivery that replays a stored delivery tags the
+// resulting build as a replay.
+func postHook(c *gin.Context, d *model.Delivery) {
 	remote_ := remote.FromContext(c)
 
 	tmprepo, build, err := remote_.Hook(c.Request)
@@ -76,6 +98,8 @@ func PostHook(c *gin.Context) {
 		return
 	}
 	if build == nil {
+		d.Reason = "ignoring hook. event is not supported"
+		attachDelivery(c, d, tmprepo)
 		c.Writer.WriteHeader(200)
 		return
 	}
@@ -86,10 +110,13 @@ func PostHook(c *gin.Context) {
 	}
 
 	// skip the build if any case-insensitive combination of the words "skip" and "ci"
-	// wrapped in square brackets appear in the commit message
+	// wrapped in square brackets appear in the commit message. The build is recorded
+	// as skipped below, unless the server is configured to drop skipped commits.
 	skipMatch := skipRe.FindString(build.Message)
-	if len(skipMatch) > 0 {
+	if len(skipMatch) > 0 && Config.Server.SkipDrop {
 		logrus.Infof("ignoring hook. %s found in %s", skipMatch, build.Commit)
+		d.Reason = fmt.Sprintf("ignoring hook. %s found in %s", skipMatch, build.Commit)
+		attachDelivery(c, d, tmprepo)
 		c.Writer.WriteHeader(204)
 		return
 	}
@@ -100,8 +127,11 @@ func PostHook(c *gin.Context) {
 		c.AbortWithError(404, err)
 		return
 	}
+	d.RepoID = repo.ID
+
 	if !repo.IsActive {
 		logrus.Errorf("ignoring hook. %s/%s is inactive.", tmprepo.Owner, tmprepo.Name)
+		d.Reason = "ignoring hook. repository is inactive"
 		c.AbortWithError(204, err)
 		return
 	}
@@ -117,26 +147,22 @@ func PostHook(c *gin.Context) {
 	}
 	if parsed.Text != repo.FullName {
 		logrus.Errorf("failure to verify token from hook. Expected %s, got %s", repo.FullName, parsed.Text)
+		d.Reason = fmt.Sprintf("failure to verify token from hook. Expected %s, got %s", repo.FullName, parsed.Text)
 		c.AbortWithStatus(403)
 		return
 	}
+	d.Verified = true
 
 	if repo.UserID == 0 {
 		logrus.Warnf("ignoring hook. repo %s has no owner.", repo.FullName)
+		d.Reason = "ignoring hook. repository has no owner"
 		c.Writer.WriteHeader(204)
 		return
 	}
-	var skipped = true
-	if (build.Event == model.EventPush && repo.AllowPush) ||
-		(build.Event == model.EventPull && repo.AllowPull) ||
-		(build.Event == model.EventDeploy && repo.AllowDeploy) ||
-		(build.Event == model.EventTag && repo.AllowTag) {
-		skipped = false
-	}
-
-	if skipped {
+	if !repo.AllowEvent(build.Event) {
 		logrus.Infof("ignoring hook. repo %s is disabled for %s events.", repo.FullName, build.Event)
-		c.Writer.WriteHeader(204)
+		d.Reason = fmt.Sprintf("ignoring hook. repository is disabled for %s events", build.Event)
+		c.String(200, "Event %s not enabled for %s", build.Event, repo.FullName)
 		return
 	}
 
@@ -157,62 +183,65 @@ func PostHook(c *gin.Context) {
 		}
 	}
 
+	if len(skipMatch) > 0 {
+		logrus.Infof("skipping build. %s found in %s", skipMatch, build.Commit)
+		d.Reason = fmt.Sprintf("skipping build. %s found in %s", skipMatch, build.Commit)
+		if err := skipBuild(c, repo, user, build, d); err != nil {
+			logrus.Errorf("failure to save skipped build for %s. %s", repo.FullName, err)
+			c.AbortWithError(500, err)
+			return
+		}
+		c.JSON(200, build)
+		return
+	}
+
 	// fetch the build file from the database
-	confb, err := remote.FileBackoff(remote_, user, repo, build, repo.Config)
+	files, err := fetchHookConfigFiles(remote_, user, repo, build, func(f string) ([]byte, error) {
+		return remote.FileBackoff(remote_, user, repo, build, f)
+	})
 	if err != nil {
 		logrus.Errorf("error: %s: cannot find %s in %s: %s", repo.FullName, repo.Config, build.Ref, err)
 		c.AbortWithError(404, err)
 		return
 	}
-	sha := shasum(confb)
-	conf, err := Config.Storage.Config.ConfigFind(repo, sha)
-	if err != nil {
-		conf = &model.Config{
-			RepoID: repo.ID,
-			Data:   string(confb),
-			Hash:   sha,
-		}
-		err = Config.Storage.Config.ConfigCreate(conf)
-		if err != nil {
-			// retry in case we receive two hooks at the same time
-			conf, err = Config.Storage.Config.ConfigFind(repo, sha)
-			if err != nil {
-				logrus.Errorf("failure to find or persist build config for %s. %s", repo.FullName, err)
-				c.AbortWithError(500, err)
-				return
-			}
-		}
-	}
-	build.ConfigID = conf.ID
-
-	netrc, err := remote_.Netrc(user, repo)
+	confs, err := persistConfigs(repo, files)
 	if err != nil {
-		c.String(500, "Failed to generate netrc file. %s", err)
+		logrus.Errorf("failure to find or persist build config for %s. %s", repo.FullName, err)
+		c.AbortWithError(500, err)
 		return
 	}
 
 	// verify the branches can be built vs skipped
-	branches, err := yaml.ParseString(conf.Data)
-	if err == nil {
-		if !branches.Branches.Match(build.Branch) && build.Event != model.EventTag && build.Event != model.EventDeploy {
-			c.String(200, "Branch does not match restrictions defined in yaml")
-			return
-		}
+	confs = matchBranches(confs, build)
+	if len(confs) == 0 {
+		d.Reason = "Branch does not match restrictions defined in yaml"
+		c.String(200, "Branch does not match restrictions defined in yaml")
+		return
 	}
+	build.ConfigID = confs[0].ID
 
-	// update some build fields
+	// update some build fields. The hook signature was verified
+	// above, which is recorded so that hook builds can be told apart
+	// from restarted and manually triggered builds. Replayed payloads
+	// are signed by the server, not by the remote.
 	build.RepoID = repo.ID
-	build.Verified = true
+	build.Verified = d.Replay == 0
+	build.Trigger = model.TriggerHook
 	build.Status = model.StatusPending
+	if d.Replay != 0 {
+		build.Trigger = model.TriggerReplay
+	}
 
-	if repo.IsGated {
-		allowed, _ := Config.Services.Senders.SenderAllowed(user, repo, build, conf)
-		if !allowed {
-			build.Status = model.StatusBlocked
-		}
+	if requiresApproval(user, repo, build, confs[0]) {
+		build.Status = model.StatusBlocked
+	}
+	if reason := repo.Protected(build); reason != "" && !isRepoAdmin(store.FromContext(c), remote_, repo, build.Sender) {
+		build.Status = model.StatusBlocked
+		build.BlockReason = reason
 	}
 
 	if err = Config.Services.Limiter.LimitBuild(user, repo, build); err != nil {
+		d.Reason = "Build blocked by limiter"
 		c.String(403, "Build blocked by limiter")
 		return
 	}
@@ -224,139 +253,83 @@ func PostHook(c *gin.Context) {
 		c.AbortWithError(500, err)
 		return
 	}
-
-	c.JSON(200, build)
+	if err := saveBuildConfigs(store.FromContext(c), build, confs); err != nil {
+		logrus.Errorf("failure to save build configs for %s#%d. %s", repo.FullName, build.Number, err)
+	}
+	build.Configs = configNames(confs)
+	d.Build = build.Number
 
 	if build.Status == model.StatusBlocked {
+		c.JSON(200, build)
 		return
 	}
 
-	envs := map[string]string{}
-	if Config.Services.Environ != nil {
-		globals, _ := Config.Services.Environ.EnvironList(repo)
-		for _, global := range globals {
-			envs[global.Name] = global.Value
-		}
+	l := &launcher{
+		store:  store.FromContext(c),
+		remote: remote_,
+		link:   httputil.GetURL(c.Request),
 	}
-
-	secs, err := Config.Services.Secrets.SecretListBuild(repo, build)
-	if err != nil {
-		logrus.Debugf("Error getting secrets for %s#%d. %s", repo.FullName, build.Number, err)
+	if err := l.start(repo, user, build, confs, nil, nil); err != nil {
+		logrus.Errorf("cannot start %s#%d: %s", repo.FullName, build.Number, err)
 	}
+	c.JSON(200, build)
 
-	regs, err := Config.Services.Registries.RegistryList(repo)
-	if err != nil {
-		logrus.Debugf("Error getting registry credentials for %s#%d. %s", repo.FullName, build.Number, err)
+	if build.Held {
+		return
 	}
 
-	// get the previous build so that we can send
-	// on status change notifications
-	last, _ := store.GetBuildLastBefore(c, repo, build.Branch, build.ID)
+	uri := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, build.Number)
+	if err := remote_.Status(user, repo, build, uri); err != nil {
+		logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
+	}
+}
 
-	//
-	// BELOW: NEW
-	//
+// skipBuild records the build as skipped without running any pipelines,
+// and reports the skipped build to the remote.
+func skipBuild(c *gin.Context, repo *model.Repo, user *model.User, build *model.Build, d *model.Delivery) error {
+	build.RepoID = repo.ID
+	build.Verified = d.Replay == 0
+	build.Trigger = model.TriggerHook
+	if d.Replay != 0 {
+		build.Trigger = model.TriggerReplay
+	}
+	build.Status = model.StatusSkipped
+	build.Started = time.Now().Unix()
+	build.Finished = build.Started
+	build.Trim()
 
-	defer func() {
-		uri := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, build.Number)
-		err = remote_.Status(user, repo, build, uri)
-		if err != nil {
-			logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
-		}
-	}()
-
-	b := builder{
-		Repo:  repo,
-		Curr:  build,
-		Last:  last,
-		Netrc: netrc,
-		Secs:  secs,
-		Regs:  regs,
-		Envs:  envs,
-		Link:  httputil.GetURL(c.Request),
-		Yaml:  conf.Data,
-	}
-	items, err := b.Build()
-	if err != nil {
-		build.Status = model.StatusError
-		build.Started = time.Now().Unix()
-		build.Finished = build.Started
-		build.Error = err.Error()
-		store.UpdateBuild(c, build)
-		return
+	if err := store.CreateBuild(c, build); err != nil {
+		return err
 	}
+	d.Build = build.Number
+	buildFinished(repo, build)
+	publishEvent(c, model.Finished, repo, build, nil)
 
-	var pcounter = len(items)
-
-	for _, item := range items {
-		build.Procs = append(build.Procs, item.Proc)
-		item.Proc.BuildID = build.ID
-
-		for _, stage := range item.Config.Stages {
-			var gid int
-			for _, step := range stage.Steps {
-				pcounter++
-				if gid == 0 {
-					gid = pcounter
-				}
-				proc := &model.Proc{
-					BuildID: build.ID,
-					Name:    step.Alias,
-					PID:     pcounter,
-					PPID:    item.Proc.PID,
-					PGID:    gid,
-					State:   model.StatusPending,
-				}
-				build.Procs = append(build.Procs, proc)
-			}
-		}
-	}
-	err = store.FromContext(c).ProcCreate(build.Procs)
-	if err != nil {
-		logrus.Errorf("error persisting procs %s/%d: %s", repo.FullName, build.Number, err)
+	uri := fmt.Sprintf("%s/%s/%d", httputil.GetURL(c.Request), repo.FullName, build.Number)
+	if err := remote.FromContext(c).Status(user, repo, build, uri); err != nil {
+		logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
 	}
+	return nil
+}
 
-	//
-	// publish topic
-	//
-	message := pubsub.Message{
-		Labels: map[string]string{
-			"repo":    repo.FullName,
-			"private": strconv.FormatBool(repo.IsPrivate),
-		},
+// findOrPersistConfig returns the stored build configuration with the
+// given content, storing it first if it does not exist.
+func findOrPersistConfig(repo *model.Repo, data []byte) (*model.Config, error) {
+	sha := shasum(data)
+	conf, err := Config.Storage.Config.ConfigFind(repo, sha)
+	if err == nil {
+		return conf, nil
 	}
-	buildCopy := *build
-	buildCopy.Procs = model.Tree(buildCopy.Procs)
-	message.Data, _ = json.Marshal(model.Event{
-		Type:  model.Enqueued,
-		Repo:  *repo,
-		Build: buildCopy,
-	})
-	// TODO remove global reference
-	Config.Services.Pubsub.Publish(c, "topic/events", message)
-	//
-	// end publish topic
-	//
-
-	for _, item := range items {
-		task := new(queue.Task)
-		task.ID = fmt.Sprint(item.Proc.ID)
-		task.Labels = map[string]string{}
-		for k, v := range item.Labels {
-			task.Labels[k] = v
-		}
-		task.Labels["platform"] = item.Platform
-		task.Labels["repo"] = b.Repo.FullName
-
-		task.Data, _ = json.Marshal(rpc.Pipeline{
-			ID:      fmt.Sprint(item.Proc.ID),
-			Config:  item.Config,
-			Timeout: b.Repo.Timeout,
-		})
-
-		Config.Services.Logs.Open(context.Background(), task.ID)
-		Config.Services.Queue.Push(context.Background(), task)
+	conf = &model.Config{
+		RepoID: repo.ID,
+		Data:   string(data),
+		Hash:   sha,
 	}
+	if err := Config.Storage.Config.ConfigCreate(conf); err != nil {
+		// retry in case we receive two hooks at the same time
+		return Config.Storage.Config.ConfigFind(repo, sha)
+	}
+	return conf, nil
 }
 
 // return the metadata from the cli context.
@@ -448,7 +421,113 @@ type buildItem struct {
 	Proc     *model.Proc
 	Platform string
 	Labels   map[string]string
+	Environ  map[string]string
 	Config   *backend.Config
+	Skipped  []string // steps excluded by their when conditions
+}
+
+// requiresApproval returns true if the repository approval policy
+// requires the build to be approved before it runs. Builds covered by
+// the policy run immediately when the sender is allowed.
+func requiresApproval(user *model.User, repo *model.Repo, build *model.Build, conf *model.Config) bool {
+	switch repo.ApprovalPolicy() {
+	case model.ApprovalAll:
+	case model.ApprovalPullRequests:
+		if build.Event != model.EventPull {
+			return false
+		}
+	case model.ApprovalForks:
+		if !repo.IsFork(build) {
+			return false
+		}
+	default:
+		return false
+	}
+	allowed, _ := Config.Services.Senders.SenderAllowed(user, repo, build, conf)
+	return !allowed
+}
+
+// isRepoAdmin returns true if the named user is a system admin or an
+// admin of the repository. The cached permissions are refreshed from
+// the remote when they are more than an hour old.
+func isRepoAdmin(s store.Store, r remote.Remote, repo *model.Repo, login string) bool {
+	user, err := s.GetUserLogin(login)
+	if err != nil {
+		return false
+	}
+	if user.Admin {
+		return true
+	}
+	perm, err := s.PermFind(user, repo)
+	if err != nil || time.Unix(perm.Synced, 0).Add(time.Hour).Before(time.Now()) {
+		perm, err = r.Perm(user, repo.Owner, repo.Name)
+		if err != nil {
+			logrus.Debugf("cannot get the permissions of %s for %s. %s", login, repo.FullName, err)
+			return false
+		}
+		perm.Repo = repo.FullName
+		perm.UserID = user.ID
+		perm.Synced = time.Now().Unix()
+		s.PermUpsert(perm)
+	}
+	return perm.Admin
+}
+
+// gated returns true if the pipeline configuration requires approval
+// before the pipeline runs, declared with the approval attribute:
+//
+//	approval: true
+//
+// The attribute can be set per matrix axis using a matrix variable.
+func gated(data string) bool {
+	out := struct {
+		Approval bool `yaml:"approval"`
+	}{}
+	libyaml.Unmarshal([]byte(data), &out)
+	return out.Approval
+}
+
+// environ returns the global environment and build parameters the
+// pipelines are compiled with, with the secret values masked.
+func (b *builder) environ() map[string]string {
+	var values []string
+	for _, sec := range b.Secs {
+		values = append(values, sec.Value)
+	}
+	replacer := newMaskReplacer(values)
+
+	environ := map[string]string{}
+	for k, v := range b.Envs {
+		if replacer != nil {
+			v = replacer.Replace(v)
+		}
+		environ[k] = v
+	}
+	return environ
+}
+
+// BuildAll compiles the pipelines of each configuration and numbers
+// them in order. The pipelines of a configuration directory are named
+// after the configuration file they are defined in.
+func (b *builder) BuildAll(confs []*model.Config) ([]*buildItem, error) {
+	var items []*buildItem
+	for _, conf := range confs {
+		b.Yaml = conf.Data
+		compiled, err := b.Build()
+		if err != nil {
+			if conf.Name != "" {
+				return nil, fmt.Errorf("%s: %s", conf.Name, err)
+			}
+			return nil, err
+		}
+		for _, item := range compiled {
+			item.Proc.PID = len(items) + 1
+			item.Proc.PGID = item.Proc.PID
+			item.Proc.Name = conf.Name
+			items = append(items, item)
+		}
+	}
+	return items, nil
 }
 
 func (b *builder) Build() ([]*buildItem, error) {
@@ -461,6 +540,8 @@ func (b *builder) Build() ([]*buildItem, error) {
 		axes = append(axes, matrix.Axis{})
 	}
 
+	snapshot := b.environ()
+
 	var items []*buildItem
 	for i, axis := range axes {
 		proc := &model.Proc{
@@ -476,6 +557,9 @@ func (b *builder) Build() ([]*buildItem, error) {
 		for k, v := range metadata.EnvironDrone() {
 			environ[k] = v
 		}
+		if b.Curr.Fallback != "" {
+			environ["DRONE_CONFIG_REPO"], environ["DRONE_CONFIG_PATH"] = fallbackSource(b.Curr)
+		}
 		for k, v := range axis {
 			environ[k] = v
 		}
@@ -521,6 +605,11 @@ func (b *builder) Build() ([]*buildItem, error) {
 			return nil, lerr
 		}
 
+		// gated pipelines wait for approval before they are queued.
+		if gated(y) {
+			proc.State = model.StatusGated
+		}
+
 		var registries []compiler.Registry
 		for _, reg := range b.Regs {
 			registries = append(registries, compiler.Registry{
@@ -562,24 +651,22 @@ func (b *builder) Build() ([]*buildItem, error) {
 			compiler.WithMetadata(metadata),
 		).Compile(parsed)
 
-		// for _, sec := range b.Secs {
-		// 	if !sec.MatchEvent(b.Curr.Event) {
-		// 		continue
-		// 	}
-		// 	if b.Curr.Verified || sec.SkipVerify {
-		// 		ir.Secrets = append(ir.Secrets, &backend.Secret{
-		// 			Mask:  sec.Conceal,
-		// 			Name:  sec.Name,
-		// 			Value: sec.Value,
-		// 		})
-		// 	}
-		// }
+		// the secret values are masked in the logs of the pipeline.
+		for _, sec := range secrets {
+			ir.Secrets = append(ir.Secrets, &backend.Secret{
+				Mask:  true,
+				Name:  sec.Name,
+				Value: sec.Value,
+			})
+		}
 
 		item := &buildItem{
 			Proc:     proc,
 			Config:   ir,
 			Labels:   parsed.Labels,
+			Environ:  snapshot,
 			Platform: metadata.Sys.Arch,
+			Skipped:  skippedSteps(parsed, metadata),
 		}
 		if item.Labels == nil {
 			item.Labels = map[string]string{}
@@ -590,6 +677,18 @@ func (b *builder) Build() ([]*buildItem, error) {
 	return items, nil
 }
 
+// skippedSteps returns the names of the pipeline steps the compiler
+// excludes because their when conditions do not match the build.
+func skippedSteps(parsed *yaml.Config, metadata frontend.Metadata) []string {
+	var names []string
+	for _, container := range parsed.Pipeline.Containers {
+		if !container.Constraints.Match(metadata) {
+			names = append(names, container.Name)
+		}
+	}
+	return names
+}
+
 func shasum(raw []byte) string {
 	sum := sha256.Sum256(raw)
 	return fmt.Sprintf("%x", sum)
@@ -15,9 +15,17 @@
 package server
 
 import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+	"github.com/drone/drone/shared/token"
+	"github.com/drone/drone/store"
+	"github.com/gin-gonic/gin"
 )
 
 func TestMultilineEnvsubst(t *testing.T) {
@@ -43,3 +51,359 @@ bbb`,
 		t.Fatal(err)
 	}
 }
+
+func TestBuildGated(t *testing.T) {
+	b := builder{
+		Repo:  &model.Repo{},
+		Curr:  &model.Build{},
+		Last:  &model.Build{},
+		Netrc: &model.Netrc{},
+		Yaml: `approval: ${GATED}
+pipeline:
+  deploy:
+    image: alpine
+    commands: [ echo deploy ]
+matrix:
+  GATED: [ false, true ]
+`,
+	}
+
+	items, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Want a pipeline per matrix axis, got %d", len(items))
+	}
+	if got := items[0].Proc.State; got != model.StatusPending {
+		t.Errorf("Want pipeline without approval pending, got %s", got)
+	}
+	if got := items[1].Proc.State; got != model.StatusGated {
+		t.Errorf("Want pipeline with approval gated, got %s", got)
+	}
+}
+
+func TestBuildSkippedSteps(t *testing.T) {
+	b := builder{
+		Repo:  &model.Repo{},
+		Curr:  &model.Build{Event: model.EventPush, Branch: "master"},
+		Last:  &model.Build{},
+		Netrc: &model.Netrc{},
+		Yaml: `pipeline:
+  test:
+    image: golang
+    commands: [ go test ]
+  publish:
+    image: plugins/docker
+    when:
+      branch: release
+`,
+	}
+
+	items, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items[0].Skipped) != 1 || items[0].Skipped[0] != "publish" {
+		t.Fatalf("Want the publish step skipped, got %v", items[0].Skipped)
+	}
+
+	build := &model.Build{}
+	buildProcs(build, items)
+	procs := model.Tree(build.Procs)
+	if len(procs) != 1 {
+		t.Fatalf("Want a single pipeline, got %d", len(procs))
+	}
+	children := procs[0].Children
+	last := children[len(children)-1]
+	if last.Name != "publish" || last.State != model.StatusSkipped {
+		t.Errorf("Want the publish step rendered as skipped, got %s %s", last.Name, last.State)
+	}
+	for _, proc := range children[:len(children)-1] {
+		if proc.State != model.StatusPending {
+			t.Errorf("Want step %s pending, got %s", proc.Name, proc.State)
+		}
+	}
+}
+
+func TestBuildFallback(t *testing.T) {
+	b := builder{
+		Repo:  &model.Repo{},
+		Curr:  &model.Build{Fallback: "platform/starter:.drone.yml"},
+		Last:  &model.Build{},
+		Netrc: &model.Netrc{},
+		Yaml: `pipeline:
+  test:
+    image: golang
+    commands: [ go test ]
+`,
+	}
+
+	items, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages := items[0].Config.Stages
+	environ := stages[len(stages)-1].Steps[0].Environment
+	if got := environ["DRONE_CONFIG_REPO"]; got != "platform/starter" {
+		t.Errorf("Want DRONE_CONFIG_REPO=platform/starter, got %q", got)
+	}
+	if got := environ["DRONE_CONFIG_PATH"]; got != ".drone.yml" {
+		t.Errorf("Want DRONE_CONFIG_PATH=.drone.yml, got %q", got)
+	}
+}
+
+// senderService is a sender service that allows or denies every
+// sender.
+type senderService struct {
+	model.SenderService
+	allowed bool
+}
+
+func (s *senderService) SenderAllowed(*model.User, *model.Repo, *model.Build, *model.Config) (bool, error) {
+	return s.allowed, nil
+}
+
+func TestRequiresApproval(t *testing.T) {
+	senders := Config.Services.Senders
+	defer func() { Config.Services.Senders = senders }()
+
+	var (
+		push = &model.Build{Event: model.EventPush}
+		pull = &model.Build{Event: model.EventPull, Remote: "https://github.com/octocat/hello-world.git"}
+		fork = &model.Build{Event: model.EventPull, Remote: "https://github.com/spaceghost/hello-world.git"}
+	)
+
+	tests := []struct {
+		policy  string
+		build   *model.Build
+		allowed bool
+		blocked bool
+	}{
+		{model.ApprovalNone, fork, false, false},
+		{model.ApprovalForks, fork, false, true},
+		{model.ApprovalForks, fork, true, false},
+		{model.ApprovalForks, pull, false, false},
+		{model.ApprovalPullRequests, pull, false, true},
+		{model.ApprovalPullRequests, push, false, false},
+		{model.ApprovalAll, push, false, true},
+		{model.ApprovalAll, push, true, false},
+	}
+	for _, test := range tests {
+		Config.Services.Senders = &senderService{allowed: test.allowed}
+		repo := &model.Repo{Clone: "https://github.com/octocat/hello-world.git", Approval: test.policy}
+
+		if got := requiresApproval(new(model.User), repo, test.build, new(model.Config)); got != test.blocked {
+			t.Errorf("Want blocked %v with policy %s for %s from %s, got %v", test.blocked, test.policy, test.build.Event, test.build.Remote, got)
+		}
+	}
+}
+
+func TestRequiresApprovalGated(t *testing.T) {
+	senders := Config.Services.Senders
+	defer func() { Config.Services.Senders = senders }()
+
+	repo := &model.Repo{IsGated: true}
+	push := &model.Build{Event: model.EventPush, Sender: "spaceghost"}
+
+	Config.Services.Senders = &senderService{allowed: false}
+	if !requiresApproval(new(model.User), repo, push, new(model.Config)) {
+		t.Errorf("Want push from a sender that is not allowed blocked in a gated repository")
+	}
+	Config.Services.Senders = &senderService{allowed: true}
+	if requiresApproval(new(model.User), repo, push, new(model.Config)) {
+		t.Errorf("Want push from an allowed sender not blocked in a gated repository")
+	}
+}
+
+// skipStore is a store that returns a single repository and its owner,
+// and records the created builds.
+type skipStore struct {
+	deliveryStore
+	created []*model.Build
+}
+
+func (s *skipStore) GetUser(int64) (*model.User, error) {
+	return &model.User{Login: "octocat"}, nil
+}
+
+func (s *skipStore) CreateBuild(build *model.Build, procs ...*model.Proc) error {
+	build.Number = len(s.created) + 1
+	s.created = append(s.created, build)
+	return nil
+}
+
+// skipRemote is a remote that parses every webhook as a push of a
+// commit with a skip directive.
+type skipRemote struct {
+	nopRemote
+}
+
+func (r *skipRemote) Hook(*http.Request) (*model.Repo, *model.Build, error) {
+	repo := &model.Repo{Owner: "octocat", Name: "hello-world"}
+	build := &model.Build{Event: model.EventPush, Commit: "9ecad50", Message: "update readme [ci skip]"}
+	return repo, build, nil
+}
+
+func newSkipContext(s store.Store, r remote.Remote) (*gin.Context, *model.Repo) {
+	repo := &model.Repo{ID: 1, UserID: 1, FullName: "octocat/hello-world", Hash: "hash", IsActive: true, AllowPush: true}
+	sig, _ := token.New(token.HookToken, repo.FullName).Sign(repo.Hash)
+	c, _, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/hook?access_token="+sig, nil)
+	remote.ToContext(c, r)
+	store.ToContext(c, s)
+	return c, repo
+}
+
+func TestPostHookSkipped(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	s := new(skipStore)
+	r := new(skipRemote)
+	c, repo := newSkipContext(s, r)
+	s.repo = repo
+
+	PostHook(c)
+
+	if len(s.created) != 1 {
+		t.Fatalf("Want a skipped build created, got %d builds", len(s.created))
+	}
+	build := s.created[0]
+	if build.Status != model.StatusSkipped || build.Trigger != model.TriggerHook {
+		t.Errorf("Want a skipped hook build, got status %s trigger %s", build.Status, build.Trigger)
+	}
+	if !build.Verified {
+		t.Errorf("Want the build of a signed hook verified")
+	}
+	if len(f.tasks) != 0 {
+		t.Errorf("Want no procs enqueued for a skipped build, got %d", len(f.tasks))
+	}
+	if r.desc == "" {
+		t.Errorf("Want the skipped status reported to the remote")
+	}
+	if len(s.deliveries) != 1 || s.deliveries[0].Build != 1 || !s.deliveries[0].Verified {
+		t.Errorf("Want the verified delivery recorded with the skipped build")
+	}
+}
+
+func TestPostHookUnverified(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := new(skipStore)
+	c, repo := newSkipContext(s, new(skipRemote))
+	s.repo = repo
+	sig, _ := token.New(token.HookToken, "octocat/forked").Sign(repo.Hash)
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/hook?access_token="+sig, nil)
+
+	PostHook(c)
+
+	if c.Writer.Status() != 403 {
+		t.Errorf("Want status 403, got %d", c.Writer.Status())
+	}
+	if len(s.deliveries) != 1 || s.deliveries[0].Verified {
+		t.Errorf("Want the delivery recorded as not verified")
+	}
+}
+
+func TestSkipBuildReplay(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := new(skipStore)
+	c, repo := newSkipContext(s, new(skipRemote))
+	build := &model.Build{Event: model.EventPush, Commit: "9ecad50"}
+
+	if err := skipBuild(c, repo, &model.User{Login: "octocat"}, build, &model.Delivery{Replay: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if build.Verified {
+		t.Errorf("Want the build of a replayed delivery not verified")
+	}
+	if build.Trigger != model.TriggerReplay {
+		t.Errorf("Want build trigger %s, got %s", model.TriggerReplay, build.Trigger)
+	}
+}
+
+func TestPostHookSkippedDrop(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+	Config.Server.SkipDrop = true
+	defer func() { Config.Server.SkipDrop = false }()
+
+	s := new(skipStore)
+	r := new(skipRemote)
+	c, repo := newSkipContext(s, r)
+	s.repo = repo
+
+	PostHook(c)
+
+	if len(s.created) != 0 {
+		t.Errorf("Want the skipped commit dropped, got %d builds", len(s.created))
+	}
+	if c.Writer.Status() != 204 {
+		t.Errorf("Want status 204, got %d", c.Writer.Status())
+	}
+}
+
+// hookReleaseStore is a store for a repository with a build
+// concurrency limit, that counts the lookups of held builds.
+type hookReleaseStore struct {
+	buildStore
+	repo     *model.Repo
+	released int
+}
+
+func (s *hookReleaseStore) GetRepoName(string) (*model.Repo, error) {
+	return s.repo, nil
+}
+
+func (s *hookReleaseStore) GetBuildActiveCount(*model.Repo) (int, error) {
+	return 0, nil
+}
+
+func (s *hookReleaseStore) GetBuildHeld(*model.Repo) (*model.Build, error) {
+	s.released++
+	return nil, sql.ErrNoRows
+}
+
+// pushRemote is a remote that parses every webhook as a push.
+type pushRemote struct {
+	nopRemote
+}
+
+func (r *pushRemote) Hook(*http.Request) (*model.Repo, *model.Build, error) {
+	repo := &model.Repo{Owner: "octocat", Name: "hello-world"}
+	build := &model.Build{Event: model.EventPush, Commit: "9ecad50", Branch: "master", Message: "update readme"}
+	return repo, build, nil
+}
+
+func TestPostHookDispatchError(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+	f.pushErr = errors.New("queue unavailable")
+
+	backoff := pushBackoff
+	pushBackoff = 0
+	defer func() { pushBackoff = backoff }()
+
+	s := new(hookReleaseStore)
+	defer withConfigStore(&s.buildStore)()
+	c, repo := newSkipContext(s, new(pushRemote))
+	repo.Config = ".drone.yml"
+	repo.MaxBuilds = 1
+	s.repo = repo
+
+	postHook(c, new(model.Delivery))
+
+	if len(s.created) != 1 {
+		t.Fatalf("Want a build created, got %d builds", len(s.created))
+	}
+	if build := s.created[0]; build.Status != model.StatusError || !strings.Contains(build.Error, "queue unavailable") {
+		t.Errorf("Want the build errored with the queue error, got status %s error %q", build.Status, build.Error)
+	}
+	if s.released == 0 {
+		t.Errorf("Want a concurrency slot released when the hook build cannot be dispatched")
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cncd/pipeline/pipeline/frontend/yaml"
+	"github.com/cncd/pipeline/pipeline/frontend/yaml/linter"
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/router/middleware/session"
+	"github.com/gin-gonic/gin"
+)
+
+// lintError is an error in a pipeline configuration. The step and line
+// are set when the error can be attributed to them.
+type lintError struct {
+	Message string `json:"message"`
+	Step    string `json:"step,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// lintStep reports whether a pipeline step would be skipped because of
+// its when clause.
+type lintStep struct {
+	Name    string `json:"name"`
+	Skipped bool   `json:"skipped"`
+}
+
+var lineRe = regexp.MustCompile(`line (\d+)`)
+
+// PostLint lints the pipeline configuration in the request body with
+// the same parse and compile path used for builds, without creating a
+// build. It returns 204 if the configuration is valid, or the list of
+// errors. When the event or branch query parameter is given, the steps
+// are evaluated for a build of that event and branch, and the steps
+// that would be skipped are reported.
+func PostLint(c *gin.Context) {
+	repo := session.Repo(c)
+
+	data, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		writeError(c, 400, errInvalidBody, "Error reading request body. %s", err)
+		return
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		writeError(c, 400, errInvalidBody, "Missing pipeline configuration")
+		return
+	}
+
+	event := c.DefaultQuery("event", model.EventPush)
+	switch event {
+	case model.EventPush, model.EventPull, model.EventTag, model.EventDeploy, model.EventCron, model.EventManual:
+	default:
+		writeError(c, 400, errInvalidParam, "Invalid event %q", event)
+		return
+	}
+	branch := c.DefaultQuery("branch", repo.Branch)
+
+	build := &model.Build{
+		Event:  event,
+		Branch: branch,
+		Ref:    "refs/heads/" + branch,
+		Status: model.StatusPending,
+	}
+	b := builder{
+		Repo:  repo,
+		Curr:  build,
+		Last:  &model.Build{},
+		Netrc: &model.Netrc{},
+		Yaml:  string(data),
+	}
+	items, err := b.Build()
+	if err != nil {
+		c.JSON(400, gin.H{
+			"code":    errInvalidConfig,
+			"message": err.Error(),
+			"errors":  lintConfig(repo, string(data), err),
+		})
+		return
+	}
+
+	if c.Query("event") == "" && c.Query("branch") == "" {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// the steps that are not part of any compiled pipeline are
+	// skipped by their when clause.
+	compiled := map[string]bool{}
+	for _, item := range items {
+		for _, stage := range item.Config.Stages {
+			for _, step := range stage.Steps {
+				compiled[step.Alias] = true
+			}
+		}
+	}
+	parsed, _ := yaml.ParseString(string(data))
+	steps := []*lintStep{}
+	for _, container := range parsed.Pipeline.Containers {
+		steps = append(steps, &lintStep{
+			Name:    container.Name,
+			Skipped: !compiled[container.Name],
+		})
+	}
+	matched := matchBranches([]*model.Config{{Data: string(data)}}, build)
+	c.JSON(200, gin.H{
+		"skipped": len(matched) == 0,
+		"steps":   steps,
+	})
+}
+
+// lintConfig returns the errors of an invalid pipeline configuration.
+// The steps of the pipeline are linted one by one so that all of their
+// errors are reported. Otherwise the error that failed the compilation
+// is returned.
+func lintConfig(repo *model.Repo, data string, err error) []*lintError {
+	parsed, perr := yaml.ParseString(data)
+	if perr != nil {
+		return []*lintError{newLintError(perr)}
+	}
+
+	var errs []*lintError
+	l := linter.New(
+		linter.WithTrusted(repo.IsTrusted),
+	)
+	for _, container := range parsed.Pipeline.Containers {
+		conf := &yaml.Config{}
+		conf.Pipeline.Containers = []*yaml.Container{container}
+		if err := l.Lint(conf); err != nil {
+			errs = append(errs, &lintError{
+				Message: err.Error(),
+				Step:    container.Name,
+				Line:    stepLine(data, container.Name),
+			})
+		}
+	}
+	if len(errs) == 0 {
+		errs = append(errs, newLintError(err))
+	}
+	return errs
+}
+
+// newLintError returns the lint error for err, with the line number of
+// yaml syntax errors.
+func newLintError(err error) *lintError {
+	out := &lintError{Message: err.Error()}
+	if match := lineRe.FindStringSubmatch(out.Message); match != nil {
+		out.Line, _ = strconv.Atoi(match[1])
+	}
+	return out
+}
+
+// stepLine returns the line number at which the step is declared in the
+// pipeline section of the configuration, or zero if it is not found.
+func stepLine(data, name string) int {
+	var pipeline bool
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case text == trimmed && trimmed != "":
+			pipeline = strings.HasPrefix(trimmed, "pipeline:")
+		case pipeline && strings.HasPrefix(trimmed, name+":"):
+			return line
+		}
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone/model"
+	"github.com/gin-gonic/gin"
+)
+
+func postLint(query, data string) (int, []byte) {
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "/api/repos/octocat/hello-world/lint"+query, strings.NewReader(data))
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world", Branch: "master"})
+
+	PostLint(c)
+	return c.Writer.Status(), w.Body.Bytes()
+}
+
+func TestPostLint(t *testing.T) {
+	code, _ := postLint("", "pipeline:\n  test:\n    image: golang\n    commands: [ go test ]\n")
+	if code != 204 {
+		t.Errorf("Want status 204 for a valid configuration, got %d", code)
+	}
+
+	code, _ = postLint("?event=comment", "pipeline:\n  test:\n    image: golang\n")
+	if code != 400 {
+		t.Errorf("Want status 400 for an invalid event, got %d", code)
+	}
+}
+
+func TestPostLintErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want []*lintError
+	}{
+		{
+			"pipeline:\n  test:\n    image: golang\n  - bad\n",
+			[]*lintError{{Line: 3}},
+		},
+		{
+			"pipeline:\n  build:\n    commands: [ go build ]\n  test:\n    image: golang\n    privileged: true\n",
+			[]*lintError{{Step: "build", Line: 2}, {Step: "test", Line: 4}},
+		},
+	}
+	for _, test := range tests {
+		code, body := postLint("", test.data)
+		if code != 400 {
+			t.Errorf("Want status 400 for an invalid configuration, got %d", code)
+			continue
+		}
+		out := struct {
+			Code   string       `json:"code"`
+			Errors []*lintError `json:"errors"`
+		}{}
+		json.Unmarshal(body, &out)
+		if out.Code != errInvalidConfig || len(out.Errors) != len(test.want) {
+			t.Errorf("Want %d errors, got %s", len(test.want), body)
+			continue
+		}
+		for i, want := range test.want {
+			got := out.Errors[i]
+			if got.Step != want.Step || got.Line != want.Line || got.Message == "" {
+				t.Errorf("Want error in step %q at line %d, got %q at line %d: %s", want.Step, want.Line, got.Step, got.Line, got.Message)
+			}
+		}
+	}
+}
+
+func TestPostLintSkipped(t *testing.T) {
+	data := `branches: [ master, develop ]
+pipeline:
+  test:
+    image: golang
+    commands: [ go test ]
+  publish:
+    image: plugins/docker
+    when:
+      branch: master
+`
+	tests := []struct {
+		query   string
+		skipped bool
+		publish bool
+	}{
+		{"?branch=master", false, false},
+		{"?branch=develop", false, true},
+		{"?branch=feature", true, true},
+		{"?event=tag&branch=feature", false, true},
+	}
+	for _, test := range tests {
+		code, body := postLint(test.query, data)
+		if code != 200 {
+			t.Errorf("Want status 200 for %s, got %d: %s", test.query, code, body)
+			continue
+		}
+		out := struct {
+			Skipped bool        `json:"skipped"`
+			Steps   []*lintStep `json:"steps"`
+		}{}
+		json.Unmarshal(body, &out)
+		if out.Skipped != test.skipped {
+			t.Errorf("Want pipeline skipped %v for %s, got %v", test.skipped, test.query, out.Skipped)
+		}
+		if len(out.Steps) != 2 || out.Steps[0].Skipped || out.Steps[1].Skipped != test.publish {
+			t.Errorf("Want publish step skipped %v for %s, got %s", test.publish, test.query, body)
+		}
+	}
+}
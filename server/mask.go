@@ -0,0 +1,196 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cncd/pipeline/pipeline/backend"
+	"github.com/cncd/pipeline/pipeline/rpc"
+	"github.com/drone/drone/model"
+)
+
+// maskValue replaces the secret values in the logs.
+const maskValue = "********"
+
+// maskEncodings are the base64 encodings of the secret values that are
+// masked in the logs.
+var maskEncodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.URLEncoding,
+	base64.RawStdEncoding,
+	base64.RawURLEncoding,
+}
+
+// masks records the secret values that are masked in the logs of each
+// pipeline. The logs are masked by the server since the agents cannot
+// be trusted to mask the output of every plugin.
+var masks = &logMasks{
+	replacers: map[string]*strings.Replacer{},
+}
+
+type logMasks struct {
+	sync.Mutex
+	replacers map[string]*strings.Replacer
+}
+
+// add records the secrets that are masked in the logs of the pipeline.
+func (m *logMasks) add(id string, secrets []*backend.Secret) {
+	var values []string
+	for _, secret := range secrets {
+		if secret.Mask {
+			values = append(values, secret.Value)
+		}
+	}
+	replacer := newMaskReplacer(values)
+	if replacer == nil {
+		return
+	}
+	m.Lock()
+	m.replacers[id] = replacer
+	m.Unlock()
+}
+
+// mask replaces the secret values in the log output of the pipeline.
+func (m *logMasks) mask(id, out string) string {
+	m.Lock()
+	replacer, ok := m.replacers[id]
+	m.Unlock()
+	if !ok {
+		return out
+	}
+	return replacer.Replace(out)
+}
+
+// maskLines replaces the secret values in the uploaded json log lines
+// of the pipeline.
+func (m *logMasks) maskLines(id string, data []byte) []byte {
+	m.Lock()
+	replacer, ok := m.replacers[id]
+	m.Unlock()
+	if !ok {
+		return data
+	}
+
+	return maskLogLines(replacer, data)
+}
+
+// buildMask returns a replacer that masks the values of the secrets
+// exposed to the build, or nil if there is nothing to mask. It returns
+// an error if the secrets cannot be listed, so that the logs are not
+// served unmasked.
+func buildMask(repo *model.Repo, build *model.Build) (*strings.Replacer, error) {
+	secrets, err := Config.Services.Secrets.SecretListBuild(repo, build)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, secret := range secrets {
+		values = append(values, secret.Value)
+	}
+	return newMaskReplacer(values), nil
+}
+
+// maskLog replaces the secret values in the stored log when it is
+// read. Logs are masked when they are written as well, but logs stored
+// before a secret was added, or by an older server, are not.
+func maskLog(replacer *strings.Replacer, r io.Reader) (io.Reader, error) {
+	if replacer == nil {
+		return r, nil
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(maskLogLines(replacer, data)), nil
+}
+
+// maskLogLines replaces the secret values in the output of the json
+// log lines. The output is decoded first so that values containing
+// characters escaped in json are matched as well.
+func maskLogLines(replacer *strings.Replacer, data []byte) []byte {
+	var lines []*rpc.Line
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return []byte(replacer.Replace(string(data)))
+	}
+	for _, line := range lines {
+		line.Out = replacer.Replace(line.Out)
+	}
+	masked, err := json.Marshal(lines)
+	if err != nil {
+		return []byte(replacer.Replace(string(data)))
+	}
+	return masked
+}
+
+// forget removes the secrets recorded for the pipeline.
+func (m *logMasks) forget(id string) {
+	m.Lock()
+	delete(m.replacers, id)
+	m.Unlock()
+}
+
+// newMaskReplacer returns a replacer that masks the secret values, or
+// nil if there is nothing to mask. The lines of multi-line values are
+// masked individually since the log output is streamed in chunks, and
+// the base64 encoding of each value is masked as well.
+func newMaskReplacer(values []string) *strings.Replacer {
+	set := map[string]struct{}{}
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		set[value] = struct{}{}
+		for _, enc := range maskEncodings {
+			set[enc.EncodeToString([]byte(value))] = struct{}{}
+		}
+		if !strings.Contains(value, "\n") {
+			continue
+		}
+		for _, line := range strings.Split(value, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				set[line] = struct{}{}
+			}
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	// longer values are matched first so that a multi-line value is
+	// masked as a whole before its individual lines.
+	var olds []string
+	for old := range set {
+		olds = append(olds, old)
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+		return olds[i] < olds[j]
+	})
+	var oldnew []string
+	for _, old := range olds {
+		oldnew = append(oldnew, old, maskValue)
+	}
+	return strings.NewReplacer(oldnew...)
+}
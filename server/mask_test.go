@@ -0,0 +1,96 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cncd/logging"
+	"github.com/cncd/pipeline/pipeline/backend"
+	"github.com/cncd/pipeline/pipeline/rpc"
+)
+
+func TestNewMaskReplacer(t *testing.T) {
+	key := "-----BEGIN KEY-----\nMIIEpAIBAAKCAQEA\n-----END KEY-----"
+	replacer := newMaskReplacer([]string{"correct-horse", key, " "})
+
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{"password is correct-horse", "password is ********"},
+		{"encoded " + base64.StdEncoding.EncodeToString([]byte("correct-horse")), "encoded ********"},
+		{"raw " + base64.RawStdEncoding.EncodeToString([]byte("correct-horse")) + ".", "raw ********."},
+		{"url " + base64.URLEncoding.EncodeToString([]byte(key)), "url ********"},
+		{key + "\n", "********\n"},
+		{"  MIIEpAIBAAKCAQEA\n", "  ********\n"},
+		{"nothing to see here", "nothing to see here"},
+	}
+	for _, test := range tests {
+		if got := replacer.Replace(test.out); got != test.want {
+			t.Errorf("Want output %q masked as %q, got %q", test.out, test.want, got)
+		}
+	}
+
+	if newMaskReplacer([]string{"", "\n"}) != nil {
+		t.Errorf("Want no replacer for blank secrets")
+	}
+}
+
+// lineLogger is a log service that records the written entries.
+type lineLogger struct {
+	logging.Log
+	entries []*logging.Entry
+}
+
+func (l *lineLogger) Write(c context.Context, path string, entry *logging.Entry) error {
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func TestLogMasked(t *testing.T) {
+	masks.add("1", []*backend.Secret{
+		{Name: "password", Value: "correct-horse", Mask: true},
+	})
+	defer masks.forget("1")
+
+	logger := new(lineLogger)
+	peer := RPC{logger: logger}
+	peer.Log(context.Background(), "1", &rpc.Line{Out: "echo correct-horse"})
+	peer.Log(context.Background(), "2", &rpc.Line{Out: "echo correct-horse"})
+	defer activity.forget("1")
+	defer activity.forget("2")
+
+	if len(logger.entries) != 2 {
+		t.Fatalf("Want 2 log entries, got %d", len(logger.entries))
+	}
+	if got := string(logger.entries[0].Data); strings.Contains(got, "correct-horse") {
+		t.Errorf("Want the secret masked in the streamed log, got %s", got)
+	}
+	if got := string(logger.entries[1].Data); !strings.Contains(got, "correct-horse") {
+		t.Errorf("Want the log of another pipeline unmasked, got %s", got)
+	}
+
+	data, _ := json.Marshal([]*rpc.Line{{Out: "correct-horse\n"}})
+	var lines []*rpc.Line
+	json.Unmarshal(masks.maskLines("1", data), &lines)
+	if len(lines) != 1 || lines[0].Out != "********\n" {
+		t.Errorf("Want the secret masked in the stored log, got %s", masks.maskLines("1", data))
+	}
+}
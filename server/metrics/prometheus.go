@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/drone/drone/router/middleware/session"
 	"github.com/drone/drone/server"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -28,15 +29,21 @@ var (
 	errInvalidToken = errors.New("Invalid or missing token")
 )
 
-// PromHandler will pass the call from /api/metrics/prometheus to prometheus
+// PromHandler will pass the call from /api/metrics/prometheus to prometheus.
+// The request must be made by an administrator, or carry the configured
+// prometheus auth token as a bearer token.
 func PromHandler() gin.HandlerFunc {
 	handler := promhttp.Handler()
 
 	return func(c *gin.Context) {
-		token := server.Config.Prometheus.AuthToken
+		if user := session.User(c); user != nil && user.Admin {
+			handler.ServeHTTP(c.Writer, c.Request)
+			return
+		}
 
+		token := server.Config.Prometheus.AuthToken
 		if token == "" {
-			handler.ServeHTTP(c.Writer, c.Request)
+			c.String(401, errInvalidToken.Error())
 			return
 		}
 
@@ -0,0 +1,290 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/cncd/logging"
+	"github.com/cncd/pubsub"
+	"github.com/cncd/queue"
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// buildStore is a minimal store shared by the server tests. It returns
+// a single build by number and an active repository, records created
+// and updated builds and procs, and stores the build configuration and
+// parameters. Tests embed it and override the methods they exercise.
+type buildStore struct {
+	store.Store
+	build   *model.Build
+	created []*model.Build
+	updated []*model.Build
+	procs   []*model.Proc
+	environ map[string]string
+	params  map[string]string
+	envs    []*model.Environ
+	confs   []*model.Config
+}
+
+func (s *buildStore) GetRepo(int64) (*model.Repo, error) {
+	return &model.Repo{ID: 1, FullName: "octocat/hello-world", IsActive: true, AllowPush: true, AllowDeploy: true, Config: ".drone.yml"}, nil
+}
+
+func (s *buildStore) GetUser(int64) (*model.User, error) {
+	return new(model.User), nil
+}
+
+func (s *buildStore) GetUserLogin(string) (*model.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *buildStore) CreateBuild(build *model.Build, procs ...*model.Proc) error {
+	build.Number = len(s.created) + 1
+	s.created = append(s.created, build)
+	return nil
+}
+
+func (s *buildStore) GetBuildNumber(*model.Repo, int) (*model.Build, error) {
+	return s.build, nil
+}
+
+func (s *buildStore) GetBuildLastBefore(*model.Repo, string, int64) (*model.Build, error) {
+	return new(model.Build), nil
+}
+
+func (s *buildStore) UpdateBuild(build *model.Build) error {
+	s.updated = append(s.updated, build)
+	return nil
+}
+
+func (s *buildStore) ProcList(*model.Build) ([]*model.Proc, error) {
+	return s.procs, nil
+}
+
+func (s *buildStore) ProcCreate(procs []*model.Proc) error {
+	s.procs = append(s.procs, procs...)
+	return nil
+}
+
+func (s *buildStore) ProcUpdate(*model.Proc) error {
+	return nil
+}
+
+func (s *buildStore) AuditCreate(*model.Audit) error {
+	return nil
+}
+
+func (s *buildStore) EnvironList(*model.Repo) ([]*model.Environ, error) {
+	return s.envs, nil
+}
+
+func (s *buildStore) BuildEnvironFind(int64) (map[string]string, error) {
+	return s.environ, nil
+}
+
+func (s *buildStore) BuildConfigFind(int64) ([]*model.Config, error) {
+	return s.confs, nil
+}
+
+func (s *buildStore) GetBuildHeld(*model.Repo) (*model.Build, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *buildStore) BuildConfigSave(buildID int64, confs []*model.Config) error {
+	s.confs = confs
+	return nil
+}
+
+func (s *buildStore) BuildEnvironSave(buildID int64, environ map[string]string) error {
+	s.environ = environ
+	return nil
+}
+
+func (s *buildStore) BuildParamsFind(int64) (map[string]string, error) {
+	params := map[string]string{}
+	for k, v := range s.params {
+		params[k] = v
+	}
+	return params, nil
+}
+
+func (s *buildStore) BuildParamsSave(buildID int64, params map[string]string) error {
+	s.params = params
+	return nil
+}
+
+func (s *buildStore) ConfigFind(*model.Repo, string) (*model.Config, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *buildStore) ConfigLoad(int64) (*model.Config, error) {
+	return &model.Config{ID: 1, Data: "pipeline:\n  deploy:\n    image: alpine\n    commands: [ echo deploy ]\n"}, nil
+}
+
+func (s *buildStore) ConfigCreate(conf *model.Config) error {
+	conf.ID = 1
+	return nil
+}
+
+// withConfigStore replaces the global configuration store and returns
+// a function that restores the original store.
+func withConfigStore(s *buildStore) func() {
+	configs := Config.Storage.Config
+	Config.Storage.Config = s
+	return func() { Config.Storage.Config = configs }
+}
+
+// nopRemote is a remote that generates empty netrc files, returns the
+// same build configuration for every ref and the same head commit for
+// every branch, and records the last commit status description.
+type nopRemote struct {
+	remote.Remote
+	desc    string
+	ref     string
+	branch  string
+	headErr error
+}
+
+func (r *nopRemote) FileRef(u *model.User, repo *model.Repo, ref, f string) ([]byte, error) {
+	r.ref = ref
+	return []byte("pipeline:\n  test:\n    image: golang\n    commands: [ go test ]\n"), nil
+}
+
+func (r *nopRemote) File(u *model.User, repo *model.Repo, b *model.Build, f string) ([]byte, error) {
+	return r.FileRef(u, repo, b.Commit, f)
+}
+
+func (r *nopRemote) BranchHead(u *model.User, repo *model.Repo, branch string) (string, error) {
+	r.branch = branch
+	if r.headErr != nil {
+		return "", r.headErr
+	}
+	return "9ecad50", nil
+}
+
+func (r *nopRemote) Netrc(*model.User, *model.Repo) (*model.Netrc, error) {
+	return &model.Netrc{}, nil
+}
+
+func (r *nopRemote) Status(u *model.User, repo *model.Repo, b *model.Build, link string) error {
+	r.desc = remote.StatusDesc(b, "the build was rejected")
+	return nil
+}
+
+// fakeServices records the tasks, messages and logs that are sent to
+// the queue, pubsub and logging services.
+type fakeServices struct {
+	queue.Queue
+	pubsub.Publisher
+	logging.Log
+	model.SecretService
+	model.RegistryService
+
+	tasks      []*queue.Task
+	messages   []pubsub.Message
+	logs       []string
+	globals    []*model.Environ
+	secrets    []*model.Secret
+	secretsErr error
+	errored    []string
+	evicted    []string
+	info       queue.InfoT
+	pushErr    error
+	pushFails  int
+	pushes     int
+}
+
+func (f *fakeServices) Push(c context.Context, task *queue.Task) error {
+	f.pushes++
+	if f.pushErr != nil {
+		return f.pushErr
+	}
+	if f.pushes <= f.pushFails {
+		return errors.New("queue unavailable")
+	}
+	f.tasks = append(f.tasks, task)
+	return nil
+}
+
+func (f *fakeServices) Evict(c context.Context, id string) error {
+	f.evicted = append(f.evicted, id)
+	return nil
+}
+
+func (f *fakeServices) Error(c context.Context, id string, err error) error {
+	f.errored = append(f.errored, id)
+	return nil
+}
+
+func (f *fakeServices) Info(c context.Context) queue.InfoT {
+	return f.info
+}
+
+func (f *fakeServices) Publish(c context.Context, topic string, message pubsub.Message) error {
+	f.messages = append(f.messages, message)
+	return nil
+}
+
+func (f *fakeServices) Open(c context.Context, path string) error {
+	f.logs = append(f.logs, path)
+	return nil
+}
+
+func (f *fakeServices) Close(c context.Context, path string) error {
+	return nil
+}
+
+func (f *fakeServices) SecretListBuild(*model.Repo, *model.Build) ([]*model.Secret, error) {
+	return f.secrets, f.secretsErr
+}
+
+func (f *fakeServices) RegistryList(*model.Repo) ([]*model.Registry, error) {
+	return nil, nil
+}
+
+func (f *fakeServices) EnvironList(*model.Repo) ([]*model.Environ, error) {
+	return f.globals, nil
+}
+
+// withFakeServices replaces the global services with fakes and returns
+// a function that restores the original services.
+func withFakeServices() (*fakeServices, func()) {
+	f := new(fakeServices)
+	services := Config.Services
+	Config.Services.Queue = f
+	Config.Services.Pubsub = f
+	Config.Services.Logs = f
+	Config.Services.Secrets = f
+	Config.Services.Registries = f
+	Config.Services.Environ = f
+	Config.Services.Limiter = model.NoLimit{}
+	return f, func() { Config.Services = services }
+}
+
+func newStartContext(s store.Store) *gin.Context {
+	c, _, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "http://drone.example.com/", nil)
+	remote.ToContext(c, new(nopRemote))
+	store.ToContext(c, s)
+	return c
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// buildBuckets are the histogram buckets of the build durations in
+// seconds, from seconds up to a few hours.
+var buildBuckets = []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200, 14400}
+
+var (
+	buildsStarted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "drone",
+		Name:      "builds_started_total",
+		Help:      "Total number of builds started by agents.",
+	})
+	buildsFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "drone",
+		Name:      "builds_finished_total",
+		Help:      "Total number of finished builds by status.",
+	}, []string{"status"})
+	buildQueueTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "drone",
+		Name:      "build_queue_seconds",
+		Help:      "Time builds waited in the queue before starting in seconds.",
+		Buckets:   buildBuckets,
+	}, []string{"repo"})
+	buildDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "drone",
+		Name:      "build_duration_seconds",
+		Help:      "Duration of finished builds in seconds.",
+		Buckets:   buildBuckets,
+	}, []string{"repo", "status"})
+	procDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "drone",
+		Name:      "proc_duration_seconds",
+		Help:      "Duration of pipeline steps in seconds.",
+		Buckets:   []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	})
+	logSubscribers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "drone",
+		Name:      "log_subscribers",
+		Help:      "Number of clients streaming live logs.",
+	})
+	repoCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "drone",
+		Name:      "repo_count",
+		Help:      "Total number of repositories.",
+	})
+	userCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "drone",
+		Name:      "user_count",
+		Help:      "Total number of users.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		buildsStarted,
+		buildsFinished,
+		buildQueueTime,
+		buildDuration,
+		procDuration,
+		logSubscribers,
+		repoCount,
+		userCount,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "drone",
+			Name:      "pending_tasks",
+			Help:      "Number of tasks waiting in the queue.",
+		}, func() float64 {
+			return float64(queueStats().Pending)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "drone",
+			Name:      "running_tasks",
+			Help:      "Number of tasks being executed by agents.",
+		}, func() float64 {
+			return float64(queueStats().Running)
+		}),
+	)
+}
+
+// buildStarted records the metrics of a build started by an agent,
+// including the time the build waited in the queue.
+func buildStarted(repo *model.Repo, build *model.Build) {
+	buildsStarted.Inc()
+	if build.Enqueued != 0 && build.Started >= build.Enqueued {
+		buildQueueTime.WithLabelValues(repo.FullName).Observe(float64(build.Started - build.Enqueued))
+	}
+}
+
+// buildFinished records the metrics of a build that reached a final
+// status, including its duration. It must be invoked on every path
+// that finishes a build, so that the finished builds add up with the
+// started builds.
+func buildFinished(repo *model.Repo, build *model.Build) {
+	buildsFinished.WithLabelValues(build.Status).Inc()
+	if build.Started != 0 && build.Finished >= build.Started {
+		buildDuration.WithLabelValues(repo.FullName, build.Status).Observe(float64(build.Finished - build.Started))
+	}
+}
+
+// queueStats returns the pending and running task counts of the queue.
+func queueStats() (stats struct{ Pending, Running int }) {
+	if Config.Services.Queue == nil {
+		return
+	}
+	info := Config.Services.Queue.Info(context.Background())
+	stats.Pending = info.Stats.Pending
+	stats.Running = info.Stats.Running
+	return
+}
+
+// CollectMetrics updates the repository and user count metrics from
+// the store at the given interval, so that scraping the metrics does
+// not query the database.
+func CollectMetrics(s store.Store, interval time.Duration) {
+	for {
+		if n, err := s.GetRepoCount(); err == nil {
+			repoCount.Set(float64(n))
+		} else {
+			logrus.Debugf("metrics: cannot count repositories. %s", err)
+		}
+		if n, err := s.GetUserCount(); err == nil {
+			userCount.Set(float64(n))
+		} else {
+			logrus.Debugf("metrics: cannot count users. %s", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/drone/drone/model"
+	"github.com/prometheus/client_golang/prometheus"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterValue returns the current value of the counter.
+func counterValue(counter prometheus.Counter) float64 {
+	m := new(dto.Metric)
+	counter.Write(m)
+	return m.GetCounter().GetValue()
+}
+
+func TestBuildMetrics(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	started := counterValue(buildsStarted)
+	killed := counterValue(buildsFinished.WithLabelValues(model.StatusKilled))
+
+	s := new(buildStore)
+	c := newStartContext(s)
+	build := &model.Build{ID: 1, Number: 1, Event: model.EventPush, Status: model.StatusPending}
+	conf := &model.Config{Data: "pipeline:\n  test:\n    image: golang\n    commands: [ go test ]\n"}
+	if err := startBuild(c, &model.Repo{FullName: "octocat/hello-world"}, &model.User{}, build, []*model.Config{conf}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.tasks) != 1 {
+		t.Fatalf("Want the build queued")
+	}
+	if got := counterValue(buildsStarted) - started; got != 0 {
+		t.Errorf("Want queued builds not counted as started, got %v", got)
+	}
+
+	killBuild(s, &model.Repo{}, build, s.procs)
+	if got := counterValue(buildsFinished.WithLabelValues(model.StatusKilled)) - killed; got != 1 {
+		t.Errorf("Want the killed build counted as finished, got %v", got)
+	}
+}
+
+func TestBuildDurationMetrics(t *testing.T) {
+	repo := &model.Repo{FullName: "octocat/metrics"}
+	buildStarted(repo, &model.Build{Enqueued: 100, Started: 130})
+	buildStarted(repo, &model.Build{Started: 130})
+	buildFinished(repo, &model.Build{Status: model.StatusSuccess, Started: 130, Finished: 430})
+	buildFinished(repo, &model.Build{Status: model.StatusKilled, Finished: 430})
+
+	tests := []struct {
+		observer prometheus.Observer
+		count    uint64
+		sum      float64
+	}{
+		{buildQueueTime.WithLabelValues(repo.FullName), 1, 30},
+		{buildDuration.WithLabelValues(repo.FullName, model.StatusSuccess), 1, 300},
+		{buildDuration.WithLabelValues(repo.FullName, model.StatusKilled), 0, 0},
+	}
+	for _, test := range tests {
+		m := new(dto.Metric)
+		test.observer.(prometheus.Metric).Write(m)
+		if got := m.GetHistogram().GetSampleCount(); got != test.count {
+			t.Errorf("Want %d samples, got %d", test.count, got)
+		}
+		if got := m.GetHistogram().GetSampleSum(); got != test.sum {
+			t.Errorf("Want a sample sum of %v, got %v", test.sum, got)
+		}
+	}
+}
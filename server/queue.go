@@ -0,0 +1,49 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/drone/drone/model"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+)
+
+// PostQueuePause stops the queue from handing out tasks to the agents.
+// Running tasks are not affected and new tasks are still accepted.
+func PostQueuePause(c *gin.Context) {
+	q, ok := model.QueuePauser(Config.Services.Queue)
+	if !ok {
+		c.String(http.StatusNotImplemented, "Queue cannot be paused")
+		return
+	}
+	q.Pause()
+	logrus.Infof("queue: paused")
+	c.Status(http.StatusNoContent)
+}
+
+// PostQueueResume resumes handing out tasks to the agents.
+func PostQueueResume(c *gin.Context) {
+	q, ok := model.QueuePauser(Config.Services.Queue)
+	if !ok {
+		c.String(http.StatusNotImplemented, "Queue cannot be paused")
+		return
+	}
+	q.Resume()
+	logrus.Infof("queue: resumed")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/router/middleware/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// buildRates records the builds created through the api, limiting how
+// often builds are created for each repository and user so that a
+// misbehaving client cannot flood the queue.
+var buildRates = &rateLimiter{
+	hits: map[string][]time.Time{},
+}
+
+// limitBuildRate records a build created by the user for the
+// repository. It writes a 429 error response with a Retry-After header
+// and returns false if the repository or user limit is exceeded.
+func limitBuildRate(c *gin.Context, repo *model.Repo) bool {
+	limits := Config.BuildRate
+	if limits.Window <= 0 {
+		return true
+	}
+	keys := map[string]int{}
+	if limits.Repo > 0 {
+		keys[fmt.Sprintf("repo/%d", repo.ID)] = limits.Repo
+	}
+	if user := session.User(c); user != nil && limits.User > 0 {
+		keys[fmt.Sprintf("user/%d", user.ID)] = limits.User
+	}
+	if len(keys) == 0 {
+		return true
+	}
+
+	wait := buildRates.allow(keys, limits.Window, time.Now())
+	if wait == 0 {
+		return true
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeError(c, http.StatusTooManyRequests, errRateLimited,
+		"too many builds created for %s, retry in %s", repo.FullName, wait)
+	return false
+}
+
+// rateLimiter is a sliding window rate limiter.
+type rateLimiter struct {
+	sync.Mutex
+	hits map[string][]time.Time
+}
+
+// allow records a hit for each key when none of the keys exceeds its
+// limit within the window, and returns 0. Otherwise nothing is
+// recorded and the time until the hit would be allowed is returned.
+func (l *rateLimiter) allow(limits map[string]int, window time.Duration, now time.Time) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+
+	var wait time.Duration
+	for key, limit := range limits {
+		hits := l.hits[key]
+		for len(hits) != 0 && !hits[0].After(now.Add(-window)) {
+			hits = hits[1:]
+		}
+		l.hits[key] = hits
+		if len(hits) >= limit {
+			if w := hits[len(hits)-limit].Add(window).Sub(now); w > wait {
+				wait = w
+			}
+		}
+	}
+	if wait != 0 {
+		return wait
+	}
+	for key := range limits {
+		l.hits[key] = append(l.hits[key], now)
+	}
+	l.evict(now.Add(-window))
+	return 0
+}
+
+// evict removes the keys without hits since the time.
+func (l *rateLimiter) evict(since time.Time) {
+	for key, hits := range l.hits {
+		if len(hits) == 0 || !hits[len(hits)-1].After(since) {
+			delete(l.hits, key)
+		}
+	}
+}
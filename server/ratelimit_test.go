@@ -0,0 +1,75 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/drone/drone/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := &rateLimiter{hits: map[string][]time.Time{}}
+	now := time.Unix(1000, 0)
+	limits := map[string]int{"repo/1": 2, "user/1": 3}
+
+	for i := 0; i < 2; i++ {
+		if wait := l.allow(limits, time.Minute, now.Add(time.Duration(i)*time.Second)); wait != 0 {
+			t.Errorf("Want hit %d allowed, got wait %s", i, wait)
+		}
+	}
+	if wait := l.allow(limits, time.Minute, now.Add(10*time.Second)); wait != 50*time.Second {
+		t.Errorf("Want the third hit to wait 50s, got %s", wait)
+	}
+	if got := len(l.hits["user/1"]); got != 2 {
+		t.Errorf("Want rejected hits not recorded, got %d user hits", got)
+	}
+	if wait := l.allow(limits, time.Minute, now.Add(time.Minute)); wait != 0 {
+		t.Errorf("Want hits allowed once the window passed, got wait %s", wait)
+	}
+	if wait := l.allow(map[string]int{"repo/2": 1}, time.Minute, now.Add(3*time.Minute)); wait != 0 {
+		t.Errorf("Want other keys limited separately, got wait %s", wait)
+	}
+	if _, ok := l.hits["repo/1"]; ok {
+		t.Errorf("Want expired keys evicted")
+	}
+}
+
+func TestLimitBuildRate(t *testing.T) {
+	limits := Config.BuildRate
+	defer func() { Config.BuildRate = limits }()
+	Config.BuildRate.Repo = 1
+	Config.BuildRate.Window = time.Minute
+
+	repo := &model.Repo{ID: 42, FullName: "octocat/rate-limit"}
+	codes := []int{200, 429}
+	for _, code := range codes {
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("POST", "/api/repos/octocat/rate-limit/builds/1", nil)
+
+		if ok := limitBuildRate(c, repo); ok != (code == 200) {
+			t.Errorf("Want build allowed %v", code == 200)
+		}
+		if code == 429 {
+			if w.Code != 429 || w.Header().Get("Retry-After") != "60" {
+				t.Errorf("Want status 429 and Retry-After 60, got %d and %q", w.Code, w.Header().Get("Retry-After"))
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/remote"
+	"github.com/drone/drone/store"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// heartbeatTimeout is the duration after which an agent that stopped
+// renewing the lease of a proc is considered gone. Agents renew their
+// leases every minute.
+const heartbeatTimeout = 3 * time.Minute
+
+// Reaper kills running builds whose pipelines exceeded the timeout of
+// their repository by the Grace period. It protects against agents
+// that die or stop reporting, which would otherwise leave builds
+// running forever. The timeout applies to each pipeline from the time
+// it started, and a build is only killed when none of its pipelines
+// is waiting in the queue, renewed its lease within the heartbeat
+// timeout, or wrote to its log within the repository timeout and the
+// Grace period.
+//
+// When ZombieAge is set the reaper also kills pending and running
+// builds older than ZombieAge that no longer have a task in the queue.
+type Reaper struct {
+	Store     store.Store
+	Remote    remote.Remote
+	Host      string
+	Grace     time.Duration
+	ZombieAge time.Duration
+}
+
+// Start reaps timed out builds at the given interval. It never returns
+// and should be invoked in a separate goroutine.
+func (r *Reaper) Start(interval time.Duration) {
+	for range time.Tick(interval) {
+		r.Reap(time.Now())
+	}
+}
+
+// Reap kills the running builds that exceeded the repository timeout,
+// and the zombie builds, at the given time.
+func (r *Reaper) Reap(now time.Time) {
+	feed, err := r.Store.GetBuildQueue()
+	if err != nil {
+		logrus.Errorf("reaper: cannot list running builds. %s", err)
+		return
+	}
+
+	queued, active := queueTasks()
+
+	for _, item := range feed {
+		repo, err := r.Store.GetRepoName(item.FullName)
+		if err != nil {
+			logrus.Errorf("reaper: cannot find repository %s. %s", item.FullName, err)
+			continue
+		}
+
+		switch {
+		case timedOut(item, repo, now, r.Grace):
+			killed, err := r.kill(repo, item.Number, func(proc *model.Proc) bool {
+				return r.alive(proc, repo, now, queued)
+			})
+			if err != nil {
+				logrus.Errorf("reaper: cannot kill build %s#%d. %s", repo.FullName, item.Number, err)
+				continue
+			}
+			if killed {
+				logrus.Infof("reaper: killed build %s#%d after %d minutes", repo.FullName, item.Number, repo.Timeout)
+			}
+
+		case r.ZombieAge != 0 && stale(item, now, r.ZombieAge):
+			killed, err := r.kill(repo, item.Number, func(proc *model.Proc) bool {
+				return active[fmt.Sprint(proc.ID)]
+			})
+			if err != nil {
+				logrus.Errorf("reaper: cannot kill zombie build %s#%d. %s", repo.FullName, item.Number, err)
+				continue
+			}
+			if killed {
+				logrus.Warnf("reaper: killed zombie build %s#%d with status %s and no queued tasks", repo.FullName, item.Number, item.Status)
+			}
+		}
+	}
+}
+
+// timedOut returns true if the running build started longer ago than
+// the repository timeout and the grace period, in which case one of
+// its pipelines may have exceeded the timeout.
+func timedOut(item *model.Feed, repo *model.Repo, now time.Time, grace time.Duration) bool {
+	if item.Status != model.StatusRunning || item.Started == 0 || repo.Timeout == 0 {
+		return false
+	}
+	deadline := time.Unix(item.Started, 0).Add(time.Duration(repo.Timeout)*time.Minute + grace)
+	return !now.Before(deadline)
+}
+
+// alive returns true if the pipeline proc is pending or its task is
+// waiting in the queue, or if it is running and its agent renewed the
+// lease within the heartbeat timeout, or the pipeline started or wrote
+// to its log within the repository timeout and the grace period. Steps
+// are not considered since agents report on behalf of the pipeline.
+func (r *Reaper) alive(proc *model.Proc, repo *model.Repo, now time.Time, queued map[string]bool) bool {
+	if proc.PPID != 0 {
+		return false
+	}
+	if proc.State == model.StatusPending || queued[fmt.Sprint(proc.ID)] {
+		return true
+	}
+	if proc.State != model.StatusRunning {
+		return false
+	}
+	lease, logged := activity.get(fmt.Sprint(proc.ID))
+	if now.Sub(lease) < heartbeatTimeout {
+		return true
+	}
+	last := time.Unix(proc.Started, 0)
+	if logged.After(last) {
+		last = logged
+	}
+	return now.Before(last.Add(time.Duration(repo.Timeout)*time.Minute + r.Grace))
+}
+
+// stale returns true if the build was started, or created when it is
+// still pending, longer than age ago.
+func stale(item *model.Feed, now time.Time, age time.Duration) bool {
+	since := item.Started
+	if since == 0 {
+		since = item.Created
+	}
+	return since != 0 && now.Sub(time.Unix(since, 0)) > age
+}
+
+// activeTasks returns the identifiers of the pending and running tasks
+// in the queue.
+func activeTasks() map[string]bool {
+	_, active := queueTasks()
+	return active
+}
+
+// queueTasks returns the identifiers of the tasks waiting in the queue,
+// and of the pending and running tasks in the queue.
+func queueTasks() (queued, active map[string]bool) {
+	info := Config.Services.Queue.Info(context.Background())
+	queued = map[string]bool{}
+	active = map[string]bool{}
+	for _, task := range info.Pending {
+		queued[task.ID] = true
+		active[task.ID] = true
+	}
+	for _, task := range info.Running {
+		active[task.ID] = true
+	}
+	return queued, active
+}
+
+// kill kills the build unless one of its procs is alive.
+func (r *Reaper) kill(repo *model.Repo, number int, alive func(*model.Proc) bool) (bool, error) {
+	build, err := r.Store.GetBuildNumber(repo, number)
+	if err != nil {
+		return false, err
+	}
+	// held builds wait for a build concurrency slot without tasks in
+	// the queue, they are started when a slot is released.
+	if build.Held {
+		return false, nil
+	}
+	procs, err := r.Store.ProcList(build)
+	if err != nil {
+		return false, err
+	}
+	for _, proc := range procs {
+		if alive(proc) {
+			return false, nil
+		}
+	}
+	killBuild(r.Store, repo, build, procs)
+	for _, proc := range procs {
+		activity.forget(fmt.Sprint(proc.ID))
+		masks.forget(fmt.Sprint(proc.ID))
+	}
+
+	build.Procs = model.Tree(procs)
+	publishEvent(context.Background(), model.Cancelled, repo, build, nil)
+
+	if r.Remote == nil {
+		return true, nil
+	}
+	l := &launcher{store: r.Store, remote: r.Remote, link: r.Host}
+	l.release(repo)
+
+	user, err := r.Store.GetUser(repo.UserID)
+	if err != nil {
+		return true, err
+	}
+	uri := fmt.Sprintf("%s/%s/%d", r.Host, repo.FullName, build.Number)
+	if err := r.Remote.Status(user, repo, build, uri); err != nil {
+		logrus.Errorf("error setting commit status for %s/%d: %v", repo.FullName, build.Number, err)
+	}
+	return true, nil
+}
+
+// activity records when agents last renewed the lease of a proc, and
+// when a proc last wrote to its log.
+var activity = &procActivity{
+	lease: map[string]time.Time{},
+	log:   map[string]time.Time{},
+}
+
+type procActivity struct {
+	sync.Mutex
+	lease map[string]time.Time
+	log   map[string]time.Time
+}
+
+// renewed records that the agent renewed the lease of the proc.
+func (a *procActivity) renewed(id string, now time.Time) {
+	a.Lock()
+	a.lease[id] = now
+	a.Unlock()
+}
+
+// logged records that the proc wrote to its log.
+func (a *procActivity) logged(id string, now time.Time) {
+	a.Lock()
+	a.log[id] = now
+	a.Unlock()
+}
+
+// get returns when the lease of the proc was last renewed, and when
+// the proc last wrote to its log.
+func (a *procActivity) get(id string) (lease, log time.Time) {
+	a.Lock()
+	defer a.Unlock()
+	return a.lease[id], a.log[id]
+}
+
+// forget removes the recorded activity of the proc.
+func (a *procActivity) forget(id string) {
+	a.Lock()
+	delete(a.lease, id)
+	delete(a.log, id)
+	a.Unlock()
+}
@@ -0,0 +1,347 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drone/drone/model"
+
+	"github.com/cncd/queue"
+)
+
+type reaperStore struct {
+	buildStore
+	repo    *model.Repo
+	feed    []*model.Feed
+	running []*model.Proc
+	killed  []*model.Proc
+}
+
+func (s *reaperStore) GetBuildQueue() ([]*model.Feed, error) {
+	return s.feed, nil
+}
+
+func (s *reaperStore) GetRepoName(string) (*model.Repo, error) {
+	return s.repo, nil
+}
+
+func (s *reaperStore) GetUser(int64) (*model.User, error) {
+	return new(model.User), nil
+}
+
+func (s *reaperStore) ProcList(*model.Build) ([]*model.Proc, error) {
+	return s.running, nil
+}
+
+func (s *reaperStore) ProcUpdate(proc *model.Proc) error {
+	s.killed = append(s.killed, proc)
+	return nil
+}
+
+func TestReaper(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	started := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	s := &reaperStore{
+		repo: &model.Repo{FullName: "octocat/hello-world", Timeout: 60},
+		feed: []*model.Feed{{
+			FullName: "octocat/hello-world",
+			Number:   1,
+			Status:   model.StatusRunning,
+			Started:  started.Unix(),
+		}},
+		running: []*model.Proc{
+			{ID: 1, PID: 1, State: model.StatusRunning, Started: started.Unix()},
+			{ID: 2, PID: 2, PPID: 1, State: model.StatusSuccess},
+		},
+	}
+	s.build = &model.Build{Number: 1, Status: model.StatusRunning, Started: started.Unix()}
+	rmt := new(nopRemote)
+	reaper := &Reaper{Store: s, Remote: rmt}
+
+	reaper.Reap(started.Add(59 * time.Minute))
+	if len(s.updated) != 0 {
+		t.Fatalf("Want build within the timeout to keep running")
+	}
+
+	reaper.Reap(started.Add(61 * time.Minute))
+	if s.build.Status != model.StatusKilled {
+		t.Errorf("Want build status %s, got %s", model.StatusKilled, s.build.Status)
+	}
+	if proc := s.running[0]; proc.State != model.StatusKilled || proc.ExitCode != 137 {
+		t.Errorf("Want running proc killed with exit code 137, got %s and %d", proc.State, proc.ExitCode)
+	}
+	if proc := s.running[1]; proc.State != model.StatusSuccess {
+		t.Errorf("Want finished proc left untouched, got %s", proc.State)
+	}
+	if len(f.errored) != 2 {
+		t.Errorf("Want procs released from the queue, got %d", len(f.errored))
+	}
+	if len(f.messages) != 1 {
+		t.Errorf("Want cancellation event published")
+	}
+}
+
+func TestReaperPipelineTimeout(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	started := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+	now := started.Add(90 * time.Minute)
+
+	tests := []struct {
+		name   string
+		second *model.Proc
+		queued bool
+		killed bool
+	}{
+		{"pending", &model.Proc{ID: 2, PID: 2, State: model.StatusPending}, false, false},
+		{"queued", &model.Proc{ID: 2, PID: 2, State: model.StatusRunning, Started: started.Unix()}, true, false},
+		{"started late", &model.Proc{ID: 2, PID: 2, State: model.StatusRunning, Started: started.Add(40 * time.Minute).Unix()}, false, false},
+		{"timed out", &model.Proc{ID: 2, PID: 2, State: model.StatusRunning, Started: started.Add(20 * time.Minute).Unix()}, false, true},
+	}
+	for _, test := range tests {
+		f.info = queue.InfoT{}
+		if test.queued {
+			f.info.Pending = []*queue.Task{{ID: "2"}}
+		}
+		s := &reaperStore{
+			repo: &model.Repo{FullName: "octocat/hello-world", Timeout: 60},
+			feed: []*model.Feed{{
+				FullName: "octocat/hello-world",
+				Number:   1,
+				Status:   model.StatusRunning,
+				Started:  started.Unix(),
+			}},
+			running: []*model.Proc{
+				{ID: 1, PID: 1, State: model.StatusSuccess, Started: started.Unix(), Stopped: started.Add(30 * time.Minute).Unix()},
+				test.second,
+			},
+		}
+		s.build = &model.Build{Number: 1, Status: model.StatusRunning, Started: started.Unix()}
+		reaper := &Reaper{Store: s}
+		reaper.Reap(now)
+
+		if killed := s.build.Status == model.StatusKilled; killed != test.killed {
+			t.Errorf("Want build with a %s second pipeline killed %v, got status %s", test.name, test.killed, s.build.Status)
+		}
+	}
+}
+
+func TestReaperNoTimeout(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	s := &reaperStore{
+		repo: &model.Repo{FullName: "octocat/hello-world"},
+		feed: []*model.Feed{{
+			FullName: "octocat/hello-world",
+			Number:   1,
+			Status:   model.StatusRunning,
+			Started:  1,
+		}},
+	}
+	reaper := &Reaper{Store: s}
+	reaper.Reap(time.Now())
+	if len(s.updated) != 0 {
+		t.Errorf("Want builds without a repository timeout to keep running")
+	}
+}
+
+func TestReaperGrace(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	started := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	s := &reaperStore{
+		repo: &model.Repo{FullName: "octocat/hello-world", Timeout: 60},
+		feed: []*model.Feed{{
+			FullName: "octocat/hello-world",
+			Number:   1,
+			Status:   model.StatusRunning,
+			Started:  started.Unix(),
+		}},
+		running: []*model.Proc{
+			{ID: 1, PID: 1, State: model.StatusRunning, Started: started.Unix()},
+		},
+	}
+	s.build = &model.Build{Number: 1, Status: model.StatusRunning, Started: started.Unix()}
+	reaper := &Reaper{Store: s, Grace: 10 * time.Minute}
+
+	reaper.Reap(started.Add(65 * time.Minute))
+	if len(s.updated) != 0 {
+		t.Fatalf("Want build within the grace period to keep running")
+	}
+
+	reaper.Reap(started.Add(71 * time.Minute))
+	if s.build.Status != model.StatusKilled {
+		t.Errorf("Want build status %s after the grace period, got %s", model.StatusKilled, s.build.Status)
+	}
+}
+
+func TestReaperActivity(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+	defer activity.forget("1")
+
+	started := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+	now := started.Add(2 * time.Hour)
+
+	s := &reaperStore{
+		repo: &model.Repo{FullName: "octocat/hello-world", Timeout: 60},
+		feed: []*model.Feed{{
+			FullName: "octocat/hello-world",
+			Number:   1,
+			Status:   model.StatusRunning,
+			Started:  started.Unix(),
+		}},
+		running: []*model.Proc{
+			{ID: 1, PID: 1, State: model.StatusRunning, Started: started.Unix()},
+			{ID: 2, PID: 2, PPID: 1, State: model.StatusRunning, Started: started.Unix()},
+		},
+	}
+	s.build = &model.Build{Number: 1, Status: model.StatusRunning, Started: started.Unix()}
+	reaper := &Reaper{Store: s}
+
+	activity.renewed("1", now.Add(-time.Minute))
+	reaper.Reap(now)
+	if len(s.updated) != 0 {
+		t.Fatalf("Want build of a heartbeating agent to keep running")
+	}
+
+	activity.forget("1")
+	activity.logged("1", now.Add(-30*time.Minute))
+	reaper.Reap(now)
+	if len(s.updated) != 0 {
+		t.Fatalf("Want build with recent log activity to keep running")
+	}
+
+	activity.logged("1", now.Add(-61*time.Minute))
+	reaper.Reap(now)
+	if s.build.Status != model.StatusKilled {
+		t.Errorf("Want build status %s without activity, got %s", model.StatusKilled, s.build.Status)
+	}
+	if lease, logged := activity.get("1"); !lease.IsZero() || !logged.IsZero() {
+		t.Errorf("Want activity of killed procs forgotten")
+	}
+}
+
+func TestReaperZombie(t *testing.T) {
+	f, restore := withFakeServices()
+	defer restore()
+
+	created := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	s := &reaperStore{
+		repo: &model.Repo{FullName: "octocat/hello-world"},
+		feed: []*model.Feed{{
+			FullName: "octocat/hello-world",
+			Number:   1,
+			Status:   model.StatusPending,
+			Created:  created.Unix(),
+		}},
+		running: []*model.Proc{
+			{ID: 1, PID: 1, State: model.StatusPending},
+		},
+	}
+	s.build = &model.Build{Number: 1, Status: model.StatusPending, Created: created.Unix()}
+	reaper := &Reaper{Store: s, ZombieAge: time.Hour}
+
+	reaper.Reap(created.Add(30 * time.Minute))
+	if len(s.updated) != 0 {
+		t.Fatalf("Want build younger than the zombie age to be left untouched")
+	}
+
+	f.info.Pending = []*queue.Task{{ID: "1"}}
+	reaper.Reap(created.Add(2 * time.Hour))
+	if len(s.updated) != 0 {
+		t.Fatalf("Want build with a queued task to be left untouched")
+	}
+
+	f.info.Pending = nil
+	reaper.Reap(created.Add(2 * time.Hour))
+	if s.build.Status != model.StatusKilled {
+		t.Errorf("Want zombie build status %s, got %s", model.StatusKilled, s.build.Status)
+	}
+	if proc := s.running[0]; proc.State != model.StatusKilled || proc.ExitCode != 137 {
+		t.Errorf("Want zombie proc killed with exit code 137, got %s and %d", proc.State, proc.ExitCode)
+	}
+}
+
+func TestReaperZombieHeld(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+
+	created := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	s := &reaperStore{
+		repo: &model.Repo{FullName: "octocat/hello-world", MaxBuilds: 1},
+		feed: []*model.Feed{{
+			FullName: "octocat/hello-world",
+			Number:   2,
+			Status:   model.StatusPending,
+			Created:  created.Unix(),
+		}},
+		running: []*model.Proc{
+			{ID: 1, PID: 1, State: model.StatusPending},
+		},
+	}
+	s.build = &model.Build{Number: 2, Status: model.StatusPending, Created: created.Unix(), Held: true}
+	reaper := &Reaper{Store: s, ZombieAge: time.Hour}
+
+	reaper.Reap(created.Add(2 * time.Hour))
+	if len(s.updated) != 0 || s.build.Status != model.StatusPending {
+		t.Errorf("Want held build waiting for a concurrency slot left untouched")
+	}
+}
+
+func TestKillBuildPending(t *testing.T) {
+	_, restore := withFakeServices()
+	defer restore()
+	killed := counterValue(buildsFinished.WithLabelValues(model.StatusKilled))
+
+	s := new(reaperStore)
+	build := &model.Build{Number: 1, Status: model.StatusRunning}
+	procs := []*model.Proc{
+		{ID: 1, PID: 1, State: model.StatusRunning, Started: 1},
+		{ID: 2, PID: 2, PPID: 1, State: model.StatusSuccess, ExitCode: 0, Started: 1, Stopped: 2},
+		{ID: 3, PID: 3, PPID: 1, State: model.StatusPending},
+	}
+	killBuild(s, &model.Repo{}, build, procs)
+
+	if procs[0].State != model.StatusKilled || procs[0].ExitCode != 137 || procs[0].Started != 1 {
+		t.Errorf("Want running proc killed with exit code 137")
+	}
+	if procs[1].State != model.StatusSuccess || procs[1].ExitCode != 0 || procs[1].Stopped != 2 {
+		t.Errorf("Want finished proc left untouched")
+	}
+	if procs[2].State != model.StatusKilled || procs[2].ExitCode != 137 {
+		t.Errorf("Want pending proc killed with exit code 137, got %s and %d", procs[2].State, procs[2].ExitCode)
+	}
+	if procs[2].Started == 0 || procs[2].Started != procs[2].Stopped {
+		t.Errorf("Want pending proc started and stopped at the time it was killed")
+	}
+	if build.Status != model.StatusKilled || build.Finished == 0 {
+		t.Errorf("Want build finalized as killed")
+	}
+	if got := counterValue(buildsFinished.WithLabelValues(model.StatusKilled)) - killed; got != 1 {
+		t.Errorf("Want the killed build counted as finished, got %v", got)
+	}
+}
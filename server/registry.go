@@ -16,10 +16,14 @@ package server
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/drone/drone/model"
+	"github.com/drone/drone/plugins/registry"
 	"github.com/drone/drone/router/middleware/session"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
 )
 
@@ -59,6 +63,9 @@ func PostRegistry(c *gin.Context) {
 		c.String(400, "Error inserting registry. %s", err)
 		return
 	}
+	if !validateRegistry(c, registry) {
+		return
+	}
 	if err := Config.Services.Registries.RegistryCreate(repo, registry); err != nil {
 		c.String(500, "Error inserting registry %q. %s", in.Address, err)
 		return
@@ -102,6 +109,9 @@ func PatchRegistry(c *gin.Context) {
 		c.String(400, "Error updating registry. %s", err)
 		return
 	}
+	if !validateRegistry(c, registry) {
+		return
+	}
 	if err := Config.Services.Registries.RegistryUpdate(repo, registry); err != nil {
 		c.String(500, "Error updating registry %q. %s", in.Address, err)
 		return
@@ -138,3 +148,32 @@ func DeleteRegistry(c *gin.Context) {
 	}
 	c.String(204, "")
 }
+
+// registryClient is the client used to validate registry credentials.
+// The timeout is short because the registry may not be reachable from
+// the server.
+var registryClient = &http.Client{Timeout: 5 * time.Second}
+
+// validateRegistry logs in to the registry with the credentials when
+// validation is enabled for the server or requested with the validate
+// query parameter. It writes a 400 error response and returns false if
+// the registry rejects the credentials. Other failures are logged and
+// do not block saving the registry.
+func validateRegistry(c *gin.Context, in *model.Registry) bool {
+	validate := Config.Server.RegistryValidate
+	if v := c.Query("validate"); v != "" {
+		validate, _ = strconv.ParseBool(v)
+	}
+	if !validate {
+		return true
+	}
+	err := registry.Login(registryClient, in.Address, in.Username, in.Password)
+	if authErr, ok := err.(*registry.AuthError); ok {
+		c.String(400, "Error validating registry %q. %s", in.Address, authErr.Message)
+		return false
+	}
+	if err != nil {
+		logrus.Warnf("cannot validate registry %q: %s", in.Address, err)
+	}
+	return true
+}
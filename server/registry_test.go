@@ -0,0 +1,84 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drone/drone/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registryService records the created registries.
+type registryService struct {
+	model.RegistryService
+	created []*model.Registry
+}
+
+func (s *registryService) RegistryCreate(repo *model.Repo, in *model.Registry) error {
+	s.created = append(s.created, in)
+	return nil
+}
+
+func TestPostRegistryValidate(t *testing.T) {
+	registries := Config.Services.Registries
+	defer func() { Config.Services.Registries = registries }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pass, _ := r.BasicAuth(); pass != "correct-horse" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors":[{"message":"authentication required"}]}`))
+		}
+	}))
+	defer srv.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		addr     string
+		password string
+		query    string
+		code     int
+	}{
+		{srv.URL, "correct-horse", "?validate=true", 200},
+		{srv.URL, "battery-staple", "?validate=true", 400},
+		{srv.URL, "battery-staple", "", 200},
+		{closed.URL, "correct-horse", "?validate=true", 200},
+	}
+	for _, test := range tests {
+		s := new(registryService)
+		Config.Services.Registries = s
+
+		body := `{"address":"` + test.addr + `","username":"octocat","password":"` + test.password + `"}`
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("POST", "/api/repos/octocat/hello-world/registry"+test.query, bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+
+		PostRegistry(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d for password %s%s, got %d: %s", test.code, test.password, test.query, w.Code, w.Body)
+		}
+		if created := len(s.created) == 1; created != (test.code == 200) {
+			t.Errorf("Want the registry created only when accepted")
+		}
+	}
+}
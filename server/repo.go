@@ -18,6 +18,7 @@ import (
 	"encoding/base32"
 	"fmt"
 	"net/http"
+	"path"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -51,6 +52,8 @@ func PostRepo(c *gin.Context) {
 	if !repo.AllowPush && !repo.AllowPull && !repo.AllowDeploy && !repo.AllowTag {
 		repo.AllowPush = true
 		repo.AllowPull = true
+		repo.AllowTag = true
+		repo.AllowDeploy = true
 	}
 	if repo.Visibility == "" {
 		repo.Visibility = model.VisibilityPublic
@@ -133,6 +136,43 @@ func PatchRepo(c *gin.Context) {
 	}
 	if in.IsGated != nil {
 		repo.IsGated = *in.IsGated
+		// the gated flag maps to the all events policy.
+		repo.Approval = model.ApprovalNone
+		if repo.IsGated {
+			repo.Approval = model.ApprovalAll
+		}
+	}
+	if in.Approval != nil {
+		switch *in.Approval {
+		case model.ApprovalNone, model.ApprovalForks, model.ApprovalPullRequests, model.ApprovalAll:
+			repo.Approval = *in.Approval
+		default:
+			c.String(400, "Invalid approval policy")
+			return
+		}
+	}
+	if in.ApproveAdmin != nil {
+		repo.ApproveAdmin = *in.ApproveAdmin
+	}
+	if in.Approvers != nil {
+		repo.Approvers = *in.Approvers
+	}
+	if in.Params != nil {
+		repo.Params = *in.Params
+	}
+	if in.ProtBranches != nil {
+		if !validPatterns(*in.ProtBranches) {
+			c.String(400, "Invalid protected branch pattern")
+			return
+		}
+		repo.ProtBranches = *in.ProtBranches
+	}
+	if in.ProtTargets != nil {
+		if !validPatterns(*in.ProtTargets) {
+			c.String(400, "Invalid protected target pattern")
+			return
+		}
+		repo.ProtTargets = *in.ProtTargets
 	}
 	if in.IsTrusted != nil {
 		repo.IsTrusted = *in.IsTrusted
@@ -140,9 +180,40 @@ func PatchRepo(c *gin.Context) {
 	if in.Timeout != nil {
 		repo.Timeout = *in.Timeout
 	}
+	if in.Concurrency != nil {
+		if *in.Concurrency < 0 {
+			c.String(400, "Invalid concurrency limit")
+			return
+		}
+		repo.Concurrency = *in.Concurrency
+	}
+	if in.MaxBuilds != nil {
+		if *in.MaxBuilds < 0 {
+			c.String(400, "Invalid build concurrency")
+			return
+		}
+		repo.MaxBuilds = *in.MaxBuilds
+	}
+	if in.RetainBuilds != nil {
+		if *in.RetainBuilds < 0 {
+			c.String(400, "Invalid build retention")
+			return
+		}
+		repo.RetainBuilds = *in.RetainBuilds
+	}
+	if in.RetainDays != nil {
+		if *in.RetainDays < 0 {
+			c.String(400, "Invalid build retention")
+			return
+		}
+		repo.RetainDays = *in.RetainDays
+	}
 	if in.Config != nil {
 		repo.Config = *in.Config
 	}
+	if in.NoFallback != nil {
+		repo.NoFallback = *in.NoFallback
+	}
 	if in.Visibility != nil {
 		switch *in.Visibility {
 		case model.VisibilityInternal, model.VisibilityPrivate, model.VisibilityPublic:
@@ -165,6 +236,16 @@ func PatchRepo(c *gin.Context) {
 	c.JSON(http.StatusOK, repo)
 }
 
+// validPatterns returns true if the glob patterns are well formed.
+func validPatterns(patterns []string) bool {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
 func ChownRepo(c *gin.Context) {
 	repo := session.Repo(c)
 	user := session.User(c)
@@ -0,0 +1,125 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/router/middleware/session"
+	"github.com/drone/drone/store"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+)
+
+// pruneBatchSize is the number of builds that are deleted at once.
+const pruneBatchSize = 50
+
+// Retention deletes old builds with their procs, files and logs. A
+// build is kept when it is one of the last Builds builds of the
+// repository, when it is newer than Days days, or when it is the
+// latest build of its branch. The repository settings override the
+// server settings when set. A zero value disables the criterion; when
+// both are zero no build is deleted.
+type Retention struct {
+	Store  store.Store
+	Builds int
+	Days   int
+}
+
+// Start prunes the builds of all active repositories at the given
+// interval. It never returns and should be invoked in a separate
+// goroutine.
+func (r *Retention) Start(interval time.Duration) {
+	for range time.Tick(interval) {
+		r.Run(time.Now())
+	}
+}
+
+// Run prunes the builds of all active repositories at the given time.
+func (r *Retention) Run(now time.Time) {
+	repos, err := r.Store.GetRepoListActive()
+	if err != nil {
+		logrus.Errorf("retention: cannot list repositories. %s", err)
+		return
+	}
+	for _, repo := range repos {
+		count, err := r.Prune(repo, now)
+		if err != nil {
+			logrus.Errorf("retention: cannot prune builds of %s. %s", repo.FullName, err)
+		}
+		if count != 0 {
+			logrus.Infof("retention: pruned %d builds of %s", count, repo.FullName)
+		}
+	}
+}
+
+// Prune deletes the builds of the repository that are outside of the
+// retention policy, and returns the number of deleted builds.
+func (r *Retention) Prune(repo *model.Repo, now time.Time) (int, error) {
+	keep, days := r.Builds, r.Days
+	if repo.RetainBuilds != 0 {
+		keep = repo.RetainBuilds
+	}
+	if repo.RetainDays != 0 {
+		days = repo.RetainDays
+	}
+	if keep == 0 && days == 0 {
+		return 0, nil
+	}
+
+	before := int64(math.MaxInt64)
+	if days != 0 {
+		before = now.AddDate(0, 0, -days).Unix()
+	}
+
+	var count int
+	for {
+		builds, err := r.Store.GetBuildListPrunable(repo, keep, before, pruneBatchSize)
+		if err != nil {
+			return count, err
+		}
+		for _, build := range builds {
+			if err := r.Store.DeleteBuild(build); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if len(builds) < pruneBatchSize {
+			return count, nil
+		}
+	}
+}
+
+// PostPrune prunes the builds of the repository that are outside of
+// the retention policy, and returns the number of deleted builds.
+func PostPrune(c *gin.Context) {
+	repo := session.Repo(c)
+
+	retention := &Retention{
+		Store:  store.FromContext(c),
+		Builds: Config.Retention.Builds,
+		Days:   Config.Retention.Days,
+	}
+	count, err := retention.Prune(repo, time.Now())
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error pruning builds. %s", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"builds": count})
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drone/drone/model"
+)
+
+type retentionStore struct {
+	buildStore
+	prunable []*model.Build
+	keep     int
+	before   int64
+	deleted  []*model.Build
+}
+
+func (s *retentionStore) GetBuildListPrunable(repo *model.Repo, keep int, before int64, limit int) ([]*model.Build, error) {
+	s.keep, s.before = keep, before
+	if limit > len(s.prunable) {
+		limit = len(s.prunable)
+	}
+	builds := s.prunable[:limit]
+	s.prunable = s.prunable[limit:]
+	return builds, nil
+}
+
+func (s *retentionStore) DeleteBuild(build *model.Build) error {
+	s.deleted = append(s.deleted, build)
+	return nil
+}
+
+func TestRetentionPrune(t *testing.T) {
+	s := &retentionStore{}
+	for i := 0; i < pruneBatchSize+1; i++ {
+		s.prunable = append(s.prunable, &model.Build{Number: i + 1})
+	}
+	now := time.Date(2018, time.January, 31, 12, 0, 0, 0, time.UTC)
+
+	retention := &Retention{Store: s, Builds: 10, Days: 30}
+	count, err := retention.Prune(&model.Repo{RetainDays: 7}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != pruneBatchSize+1 || len(s.deleted) != count {
+		t.Errorf("Want %d builds deleted in batches, got %d", pruneBatchSize+1, count)
+	}
+	if s.keep != 10 {
+		t.Errorf("Want server build retention used, got %d", s.keep)
+	}
+	if want := now.AddDate(0, 0, -7).Unix(); s.before != want {
+		t.Errorf("Want repository day retention used, got %d", s.before)
+	}
+}
+
+func TestRetentionDisabled(t *testing.T) {
+	s := &retentionStore{
+		prunable: []*model.Build{{Number: 1}},
+	}
+	retention := &Retention{Store: s}
+	count, err := retention.Prune(&model.Repo{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 || len(s.deleted) != 0 {
+		t.Errorf("Want no builds deleted without a retention policy")
+	}
+}
@@ -76,10 +76,33 @@ var Config = struct {
 		Pass           string
 		RepoConfig     string
 		SessionExpires time.Duration
+		// ConfigFallback names the repository, and ConfigFallbackPath
+		// the file, with the configuration used when a repository has
+		// no configuration of its own.
+		ConfigFallback     string
+		ConfigFallbackPath string
+		// SkipDrop drops commits skipped with a [ci skip] directive
+		// instead of recording them as skipped builds.
+		SkipDrop bool
+		// RegistryValidate enables validating registry credentials
+		// when they are created or updated.
+		RegistryValidate bool
 		// Open bool
 		// Orgs map[string]struct{}
 		// Admins map[string]struct{}
 	}
+	Retention struct {
+		Builds int
+		Days   int
+	}
+	// BuildRate limits the builds created through the api for each
+	// repository and user within the window. A zero limit is not
+	// enforced.
+	BuildRate struct {
+		Repo   int
+		User   int
+		Window time.Duration
+	}
 	Prometheus struct {
 		AuthToken string
 	}
@@ -143,6 +166,7 @@ func (s *RPC) Wait(c context.Context, id string) error {
 
 // Extend implements the rpc.Extend function
 func (s *RPC) Extend(c context.Context, id string) error {
+	activity.renewed(id, time.Now())
 	return s.queue.Extend(c, id)
 }
 
@@ -204,6 +228,9 @@ func (s *RPC) Update(c context.Context, id string, state rpc.State) error {
 	if proc.Started == 0 && proc.Stopped != 0 {
 		proc.Started = build.Started
 	}
+	if state.Exited && proc.Started != 0 {
+		procDuration.Observe(float64(proc.Stopped - proc.Started))
+	}
 
 	if err := s.store.ProcUpdate(proc); err != nil {
 		log.Printf("error: rpc.update: cannot update proc: %s", err)
@@ -254,7 +281,7 @@ func (s *RPC) Upload(c context.Context, id string, file *rpc.File) error {
 	if file.Mime == "application/json+logs" {
 		return s.store.LogSave(
 			proc,
-			bytes.NewBuffer(file.Data),
+			bytes.NewBuffer(masks.maskLines(id, file.Data)),
 		)
 	}
 
@@ -337,6 +364,7 @@ func (s *RPC) Init(c context.Context, id string, state rpc.State) error {
 		if err := s.store.UpdateBuild(build); err != nil {
 			log.Printf("error: init: cannot update build_id %d state: %s", build.ID, err)
 		}
+		buildStarted(repo, build)
 	}
 
 	defer func() {
@@ -398,6 +426,8 @@ func (s *RPC) Done(c context.Context, id string, state rpc.State) error {
 	if err := s.queue.Done(c, id); err != nil {
 		log.Printf("error: done: cannot ack proc_id %d: %s", procID, err)
 	}
+	activity.forget(id)
+	masks.forget(id)
 
 	// TODO handle this error
 	procs, _ := s.store.ProcList(build)
@@ -414,24 +444,19 @@ func (s *RPC) Done(c context.Context, id string, state rpc.State) error {
 		}
 	}
 
-	running := false
-	status := model.StatusSuccess
-	for _, p := range procs {
-		if p.PPID == 0 {
-			if p.Running() {
-				running = true
-			}
-			if p.Failing() {
-				status = p.State
-			}
-		}
-	}
-	if !running {
+	if status, done := procsStatus(procs); done {
 		build.Status = status
-		build.Finished = proc.Stopped
+		// a build blocked by gated pipelines finishes once they are
+		// reviewed and completed.
+		if status != model.StatusBlocked {
+			build.Finished = proc.Stopped
+		}
 		if err := s.store.UpdateBuild(build); err != nil {
 			log.Printf("error: done: cannot update build_id %d final state: %s", build.ID, err)
 		}
+		if status != model.StatusBlocked {
+			buildFinished(repo, build)
+		}
 
 		// update the status
 		user, err := s.store.GetUser(repo.UserID)
@@ -467,11 +492,19 @@ func (s *RPC) Done(c context.Context, id string, state rpc.State) error {
 	})
 	s.pubsub.Publish(c, "topic/events", message)
 
+	// start the builds held back by the build concurrency limit of
+	// the repository now that a slot is available.
+	if build.Status != model.StatusPending && build.Status != model.StatusRunning && build.Status != model.StatusBlocked {
+		l := &launcher{store: s.store, remote: s.remote, link: s.host}
+		l.release(repo)
+	}
 	return nil
 }
 
 // Log implements the rpc.Log function
 func (s *RPC) Log(c context.Context, id string, line *rpc.Line) error {
+	activity.logged(id, time.Now())
+	line.Out = masks.mask(id, line.Out)
 	entry := new(logging.Entry)
 	entry.Data, _ = json.Marshal(line)
 	s.logger.Write(c, id, entry)
@@ -23,6 +23,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// secretPatch represents a secret patch object. Fields that are empty
+// are not updated.
+type secretPatch struct {
+	model.Secret
+	PullRequest *bool `json:"pull_request"`
+}
+
 // GetSecret gets the named secret from the database and writes
 // to the response in json format.
 func GetSecret(c *gin.Context) {
@@ -48,11 +55,13 @@ func PostSecret(c *gin.Context) {
 		return
 	}
 	secret := &model.Secret{
-		RepoID: repo.ID,
-		Name:   in.Name,
-		Value:  in.Value,
-		Events: in.Events,
-		Images: in.Images,
+		RepoID:      repo.ID,
+		Name:        in.Name,
+		Value:       in.Value,
+		Events:      in.Events,
+		Images:      in.Images,
+		Branches:    in.Branches,
+		PullRequest: in.PullRequest,
 	}
 	if err := secret.Validate(); err != nil {
 		c.String(400, "Error inserting secret. %s", err)
@@ -72,7 +81,7 @@ func PatchSecret(c *gin.Context) {
 		name = c.Param("secret")
 	)
 
-	in := new(model.Secret)
+	in := new(secretPatch)
 	err := c.Bind(in)
 	if err != nil {
 		c.String(http.StatusBadRequest, "Error parsing secret. %s", err)
@@ -93,6 +102,12 @@ func PatchSecret(c *gin.Context) {
 	if len(in.Images) != 0 {
 		secret.Images = in.Images
 	}
+	if len(in.Branches) != 0 {
+		secret.Branches = in.Branches
+	}
+	if in.PullRequest != nil {
+		secret.PullRequest = *in.PullRequest
+	}
 
 	if err := secret.Validate(); err != nil {
 		c.String(400, "Error updating secret. %s", err)
@@ -134,3 +149,113 @@ func DeleteSecret(c *gin.Context) {
 	}
 	c.String(204, "")
 }
+
+// GetGlobalSecret gets the named global secret from the database and
+// writes to the response in json format.
+func GetGlobalSecret(c *gin.Context) {
+	name := c.Param("secret")
+	secret, err := Config.Services.Secrets.GlobalSecretFind(name)
+	if err != nil {
+		c.String(404, "Error getting global secret %q. %s", name, err)
+		return
+	}
+	c.JSON(200, secret.Copy())
+}
+
+// GetGlobalSecretList gets the global secret list from the database and
+// writes to the response in json format.
+func GetGlobalSecretList(c *gin.Context) {
+	list, err := Config.Services.Secrets.GlobalSecretList()
+	if err != nil {
+		c.String(500, "Error getting global secret list. %s", err)
+		return
+	}
+	// copy the secret detail to remove the sensitive
+	// password and token fields.
+	for i, secret := range list {
+		list[i] = secret.Copy()
+	}
+	c.JSON(200, list)
+}
+
+// PostGlobalSecret persists the global secret to the database. Global
+// secrets are provided to the builds of every repository.
+func PostGlobalSecret(c *gin.Context) {
+	in := new(model.Secret)
+	if err := c.Bind(in); err != nil {
+		c.String(http.StatusBadRequest, "Error parsing secret. %s", err)
+		return
+	}
+	secret := &model.Secret{
+		Name:        in.Name,
+		Value:       in.Value,
+		Events:      in.Events,
+		Images:      in.Images,
+		Branches:    in.Branches,
+		PullRequest: in.PullRequest,
+	}
+	if err := secret.Validate(); err != nil {
+		c.String(400, "Error inserting global secret. %s", err)
+		return
+	}
+	if err := Config.Services.Secrets.GlobalSecretCreate(secret); err != nil {
+		c.String(500, "Error inserting global secret %q. %s", in.Name, err)
+		return
+	}
+	writeSecretAudit(c, model.AuditSecretCreate, secret.Name)
+	c.JSON(200, secret.Copy())
+}
+
+// PatchGlobalSecret updates the global secret in the database.
+func PatchGlobalSecret(c *gin.Context) {
+	name := c.Param("secret")
+
+	in := new(secretPatch)
+	err := c.Bind(in)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Error parsing secret. %s", err)
+		return
+	}
+
+	secret, err := Config.Services.Secrets.GlobalSecretFind(name)
+	if err != nil {
+		c.String(404, "Error getting global secret %q. %s", name, err)
+		return
+	}
+	if in.Value != "" {
+		secret.Value = in.Value
+	}
+	if len(in.Events) != 0 {
+		secret.Events = in.Events
+	}
+	if len(in.Images) != 0 {
+		secret.Images = in.Images
+	}
+	if len(in.Branches) != 0 {
+		secret.Branches = in.Branches
+	}
+	if in.PullRequest != nil {
+		secret.PullRequest = *in.PullRequest
+	}
+
+	if err := secret.Validate(); err != nil {
+		c.String(400, "Error updating global secret. %s", err)
+		return
+	}
+	if err := Config.Services.Secrets.GlobalSecretUpdate(secret); err != nil {
+		c.String(500, "Error updating global secret %q. %s", name, err)
+		return
+	}
+	c.JSON(200, secret.Copy())
+}
+
+// DeleteGlobalSecret deletes the named global secret from the database.
+func DeleteGlobalSecret(c *gin.Context) {
+	name := c.Param("secret")
+	if err := Config.Services.Secrets.GlobalSecretDelete(name); err != nil {
+		c.String(500, "Error deleting global secret %q. %s", name, err)
+		return
+	}
+	writeSecretAudit(c, model.AuditSecretDelete, name)
+	c.String(204, "")
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// globalSecrets is a secret service that stores global secrets in
+// memory.
+type globalSecrets struct {
+	model.SecretService
+	secrets map[string]*model.Secret
+}
+
+func (s *globalSecrets) GlobalSecretCreate(secret *model.Secret) error {
+	s.secrets[secret.Name] = secret
+	return nil
+}
+
+func (s *globalSecrets) GlobalSecretDelete(name string) error {
+	delete(s.secrets, name)
+	return nil
+}
+
+// auditStore is a store that records the audit entries.
+type auditStore struct {
+	store.Store
+	audits []*model.Audit
+}
+
+func (s *auditStore) AuditCreate(audit *model.Audit) error {
+	s.audits = append(s.audits, audit)
+	return nil
+}
+
+func TestGlobalSecretAudit(t *testing.T) {
+	services := Config.Services
+	defer func() { Config.Services = services }()
+	secrets := &globalSecrets{secrets: map[string]*model.Secret{}}
+	Config.Services.Secrets = secrets
+
+	s := new(auditStore)
+	body := `{"name": "artifact_token", "value": "s3cr3t", "image": ["plugins/s3"], "event": ["push"]}`
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("POST", "/api/secrets", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user", &model.User{Login: "octocat", Admin: true})
+	store.ToContext(c, s)
+
+	PostGlobalSecret(c)
+
+	if w.Code != 200 {
+		t.Fatalf("Want status 200, got %d %s", w.Code, w.Body.String())
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("s3cr3t")) {
+		t.Errorf("Want the secret value omitted from the response")
+	}
+	secret := secrets.secrets["artifact_token"]
+	if secret == nil || secret.RepoID != 0 || len(secret.Images) != 1 || len(secret.Events) != 1 {
+		t.Errorf("Want the global secret stored with its restrictions, got %+v", secret)
+	}
+
+	c, w, _ = gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("DELETE", "/api/secrets/artifact_token", nil)
+	c.Params = gin.Params{{Key: "secret", Value: "artifact_token"}}
+	c.Set("user", &model.User{Login: "octocat", Admin: true})
+	store.ToContext(c, s)
+
+	DeleteGlobalSecret(c)
+
+	if w.Code != 204 || len(secrets.secrets) != 0 {
+		t.Errorf("Want the global secret deleted, got %d", w.Code)
+	}
+	if len(s.audits) != 2 {
+		t.Fatalf("Want 2 audit entries, got %d", len(s.audits))
+	}
+	for i, action := range []string{model.AuditSecretCreate, model.AuditSecretDelete} {
+		audit := s.audits[i]
+		if audit.Action != action || audit.Target != "artifact_token" || audit.Actor != "octocat" {
+			t.Errorf("Want %s audit of artifact_token by octocat, got %+v", action, audit)
+		}
+	}
+}
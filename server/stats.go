@@ -0,0 +1,119 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/router/middleware/session"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// statsDays is the default number of days covered by the
+	// repository statistics.
+	statsDays = 30
+
+	// statsMaxDays is the maximum number of days covered by the
+	// repository statistics.
+	statsMaxDays = 365
+
+	// statsTTL is how long the repository statistics are cached.
+	statsTTL = time.Minute
+)
+
+// GetRepoStats returns the aggregate build statistics of the repository
+// over the last number of days. The statistics are cached for a minute
+// since they are expensive to compute for busy repositories.
+func GetRepoStats(c *gin.Context) {
+	repo := session.Repo(c)
+
+	days := statsDays
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > statsMaxDays {
+			writeError(c, http.StatusBadRequest, errInvalidParam,
+				"days must be a number between 1 and %d", statsMaxDays)
+			return
+		}
+		days = n
+	}
+
+	now := time.Now()
+	key := fmt.Sprintf("%d/%d", repo.ID, days)
+	if stats, ok := statsCache.get(key, now); ok {
+		c.JSON(http.StatusOK, stats)
+		return
+	}
+
+	since := now.AddDate(0, 0, -days).Unix()
+	stats, err := store.FromContext(c).GetRepoStats(repo, since)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, errStore,
+			"Error getting repository statistics. %s", err)
+		return
+	}
+	statsCache.put(key, stats, now)
+	c.JSON(http.StatusOK, stats)
+}
+
+// statsCache caches the computed repository statistics.
+var statsCache = &repoStatsCache{
+	entries: map[string]repoStatsEntry{},
+}
+
+type repoStatsCache struct {
+	sync.Mutex
+	entries map[string]repoStatsEntry
+}
+
+type repoStatsEntry struct {
+	stats   *model.RepoStats
+	expires time.Time
+}
+
+// get returns the cached statistics if they have not yet expired.
+func (s *repoStatsCache) get(key string, now time.Time) (*model.RepoStats, bool) {
+	s.Lock()
+	defer s.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		return nil, false
+	}
+	return entry.stats, true
+}
+
+// put caches the statistics, evicting expired entries so the cache
+// does not grow with every repository ever requested.
+func (s *repoStatsCache) put(key string, stats *model.RepoStats, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	for k, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = repoStatsEntry{
+		stats:   stats,
+		expires: now.Add(statsTTL),
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statsStore is a store that counts the repository stats queries.
+type statsStore struct {
+	store.Store
+	calls int
+	since int64
+}
+
+func (s *statsStore) GetRepoStats(repo *model.Repo, since int64) (*model.RepoStats, error) {
+	s.calls++
+	s.since = since
+	return &model.RepoStats{Since: since}, nil
+}
+
+func TestGetRepoStats(t *testing.T) {
+	defer func() { statsCache.entries = map[string]repoStatsEntry{} }()
+
+	tests := []struct {
+		query string
+		code  int
+		calls int
+	}{
+		{"", 200, 1},
+		{"", 200, 1}, // cached
+		{"?days=7", 200, 2},
+		{"?days=7", 200, 2}, // cached
+		{"?days=0", 400, 2},
+		{"?days=1000", 400, 2},
+		{"?days=week", 400, 2},
+	}
+	s := new(statsStore)
+	for _, test := range tests {
+		c, w, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/stats"+test.query, nil)
+		c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+		store.ToContext(c, s)
+
+		GetRepoStats(c)
+
+		if w.Code != test.code {
+			t.Errorf("Want status %d for query %q, got %d", test.code, test.query, w.Code)
+		}
+		if s.calls != test.calls {
+			t.Errorf("Want %d stats queries after query %q, got %d", test.calls, test.query, s.calls)
+		}
+	}
+}
+
+func TestRepoStatsCache(t *testing.T) {
+	cache := &repoStatsCache{entries: map[string]repoStatsEntry{}}
+	now := time.Now()
+
+	cache.put("1/30", &model.RepoStats{}, now)
+	if _, ok := cache.get("1/30", now.Add(statsTTL-time.Second)); !ok {
+		t.Errorf("Want stats cached before expiry")
+	}
+	if _, ok := cache.get("1/30", now.Add(statsTTL)); ok {
+		t.Errorf("Want stats expired after ttl")
+	}
+
+	// expired entries are evicted when adding new entries.
+	cache.put("2/30", &model.RepoStats{}, now.Add(statsTTL))
+	if _, ok := cache.entries["1/30"]; ok {
+		t.Errorf("Want expired stats evicted")
+	}
+}
@@ -16,6 +16,7 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -23,6 +24,7 @@ import (
 	"time"
 
 	"github.com/cncd/logging"
+	"github.com/cncd/pipeline/pipeline/rpc"
 	"github.com/cncd/pubsub"
 	"github.com/drone/drone/model"
 	"github.com/drone/drone/router/middleware/session"
@@ -181,10 +183,12 @@ func LogStreamSSE(c *gin.Context) {
 	)
 
 	logrus.Debugf("log stream: connection opened")
+	logSubscribers.Inc()
 
 	defer func() {
 		cancel()
 		close(logc)
+		logSubscribers.Dec()
 		logrus.Debugf("log stream: connection closed")
 	}()
 
@@ -248,3 +252,306 @@ func LogStreamSSE(c *gin.Context) {
 		}
 	}
 }
+
+// GetProcLogStream streams the log output of a proc as server-sent
+// events. Output of a running proc is followed until it finishes, and
+// the stored log is replayed for completed procs.
+func GetProcLogStream(c *gin.Context) {
+	repo := session.Repo(c)
+
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		c.AbortWithError(404, err)
+		return
+	}
+	proc, err := store.FromContext(c).ProcFind(build, pid)
+	if err != nil {
+		c.AbortWithError(404, err)
+		return
+	}
+
+	if proc.Running() {
+		streamProcLogs(c, build, proc)
+		return
+	}
+
+	rc, err := store.FromContext(c).LogFind(proc)
+	if err != nil {
+		c.AbortWithError(404, err)
+		return
+	}
+	defer rc.Close()
+
+	var lines []json.RawMessage
+	if err := json.NewDecoder(rc).Decode(&lines); err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	rw := c.Writer
+	for _, line := range lines {
+		io.WriteString(rw, "data: ")
+		rw.Write(line)
+		io.WriteString(rw, "\n\n")
+	}
+	io.WriteString(rw, "event: error\ndata: eof\n\n")
+	rw.Flush()
+}
+
+// streamProcLogs streams the live log output of a running proc to the
+// client as server-sent events. The stream ends when the proc finishes
+// or when the client disconnects.
+func streamProcLogs(c *gin.Context, build *model.Build, proc *model.Proc) {
+	// live output is written to the log stream of the top-level
+	// proc, where each line is tagged with the name of the step.
+	id, name := proc.ID, ""
+	if proc.PPID != 0 {
+		parent, err := store.FromContext(c).ProcFind(build, proc.PPID)
+		if err != nil {
+			c.AbortWithError(404, err)
+			return
+		}
+		id, name = parent.ID, proc.Name
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	rw := c.Writer
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		c.String(500, "Streaming not supported")
+		return
+	}
+
+	io.WriteString(rw, ": ping\n\n")
+	flusher.Flush()
+
+	logc := make(chan []byte, 10)
+	ctx, cancel := context.WithCancel(
+		context.Background(),
+	)
+
+	logrus.Debugf("log stream: proc %d: connection opened", proc.ID)
+	logSubscribers.Inc()
+
+	defer func() {
+		cancel()
+		close(logc)
+		logSubscribers.Dec()
+		logrus.Debugf("log stream: proc %d: connection closed", proc.ID)
+	}()
+
+	go func() {
+		// TODO remove global variable
+		Config.Services.Logs.Tail(ctx, fmt.Sprint(id), func(entries ...*logging.Entry) {
+			defer func() {
+				recover() // fix #2480
+			}()
+			for _, entry := range entries {
+				if name != "" {
+					line := new(rpc.Line)
+					if err := json.Unmarshal(entry.Data, line); err != nil || line.Proc != name {
+						continue
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return
+				default:
+					logc <- entry.Data
+				}
+			}
+		})
+		cancel()
+	}()
+
+	write := func(buf []byte) {
+		io.WriteString(rw, "data: ")
+		rw.Write(buf)
+		io.WriteString(rw, "\n\n")
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ctx.Done():
+			// flush any buffered lines before signaling
+			// the client that the proc is complete.
+			for {
+				select {
+				case buf := <-logc:
+					write(buf)
+				default:
+					io.WriteString(rw, "event: error\ndata: eof\n\n")
+					flusher.Flush()
+					return
+				}
+			}
+		case <-time.After(time.Second * 30):
+			io.WriteString(rw, ": ping\n\n")
+			flusher.Flush()
+		case buf, ok := <-logc:
+			if ok {
+				write(buf)
+			}
+		}
+	}
+}
+
+// GetBuildEvents streams the events of a single build as server-sent
+// events. The first event holds the current state of the build, which
+// is followed by the events published for the build until it finishes.
+func GetBuildEvents(c *gin.Context) {
+	repo := session.Repo(c)
+
+	num, ok := parseBuildNumber(c)
+	if !ok {
+		return
+	}
+	build, err := store.GetBuildNumber(c, repo, num)
+	if err != nil {
+		c.AbortWithError(404, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	rw := c.Writer
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		c.String(500, "Streaming not supported")
+		return
+	}
+
+	eventc := make(chan []byte, 10)
+	ctx, cancel := context.WithCancel(
+		context.Background(),
+	)
+
+	logrus.Debugf("build events: %s#%d: connection opened", repo.FullName, build.Number)
+
+	defer func() {
+		cancel()
+		close(eventc)
+		logrus.Debugf("build events: %s#%d: connection closed", repo.FullName, build.Number)
+	}()
+
+	// the subscription is started before the current state of the
+	// build is read. An event that is missed in between is caught up
+	// with by reading the build again on every ping.
+	if !buildDone(build) {
+		go func() {
+			// TODO remove this from global config
+			Config.Services.Pubsub.Subscribe(ctx, "topic/events", func(m pubsub.Message) {
+				defer func() {
+					recover() // fix #2480
+				}()
+				if m.Labels["repo"] != repo.FullName {
+					return
+				}
+				event := new(model.Event)
+				if err := json.Unmarshal(m.Data, event); err != nil || event.Build.ID != build.ID {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				default:
+					eventc <- m.Data
+				}
+			})
+			cancel()
+		}()
+	}
+
+	write := func(buf []byte) {
+		io.WriteString(rw, "data: ")
+		rw.Write(buf)
+		io.WriteString(rw, "\n\n")
+		flusher.Flush()
+	}
+	eof := func() {
+		io.WriteString(rw, "event: error\ndata: eof\n\n")
+		flusher.Flush()
+	}
+	snapshot := func() bool {
+		build, err := store.GetBuildNumber(c, repo, num)
+		if err != nil {
+			return false
+		}
+		procs, _ := store.FromContext(c).ProcList(build)
+		build.Procs = model.Tree(procs)
+		buf, _ := json.Marshal(model.Event{
+			Repo:  *repo,
+			Build: *build,
+		})
+		write(buf)
+		return buildDone(build)
+	}
+
+	if snapshot() {
+		eof()
+		return
+	}
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 30):
+			// the build is read again in case the event that
+			// finished it was missed.
+			if snapshot() {
+				eof()
+				return
+			}
+		case buf, ok := <-eventc:
+			if !ok {
+				return
+			}
+			write(buf)
+			event := new(model.Event)
+			json.Unmarshal(buf, event)
+			if buildDone(&event.Build) {
+				eof()
+				return
+			}
+		}
+	}
+}
+
+// buildDone returns true if the build has finished, and no more events
+// are published for the build.
+func buildDone(build *model.Build) bool {
+	switch build.Status {
+	case model.StatusPending, model.StatusRunning, model.StatusBlocked:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cncd/pubsub"
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetBuildEvents(t *testing.T) {
+	services := Config.Services
+	defer func() {
+		Config.Services = services
+	}()
+	Config.Services.Pubsub = pubsub.New()
+	Config.Services.Pubsub.Create(context.Background(), "topic/events")
+
+	repo := &model.Repo{ID: 1, FullName: "octocat/hello-world"}
+	s := &buildStore{
+		build: &model.Build{ID: 1, Number: 1, Status: model.StatusRunning},
+	}
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds/1/events", nil)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", repo)
+	store.ToContext(c, s)
+
+	done := make(chan struct{})
+	go func() {
+		GetBuildEvents(c)
+		close(done)
+	}()
+
+	publish := func(build model.Build) {
+		message := pubsub.Message{Labels: map[string]string{"repo": repo.FullName}}
+		message.Data, _ = json.Marshal(model.Event{Repo: *repo, Build: build})
+		Config.Services.Pubsub.Publish(context.Background(), "topic/events", message)
+	}
+
+	// the events are published until the stream ends, since the
+	// handler subscribes in the background.
+	timeout := time.After(5 * time.Second)
+	for finished := false; !finished; {
+		publish(model.Build{ID: 2, Number: 2, Status: model.StatusFailure})
+		publish(model.Build{ID: 1, Number: 1, Status: model.StatusSuccess})
+		select {
+		case <-done:
+			finished = true
+		case <-timeout:
+			t.Fatal("Want the stream to end when the build finishes")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	body := w.Body.String()
+	if !strings.HasSuffix(body, "event: error\ndata: eof\n\n") {
+		t.Errorf("Want the stream to end with eof, got %q", body)
+	}
+	if !strings.Contains(body, `"status":"success"`) {
+		t.Errorf("Want the event that finished the build, got %q", body)
+	}
+	if strings.Contains(body, `"status":"failure"`) {
+		t.Errorf("Want the events of other builds filtered, got %q", body)
+	}
+}
+
+func TestGetBuildEventsDone(t *testing.T) {
+	s := &buildStore{
+		build: &model.Build{ID: 1, Number: 1, Status: model.StatusSuccess},
+	}
+	c, w, _ := gin.CreateTestContext()
+	c.Request, _ = http.NewRequest("GET", "/api/repos/octocat/hello-world/builds/1/events", nil)
+	c.Params = gin.Params{{Key: "number", Value: "1"}}
+	c.Set("repo", &model.Repo{ID: 1, FullName: "octocat/hello-world"})
+	store.ToContext(c, s)
+
+	GetBuildEvents(c)
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"status":"success"`) {
+		t.Errorf("Want the state of a finished build followed by eof, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// monday, january 1st 2018
+	from := time.Date(2018, time.January, 1, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2018, time.January, 1, 10, 31, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2018, time.January, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2018, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2018, time.January, 7, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2018, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2018, time.January, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 2 * * 1-5", time.Date(2018, time.January, 2, 2, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2018, time.January, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 9,17 * * *", time.Date(2018, time.January, 1, 17, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+		// day of month or day of week when both are restricted.
+		{"0 0 15 * 5", time.Date(2018, time.January, 5, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		s, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("Want %q parsed, got error %s", test.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(test.want) {
+			t.Errorf("Want %q next at %s, got %s", test.expr, test.want, got)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@often",
+	}
+	for _, expr := range tests {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Want error parsing %q", expr)
+		}
+	}
+}
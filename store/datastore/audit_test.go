@@ -0,0 +1,67 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+func TestAuditList(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from audits")
+		s.Close()
+	}()
+
+	s.AuditCreate(&model.Audit{
+		RepoID:  1,
+		Build:   1,
+		Actor:   "octocat",
+		Action:  model.AuditApprove,
+		Created: 1,
+	})
+	s.AuditCreate(&model.Audit{
+		RepoID:  1,
+		Build:   2,
+		Actor:   "octocat",
+		Action:  model.AuditCancel,
+		Created: 2,
+	})
+	s.AuditCreate(&model.Audit{
+		RepoID:  2,
+		Build:   1,
+		Actor:   "octocat",
+		Action:  model.AuditCancel,
+		Created: 3,
+	})
+
+	list, err := s.AuditList(&model.Repo{ID: 1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(list), 2; got != want {
+		t.Errorf("Want %d audit entries, got %d", want, got)
+		return
+	}
+	if got, want := list[0].Action, model.AuditCancel; got != want {
+		t.Errorf("Want most recent audit action %s, got %s", want, got)
+	}
+	if got, want := list[0].Actor, "octocat"; got != want {
+		t.Errorf("Want audit actor %s, got %s", want, got)
+	}
+}
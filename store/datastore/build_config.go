@@ -0,0 +1,70 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store/datastore/sql"
+	"github.com/russross/meddler"
+)
+
+func (db *datastore) BuildConfigFind(buildID int64) ([]*model.Config, error) {
+	stmt := sql.Lookup(db.driver, "build-config-find-build")
+	data := []*buildConfigData{}
+	err := meddler.QueryAll(db, &data, stmt, buildID)
+	if err != nil {
+		return nil, err
+	}
+	confs := []*model.Config{}
+	for _, d := range data {
+		confs = append(confs, &model.Config{
+			ID:     d.ID,
+			RepoID: d.RepoID,
+			Hash:   d.Hash,
+			Data:   d.Data,
+			Name:   d.Name,
+		})
+	}
+	return confs, nil
+}
+
+func (db *datastore) BuildConfigSave(buildID int64, confs []*model.Config) error {
+	for _, conf := range confs {
+		row := &buildConfig{
+			BuildID:  buildID,
+			ConfigID: conf.ID,
+			Name:     conf.Name,
+		}
+		if err := meddler.Insert(db, "build_config", row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type buildConfig struct {
+	ID       int64  `meddler:"bconf_id,pk"`
+	BuildID  int64  `meddler:"bconf_build_id"`
+	ConfigID int64  `meddler:"bconf_config_id"`
+	Name     string `meddler:"bconf_name"`
+}
+
+type buildConfigData struct {
+	ID     int64  `meddler:"config_id"`
+	RepoID int64  `meddler:"config_repo_id"`
+	Hash   string `meddler:"config_hash"`
+	Data   string `meddler:"config_data"`
+	Name   string `meddler:"bconf_name"`
+}
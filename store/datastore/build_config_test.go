@@ -0,0 +1,79 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+func TestBuildConfigSaveFind(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from build_config")
+		s.Exec("delete from config")
+		s.Close()
+	}()
+
+	deploy := &model.Config{RepoID: 1, Data: "pipeline: { deploy: { image: alpine } }", Hash: "b"}
+	build := &model.Config{RepoID: 1, Data: "pipeline: { build: { image: golang } }", Hash: "a"}
+	for _, conf := range []*model.Config{deploy, build} {
+		if err := s.ConfigCreate(conf); err != nil {
+			t.Errorf("Unexpected error: insert config: %s", err)
+			return
+		}
+	}
+	deploy.Name = "deploy.yml"
+	build.Name = "build.yml"
+
+	if err := s.BuildConfigSave(1, []*model.Config{deploy, build}); err != nil {
+		t.Errorf("Unexpected error: build config save: %s", err)
+		return
+	}
+
+	confs, err := s.BuildConfigFind(1)
+	if err != nil {
+		t.Errorf("Unexpected error: build config find: %s", err)
+		return
+	}
+	if got, want := len(confs), 2; got != want {
+		t.Errorf("Want %d build configs, got %d", want, got)
+		return
+	}
+	if got, want := confs[0].Name, "build.yml"; got != want {
+		t.Errorf("Want build configs ordered by name, got %s first", got)
+	}
+	if got, want := confs[0].ID, build.ID; got != want {
+		t.Errorf("Want build config id %d, got %d", want, got)
+	}
+	if got, want := confs[1].Data, deploy.Data; got != want {
+		t.Errorf("Want build config data %s, got %s", want, got)
+	}
+}
+
+func TestBuildConfigFindMissing(t *testing.T) {
+	s := newTest()
+	defer s.Close()
+
+	confs, err := s.BuildConfigFind(2)
+	if err != nil {
+		t.Errorf("Unexpected error: build config find: %s", err)
+		return
+	}
+	if len(confs) != 0 {
+		t.Errorf("Want no build configs, got %d", len(confs))
+	}
+}
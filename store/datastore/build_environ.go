@@ -0,0 +1,55 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	gosql "database/sql"
+
+	"github.com/drone/drone/store/datastore/sql"
+	"github.com/russross/meddler"
+)
+
+func (db *datastore) BuildEnvironFind(buildID int64) (map[string]string, error) {
+	stmt := sql.Lookup(db.driver, "build-environ-find-build")
+	data := new(environData)
+	err := meddler.QueryRow(db, data, stmt, buildID)
+	if err == gosql.ErrNoRows {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data.Environ == nil {
+		data.Environ = map[string]string{}
+	}
+	return data.Environ, nil
+}
+
+func (db *datastore) BuildEnvironSave(buildID int64, environ map[string]string) error {
+	stmt := sql.Lookup(db.driver, "build-environ-find-build")
+	data := new(environData)
+	err := meddler.QueryRow(db, data, stmt, buildID)
+	if err != nil {
+		data = &environData{BuildID: buildID}
+	}
+	data.Environ = environ
+	return meddler.Save(db, "build_environ", data)
+}
+
+type environData struct {
+	ID      int64             `meddler:"environ_id,pk"`
+	BuildID int64             `meddler:"environ_build_id"`
+	Environ map[string]string `meddler:"environ_data,json"`
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"testing"
+)
+
+func TestBuildEnvironSaveFind(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from build_environ")
+		s.Close()
+	}()
+
+	err := s.BuildEnvironSave(1, map[string]string{"FOO": "bar"})
+	if err != nil {
+		t.Errorf("Unexpected error: build environ save: %s", err)
+		return
+	}
+	err = s.BuildEnvironSave(1, map[string]string{"FOO": "baz"})
+	if err != nil {
+		t.Errorf("Unexpected error: build environ update: %s", err)
+		return
+	}
+
+	environ, err := s.BuildEnvironFind(1)
+	if err != nil {
+		t.Errorf("Unexpected error: build environ find: %s", err)
+		return
+	}
+	if got, want := environ["FOO"], "baz"; got != want {
+		t.Errorf("Want build environ FOO=%s, got %s", want, got)
+	}
+}
+
+func TestBuildEnvironFindMissing(t *testing.T) {
+	s := newTest()
+	defer s.Close()
+
+	environ, err := s.BuildEnvironFind(2)
+	if err != nil {
+		t.Errorf("Unexpected error: build environ find: %s", err)
+		return
+	}
+	if len(environ) != 0 {
+		t.Errorf("Want no build environ, got %v", environ)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	gosql "database/sql"
+
+	"github.com/drone/drone/store/datastore/sql"
+	"github.com/russross/meddler"
+)
+
+func (db *datastore) BuildParamsFind(buildID int64) (map[string]string, error) {
+	stmt := sql.Lookup(db.driver, "build-params-find-build")
+	data := new(paramsData)
+	err := meddler.QueryRow(db, data, stmt, buildID)
+	if err == gosql.ErrNoRows {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data.Params == nil {
+		data.Params = map[string]string{}
+	}
+	return data.Params, nil
+}
+
+func (db *datastore) BuildParamsSave(buildID int64, params map[string]string) error {
+	stmt := sql.Lookup(db.driver, "build-params-find-build")
+	data := new(paramsData)
+	err := meddler.QueryRow(db, data, stmt, buildID)
+	if err != nil {
+		data = &paramsData{BuildID: buildID}
+	}
+	data.Params = params
+	return meddler.Save(db, "build_params", data)
+}
+
+type paramsData struct {
+	ID      int64             `meddler:"param_id,pk"`
+	BuildID int64             `meddler:"param_build_id"`
+	Params  map[string]string `meddler:"param_data,json"`
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"testing"
+)
+
+func TestBuildParamsSaveFind(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from build_params")
+		s.Close()
+	}()
+
+	err := s.BuildParamsSave(1, map[string]string{"FOO": "bar"})
+	if err != nil {
+		t.Errorf("Unexpected error: build params save: %s", err)
+		return
+	}
+	err = s.BuildParamsSave(1, map[string]string{"FOO": "baz"})
+	if err != nil {
+		t.Errorf("Unexpected error: build params update: %s", err)
+		return
+	}
+
+	params, err := s.BuildParamsFind(1)
+	if err != nil {
+		t.Errorf("Unexpected error: build params find: %s", err)
+		return
+	}
+	if got, want := params["FOO"], "baz"; got != want {
+		t.Errorf("Want build param FOO=%s, got %s", want, got)
+	}
+}
+
+func TestBuildParamsFindMissing(t *testing.T) {
+	s := newTest()
+	defer s.Close()
+
+	params, err := s.BuildParamsFind(2)
+	if err != nil {
+		t.Errorf("Unexpected error: build params find: %s", err)
+		return
+	}
+	if len(params) != 0 {
+		t.Errorf("Want no build params, got %v", params)
+	}
+}
@@ -15,7 +15,9 @@
 package datastore
 
 import (
+	gosql "database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/drone/drone/model"
@@ -47,30 +49,189 @@ func (db *datastore) GetBuildCommit(repo *model.Repo, sha, branch string) (*mode
 	return build, err
 }
 
+func (db *datastore) GetBuildLastCommit(repo *model.Repo, sha string) (*model.Build, error) {
+	var build = new(model.Build)
+	var err = meddler.QueryRow(db, build, rebind(buildLastCommitQuery), repo.ID, sha)
+	return build, err
+}
+
+func (db *datastore) GetBuildCommitList(repo *model.Repo, prefix string, limit int) ([]string, error) {
+	rows, err := db.Query(rebind(buildCommitListQuery), repo.ID, prefix+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commits := []string{}
+	for rows.Next() {
+		var commit string
+		if err := rows.Scan(&commit); err != nil {
+			return nil, err
+		}
+		commits = append(commits, commit)
+	}
+	return commits, rows.Err()
+}
+
 func (db *datastore) GetBuildLast(repo *model.Repo, branch string) (*model.Build, error) {
 	var build = new(model.Build)
 	var err = meddler.QueryRow(db, build, rebind(buildLastQuery), repo.ID, branch)
 	return build, err
 }
 
+func (db *datastore) GetBuildLastFiltered(repo *model.Repo, filter *model.BuildFilter) (*model.Build, error) {
+	where, args := buildFilterClause(repo, filter)
+	stmt := fmt.Sprintf(buildLastFilteredQuery, where)
+
+	var build = new(model.Build)
+	var err = meddler.QueryRow(db, build, rebind(stmt), args...)
+	return build, err
+}
+
 func (db *datastore) GetBuildLastBefore(repo *model.Repo, branch string, num int64) (*model.Build, error) {
 	var build = new(model.Build)
 	var err = meddler.QueryRow(db, build, rebind(buildLastBeforeQuery), repo.ID, branch, num)
 	return build, err
 }
 
-func (db *datastore) GetBuildList(repo *model.Repo, page int) ([]*model.Build, error) {
+func (db *datastore) GetBuildList(repo *model.Repo, page, perPage int) ([]*model.Build, error) {
+	return db.GetBuildListFiltered(repo, page, perPage, nil)
+}
+
+func (db *datastore) GetBuildListFiltered(repo *model.Repo, page, perPage int, filter *model.BuildFilter) ([]*model.Build, error) {
+	where, args := buildFilterClause(repo, filter)
+	stmt := fmt.Sprintf(buildListQuery, where)
+	args = append(args, perPage, perPage*(page-1))
+
 	var builds = []*model.Build{}
-	var err = meddler.QueryAll(db, &builds, rebind(buildListQuery), repo.ID, 50*(page-1))
+	var err = meddler.QueryAll(db, &builds, rebind(stmt), args...)
 	return builds, err
 }
 
+func (db *datastore) GetBuildListBefore(repo *model.Repo, number, limit int) ([]*model.Build, error) {
+	var builds = []*model.Build{}
+	var err = meddler.QueryAll(db, &builds, rebind(buildListBeforeQuery), repo.ID, number, limit)
+	return builds, err
+}
+
+func (db *datastore) GetBuildListCount(repo *model.Repo, filter *model.BuildFilter) (count int, err error) {
+	where, args := buildFilterClause(repo, filter)
+	stmt := fmt.Sprintf(buildListCountQuery, where)
+	err = db.QueryRow(rebind(stmt), args...).Scan(&count)
+	return
+}
+
+// buildFilterClause returns the where clause and arguments
+// used to select the builds matching the filter.
+func buildFilterClause(repo *model.Repo, filter *model.BuildFilter) (string, []interface{}) {
+	var (
+		where = "WHERE build_repo_id = ?"
+		args  = []interface{}{repo.ID}
+	)
+	if filter == nil {
+		return where, args
+	}
+	if filter.Status != "" {
+		where += "\n  AND build_status = ?"
+		args = append(args, filter.Status)
+	}
+	if filter.Event != "" {
+		where += "\n  AND build_event = ?"
+		args = append(args, filter.Event)
+	}
+	if filter.Branch != "" {
+		where += "\n  AND build_branch = ?"
+		args = append(args, filter.Branch)
+	}
+	if filter.Author != "" {
+		where += "\n  AND build_author = ?"
+		args = append(args, filter.Author)
+	}
+	if filter.Ref != "" {
+		where += "\n  AND build_ref = ?"
+		args = append(args, filter.Ref)
+	}
+	if len(filter.Refs) != 0 {
+		where += "\n  AND build_ref IN (?" + strings.Repeat(",?", len(filter.Refs)-1) + ")"
+		for _, ref := range filter.Refs {
+			args = append(args, ref)
+		}
+	}
+	return where, args
+}
+
 func (db *datastore) GetBuildQueue() ([]*model.Feed, error) {
 	feed := []*model.Feed{}
 	err := meddler.QueryAll(db, &feed, buildQueueList)
 	return feed, err
 }
 
+func (db *datastore) GetBuildRecent(status string, after, before int64, limit int) ([]*model.Feed, error) {
+	var (
+		where string
+		args  []interface{}
+	)
+	if status != "" {
+		where += "\n  AND b.build_status = ?"
+		args = append(args, status)
+	}
+	if after != 0 {
+		where += "\n  AND b.build_created > ?"
+		args = append(args, after)
+	}
+	if before != 0 {
+		where += "\n  AND b.build_created < ?"
+		args = append(args, before)
+	}
+	args = append(args, limit)
+
+	feed := []*model.Feed{}
+	err := meddler.QueryAll(db, &feed, rebind(fmt.Sprintf(buildRecentList, where)), args...)
+	return feed, err
+}
+
+func (db *datastore) GetBuildRunning() ([]*model.Feed, error) {
+	feed := []*model.Feed{}
+	err := meddler.QueryAll(db, &feed, buildRunningList)
+	return feed, err
+}
+
+func (db *datastore) GetBuildListPrunable(repo *model.Repo, keep int, before int64, limit int) ([]*model.Build, error) {
+	var last gosql.NullInt64
+	if err := db.QueryRow(rebind(buildNumberLast), repo.ID).Scan(&last); err != nil {
+		return nil, err
+	}
+	var builds = []*model.Build{}
+	var err = meddler.QueryAll(db, &builds, rebind(buildPrunableQuery), repo.ID, last.Int64-int64(keep), before, repo.ID, limit)
+	return builds, err
+}
+
+func (db *datastore) DeleteBuild(build *model.Build) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		buildDeleteLogsStmt,
+		buildDeleteFilesStmt,
+		buildDeleteProcsStmt,
+		buildDeleteParamsStmt,
+		buildDeleteEnvironStmt,
+		buildDeleteConfigStmt,
+		buildDeleteStmt,
+	} {
+		if _, err := tx.Exec(rebind(stmt), build.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(rebind(buildDeleteDeliveriesStmt), build.RepoID, build.Number); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (db *datastore) CreateBuild(build *model.Build, procs ...*model.Proc) error {
 	id, err := db.incrementRepoRetry(build.RepoID)
 	if err != nil {
@@ -130,6 +291,41 @@ func (db *datastore) UpdateBuild(build *model.Build) error {
 	return meddler.Update(db, buildTable, build)
 }
 
+func (db *datastore) UpdateBuildProcs(build *model.Build, procs []*model.Proc) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, proc := range procs {
+		if err := meddler.Update(tx, "procs", proc); err != nil {
+			return err
+		}
+	}
+	if err := meddler.Update(tx, buildTable, build); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *datastore) GetBuildActiveCount(repo *model.Repo) (count int, err error) {
+	err = db.QueryRow(rebind(buildActiveCountQuery), repo.ID, false).Scan(&count)
+	return
+}
+
+func (db *datastore) GetBuildActiveList(repo *model.Repo) ([]*model.Build, error) {
+	var builds = []*model.Build{}
+	var err = meddler.QueryAll(db, &builds, rebind(buildActiveListQuery), repo.ID)
+	return builds, err
+}
+
+func (db *datastore) GetBuildHeld(repo *model.Repo) (*model.Build, error) {
+	var build = new(model.Build)
+	var err = meddler.QueryRow(db, build, rebind(buildHeldQuery), repo.ID, true)
+	return build, err
+}
+
 func (db *datastore) GetBuildCount() (count int, err error) {
 	err = db.QueryRow(
 		sql.Lookup(db.driver, "count-builds"),
@@ -142,9 +338,55 @@ const buildTable = "builds"
 const buildListQuery = `
 SELECT *
 FROM builds
+%s
+ORDER BY build_number DESC
+LIMIT ? OFFSET ?
+`
+
+const buildListBeforeQuery = `
+SELECT *
+FROM builds
 WHERE build_repo_id = ?
+  AND build_number < ?
 ORDER BY build_number DESC
-LIMIT 50 OFFSET ?
+LIMIT ?
+`
+
+const buildListCountQuery = `
+SELECT count(1)
+FROM builds
+%s
+`
+
+// buildActiveCountQuery counts the pending and running builds that are
+// not held back by the build concurrency limit.
+const buildActiveCountQuery = `
+SELECT count(1)
+FROM builds
+WHERE build_repo_id = ?
+  AND build_status IN ('pending', 'running')
+  AND build_held = ?
+`
+
+// buildActiveListQuery selects the pending and running builds.
+const buildActiveListQuery = `
+SELECT *
+FROM builds
+WHERE build_repo_id = ?
+  AND build_status IN ('pending', 'running')
+ORDER BY build_id ASC
+`
+
+// buildHeldQuery selects the oldest build held back by the build
+// concurrency limit.
+const buildHeldQuery = `
+SELECT *
+FROM builds
+WHERE build_repo_id = ?
+  AND build_status = 'pending'
+  AND build_held = ?
+ORDER BY build_id ASC
+LIMIT 1
 `
 
 const buildNumberQuery = `
@@ -165,6 +407,14 @@ ORDER BY build_number DESC
 LIMIT 1
 `
 
+const buildLastFilteredQuery = `
+SELECT *
+FROM builds
+%s
+ORDER BY build_number DESC
+LIMIT 1
+`
+
 const buildLastBeforeQuery = `
 SELECT *
 FROM builds
@@ -175,6 +425,24 @@ ORDER BY build_number DESC
 LIMIT 1
 `
 
+const buildLastCommitQuery = `
+SELECT *
+FROM builds
+WHERE build_repo_id = ?
+  AND build_commit  = ?
+ORDER BY build_number DESC
+LIMIT 1
+`
+
+const buildCommitListQuery = `
+SELECT DISTINCT build_commit
+FROM builds
+WHERE build_repo_id = ?
+  AND build_commit LIKE ?
+ORDER BY build_commit
+LIMIT ?
+`
+
 const buildCommitQuery = `
 SELECT *
 FROM builds
@@ -198,11 +466,77 @@ FROM builds
 WHERE build_repo_id = ?
 `
 
+// buildPrunableQuery selects the finished builds that are not among
+// the most recent builds, were created before the given time, and
+// are not the latest build of their branch.
+const buildPrunableQuery = `
+SELECT *
+FROM builds
+WHERE build_repo_id = ?
+  AND build_number <= ?
+  AND build_created < ?
+  AND build_status NOT IN ('pending', 'running', 'blocked')
+  AND build_id NOT IN (
+    SELECT MAX(build_id)
+    FROM builds
+    WHERE build_repo_id = ?
+    GROUP BY build_branch
+  )
+ORDER BY build_number
+LIMIT ?
+`
+
+const buildDeleteLogsStmt = `
+DELETE FROM logs
+WHERE log_job_id IN (
+  SELECT proc_id
+  FROM procs
+  WHERE proc_build_id = ?
+)
+`
+
+const buildDeleteFilesStmt = `
+DELETE FROM files
+WHERE file_build_id = ?
+`
+
+const buildDeleteProcsStmt = `
+DELETE FROM procs
+WHERE proc_build_id = ?
+`
+
+const buildDeleteParamsStmt = `
+DELETE FROM build_params
+WHERE param_build_id = ?
+`
+
+const buildDeleteEnvironStmt = `
+DELETE FROM build_environ
+WHERE environ_build_id = ?
+`
+
+const buildDeleteConfigStmt = `
+DELETE FROM build_config
+WHERE bconf_build_id = ?
+`
+
+const buildDeleteDeliveriesStmt = `
+DELETE FROM deliveries
+WHERE delivery_repo_id = ?
+  AND delivery_build = ?
+`
+
+const buildDeleteStmt = `
+DELETE FROM builds
+WHERE build_id = ?
+`
+
 const buildQueueList = `
 SELECT
  repo_owner
 ,repo_name
 ,repo_full_name
+,build_id
 ,build_number
 ,build_event
 ,build_status
@@ -225,3 +559,62 @@ FROM
 WHERE b.build_repo_id = r.repo_id
   AND b.build_status IN ('pending','running')
 `
+
+const buildRecentList = `
+SELECT
+ repo_owner
+,repo_name
+,repo_full_name
+,build_id
+,build_number
+,build_event
+,build_status
+,build_created
+,build_started
+,build_finished
+,build_commit
+,build_branch
+,build_ref
+,build_refspec
+,build_remote
+,build_title
+,build_message
+,build_author
+,build_email
+,build_avatar
+FROM
+ builds b
+,repos r
+WHERE b.build_repo_id = r.repo_id%s
+ORDER BY b.build_created DESC, b.build_id DESC
+LIMIT ?
+`
+
+const buildRunningList = `
+SELECT
+ repo_owner
+,repo_name
+,repo_full_name
+,build_number
+,build_event
+,build_status
+,build_created
+,build_started
+,build_finished
+,build_commit
+,build_branch
+,build_ref
+,build_refspec
+,build_remote
+,build_title
+,build_message
+,build_author
+,build_email
+,build_avatar
+FROM
+ builds b
+,repos r
+WHERE b.build_repo_id = r.repo_id
+  AND b.build_status = 'running'
+ORDER BY b.build_started
+`
@@ -48,6 +48,9 @@ func TestBuilds(t *testing.T) {
 		g.BeforeEach(func() {
 			s.Exec("DELETE FROM builds")
 			s.Exec("DELETE FROM procs")
+			s.Exec("DELETE FROM config")
+			s.Exec("DELETE FROM build_config")
+			s.Exec("DELETE FROM deliveries")
 		})
 
 		g.It("Should Post a Build", func() {
@@ -87,6 +90,29 @@ func TestBuilds(t *testing.T) {
 			g.Assert(build.Number).Equal(getbuild.Number)
 		})
 
+		g.It("Should Put a Build and its Procs", func() {
+			build := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusRunning,
+			}
+			proc := &model.Proc{
+				PID:   1,
+				Name:  "build",
+				State: model.StatusRunning,
+			}
+			s.CreateBuild(build, proc)
+			build.Status = model.StatusKilled
+			proc.State = model.StatusKilled
+			err := s.UpdateBuildProcs(build, []*model.Proc{proc})
+			g.Assert(err == nil).IsTrue()
+
+			getbuild, _ := s.GetBuild(build.ID)
+			g.Assert(getbuild.Status).Equal(model.StatusKilled)
+			procs, _ := s.ProcList(build)
+			g.Assert(len(procs)).Equal(1)
+			g.Assert(procs[0].State).Equal(model.StatusKilled)
+		})
+
 		g.It("Should Get a Build", func() {
 			build := model.Build{
 				RepoID: repo.ID,
@@ -192,6 +218,43 @@ func TestBuilds(t *testing.T) {
 			g.Assert(build2.Branch).Equal(getbuild.Branch)
 		})
 
+		g.It("Should Get the last Build by Commit", func() {
+			build1 := &model.Build{
+				RepoID: repo.ID,
+				Branch: "master",
+				Commit: "85f8c029b902ed9400bc600bac301a0aadb144ac",
+			}
+			build2 := &model.Build{
+				RepoID: repo.ID,
+				Branch: "dev",
+				Commit: "85f8c029b902ed9400bc600bac301a0aadb144ac",
+			}
+			build3 := &model.Build{
+				RepoID: repo.ID,
+				Branch: "dev",
+				Commit: "85f8c029b902ed9400bc600bac301a0aadb144aa",
+			}
+			s.CreateBuild(build1, []*model.Proc{}...)
+			s.CreateBuild(build2, []*model.Proc{}...)
+			s.CreateBuild(build3, []*model.Proc{}...)
+
+			getbuild, err := s.GetBuildLastCommit(&model.Repo{ID: 1}, build1.Commit)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(getbuild.ID).Equal(build2.ID)
+
+			commits, err := s.GetBuildCommitList(&model.Repo{ID: 1}, "85f8c02", 10)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(commits).Equal([]string{build3.Commit, build1.Commit})
+
+			commits, err = s.GetBuildCommitList(&model.Repo{ID: 1}, "85f8c029b902ed9400bc600bac301a0aadb144ac", 10)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(commits).Equal([]string{build1.Commit})
+
+			commits, err = s.GetBuildCommitList(&model.Repo{ID: 1}, "deadbeef", 10)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(commits)).Equal(0)
+		})
+
 		g.It("Should Get the last Build", func() {
 			build1 := &model.Build{
 				RepoID: repo.ID,
@@ -267,13 +330,337 @@ func TestBuilds(t *testing.T) {
 			}
 			s.CreateBuild(build1, []*model.Proc{}...)
 			s.CreateBuild(build2, []*model.Proc{}...)
-			builds, err := s.GetBuildList(&model.Repo{ID: 1}, 1)
+			builds, err := s.GetBuildList(&model.Repo{ID: 1}, 1, 50)
 			g.Assert(err == nil).IsTrue()
 			g.Assert(len(builds)).Equal(2)
 			g.Assert(builds[0].ID).Equal(build2.ID)
 			g.Assert(builds[0].RepoID).Equal(build2.RepoID)
 			g.Assert(builds[0].Status).Equal(build2.Status)
 		})
+
+		g.It("Should paginate recent Builds", func() {
+			for i := 0; i < 3; i++ {
+				s.CreateBuild(&model.Build{RepoID: repo.ID}, []*model.Proc{}...)
+			}
+			builds, err := s.GetBuildList(&model.Repo{ID: 1}, 2, 2)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(builds)).Equal(1)
+
+			count, err := s.GetBuildListCount(&model.Repo{ID: 1}, nil)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(count).Equal(3)
+		})
+
+		g.It("Should get Builds before Build N", func() {
+			var created []*model.Build
+			for i := 0; i < 5; i++ {
+				build := &model.Build{RepoID: repo.ID}
+				s.CreateBuild(build, []*model.Proc{}...)
+				created = append(created, build)
+			}
+			builds, err := s.GetBuildListBefore(&model.Repo{ID: 1}, created[3].Number, 2)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(builds)).Equal(2)
+			g.Assert(builds[0].Number).Equal(created[2].Number)
+			g.Assert(builds[1].Number).Equal(created[1].Number)
+		})
+
+		g.It("Should filter recent Builds", func() {
+			build1 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusFailure,
+				Event:  model.EventPush,
+			}
+			build2 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusSuccess,
+				Event:  model.EventPush,
+			}
+			build3 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusFailure,
+				Event:  model.EventTag,
+			}
+			s.CreateBuild(build1, []*model.Proc{}...)
+			s.CreateBuild(build2, []*model.Proc{}...)
+			s.CreateBuild(build3, []*model.Proc{}...)
+
+			filter := &model.BuildFilter{
+				Status: model.StatusFailure,
+				Event:  model.EventPush,
+			}
+			builds, err := s.GetBuildListFiltered(&model.Repo{ID: 1}, 1, 50, filter)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(builds)).Equal(1)
+			g.Assert(builds[0].ID).Equal(build1.ID)
+
+			count, err := s.GetBuildListCount(&model.Repo{ID: 1}, &model.BuildFilter{Status: model.StatusFailure})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(count).Equal(2)
+		})
+
+		g.It("Should filter recent Builds by branch", func() {
+			build1 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusFailure,
+				Branch: "master",
+			}
+			build2 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusFailure,
+				Branch: "develop",
+			}
+			s.CreateBuild(build1, []*model.Proc{}...)
+			s.CreateBuild(build2, []*model.Proc{}...)
+
+			filter := &model.BuildFilter{
+				Status: model.StatusFailure,
+				Branch: "master",
+			}
+			builds, err := s.GetBuildListFiltered(&model.Repo{ID: 1}, 1, 50, filter)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(builds)).Equal(1)
+			g.Assert(builds[0].ID).Equal(build1.ID)
+		})
+
+		g.It("Should filter recent Builds by author and pull request", func() {
+			build1 := &model.Build{
+				RepoID: repo.ID,
+				Author: "octocat",
+				Event:  model.EventPull,
+				Ref:    "refs/pull/123/head",
+			}
+			build2 := &model.Build{
+				RepoID: repo.ID,
+				Author: "spaceghost",
+				Event:  model.EventPull,
+				Ref:    "refs/pull/123/head",
+			}
+			build3 := &model.Build{
+				RepoID: repo.ID,
+				Author: "octocat",
+				Event:  model.EventPull,
+				Ref:    "refs/pull/1234/head",
+			}
+			s.CreateBuild(build1, []*model.Proc{}...)
+			s.CreateBuild(build2, []*model.Proc{}...)
+			s.CreateBuild(build3, []*model.Proc{}...)
+
+			filter := &model.BuildFilter{
+				Author: "octocat",
+				Refs:   model.PullRequestRefs(123),
+			}
+			builds, err := s.GetBuildListFiltered(&model.Repo{ID: 1}, 1, 50, filter)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(builds)).Equal(1)
+			g.Assert(builds[0].ID).Equal(build1.ID)
+
+			count, err := s.GetBuildListCount(&model.Repo{ID: 1}, &model.BuildFilter{Refs: model.PullRequestRefs(123)})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(count).Equal(2)
+
+			builds, err = s.GetBuildListFiltered(&model.Repo{ID: 1}, 1, 50, &model.BuildFilter{Author: "nobody"})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(builds)).Equal(0)
+		})
+
+		g.It("Should get the last build matching the filter", func() {
+			build1 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusSuccess,
+				Event:  model.EventDeploy,
+				Branch: "master",
+			}
+			build2 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusFailure,
+				Event:  model.EventDeploy,
+				Branch: "develop",
+			}
+			build3 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusSuccess,
+				Event:  model.EventPush,
+				Branch: "develop",
+			}
+			s.CreateBuild(build1, []*model.Proc{}...)
+			s.CreateBuild(build2, []*model.Proc{}...)
+			s.CreateBuild(build3, []*model.Proc{}...)
+
+			filter := &model.BuildFilter{
+				Status: model.StatusSuccess,
+				Event:  model.EventDeploy,
+			}
+			build, err := s.GetBuildLastFiltered(&model.Repo{ID: 1}, filter)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(build.ID).Equal(build1.ID)
+
+			filter = &model.BuildFilter{Event: model.EventDeploy}
+			build, err = s.GetBuildLastFiltered(&model.Repo{ID: 1}, filter)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(build.ID).Equal(build2.ID)
+		})
+
+		g.It("Should get running builds", func() {
+			build1 := &model.Build{
+				RepoID:  repo.ID,
+				Status:  model.StatusRunning,
+				Started: 2,
+			}
+			build2 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusPending,
+			}
+			build3 := &model.Build{
+				RepoID:  repo.ID,
+				Status:  model.StatusRunning,
+				Started: 1,
+			}
+			s.CreateBuild(build1, []*model.Proc{}...)
+			s.CreateBuild(build2, []*model.Proc{}...)
+			s.CreateBuild(build3, []*model.Proc{}...)
+
+			feed, err := s.GetBuildRunning()
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(feed)).Equal(2)
+			g.Assert(feed[0].Number).Equal(build3.Number)
+			g.Assert(feed[0].FullName).Equal(repo.FullName)
+			g.Assert(feed[1].Number).Equal(build1.Number)
+		})
+
+		g.It("Should count active builds and get held builds", func() {
+			build1 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusRunning,
+			}
+			build2 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusPending,
+				Held:   true,
+			}
+			build3 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusPending,
+				Held:   true,
+			}
+			build4 := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusSuccess,
+			}
+			s.CreateBuild(build1, []*model.Proc{}...)
+			s.CreateBuild(build2, []*model.Proc{}...)
+			s.CreateBuild(build3, []*model.Proc{}...)
+			s.CreateBuild(build4, []*model.Proc{}...)
+
+			count, err := s.GetBuildActiveCount(repo)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(count).Equal(1)
+
+			held, err := s.GetBuildHeld(repo)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(held.Number).Equal(build2.Number)
+			g.Assert(held.Held).IsTrue()
+
+			active, err := s.GetBuildActiveList(repo)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(active)).Equal(3)
+			g.Assert(active[0].Number).Equal(build1.Number)
+		})
+
+		g.It("Should get recent builds", func() {
+			builds := []*model.Build{
+				{RepoID: repo.ID, Status: model.StatusSuccess},
+				{RepoID: repo.ID, Status: model.StatusFailure},
+				{RepoID: repo.ID, Status: model.StatusSuccess},
+				{RepoID: repo.ID, Status: model.StatusRunning},
+			}
+			for i, build := range builds {
+				s.CreateBuild(build, []*model.Proc{}...)
+				// the build creation time is set when created.
+				build.Created = int64(100 * (i + 1))
+				s.UpdateBuild(build)
+			}
+
+			feed, err := s.GetBuildRecent("", 0, 0, 3)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(feed)).Equal(3)
+			g.Assert(feed[0].Number).Equal(builds[3].Number)
+			g.Assert(feed[0].FullName).Equal(repo.FullName)
+			g.Assert(feed[2].Number).Equal(builds[1].Number)
+
+			feed, err = s.GetBuildRecent(model.StatusSuccess, 0, 0, 10)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(feed)).Equal(2)
+			g.Assert(feed[0].Number).Equal(builds[2].Number)
+
+			feed, err = s.GetBuildRecent("", 100, 400, 10)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(feed)).Equal(2)
+			g.Assert(feed[0].Number).Equal(builds[2].Number)
+			g.Assert(feed[1].Number).Equal(builds[1].Number)
+		})
+
+		g.It("Should get prunable builds", func() {
+			builds := []*model.Build{
+				{RepoID: repo.ID, Branch: "master", Status: model.StatusSuccess},
+				{RepoID: repo.ID, Branch: "develop", Status: model.StatusFailure},
+				{RepoID: repo.ID, Branch: "master", Status: model.StatusRunning},
+				{RepoID: repo.ID, Branch: "master", Status: model.StatusSuccess},
+				{RepoID: repo.ID, Branch: "master", Status: model.StatusSuccess},
+				{RepoID: repo.ID, Branch: "master", Status: model.StatusSuccess},
+			}
+			for i, build := range builds {
+				s.CreateBuild(build, []*model.Proc{}...)
+				build.Created = int64(i + 1)
+				s.UpdateBuild(build)
+			}
+
+			prunable, err := s.GetBuildListPrunable(repo, 1, 5, 10)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(prunable)).Equal(2)
+			g.Assert(prunable[0].Number).Equal(builds[0].Number)
+			g.Assert(prunable[1].Number).Equal(builds[3].Number)
+
+			prunable, err = s.GetBuildListPrunable(repo, 0, 10, 1)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(prunable)).Equal(1)
+			g.Assert(prunable[0].Number).Equal(builds[0].Number)
+		})
+
+		g.It("Should delete a build", func() {
+			build := &model.Build{
+				RepoID: repo.ID,
+				Status: model.StatusSuccess,
+			}
+			proc := &model.Proc{
+				PID:  1,
+				Name: "build",
+			}
+			err := s.CreateBuild(build, proc)
+			g.Assert(err == nil).IsTrue()
+			conf := &model.Config{RepoID: repo.ID, Hash: "a1b2c3", Data: "pipeline: {}"}
+			err = s.ConfigCreate(conf)
+			g.Assert(err == nil).IsTrue()
+			err = s.BuildConfigSave(build.ID, []*model.Config{conf})
+			g.Assert(err == nil).IsTrue()
+			err = s.DeliveryCreate(&model.Delivery{RepoID: repo.ID, Event: "push", Build: build.Number})
+			g.Assert(err == nil).IsTrue()
+
+			err = s.DeleteBuild(build)
+			g.Assert(err == nil).IsTrue()
+
+			_, err = s.GetBuild(build.ID)
+			g.Assert(err != nil).IsTrue()
+			procs, err := s.ProcList(build)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(procs)).Equal(0)
+			confs, err := s.BuildConfigFind(build.ID)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(confs)).Equal(0)
+			deliveries, err := s.DeliveryList(repo)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(deliveries)).Equal(0)
+		})
 	})
 }
 
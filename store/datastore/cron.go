@@ -0,0 +1,56 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store/datastore/sql"
+	"github.com/russross/meddler"
+)
+
+func (db *datastore) CronFind(repo *model.Repo, name string) (*model.Cron, error) {
+	stmt := sql.Lookup(db.driver, "cron-find-repo-name")
+	data := new(model.Cron)
+	err := meddler.QueryRow(db, data, stmt, repo.ID, name)
+	return data, err
+}
+
+func (db *datastore) CronList(repo *model.Repo) ([]*model.Cron, error) {
+	stmt := sql.Lookup(db.driver, "cron-find-repo")
+	data := []*model.Cron{}
+	err := meddler.QueryAll(db, &data, stmt, repo.ID)
+	return data, err
+}
+
+func (db *datastore) CronListNext(before int64) ([]*model.Cron, error) {
+	stmt := sql.Lookup(db.driver, "cron-find-next")
+	data := []*model.Cron{}
+	err := meddler.QueryAll(db, &data, stmt, before)
+	return data, err
+}
+
+func (db *datastore) CronCreate(cron *model.Cron) error {
+	return meddler.Insert(db, "crons", cron)
+}
+
+func (db *datastore) CronUpdate(cron *model.Cron) error {
+	return meddler.Update(db, "crons", cron)
+}
+
+func (db *datastore) CronDelete(cron *model.Cron) error {
+	stmt := sql.Lookup(db.driver, "cron-delete")
+	_, err := db.Exec(stmt, cron.ID)
+	return err
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+func TestCronFind(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from crons")
+		s.Close()
+	}()
+
+	err := s.CronCreate(&model.Cron{
+		RepoID:  1,
+		Name:    "nightly",
+		Expr:    "@daily",
+		Branch:  "master",
+		Creator: "octocat",
+		Next:    1257894000,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: insert cron: %s", err)
+		return
+	}
+
+	cron, err := s.CronFind(&model.Repo{ID: 1}, "nightly")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := cron.Expr, "@daily"; got != want {
+		t.Errorf("Want cron expression %s, got %s", want, got)
+	}
+	if got, want := cron.Branch, "master"; got != want {
+		t.Errorf("Want cron branch %s, got %s", want, got)
+	}
+	if got, want := cron.Creator, "octocat"; got != want {
+		t.Errorf("Want cron creator %s, got %s", want, got)
+	}
+}
+
+func TestCronListNext(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from crons")
+		s.Close()
+	}()
+
+	s.CronCreate(&model.Cron{RepoID: 1, Name: "due", Expr: "@daily", Branch: "master", Next: 100})
+	s.CronCreate(&model.Cron{RepoID: 1, Name: "later", Expr: "@daily", Branch: "master", Next: 300})
+	s.CronCreate(&model.Cron{RepoID: 2, Name: "never", Expr: "@daily", Branch: "master"})
+
+	list, err := s.CronListNext(200)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(list), 1; got != want {
+		t.Errorf("Want %d due crons, got %d", want, got)
+		return
+	}
+	if got, want := list[0].Name, "due"; got != want {
+		t.Errorf("Want due cron %s, got %s", want, got)
+	}
+
+	list[0].Next = 400
+	if err := s.CronUpdate(list[0]); err != nil {
+		t.Error(err)
+		return
+	}
+	if list, _ := s.CronListNext(200); len(list) != 0 {
+		t.Errorf("Want rescheduled cron no longer due")
+	}
+}
+
+func TestCronDelete(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from crons")
+		s.Close()
+	}()
+
+	cron := &model.Cron{RepoID: 1, Name: "nightly", Expr: "@daily", Branch: "master"}
+	s.CronCreate(cron)
+	if err := s.CronDelete(cron); err != nil {
+		t.Errorf("Unexpected error: delete cron: %s", err)
+		return
+	}
+	if list, _ := s.CronList(&model.Repo{ID: 1}); len(list) != 0 {
+		t.Errorf("Want cron deleted")
+	}
+}
@@ -170,6 +170,146 @@ var migrations = []struct {
 		name: "alter-table-update-file-meta",
 		stmt: alterTableUpdateFileMeta,
 	},
+	{
+		name: "create-table-audits",
+		stmt: createTableAudits,
+	},
+	{
+		name: "create-index-audits-repo",
+		stmt: createIndexAuditsRepo,
+	},
+	{
+		name: "create-table-build-params",
+		stmt: createTableBuildParams,
+	},
+	{
+		name: "alter-table-add-repo-concurrency",
+		stmt: alterTableAddRepoConcurrency,
+	},
+	{
+		name: "alter-table-add-build-decline-reason",
+		stmt: alterTableAddBuildDeclineReason,
+	},
+	{
+		name: "create-table-crons",
+		stmt: createTableCrons,
+	},
+	{
+		name: "create-index-crons-next",
+		stmt: createIndexCronsNext,
+	},
+	{
+		name: "alter-table-add-repo-retain-builds",
+		stmt: alterTableAddRepoRetainBuilds,
+	},
+	{
+		name: "alter-table-add-repo-retain-days",
+		stmt: alterTableAddRepoRetainDays,
+	},
+	{
+		name: "alter-table-add-repo-approval",
+		stmt: alterTableAddRepoApproval,
+	},
+	{
+		name: "update-table-set-repo-approval",
+		stmt: updateTableSetRepoApproval,
+	},
+	{
+		name: "alter-table-add-repo-approve-admin",
+		stmt: alterTableAddRepoApproveAdmin,
+	},
+	{
+		name: "alter-table-add-repo-approvers",
+		stmt: alterTableAddRepoApprovers,
+	},
+	{
+		name: "create-index-builds-ref",
+		stmt: createIndexBuildsRef,
+	},
+	{
+		name: "create-index-builds-commit",
+		stmt: createIndexBuildsCommit,
+	},
+	{
+		name: "create-table-build-environ",
+		stmt: createTableBuildEnviron,
+	},
+	{
+		name: "alter-table-add-repo-allowed-params",
+		stmt: alterTableAddRepoAllowedParams,
+	},
+	{
+		name: "alter-table-add-audit-target",
+		stmt: alterTableAddAuditTarget,
+	},
+	{
+		name: "alter-table-add-secret-branches",
+		stmt: alterTableAddSecretBranches,
+	},
+	{
+		name: "alter-table-add-secret-pull-request",
+		stmt: alterTableAddSecretPullRequest,
+	},
+	{
+		name: "create-table-environ",
+		stmt: createTableEnviron,
+	},
+	{
+		name: "alter-table-add-build-reproduction",
+		stmt: alterTableAddBuildReproduction,
+	},
+	{
+		name: "create-table-build-config",
+		stmt: createTableBuildConfig,
+	},
+	{
+		name: "alter-table-add-repo-no-config-fallback",
+		stmt: alterTableAddRepoNoConfigFallback,
+	},
+	{
+		name: "alter-table-add-build-config-fallback",
+		stmt: alterTableAddBuildConfigFallback,
+	},
+	{
+		name: "alter-table-add-build-trigger",
+		stmt: alterTableAddBuildTrigger,
+	},
+	{
+		name: "alter-table-add-repo-build-concurrency",
+		stmt: alterTableAddRepoBuildConcurrency,
+	},
+	{
+		name: "alter-table-add-build-held",
+		stmt: alterTableAddBuildHeld,
+	},
+	{
+		name: "create-table-deliveries",
+		stmt: createTableDeliveries,
+	},
+	{
+		name: "create-index-deliveries-repo",
+		stmt: createIndexDeliveriesRepo,
+	},
+	{
+		name: "alter-table-add-repo-protected-branches",
+		stmt: alterTableAddRepoProtectedBranches,
+	},
+	{
+		name: "alter-table-add-repo-protected-targets",
+		stmt: alterTableAddRepoProtectedTargets,
+	},
+	{
+		name: "alter-table-add-build-block-reason",
+		stmt: alterTableAddBuildBlockReason,
+	},
+	{
+		name: "update-table-set-repo-approval-gated",
+		stmt: updateTableSetRepoApprovalGated,
+	},
+	{
+		name: "alter-table-add-delivery-verified",
+		stmt: alterTableAddDeliveryVerified,
+	},
 }
 
 // Migrate performs the database migration. If the migration fails
@@ -636,3 +776,297 @@ UPDATE files SET
 ,file_meta_failed=0
 ,file_meta_skipped=0
 `
+
+//
+// 019_create_table_audits.sql
+//
+
+var createTableAudits = `
+CREATE TABLE IF NOT EXISTS audits (
+ audit_id      INTEGER PRIMARY KEY AUTO_INCREMENT
+,audit_repo_id INTEGER
+,audit_build   INTEGER
+,audit_actor   VARCHAR(250)
+,audit_action  VARCHAR(50)
+,audit_created INTEGER
+);
+`
+
+var createIndexAuditsRepo = `
+CREATE INDEX ix_audits_repo ON audits (audit_repo_id);
+`
+
+//
+// 020_create_table_build_params.sql
+//
+
+var createTableBuildParams = `
+CREATE TABLE IF NOT EXISTS build_params (
+ param_id       INTEGER PRIMARY KEY AUTO_INCREMENT
+,param_build_id INTEGER
+,param_data     MEDIUMBLOB
+
+,UNIQUE(param_build_id)
+);
+`
+
+//
+// 021_add_column_repo_concurrency.sql
+//
+
+var alterTableAddRepoConcurrency = `
+ALTER TABLE repos ADD COLUMN repo_concurrency INTEGER DEFAULT 0;
+`
+
+//
+// 022_add_column_build_decline_reason.sql
+//
+
+var alterTableAddBuildDeclineReason = `
+ALTER TABLE builds ADD COLUMN build_decline_reason VARCHAR(500) DEFAULT '';
+`
+
+//
+// 023_create_table_crons.sql
+//
+
+var createTableCrons = `
+CREATE TABLE IF NOT EXISTS crons (
+ cron_id      INTEGER PRIMARY KEY AUTO_INCREMENT
+,cron_repo_id INTEGER
+,cron_name    VARCHAR(250)
+,cron_expr    VARCHAR(250)
+,cron_branch  VARCHAR(250)
+,cron_target  VARCHAR(250)
+,cron_creator VARCHAR(250)
+,cron_overlap BOOLEAN
+,cron_next    INTEGER
+,cron_build   INTEGER
+,cron_created INTEGER
+
+,UNIQUE(cron_repo_id, cron_name)
+);
+`
+
+var createIndexCronsNext = `
+CREATE INDEX ix_crons_next ON crons (cron_next);
+`
+
+//
+// 024_add_column_repo_retention.sql
+//
+
+var alterTableAddRepoRetainBuilds = `
+ALTER TABLE repos ADD COLUMN repo_retain_builds INTEGER DEFAULT 0;
+`
+
+var alterTableAddRepoRetainDays = `
+ALTER TABLE repos ADD COLUMN repo_retain_days INTEGER DEFAULT 0;
+`
+
+//
+// 025_add_column_repo_approval.sql
+//
+
+var alterTableAddRepoApproval = `
+ALTER TABLE repos ADD COLUMN repo_approval VARCHAR(50) DEFAULT '';
+`
+
+var updateTableSetRepoApproval = `
+UPDATE repos SET repo_approval = 'pull_requests' WHERE repo_gated = true;
+`
+
+//
+// 026_add_column_repo_approvers.sql
+//
+
+var alterTableAddRepoApproveAdmin = `
+ALTER TABLE repos ADD COLUMN repo_approve_admin BOOLEAN DEFAULT false;
+`
+
+var alterTableAddRepoApprovers = `
+ALTER TABLE repos ADD COLUMN repo_approvers VARCHAR(2000) DEFAULT '[]';
+`
+
+//
+// 027_create_index_builds_ref.sql
+//
+
+var createIndexBuildsRef = `
+CREATE INDEX ix_build_ref ON builds (build_repo_id, build_ref);
+`
+
+//
+// 028_create_index_builds_commit.sql
+//
+
+var createIndexBuildsCommit = `
+CREATE INDEX ix_build_commit ON builds (build_repo_id, build_commit(40));
+`
+
+//
+// 029_create_table_build_environ.sql
+//
+
+var createTableBuildEnviron = `
+CREATE TABLE IF NOT EXISTS build_environ (
+ environ_id       INTEGER PRIMARY KEY AUTO_INCREMENT
+,environ_build_id INTEGER
+,environ_data     MEDIUMBLOB
+
+,UNIQUE(environ_build_id)
+);
+`
+
+//
+// 030_add_column_repo_allowed_params.sql
+//
+
+var alterTableAddRepoAllowedParams = `
+ALTER TABLE repos ADD COLUMN repo_allowed_params VARCHAR(2000) DEFAULT '[]';
+`
+
+//
+// 031_add_column_audit_target.sql
+//
+
+var alterTableAddAuditTarget = `
+ALTER TABLE audits ADD COLUMN audit_target VARCHAR(250) DEFAULT '';
+`
+
+//
+// 032_add_column_secret_branches.sql
+//
+
+var alterTableAddSecretBranches = `
+ALTER TABLE secrets ADD COLUMN secret_branches VARCHAR(2000) DEFAULT '[]';
+`
+
+var alterTableAddSecretPullRequest = `
+ALTER TABLE secrets ADD COLUMN secret_pull_request BOOLEAN DEFAULT false;
+`
+
+//
+// 033_create_table_environ.sql
+//
+
+var createTableEnviron = `
+CREATE TABLE IF NOT EXISTS environ (
+ env_id      INTEGER PRIMARY KEY AUTO_INCREMENT
+,env_repo_id INTEGER
+,env_name    VARCHAR(250)
+,env_value   VARCHAR(8000)
+
+,UNIQUE(env_repo_id, env_name)
+);
+`
+
+//
+// 034_add_column_build_reproduction.sql
+//
+
+var alterTableAddBuildReproduction = `
+ALTER TABLE builds ADD COLUMN build_reproduction BOOLEAN DEFAULT false;
+`
+
+//
+// 035_create_table_build_config.sql
+//
+
+var createTableBuildConfig = `
+CREATE TABLE IF NOT EXISTS build_config (
+ bconf_id        INTEGER PRIMARY KEY AUTO_INCREMENT
+,bconf_build_id  INTEGER
+,bconf_config_id INTEGER
+,bconf_name      VARCHAR(250)
+
+,UNIQUE(bconf_build_id, bconf_name)
+);
+`
+
+//
+// 036_add_column_config_fallback.sql
+//
+
+var alterTableAddRepoNoConfigFallback = `
+ALTER TABLE repos ADD COLUMN repo_no_config_fallback BOOLEAN DEFAULT false;
+`
+
+var alterTableAddBuildConfigFallback = `
+ALTER TABLE builds ADD COLUMN build_config_fallback VARCHAR(500) DEFAULT '';
+`
+
+//
+// 037_add_column_build_trigger.sql
+//
+
+var alterTableAddBuildTrigger = `
+ALTER TABLE builds ADD COLUMN build_trigger VARCHAR(50) DEFAULT '';
+`
+
+//
+// 038_add_column_build_held.sql
+//
+
+var alterTableAddRepoBuildConcurrency = `
+ALTER TABLE repos ADD COLUMN repo_build_concurrency INTEGER DEFAULT 0;
+`
+
+var alterTableAddBuildHeld = `
+ALTER TABLE builds ADD COLUMN build_held BOOLEAN DEFAULT false;
+`
+
+//
+// 039_create_table_deliveries.sql
+//
+
+var createTableDeliveries = `
+CREATE TABLE IF NOT EXISTS deliveries (
+ delivery_id      INTEGER PRIMARY KEY AUTO_INCREMENT
+,delivery_repo_id INTEGER
+,delivery_event   VARCHAR(50)
+,delivery_headers MEDIUMBLOB
+,delivery_payload MEDIUMBLOB
+,delivery_status  INTEGER
+,delivery_build   INTEGER
+,delivery_reason  VARCHAR(500)
+,delivery_replay  INTEGER
+,delivery_created INTEGER
+);
+`
+
+var createIndexDeliveriesRepo = `
+CREATE INDEX ix_deliveries_repo ON deliveries (delivery_repo_id);
+`
+
+//
+// 040_add_column_repo_protected.sql
+//
+
+var alterTableAddRepoProtectedBranches = `
+ALTER TABLE repos ADD COLUMN repo_protected_branches VARCHAR(2000) DEFAULT '[]';
+`
+
+var alterTableAddRepoProtectedTargets = `
+ALTER TABLE repos ADD COLUMN repo_protected_targets VARCHAR(2000) DEFAULT '[]';
+`
+
+var alterTableAddBuildBlockReason = `
+ALTER TABLE builds ADD COLUMN build_block_reason VARCHAR(500) DEFAULT '';
+`
+
+//
+// 041_update_repo_approval_gated.sql
+//
+
+var updateTableSetRepoApprovalGated = `
+UPDATE repos SET repo_approval = 'all' WHERE repo_gated = true AND repo_approval = 'pull_requests';
+`
+
+//
+// 042_add_column_delivery_verified.sql
+//
+
+var alterTableAddDeliveryVerified = `
+ALTER TABLE deliveries ADD COLUMN delivery_verified BOOLEAN DEFAULT false;
+`
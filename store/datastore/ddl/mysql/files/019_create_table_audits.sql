@@ -0,0 +1,14 @@
+-- name: create-table-audits
+
+CREATE TABLE IF NOT EXISTS audits (
+ audit_id      INTEGER PRIMARY KEY AUTO_INCREMENT
+,audit_repo_id INTEGER
+,audit_build   INTEGER
+,audit_actor   VARCHAR(250)
+,audit_action  VARCHAR(50)
+,audit_created INTEGER
+);
+
+-- name: create-index-audits-repo
+
+CREATE INDEX ix_audits_repo ON audits (audit_repo_id);
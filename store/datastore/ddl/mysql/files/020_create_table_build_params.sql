@@ -0,0 +1,9 @@
+-- name: create-table-build-params
+
+CREATE TABLE IF NOT EXISTS build_params (
+ param_id       INTEGER PRIMARY KEY AUTO_INCREMENT
+,param_build_id INTEGER
+,param_data     MEDIUMBLOB
+
+,UNIQUE(param_build_id)
+);
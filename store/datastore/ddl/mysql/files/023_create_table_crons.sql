@@ -0,0 +1,21 @@
+-- name: create-table-crons
+
+CREATE TABLE IF NOT EXISTS crons (
+ cron_id      INTEGER PRIMARY KEY AUTO_INCREMENT
+,cron_repo_id INTEGER
+,cron_name    VARCHAR(250)
+,cron_expr    VARCHAR(250)
+,cron_branch  VARCHAR(250)
+,cron_target  VARCHAR(250)
+,cron_creator VARCHAR(250)
+,cron_overlap BOOLEAN
+,cron_next    INTEGER
+,cron_build   INTEGER
+,cron_created INTEGER
+
+,UNIQUE(cron_repo_id, cron_name)
+);
+
+-- name: create-index-crons-next
+
+CREATE INDEX ix_crons_next ON crons (cron_next);
@@ -0,0 +1,7 @@
+-- name: alter-table-add-repo-approval
+
+ALTER TABLE repos ADD COLUMN repo_approval VARCHAR(50) DEFAULT '';
+
+-- name: update-table-set-repo-approval
+
+UPDATE repos SET repo_approval = 'pull_requests' WHERE repo_gated = true;
@@ -0,0 +1,3 @@
+-- name: create-index-builds-ref
+
+CREATE INDEX ix_build_ref ON builds (build_repo_id, build_ref(191));
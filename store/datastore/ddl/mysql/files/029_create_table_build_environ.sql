@@ -0,0 +1,9 @@
+-- name: create-table-build-environ
+
+CREATE TABLE IF NOT EXISTS build_environ (
+ environ_id       INTEGER PRIMARY KEY AUTO_INCREMENT
+,environ_build_id INTEGER
+,environ_data     MEDIUMBLOB
+
+,UNIQUE(environ_build_id)
+);
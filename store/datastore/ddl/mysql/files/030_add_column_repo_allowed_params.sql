@@ -0,0 +1,3 @@
+-- name: alter-table-add-repo-allowed-params
+
+ALTER TABLE repos ADD COLUMN repo_allowed_params VARCHAR(2000) DEFAULT '[]';
@@ -0,0 +1,3 @@
+-- name: alter-table-add-audit-target
+
+ALTER TABLE audits ADD COLUMN audit_target VARCHAR(250) DEFAULT '';
@@ -0,0 +1,7 @@
+-- name: alter-table-add-secret-branches
+
+ALTER TABLE secrets ADD COLUMN secret_branches VARCHAR(2000) DEFAULT '[]';
+
+-- name: alter-table-add-secret-pull-request
+
+ALTER TABLE secrets ADD COLUMN secret_pull_request BOOLEAN DEFAULT false;
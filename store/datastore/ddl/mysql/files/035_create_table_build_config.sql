@@ -0,0 +1,10 @@
+-- name: create-table-build-config
+
+CREATE TABLE IF NOT EXISTS build_config (
+ bconf_id        INTEGER PRIMARY KEY AUTO_INCREMENT
+,bconf_build_id  INTEGER
+,bconf_config_id INTEGER
+,bconf_name      VARCHAR(250)
+
+,UNIQUE(bconf_build_id, bconf_name)
+);
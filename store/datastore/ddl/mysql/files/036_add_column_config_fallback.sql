@@ -0,0 +1,7 @@
+-- name: alter-table-add-repo-no-config-fallback
+
+ALTER TABLE repos ADD COLUMN repo_no_config_fallback BOOLEAN DEFAULT false;
+
+-- name: alter-table-add-build-config-fallback
+
+ALTER TABLE builds ADD COLUMN build_config_fallback VARCHAR(500) DEFAULT '';
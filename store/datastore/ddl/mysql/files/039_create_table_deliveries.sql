@@ -0,0 +1,18 @@
+-- name: create-table-deliveries
+
+CREATE TABLE IF NOT EXISTS deliveries (
+ delivery_id      INTEGER PRIMARY KEY AUTO_INCREMENT
+,delivery_repo_id INTEGER
+,delivery_event   VARCHAR(50)
+,delivery_headers MEDIUMBLOB
+,delivery_payload MEDIUMBLOB
+,delivery_status  INTEGER
+,delivery_build   INTEGER
+,delivery_reason  VARCHAR(500)
+,delivery_replay  INTEGER
+,delivery_created INTEGER
+);
+
+-- name: create-index-deliveries-repo
+
+CREATE INDEX ix_deliveries_repo ON deliveries (delivery_repo_id);
@@ -0,0 +1,11 @@
+-- name: alter-table-add-repo-protected-branches
+
+ALTER TABLE repos ADD COLUMN repo_protected_branches VARCHAR(2000) DEFAULT '[]';
+
+-- name: alter-table-add-repo-protected-targets
+
+ALTER TABLE repos ADD COLUMN repo_protected_targets VARCHAR(2000) DEFAULT '[]';
+
+-- name: alter-table-add-build-block-reason
+
+ALTER TABLE builds ADD COLUMN build_block_reason VARCHAR(500) DEFAULT '';
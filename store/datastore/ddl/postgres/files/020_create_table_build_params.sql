@@ -0,0 +1,9 @@
+-- name: create-table-build-params
+
+CREATE TABLE IF NOT EXISTS build_params (
+ param_id       SERIAL PRIMARY KEY
+,param_build_id INTEGER
+,param_data     BYTEA
+
+,UNIQUE(param_build_id)
+);
@@ -0,0 +1,3 @@
+-- name: create-index-builds-ref
+
+CREATE INDEX IF NOT EXISTS ix_build_ref ON builds (build_repo_id, build_ref);
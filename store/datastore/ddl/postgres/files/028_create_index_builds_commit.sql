@@ -0,0 +1,3 @@
+-- name: create-index-builds-commit
+
+CREATE INDEX IF NOT EXISTS ix_build_commit ON builds (build_repo_id, build_commit);
@@ -0,0 +1,9 @@
+-- name: create-table-build-environ
+
+CREATE TABLE IF NOT EXISTS build_environ (
+ environ_id       SERIAL PRIMARY KEY
+,environ_build_id INTEGER
+,environ_data     BYTEA
+
+,UNIQUE(environ_build_id)
+);
@@ -0,0 +1,10 @@
+-- name: create-table-environ
+
+CREATE TABLE IF NOT EXISTS environ (
+ env_id      SERIAL PRIMARY KEY
+,env_repo_id INTEGER
+,env_name    VARCHAR(250)
+,env_value   VARCHAR(8000)
+
+,UNIQUE(env_repo_id, env_name)
+);
@@ -0,0 +1,14 @@
+-- name: create-table-audits
+
+CREATE TABLE IF NOT EXISTS audits (
+ audit_id      INTEGER PRIMARY KEY AUTOINCREMENT
+,audit_repo_id INTEGER
+,audit_build   INTEGER
+,audit_actor   TEXT
+,audit_action  TEXT
+,audit_created INTEGER
+);
+
+-- name: create-index-audits-repo
+
+CREATE INDEX IF NOT EXISTS ix_audits_repo ON audits (audit_repo_id);
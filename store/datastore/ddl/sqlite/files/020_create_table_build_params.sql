@@ -0,0 +1,8 @@
+-- name: create-table-build-params
+
+CREATE TABLE IF NOT EXISTS build_params (
+ param_id       INTEGER PRIMARY KEY AUTOINCREMENT
+,param_build_id INTEGER
+,param_data     TEXT
+,UNIQUE(param_build_id)
+);
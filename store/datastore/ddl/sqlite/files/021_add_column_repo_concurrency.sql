@@ -0,0 +1,3 @@
+-- name: alter-table-add-repo-concurrency
+
+ALTER TABLE repos ADD COLUMN repo_concurrency INTEGER DEFAULT 0
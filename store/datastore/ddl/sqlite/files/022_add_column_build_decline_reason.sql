@@ -0,0 +1,3 @@
+-- name: alter-table-add-build-decline-reason
+
+ALTER TABLE builds ADD COLUMN build_decline_reason TEXT DEFAULT ''
@@ -0,0 +1,21 @@
+-- name: create-table-crons
+
+CREATE TABLE IF NOT EXISTS crons (
+ cron_id      INTEGER PRIMARY KEY AUTOINCREMENT
+,cron_repo_id INTEGER
+,cron_name    TEXT
+,cron_expr    TEXT
+,cron_branch  TEXT
+,cron_target  TEXT
+,cron_creator TEXT
+,cron_overlap BOOLEAN
+,cron_next    INTEGER
+,cron_build   INTEGER
+,cron_created INTEGER
+
+,UNIQUE(cron_repo_id, cron_name)
+);
+
+-- name: create-index-crons-next
+
+CREATE INDEX IF NOT EXISTS ix_crons_next ON crons (cron_next);
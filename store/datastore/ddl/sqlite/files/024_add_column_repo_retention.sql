@@ -0,0 +1,7 @@
+-- name: alter-table-add-repo-retain-builds
+
+ALTER TABLE repos ADD COLUMN repo_retain_builds INTEGER DEFAULT 0
+
+-- name: alter-table-add-repo-retain-days
+
+ALTER TABLE repos ADD COLUMN repo_retain_days INTEGER DEFAULT 0
@@ -0,0 +1,7 @@
+-- name: alter-table-add-repo-approve-admin
+
+ALTER TABLE repos ADD COLUMN repo_approve_admin BOOLEAN DEFAULT 0
+
+-- name: alter-table-add-repo-approvers
+
+ALTER TABLE repos ADD COLUMN repo_approvers TEXT DEFAULT '[]'
@@ -0,0 +1,8 @@
+-- name: create-table-build-environ
+
+CREATE TABLE IF NOT EXISTS build_environ (
+ environ_id       INTEGER PRIMARY KEY AUTOINCREMENT
+,environ_build_id INTEGER
+,environ_data     TEXT
+,UNIQUE(environ_build_id)
+);
@@ -0,0 +1,10 @@
+-- name: create-table-environ
+
+CREATE TABLE IF NOT EXISTS environ (
+ env_id      INTEGER PRIMARY KEY AUTOINCREMENT
+,env_repo_id INTEGER
+,env_name    TEXT
+,env_value   TEXT
+
+,UNIQUE(env_repo_id, env_name)
+);
@@ -0,0 +1,3 @@
+-- name: alter-table-add-build-reproduction
+
+ALTER TABLE builds ADD COLUMN build_reproduction BOOLEAN DEFAULT 0
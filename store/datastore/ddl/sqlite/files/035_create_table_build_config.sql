@@ -0,0 +1,9 @@
+-- name: create-table-build-config
+
+CREATE TABLE IF NOT EXISTS build_config (
+ bconf_id        INTEGER PRIMARY KEY AUTOINCREMENT
+,bconf_build_id  INTEGER
+,bconf_config_id INTEGER
+,bconf_name      TEXT
+,UNIQUE(bconf_build_id, bconf_name)
+);
@@ -0,0 +1,3 @@
+-- name: alter-table-add-build-trigger
+
+ALTER TABLE builds ADD COLUMN build_trigger TEXT DEFAULT ''
@@ -0,0 +1,7 @@
+-- name: alter-table-add-repo-build-concurrency
+
+ALTER TABLE repos ADD COLUMN repo_build_concurrency INTEGER DEFAULT 0
+
+-- name: alter-table-add-build-held
+
+ALTER TABLE builds ADD COLUMN build_held BOOLEAN DEFAULT 0
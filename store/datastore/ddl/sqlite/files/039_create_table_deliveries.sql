@@ -0,0 +1,18 @@
+-- name: create-table-deliveries
+
+CREATE TABLE IF NOT EXISTS deliveries (
+ delivery_id      INTEGER PRIMARY KEY AUTOINCREMENT
+,delivery_repo_id INTEGER
+,delivery_event   TEXT
+,delivery_headers TEXT
+,delivery_payload TEXT
+,delivery_status  INTEGER
+,delivery_build   INTEGER
+,delivery_reason  TEXT
+,delivery_replay  INTEGER
+,delivery_created INTEGER
+);
+
+-- name: create-index-deliveries-repo
+
+CREATE INDEX IF NOT EXISTS ix_deliveries_repo ON deliveries (delivery_repo_id);
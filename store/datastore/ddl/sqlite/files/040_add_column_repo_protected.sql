@@ -0,0 +1,11 @@
+-- name: alter-table-add-repo-protected-branches
+
+ALTER TABLE repos ADD COLUMN repo_protected_branches TEXT DEFAULT '[]'
+
+-- name: alter-table-add-repo-protected-targets
+
+ALTER TABLE repos ADD COLUMN repo_protected_targets TEXT DEFAULT '[]'
+
+-- name: alter-table-add-build-block-reason
+
+ALTER TABLE builds ADD COLUMN build_block_reason TEXT DEFAULT ''
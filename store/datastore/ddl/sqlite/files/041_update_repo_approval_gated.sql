@@ -0,0 +1,3 @@
+-- name: update-table-set-repo-approval-gated
+
+UPDATE repos SET repo_approval = 'all' WHERE repo_gated = 1 AND repo_approval = 'pull_requests'
@@ -0,0 +1,3 @@
+-- name: alter-table-add-delivery-verified
+
+ALTER TABLE deliveries ADD COLUMN delivery_verified BOOLEAN DEFAULT 0
@@ -0,0 +1,58 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	gosql "database/sql"
+
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store/datastore/sql"
+	"github.com/russross/meddler"
+)
+
+func (db *datastore) DeliveryList(repo *model.Repo) ([]*model.Delivery, error) {
+	stmt := sql.Lookup(db.driver, "delivery-find-repo")
+	data := []*model.Delivery{}
+	err := meddler.QueryAll(db, &data, stmt, repo.ID)
+	return data, err
+}
+
+func (db *datastore) DeliveryFind(repo *model.Repo, id int64) (*model.Delivery, error) {
+	stmt := sql.Lookup(db.driver, "delivery-find-repo-id")
+	data := new(model.Delivery)
+	err := meddler.QueryRow(db, data, stmt, repo.ID, id)
+	return data, err
+}
+
+func (db *datastore) DeliveryCreate(delivery *model.Delivery) error {
+	return meddler.Insert(db, "deliveries", delivery)
+}
+
+// DeliveryPrune deletes the deliveries of the repository except for
+// the most recent deliveries, up to the limit.
+func (db *datastore) DeliveryPrune(repo *model.Repo, limit int) error {
+	var id int64
+	stmt := sql.Lookup(db.driver, "delivery-find-repo-offset")
+	err := db.QueryRow(stmt, repo.ID, limit).Scan(&id)
+	if err == gosql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stmt = sql.Lookup(db.driver, "delivery-delete-repo-before")
+	_, err = db.Exec(stmt, repo.ID, id)
+	return err
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+func TestDeliveryList(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from deliveries")
+		s.Close()
+	}()
+
+	s.DeliveryCreate(&model.Delivery{
+		RepoID:   1,
+		Event:    "push",
+		Headers:  map[string][]string{"X-Github-Event": {"push"}},
+		Payload:  `{"ref":"refs/heads/master"}`,
+		Status:   200,
+		Build:    1,
+		Verified: true,
+	})
+	s.DeliveryCreate(&model.Delivery{
+		RepoID: 1,
+		Event:  "pull_request",
+		Status: 204,
+		Reason: "skipped",
+	})
+	s.DeliveryCreate(&model.Delivery{
+		RepoID: 2,
+		Event:  "push",
+		Status: 200,
+	})
+
+	list, err := s.DeliveryList(&model.Repo{ID: 1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(list), 2; got != want {
+		t.Errorf("Want %d deliveries, got %d", want, got)
+		return
+	}
+	if got, want := list[0].Reason, "skipped"; got != want {
+		t.Errorf("Want most recent delivery reason %s, got %s", want, got)
+	}
+
+	delivery, err := s.DeliveryFind(&model.Repo{ID: 1}, list[1].ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := delivery.Payload, `{"ref":"refs/heads/master"}`; got != want {
+		t.Errorf("Want delivery payload %s, got %s", want, got)
+	}
+	if !delivery.Verified {
+		t.Errorf("Want delivery verified")
+	}
+	if got, want := delivery.Headers["X-Github-Event"], []string{"push"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("Want delivery headers %v, got %v", want, got)
+	}
+	if _, err := s.DeliveryFind(&model.Repo{ID: 2}, list[1].ID); err == nil {
+		t.Errorf("Want error finding a delivery of another repository")
+	}
+}
+
+func TestDeliveryPrune(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from deliveries")
+		s.Close()
+	}()
+
+	for i := 1; i <= 5; i++ {
+		s.DeliveryCreate(&model.Delivery{RepoID: 1, Build: i})
+	}
+	s.DeliveryCreate(&model.Delivery{RepoID: 2, Build: 1})
+
+	if err := s.DeliveryPrune(&model.Repo{ID: 1}, 3); err != nil {
+		t.Error(err)
+		return
+	}
+	list, _ := s.DeliveryList(&model.Repo{ID: 1})
+	if got, want := len(list), 3; got != want {
+		t.Errorf("Want %d deliveries after pruning, got %d", want, got)
+		return
+	}
+	if got, want := list[2].Build, 3; got != want {
+		t.Errorf("Want the oldest delivery kept for build %d, got %d", want, got)
+	}
+	if list, _ := s.DeliveryList(&model.Repo{ID: 2}); len(list) != 1 {
+		t.Errorf("Want deliveries of other repositories kept")
+	}
+	if err := s.DeliveryPrune(&model.Repo{ID: 1}, 3); err != nil {
+		t.Errorf("Want no error pruning below the limit, got %s", err)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"github.com/drone/drone/model"
+	"github.com/drone/drone/store/datastore/sql"
+	"github.com/russross/meddler"
+)
+
+func (db *datastore) EnvironFind(repo *model.Repo, name string) (*model.Environ, error) {
+	stmt := sql.Lookup(db.driver, "environ-find-repo-name")
+	data := new(model.Environ)
+	err := meddler.QueryRow(db, data, stmt, repo.ID, name)
+	return data, err
+}
+
+func (db *datastore) EnvironList(repo *model.Repo) ([]*model.Environ, error) {
+	stmt := sql.Lookup(db.driver, "environ-find-repo")
+	data := []*model.Environ{}
+	err := meddler.QueryAll(db, &data, stmt, repo.ID)
+	return data, err
+}
+
+func (db *datastore) EnvironCreate(environ *model.Environ) error {
+	return meddler.Insert(db, "environ", environ)
+}
+
+func (db *datastore) EnvironUpdate(environ *model.Environ) error {
+	return meddler.Update(db, "environ", environ)
+}
+
+func (db *datastore) EnvironDelete(environ *model.Environ) error {
+	stmt := sql.Lookup(db.driver, "environ-delete")
+	_, err := db.Exec(stmt, environ.ID)
+	return err
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+func TestEnviron(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from environ")
+		s.Close()
+	}()
+
+	repo := &model.Repo{ID: 1}
+	for _, env := range []*model.Environ{
+		{RepoID: 1, Name: "FEATURE_X", Value: "on"},
+		{RepoID: 1, Name: "API_URL", Value: "https://api.example.com"},
+		{RepoID: 2, Name: "API_URL", Value: "https://other.example.com"},
+	} {
+		if err := s.EnvironCreate(env); err != nil {
+			t.Errorf("Unexpected error: insert environ: %s", err)
+			return
+		}
+	}
+	if err := s.EnvironCreate(&model.Environ{RepoID: 1, Name: "API_URL", Value: "x"}); err == nil {
+		t.Errorf("Want unique constraint violated")
+	}
+
+	env, err := s.EnvironFind(repo, "API_URL")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := env.Value, "https://api.example.com"; got != want {
+		t.Errorf("Want environ value %s, got %s", want, got)
+	}
+
+	env.Value = "https://staging.example.com"
+	if err := s.EnvironUpdate(env); err != nil {
+		t.Error(err)
+		return
+	}
+	list, err := s.EnvironList(repo)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(list) != 2 || list[0].Name != "API_URL" || list[0].Value != "https://staging.example.com" {
+		t.Errorf("Want the environment of the repository sorted by name, got %v", list)
+	}
+
+	if err := s.EnvironDelete(env); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := s.EnvironFind(repo, "API_URL"); err == nil {
+		t.Errorf("Want the environ deleted")
+	}
+}
@@ -117,6 +117,20 @@ func TestFileList(t *testing.T) {
 	}
 }
 
+func TestFileListEmpty(t *testing.T) {
+	s := newTest()
+	defer s.Close()
+
+	files, err := s.FileList(&model.Build{ID: 1})
+	if err != nil {
+		t.Errorf("Unexpected error: list files of a build without files: %s", err)
+		return
+	}
+	if files == nil || len(files) != 0 {
+		t.Errorf("Want empty file list, got %v", files)
+	}
+}
+
 func TestFileIndexes(t *testing.T) {
 	s := newTest()
 	defer func() {
@@ -16,6 +16,7 @@ package datastore
 
 import (
 	"bytes"
+	"compress/gzip"
 	"io"
 	"io/ioutil"
 
@@ -28,8 +29,7 @@ func (db *datastore) LogFind(proc *model.Proc) (io.ReadCloser, error) {
 	stmt := sql.Lookup(db.driver, "logs-find-proc")
 	data := new(logData)
 	err := meddler.QueryRow(db, data, stmt, proc.ID)
-	buf := bytes.NewBuffer(data.Data)
-	return ioutil.NopCloser(buf), err
+	return newLogReader(data.Data), err
 }
 
 func (db *datastore) LogSave(proc *model.Proc, r io.Reader) error {
@@ -39,10 +39,100 @@ func (db *datastore) LogSave(proc *model.Proc, r io.Reader) error {
 	if err != nil {
 		data = &logData{ProcID: proc.ID}
 	}
-	data.Data, _ = ioutil.ReadAll(r)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.Copy(zw, r); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	data.Data = buf.Bytes()
 	return meddler.Save(db, "logs", data)
 }
 
+func (db *datastore) LogDelete(proc *model.Proc) error {
+	stmt := sql.Lookup(db.driver, "logs-delete-proc")
+	_, err := db.Exec(stmt, proc.ID)
+	return err
+}
+
+func (db *datastore) LogProcList() ([]*model.Proc, error) {
+	stmt := sql.Lookup(db.driver, "logs-find-procs")
+	list := []*model.Proc{}
+	err := meddler.QueryAll(db, &list, stmt)
+	return list, err
+}
+
+// gzipMagic is the header of gzip compressed data. Logs are stored
+// compressed, while logs written by older versions are stored as is
+// and never start with the header since they are JSON encoded.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// newLogReader returns a reader for the stored log data, decompressing
+// the data if needed.
+func newLogReader(data []byte) io.ReadCloser {
+	if bytes.HasPrefix(data, gzipMagic) {
+		return &gzipLog{data: data}
+	}
+	return nopReadSeekCloser{bytes.NewReader(data)}
+}
+
+// gzipLog is a decompressing reader for a compressed log. The log is
+// decompressed as it is read, unless the reader seeks, in which case
+// the log is decompressed in memory.
+type gzipLog struct {
+	data []byte
+	r    io.Reader
+	off  int64
+}
+
+func (l *gzipLog) Read(p []byte) (int, error) {
+	if l.r == nil {
+		zr, err := gzip.NewReader(bytes.NewReader(l.data))
+		if err != nil {
+			return 0, err
+		}
+		l.r = zr
+	}
+	n, err := l.r.Read(p)
+	l.off += int64(n)
+	return n, err
+}
+
+func (l *gzipLog) Seek(offset int64, whence int) (int64, error) {
+	rs, ok := l.r.(*bytes.Reader)
+	if !ok {
+		zr, err := gzip.NewReader(bytes.NewReader(l.data))
+		if err != nil {
+			return 0, err
+		}
+		raw, err := ioutil.ReadAll(zr)
+		if err != nil {
+			return 0, err
+		}
+		rs = bytes.NewReader(raw)
+		rs.Seek(l.off, io.SeekStart)
+		l.r = rs
+	}
+	return rs.Seek(offset, whence)
+}
+
+// Gzip returns the compressed log.
+func (l *gzipLog) Gzip() io.Reader {
+	return bytes.NewReader(l.data)
+}
+
+func (l *gzipLog) Close() error { return nil }
+
+// nopReadSeekCloser wraps a ReadSeeker with a no-op Close method,
+// allowing callers to seek within the log to serve byte ranges.
+type nopReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopReadSeekCloser) Close() error { return nil }
+
 type logData struct {
 	ID     int64  `meddler:"log_id,pk"`
 	ProcID int64  `meddler:"log_job_id"`
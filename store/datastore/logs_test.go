@@ -16,6 +16,9 @@ package datastore
 
 import (
 	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"testing"
 
@@ -50,6 +53,27 @@ func TestLogCreateFind(t *testing.T) {
 	}
 }
 
+func TestLogDelete(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from logs")
+		s.Close()
+	}()
+
+	proc := model.Proc{
+		ID: 1,
+	}
+	if err := s.LogSave(&proc, bytes.NewBufferString("echo hi")); err != nil {
+		t.Errorf("Unexpected error: log create: %s", err)
+	}
+	if err := s.LogDelete(&proc); err != nil {
+		t.Errorf("Unexpected error: log delete: %s", err)
+	}
+	if _, err := s.LogFind(&proc); err == nil {
+		t.Errorf("Want error finding a deleted log")
+	}
+}
+
 func TestLogUpdate(t *testing.T) {
 	s := newTest()
 	defer func() {
@@ -82,3 +106,176 @@ func TestLogUpdate(t *testing.T) {
 		t.Errorf("Want log data %s, got %s", want, got)
 	}
 }
+
+func TestLogFindSeek(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from logs")
+		s.Close()
+	}()
+
+	proc := model.Proc{
+		ID: 1,
+	}
+	if err := s.LogSave(&proc, bytes.NewBufferString("echo hi")); err != nil {
+		t.Errorf("Unexpected error: log create: %s", err)
+	}
+
+	rc, err := s.LogFind(&proc)
+	if err != nil {
+		t.Errorf("Unexpected error: log find: %s", err)
+	}
+	defer rc.Close()
+
+	rs, ok := rc.(io.ReadSeeker)
+	if !ok {
+		t.Fatalf("Want log reader to implement io.ReadSeeker")
+	}
+	rs.Seek(5, io.SeekStart)
+	out, _ := ioutil.ReadAll(rs)
+	if got, want := string(out), "hi"; got != want {
+		t.Errorf("Want log data %s, got %s", want, got)
+	}
+}
+
+func TestLogProcList(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from logs")
+		s.Exec("delete from procs")
+		s.Close()
+	}()
+
+	procs := []*model.Proc{
+		{BuildID: 1, PID: 1, Name: "build"},
+		{BuildID: 1, PID: 2, Name: "test"},
+	}
+	if err := s.ProcCreate(procs); err != nil {
+		t.Fatalf("Unexpected error: proc create: %s", err)
+	}
+	if err := s.LogSave(procs[1], bytes.NewBufferString("echo hi")); err != nil {
+		t.Fatalf("Unexpected error: log create: %s", err)
+	}
+
+	list, err := s.LogProcList()
+	if err != nil {
+		t.Fatalf("Unexpected error: log proc list: %s", err)
+	}
+	if len(list) != 1 || list[0].ID != procs[1].ID {
+		t.Errorf("Want only the proc with logs listed, got %d procs", len(list))
+	}
+}
+
+func TestLogSaveCompressed(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from logs")
+		s.Close()
+	}()
+
+	proc := model.Proc{
+		ID: 1,
+	}
+	if err := s.LogSave(&proc, bytes.NewBufferString("echo hi")); err != nil {
+		t.Errorf("Unexpected error: log create: %s", err)
+	}
+
+	var data []byte
+	s.QueryRow("select log_data from logs where log_job_id = 1").Scan(&data)
+	if !bytes.HasPrefix(data, gzipMagic) {
+		t.Errorf("Want log data stored compressed")
+	}
+
+	rc, err := s.LogFind(&proc)
+	if err != nil {
+		t.Errorf("Unexpected error: log find: %s", err)
+	}
+	defer rc.Close()
+
+	gz, ok := rc.(model.GzipLog)
+	if !ok {
+		t.Fatalf("Want log reader to implement model.GzipLog")
+	}
+	zr, _ := gzip.NewReader(gz.Gzip())
+	out, _ := ioutil.ReadAll(zr)
+	if got, want := string(out), "echo hi"; got != want {
+		t.Errorf("Want compressed log data %s, got %s", want, got)
+	}
+}
+
+func TestLogFindUncompressed(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from logs")
+		s.Close()
+	}()
+
+	// logs written by older versions are stored uncompressed.
+	s.Exec("insert into logs (log_job_id, log_data) values (1, '[]')")
+
+	rc, err := s.LogFind(&model.Proc{ID: 1})
+	if err != nil {
+		t.Errorf("Unexpected error: log find: %s", err)
+	}
+	defer rc.Close()
+
+	if _, ok := rc.(model.GzipLog); ok {
+		t.Errorf("Want uncompressed log reader")
+	}
+	out, _ := ioutil.ReadAll(rc)
+	if got, want := string(out), "[]"; got != want {
+		t.Errorf("Want log data %s, got %s", want, got)
+	}
+}
+
+func benchmarkLog() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i := 0; i < 10000; i++ {
+		if i != 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, `{"proc":"build","pos":%d,"out":"ok   github.com/drone/drone/server %d.%03ds\n"}`, i, i%10, i%1000)
+	}
+	buf.WriteString("]")
+	return buf.Bytes()
+}
+
+func BenchmarkLogReadRaw(b *testing.B) {
+	data := benchmarkLog()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		io.Copy(ioutil.Discard, newLogReader(data))
+	}
+}
+
+func BenchmarkLogReadGzip(b *testing.B) {
+	raw := benchmarkLog()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(raw)
+	zw.Close()
+	data := buf.Bytes()
+
+	b.SetBytes(int64(len(raw)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		io.Copy(ioutil.Discard, newLogReader(data))
+	}
+}
+
+func BenchmarkLogReadGzipPassthrough(b *testing.B) {
+	raw := benchmarkLog()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(raw)
+	zw.Close()
+	data := buf.Bytes()
+
+	b.SetBytes(int64(len(raw)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		io.Copy(ioutil.Discard, newLogReader(data).(model.GzipLog).Gzip())
+	}
+}
@@ -15,6 +15,8 @@
 package datastore
 
 import (
+	gosql "database/sql"
+
 	"github.com/drone/drone/model"
 	"github.com/drone/drone/store/datastore/sql"
 	"github.com/russross/meddler"
@@ -71,3 +73,10 @@ func (db *datastore) ProcClear(build *model.Build) (err error) {
 	_, err = db.Exec(stmt2, build.ID)
 	return
 }
+
+func (db *datastore) ProcAverageDuration(limit int) (int64, error) {
+	stmt := sql.Lookup(db.driver, "procs-average-duration")
+	var avg gosql.NullFloat64
+	err := db.QueryRow(stmt, limit).Scan(&avg)
+	return int64(avg.Float64), err
+}
@@ -159,6 +159,58 @@ func TestProcList(t *testing.T) {
 	}
 }
 
+func TestProcListEmpty(t *testing.T) {
+	s := newTest()
+	defer s.Close()
+
+	procs, err := s.ProcList(&model.Build{ID: 1})
+	if err != nil {
+		t.Errorf("Unexpected error: list procs of a build without procs: %s", err)
+		return
+	}
+	if procs == nil || len(procs) != 0 {
+		t.Errorf("Want empty proc list, got %v", procs)
+	}
+}
+
+func TestProcAverageDuration(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from procs")
+		s.Close()
+	}()
+
+	avg, err := s.ProcAverageDuration(2)
+	if err != nil {
+		t.Errorf("Unexpected error: average duration without procs: %s", err)
+		return
+	}
+	if avg != 0 {
+		t.Errorf("Want zero average duration without procs, got %d", avg)
+	}
+
+	err = s.ProcCreate([]*model.Proc{
+		{BuildID: 1, PID: 1, State: model.StatusSuccess, Started: 100, Stopped: 400},
+		{BuildID: 1, PID: 2, PPID: 1, State: model.StatusSuccess, Started: 100, Stopped: 900},
+		{BuildID: 2, PID: 1, State: model.StatusFailure, Started: 100, Stopped: 160},
+		{BuildID: 3, PID: 1, State: model.StatusSuccess, Started: 100, Stopped: 200},
+		{BuildID: 4, PID: 1, State: model.StatusRunning, Started: 100},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: insert procs: %s", err)
+		return
+	}
+
+	avg, err = s.ProcAverageDuration(2)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := avg, int64(80); got != want {
+		t.Errorf("Want average duration of the last finished pipelines %d, got %d", want, got)
+	}
+}
+
 func TestProcUpdate(t *testing.T) {
 	s := newTest()
 	defer func() {
@@ -34,6 +34,13 @@ func (db *datastore) RegistryList(repo *model.Repo) ([]*model.Registry, error) {
 	return data, err
 }
 
+func (db *datastore) RegistryListAll() ([]*model.Registry, error) {
+	stmt := sql.Lookup(db.driver, "registry-find-all")
+	data := []*model.Registry{}
+	err := meddler.QueryAll(db, &data, stmt)
+	return data, err
+}
+
 func (db *datastore) RegistryCreate(registry *model.Registry) error {
 	return meddler.Insert(db, "registry", registry)
 }
@@ -32,6 +32,12 @@ func (db *datastore) GetRepoName(name string) (*model.Repo, error) {
 	return repo, err
 }
 
+func (db *datastore) GetRepoListActive() ([]*model.Repo, error) {
+	var repos = []*model.Repo{}
+	var err = meddler.QueryAll(db, &repos, rebind(repoActiveQuery), true)
+	return repos, err
+}
+
 func (db *datastore) GetRepoCount() (count int, err error) {
 	err = db.QueryRow(
 		sql.Lookup(db.driver, "count-repos"),
@@ -110,6 +116,13 @@ WHERE repo_full_name = ?
 LIMIT 1;
 `
 
+const repoActiveQuery = `
+SELECT *
+FROM repos
+WHERE repo_active = ?
+ORDER BY repo_full_name
+`
+
 const repoDeleteStmt = `
 DELETE FROM repos
 WHERE repo_id = ?
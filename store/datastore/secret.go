@@ -34,6 +34,13 @@ func (db *datastore) SecretList(repo *model.Repo) ([]*model.Secret, error) {
 	return data, err
 }
 
+func (db *datastore) SecretListAll() ([]*model.Secret, error) {
+	stmt := sql.Lookup(db.driver, "secret-find-all")
+	data := []*model.Secret{}
+	err := meddler.QueryAll(db, &data, stmt)
+	return data, err
+}
+
 func (db *datastore) SecretCreate(secret *model.Secret) error {
 	return meddler.Insert(db, "secrets", secret)
 }
@@ -0,0 +1,9 @@
+-- name: build-environ-find-build
+
+SELECT
+ environ_id
+,environ_build_id
+,environ_data
+FROM build_environ
+WHERE environ_build_id = ?
+LIMIT 1
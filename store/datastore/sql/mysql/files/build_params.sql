@@ -0,0 +1,9 @@
+-- name: build-params-find-build
+
+SELECT
+ param_id
+,param_build_id
+,param_data
+FROM build_params
+WHERE param_build_id = ?
+LIMIT 1
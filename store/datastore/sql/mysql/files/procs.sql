@@ -85,3 +85,17 @@ WHERE proc_build_id = ?
 -- name: procs-delete-build
 
 DELETE FROM procs WHERE proc_build_id = ?
+
+-- name: procs-average-duration
+
+SELECT AVG(proc_stopped - proc_started)
+FROM (
+SELECT proc_started, proc_stopped
+FROM procs
+WHERE proc_ppid = 0
+  AND proc_state IN ('success', 'failure')
+  AND proc_started > 0
+  AND proc_stopped >= proc_started
+ORDER BY proc_id DESC
+LIMIT ?
+) recent
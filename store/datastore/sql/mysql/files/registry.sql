@@ -32,3 +32,16 @@ DELETE FROM registry WHERE registry_repo_id = ?
 -- name: registry-delete
 
 DELETE FROM registry WHERE registry_id = ?
+
+-- name: registry-find-all
+
+SELECT
+ registry_id
+,registry_repo_id
+,registry_addr
+,registry_username
+,registry_password
+,registry_email
+,registry_token
+FROM registry
+ORDER BY registry_id
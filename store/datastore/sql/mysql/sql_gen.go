@@ -6,12 +6,27 @@ func Lookup(name string) string {
 }
 
 var index = map[string]string{
+	"audit-find-repo":             auditFindRepo,
+	"build-config-find-build":     buildConfigFindBuild,
+	"build-environ-find-build":    buildEnvironFindBuild,
+	"build-params-find-build":     buildParamsFindBuild,
 	"config-find-id":              configFindId,
 	"config-find-repo-hash":       configFindRepoHash,
 	"config-find-approved":        configFindApproved,
 	"count-users":                 countUsers,
 	"count-repos":                 countRepos,
 	"count-builds":                countBuilds,
+	"cron-find-repo":              cronFindRepo,
+	"cron-find-repo-name":         cronFindRepoName,
+	"cron-find-next":              cronFindNext,
+	"cron-delete":                 cronDelete,
+	"delivery-find-repo":          deliveryFindRepo,
+	"delivery-find-repo-id":       deliveryFindRepoId,
+	"delivery-find-repo-offset":   deliveryFindRepoOffset,
+	"delivery-delete-repo-before": deliveryDeleteRepoBefore,
+	"environ-find-repo":           environFindRepo,
+	"environ-find-repo-name":      environFindRepoName,
+	"environ-delete":              environDelete,
 	"feed-latest-build":           feedLatestBuild,
 	"feed":                        feed,
 	"files-find-build":            filesFindBuild,
@@ -19,6 +34,8 @@ var index = map[string]string{
 	"files-find-proc-name-data":   filesFindProcNameData,
 	"files-delete-build":          filesDeleteBuild,
 	"logs-find-proc":              logsFindProc,
+	"logs-find-procs":             logsFindProcs,
+	"logs-delete-proc":            logsDeleteProc,
 	"perms-find-user":             permsFindUser,
 	"perms-find-user-repo":        permsFindUserRepo,
 	"perms-insert-replace":        permsInsertReplace,
@@ -30,10 +47,12 @@ var index = map[string]string{
 	"procs-find-build-pid":        procsFindBuildPid,
 	"procs-find-build-ppid":       procsFindBuildPpid,
 	"procs-delete-build":          procsDeleteBuild,
+	"procs-average-duration":      procsAverageDuration,
 	"registry-find-repo":          registryFindRepo,
 	"registry-find-repo-addr":     registryFindRepoAddr,
 	"registry-delete-repo":        registryDeleteRepo,
 	"registry-delete":             registryDelete,
+	"registry-find-all":           registryFindAll,
 	"repo-update-counter":         repoUpdateCounter,
 	"repo-find-user":              repoFindUser,
 	"repo-insert-ignore":          repoInsertIgnore,
@@ -41,6 +60,7 @@ var index = map[string]string{
 	"secret-find-repo":            secretFindRepo,
 	"secret-find-repo-name":       secretFindRepoName,
 	"secret-delete":               secretDelete,
+	"secret-find-all":             secretFindAll,
 	"sender-find-repo":            senderFindRepo,
 	"sender-find-repo-login":      senderFindRepoLogin,
 	"sender-delete-repo":          senderDeleteRepo,
@@ -53,6 +73,53 @@ var index = map[string]string{
 	"user-delete":                 userDelete,
 }
 
+var auditFindRepo = `
+SELECT
+ audit_id
+,audit_repo_id
+,audit_build
+,audit_actor
+,audit_action
+,audit_target
+,audit_created
+FROM audits
+WHERE audit_repo_id = ?
+ORDER BY audit_id DESC
+`
+
+var buildConfigFindBuild = `
+SELECT
+ config_id
+,config_repo_id
+,config_hash
+,config_data
+,bconf_name
+FROM build_config
+INNER JOIN config ON config_id = bconf_config_id
+WHERE bconf_build_id = ?
+ORDER BY bconf_name
+`
+
+var buildEnvironFindBuild = `
+SELECT
+ environ_id
+,environ_build_id
+,environ_data
+FROM build_environ
+WHERE environ_build_id = ?
+LIMIT 1
+`
+
+var buildParamsFindBuild = `
+SELECT
+ param_id
+,param_build_id
+,param_data
+FROM build_params
+WHERE param_build_id = ?
+LIMIT 1
+`
+
 var configFindId = `
 SELECT
  config_id
@@ -98,6 +165,141 @@ SELECT count(1)
 FROM builds
 `
 
+var cronFindRepo = `
+SELECT
+ cron_id
+,cron_repo_id
+,cron_name
+,cron_expr
+,cron_branch
+,cron_target
+,cron_creator
+,cron_overlap
+,cron_next
+,cron_build
+,cron_created
+FROM crons
+WHERE cron_repo_id = ?
+ORDER BY cron_name
+`
+
+var cronFindRepoName = `
+SELECT
+ cron_id
+,cron_repo_id
+,cron_name
+,cron_expr
+,cron_branch
+,cron_target
+,cron_creator
+,cron_overlap
+,cron_next
+,cron_build
+,cron_created
+FROM crons
+WHERE cron_repo_id = ?
+  AND cron_name = ?
+`
+
+var cronFindNext = `
+SELECT
+ cron_id
+,cron_repo_id
+,cron_name
+,cron_expr
+,cron_branch
+,cron_target
+,cron_creator
+,cron_overlap
+,cron_next
+,cron_build
+,cron_created
+FROM crons
+WHERE cron_next > 0
+  AND cron_next <= ?
+ORDER BY cron_next
+`
+
+var cronDelete = `
+DELETE FROM crons WHERE cron_id = ?
+`
+
+var deliveryFindRepo = `
+SELECT
+ delivery_id
+,delivery_repo_id
+,delivery_event
+,delivery_headers
+,delivery_payload
+,delivery_status
+,delivery_build
+,delivery_reason
+,delivery_replay
+,delivery_verified
+,delivery_created
+FROM deliveries
+WHERE delivery_repo_id = ?
+ORDER BY delivery_id DESC
+`
+
+var deliveryFindRepoId = `
+SELECT
+ delivery_id
+,delivery_repo_id
+,delivery_event
+,delivery_headers
+,delivery_payload
+,delivery_status
+,delivery_build
+,delivery_reason
+,delivery_replay
+,delivery_verified
+,delivery_created
+FROM deliveries
+WHERE delivery_repo_id = ?
+  AND delivery_id = ?
+`
+
+var deliveryFindRepoOffset = `
+SELECT delivery_id
+FROM deliveries
+WHERE delivery_repo_id = ?
+ORDER BY delivery_id DESC
+LIMIT 1 OFFSET ?
+`
+
+var deliveryDeleteRepoBefore = `
+DELETE FROM deliveries
+WHERE delivery_repo_id = ?
+  AND delivery_id <= ?
+`
+
+var environFindRepo = `
+SELECT
+ env_id
+,env_repo_id
+,env_name
+,env_value
+FROM environ
+WHERE env_repo_id = ?
+ORDER BY env_name
+`
+
+var environFindRepoName = `
+SELECT
+ env_id
+,env_repo_id
+,env_name
+,env_value
+FROM environ
+WHERE env_repo_id = ?
+  AND env_name = ?
+`
+
+var environDelete = `
+DELETE FROM environ WHERE env_id = ?
+`
+
 var feedLatestBuild = `
 SELECT
  repo_owner
@@ -228,6 +430,31 @@ WHERE log_job_id = ?
 LIMIT 1
 `
 
+var logsFindProcs = `
+SELECT
+ proc_id
+,proc_build_id
+,proc_pid
+,proc_ppid
+,proc_pgid
+,proc_name
+,proc_state
+,proc_error
+,proc_exit_code
+,proc_started
+,proc_stopped
+,proc_machine
+,proc_platform
+,proc_environ
+FROM procs
+WHERE proc_id IN (SELECT log_job_id FROM logs)
+ORDER BY proc_id
+`
+
+var logsDeleteProc = `
+DELETE FROM logs WHERE log_job_id = ?
+`
+
 var permsFindUser = `
 SELECT
  perm_user_id
@@ -375,6 +602,20 @@ var procsDeleteBuild = `
 DELETE FROM procs WHERE proc_build_id = ?
 `
 
+var procsAverageDuration = `
+SELECT AVG(proc_stopped - proc_started)
+FROM (
+SELECT proc_started, proc_stopped
+FROM procs
+WHERE proc_ppid = 0
+  AND proc_state IN ('success', 'failure')
+  AND proc_started > 0
+  AND proc_stopped >= proc_started
+ORDER BY proc_id DESC
+LIMIT ?
+) recent
+`
+
 var registryFindRepo = `
 SELECT
  registry_id
@@ -410,6 +651,19 @@ var registryDelete = `
 DELETE FROM registry WHERE registry_id = ?
 `
 
+var registryFindAll = `
+SELECT
+ registry_id
+,registry_repo_id
+,registry_addr
+,registry_username
+,registry_password
+,registry_email
+,registry_token
+FROM registry
+ORDER BY registry_id
+`
+
 var repoUpdateCounter = `
 UPDATE repos SET repo_counter = ?
 WHERE repo_counter = ?
@@ -486,6 +740,8 @@ SELECT
 ,secret_value
 ,secret_images
 ,secret_events
+,secret_branches
+,secret_pull_request
 ,secret_conceal
 ,secret_skip_verify
 FROM secrets
@@ -500,6 +756,8 @@ secret_id
 ,secret_value
 ,secret_images
 ,secret_events
+,secret_branches
+,secret_pull_request
 ,secret_conceal
 ,secret_skip_verify
 FROM secrets
@@ -511,6 +769,22 @@ var secretDelete = `
 DELETE FROM secrets WHERE secret_id = ?
 `
 
+var secretFindAll = `
+SELECT
+ secret_id
+,secret_repo_id
+,secret_name
+,secret_value
+,secret_images
+,secret_events
+,secret_branches
+,secret_pull_request
+,secret_conceal
+,secret_skip_verify
+FROM secrets
+ORDER BY secret_id
+`
+
 var senderFindRepo = `
 SELECT
  sender_id
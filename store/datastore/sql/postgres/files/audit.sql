@@ -0,0 +1,13 @@
+-- name: audit-find-repo
+
+SELECT
+ audit_id
+,audit_repo_id
+,audit_build
+,audit_actor
+,audit_action
+,audit_target
+,audit_created
+FROM audits
+WHERE audit_repo_id = $1
+ORDER BY audit_id DESC
@@ -0,0 +1,58 @@
+-- name: cron-find-repo
+
+SELECT
+ cron_id
+,cron_repo_id
+,cron_name
+,cron_expr
+,cron_branch
+,cron_target
+,cron_creator
+,cron_overlap
+,cron_next
+,cron_build
+,cron_created
+FROM crons
+WHERE cron_repo_id = $1
+ORDER BY cron_name
+
+-- name: cron-find-repo-name
+
+SELECT
+ cron_id
+,cron_repo_id
+,cron_name
+,cron_expr
+,cron_branch
+,cron_target
+,cron_creator
+,cron_overlap
+,cron_next
+,cron_build
+,cron_created
+FROM crons
+WHERE cron_repo_id = $1
+  AND cron_name = $2
+
+-- name: cron-find-next
+
+SELECT
+ cron_id
+,cron_repo_id
+,cron_name
+,cron_expr
+,cron_branch
+,cron_target
+,cron_creator
+,cron_overlap
+,cron_next
+,cron_build
+,cron_created
+FROM crons
+WHERE cron_next > 0
+  AND cron_next <= $1
+ORDER BY cron_next
+
+-- name: cron-delete
+
+DELETE FROM crons WHERE cron_id = $1
@@ -0,0 +1,49 @@
+-- name: delivery-find-repo
+
+SELECT
+ delivery_id
+,delivery_repo_id
+,delivery_event
+,delivery_headers
+,delivery_payload
+,delivery_status
+,delivery_build
+,delivery_reason
+,delivery_replay
+,delivery_verified
+,delivery_created
+FROM deliveries
+WHERE delivery_repo_id = $1
+ORDER BY delivery_id DESC
+
+-- name: delivery-find-repo-id
+
+SELECT
+ delivery_id
+,delivery_repo_id
+,delivery_event
+,delivery_headers
+,delivery_payload
+,delivery_status
+,delivery_build
+,delivery_reason
+,delivery_replay
+,delivery_verified
+,delivery_created
+FROM deliveries
+WHERE delivery_repo_id = $1
+  AND delivery_id = $2
+
+-- name: delivery-find-repo-offset
+
+SELECT delivery_id
+FROM deliveries
+WHERE delivery_repo_id = $1
+ORDER BY delivery_id DESC
+LIMIT 1 OFFSET $2
+
+-- name: delivery-delete-repo-before
+
+DELETE FROM deliveries
+WHERE delivery_repo_id = $1
+  AND delivery_id <= $2
@@ -0,0 +1,25 @@
+-- name: environ-find-repo
+
+SELECT
+ env_id
+,env_repo_id
+,env_name
+,env_value
+FROM environ
+WHERE env_repo_id = $1
+ORDER BY env_name
+
+-- name: environ-find-repo-name
+
+SELECT
+ env_id
+,env_repo_id
+,env_name
+,env_value
+FROM environ
+WHERE env_repo_id = $1
+  AND env_name = $2
+
+-- name: environ-delete
+
+DELETE FROM environ WHERE env_id = $1
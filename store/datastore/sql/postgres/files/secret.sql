@@ -7,6 +7,8 @@ SELECT
 ,secret_value
 ,secret_images
 ,secret_events
+,secret_branches
+,secret_pull_request
 ,secret_conceal
 ,secret_skip_verify
 FROM secrets
@@ -21,6 +23,8 @@ secret_id
 ,secret_value
 ,secret_images
 ,secret_events
+,secret_branches
+,secret_pull_request
 ,secret_conceal
 ,secret_skip_verify
 FROM secrets
@@ -30,3 +34,19 @@ WHERE secret_repo_id = $1
 -- name: secret-delete
 
 DELETE FROM secrets WHERE secret_id = $1
+
+-- name: secret-find-all
+
+SELECT
+ secret_id
+,secret_repo_id
+,secret_name
+,secret_value
+,secret_images
+,secret_events
+,secret_branches
+,secret_pull_request
+,secret_conceal
+,secret_skip_verify
+FROM secrets
+ORDER BY secret_id
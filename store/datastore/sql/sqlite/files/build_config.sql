@@ -0,0 +1,12 @@
+-- name: build-config-find-build
+
+SELECT
+ config_id
+,config_repo_id
+,config_hash
+,config_data
+,bconf_name
+FROM build_config
+INNER JOIN config ON config_id = bconf_config_id
+WHERE bconf_build_id = ?
+ORDER BY bconf_name
@@ -7,3 +7,28 @@ SELECT
 FROM logs
 WHERE log_job_id = ?
 LIMIT 1
+
+-- name: logs-find-procs
+
+SELECT
+ proc_id
+,proc_build_id
+,proc_pid
+,proc_ppid
+,proc_pgid
+,proc_name
+,proc_state
+,proc_error
+,proc_exit_code
+,proc_started
+,proc_stopped
+,proc_machine
+,proc_platform
+,proc_environ
+FROM procs
+WHERE proc_id IN (SELECT log_job_id FROM logs)
+ORDER BY proc_id
+
+-- name: logs-delete-proc
+
+DELETE FROM logs WHERE log_job_id = ?
@@ -0,0 +1,146 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	gosql "database/sql"
+
+	"github.com/drone/drone/model"
+)
+
+func (db *datastore) GetRepoStats(repo *model.Repo, since int64) (*model.RepoStats, error) {
+	stats := &model.RepoStats{
+		Since:    since,
+		Events:   map[string]int{},
+		Branches: map[string]*model.BranchStats{},
+	}
+
+	var (
+		timed          int
+		duration, wait gosql.NullFloat64
+		success        int
+	)
+	err := db.QueryRow(rebind(statsTotalQuery), repo.ID, since).Scan(
+		&stats.Builds,
+		&stats.Finished,
+		&success,
+		&timed,
+		&duration,
+		&wait,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Finished != 0 {
+		stats.SuccessRate = float64(success) / float64(stats.Finished)
+	}
+	stats.AvgDuration = int64(duration.Float64)
+	stats.AvgWait = int64(wait.Float64)
+
+	// the 95th percentile is the duration of the build at the
+	// nearest rank.
+	if timed != 0 {
+		rank := (95*timed+99)/100 - 1
+		err = db.QueryRow(rebind(statsPercentileQuery), repo.ID, since, rank).Scan(&stats.P95Duration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.Query(rebind(statsEventQuery), repo.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			event string
+			count int
+		)
+		if err := rows.Scan(&event, &count); err != nil {
+			return nil, err
+		}
+		stats.Events[event] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(rebind(statsBranchQuery), repo.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			branch string
+			count  int
+			avg    gosql.NullFloat64
+		)
+		if err := rows.Scan(&branch, &count, &avg); err != nil {
+			return nil, err
+		}
+		stats.Branches[branch] = &model.BranchStats{
+			Builds:      count,
+			AvgDuration: int64(avg.Float64),
+		}
+	}
+	return stats, rows.Err()
+}
+
+// the duration of a build is only known once it finished.
+const statsTotalQuery = `
+SELECT
+ COUNT(*)
+,COALESCE(SUM(CASE WHEN build_status IN ('success', 'failure', 'error', 'killed') THEN 1 ELSE 0 END), 0)
+,COALESCE(SUM(CASE WHEN build_status = 'success' THEN 1 ELSE 0 END), 0)
+,COALESCE(SUM(CASE WHEN build_status IN ('success', 'failure', 'error', 'killed') AND build_started > 0 AND build_finished >= build_started THEN 1 ELSE 0 END), 0)
+,AVG(CASE WHEN build_status IN ('success', 'failure', 'error', 'killed') AND build_started > 0 AND build_finished >= build_started THEN build_finished - build_started END)
+,AVG(CASE WHEN build_enqueued > 0 AND build_started >= build_enqueued THEN build_started - build_enqueued END)
+FROM builds
+WHERE build_repo_id = ?
+  AND build_created >= ?
+`
+
+const statsPercentileQuery = `
+SELECT build_finished - build_started AS duration
+FROM builds
+WHERE build_repo_id = ?
+  AND build_created >= ?
+  AND build_status IN ('success', 'failure', 'error', 'killed')
+  AND build_started > 0
+  AND build_finished >= build_started
+ORDER BY duration
+LIMIT 1 OFFSET ?
+`
+
+const statsEventQuery = `
+SELECT build_event, COUNT(*)
+FROM builds
+WHERE build_repo_id = ?
+  AND build_created >= ?
+GROUP BY build_event
+`
+
+const statsBranchQuery = `
+SELECT
+ build_branch
+,COUNT(*)
+,AVG(CASE WHEN build_status IN ('success', 'failure', 'error', 'killed') AND build_started > 0 AND build_finished >= build_started THEN build_finished - build_started END)
+FROM builds
+WHERE build_repo_id = ?
+  AND build_created >= ?
+GROUP BY build_branch
+`
@@ -0,0 +1,97 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+func TestRepoStats(t *testing.T) {
+	s := newTest()
+	defer func() {
+		s.Exec("delete from builds")
+		s.Exec("delete from repos")
+		s.Close()
+	}()
+
+	repo1 := &model.Repo{UserID: 1, FullName: "octocat/hello-world", Owner: "octocat", Name: "hello-world"}
+	repo2 := &model.Repo{UserID: 1, FullName: "octocat/spoon-knife", Owner: "octocat", Name: "spoon-knife"}
+	s.CreateRepo(repo1)
+	s.CreateRepo(repo2)
+
+	builds := []*model.Build{
+		// created before the start of the window.
+		{RepoID: repo1.ID, Created: 50, Status: model.StatusSuccess, Event: model.EventPush, Branch: "master"},
+		{RepoID: repo1.ID, Created: 200, Status: model.StatusSuccess, Event: model.EventPush, Branch: "master", Enqueued: 100, Started: 110, Finished: 170},
+		{RepoID: repo1.ID, Created: 200, Status: model.StatusFailure, Event: model.EventPush, Branch: "master", Enqueued: 100, Started: 130, Finished: 250},
+		{RepoID: repo1.ID, Created: 200, Status: model.StatusSuccess, Event: model.EventPull, Branch: "feature", Enqueued: 100, Started: 120, Finished: 140},
+		{RepoID: repo1.ID, Created: 200, Status: model.StatusRunning, Event: model.EventPush, Branch: "master", Enqueued: 100, Started: 140},
+		// belongs to another repository.
+		{RepoID: repo2.ID, Created: 200, Status: model.StatusFailure, Event: model.EventTag, Branch: "master", Enqueued: 100, Started: 100, Finished: 900},
+	}
+	for _, build := range builds {
+		created, enqueued := build.Created, build.Enqueued
+		if err := s.CreateBuild(build); err != nil {
+			t.Error(err)
+			return
+		}
+		// the build creation and queue times are set when created.
+		build.Created, build.Enqueued = created, enqueued
+		s.UpdateBuild(build)
+	}
+
+	stats, err := s.GetRepoStats(repo1, 100)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := &model.RepoStats{
+		Since:       100,
+		Builds:      4,
+		Finished:    3,
+		SuccessRate: 2.0 / 3.0,
+		AvgDuration: 66,
+		P95Duration: 120,
+		AvgWait:     25,
+		Events: map[string]int{
+			model.EventPush: 3,
+			model.EventPull: 1,
+		},
+		Branches: map[string]*model.BranchStats{
+			"master":  {Builds: 3, AvgDuration: 90},
+			"feature": {Builds: 1, AvgDuration: 20},
+		},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("Want repository stats %+v, got %+v", want, stats)
+	}
+}
+
+func TestRepoStatsEmpty(t *testing.T) {
+	s := newTest()
+	defer s.Close()
+
+	stats, err := s.GetRepoStats(&model.Repo{ID: 1}, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Builds != 0 || stats.SuccessRate != 0 || stats.P95Duration != 0 {
+		t.Errorf("Want empty repository stats, got %+v", stats)
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/drone/drone/model"
+)
+
+// encryptedPrefix marks the values encrypted by the store. Values
+// without the prefix were written before encryption was enabled and
+// are read as is.
+const encryptedPrefix = "enc:v1:"
+
+var (
+	errEncryptedMalformed = errors.New("store: malformed encrypted value")
+	errEncryptedKey       = errors.New("store: cannot decrypt value with the encryption keys")
+	errNotEncrypted       = errors.New("store: encryption is not enabled")
+)
+
+// WithEncryption returns a Store that encrypts secret values and
+// registry credentials before they are written to the database, and
+// decrypts them when they are read. Values are encrypted with the key,
+// and are decrypted with the key or one of the old keys so that the
+// key can be rotated. The keys must be 16, 24 or 32 bytes long.
+func WithEncryption(s Store, key []byte, old ...[]byte) (Store, error) {
+	e := new(envelope)
+	for _, k := range append([][]byte{key}, old...) {
+		aead, err := newAEAD(k)
+		if err != nil {
+			return nil, err
+		}
+		e.keys = append(e.keys, aead)
+	}
+	return &encryptedStore{Store: s, enc: e}, nil
+}
+
+// Reencrypt encrypts the stored secret values and registry credentials
+// of the encrypted store with its current key, and returns the number
+// of values written. Values stored in plain text or encrypted with an
+// old key are read and written again.
+func Reencrypt(s Store) (int, error) {
+	if _, ok := s.(*encryptedStore); !ok {
+		return 0, errNotEncrypted
+	}
+	var count int
+	secrets, err := s.SecretListAll()
+	if err != nil {
+		return count, err
+	}
+	for _, secret := range secrets {
+		if err := s.SecretUpdate(secret); err != nil {
+			return count, err
+		}
+		count++
+	}
+	registries, err := s.RegistryListAll()
+	if err != nil {
+		return count, err
+	}
+	for _, registry := range registries {
+		if err := s.RegistryUpdate(registry); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+type encryptedStore struct {
+	Store
+	enc *envelope
+}
+
+func (s *encryptedStore) SecretFind(repo *model.Repo, name string) (*model.Secret, error) {
+	secret, err := s.Store.SecretFind(repo, name)
+	if err != nil {
+		return nil, err
+	}
+	return secret, s.decryptSecret(secret)
+}
+
+func (s *encryptedStore) SecretList(repo *model.Repo) ([]*model.Secret, error) {
+	secrets, err := s.Store.SecretList(repo)
+	if err != nil {
+		return nil, err
+	}
+	return secrets, s.decryptSecrets(secrets)
+}
+
+func (s *encryptedStore) SecretListAll() ([]*model.Secret, error) {
+	secrets, err := s.Store.SecretListAll()
+	if err != nil {
+		return nil, err
+	}
+	return secrets, s.decryptSecrets(secrets)
+}
+
+func (s *encryptedStore) SecretCreate(secret *model.Secret) error {
+	return s.withSecretEncrypted(secret, s.Store.SecretCreate)
+}
+
+func (s *encryptedStore) SecretUpdate(secret *model.Secret) error {
+	return s.withSecretEncrypted(secret, s.Store.SecretUpdate)
+}
+
+func (s *encryptedStore) RegistryFind(repo *model.Repo, addr string) (*model.Registry, error) {
+	registry, err := s.Store.RegistryFind(repo, addr)
+	if err != nil {
+		return nil, err
+	}
+	return registry, s.decryptRegistry(registry)
+}
+
+func (s *encryptedStore) RegistryList(repo *model.Repo) ([]*model.Registry, error) {
+	registries, err := s.Store.RegistryList(repo)
+	if err != nil {
+		return nil, err
+	}
+	return registries, s.decryptRegistries(registries)
+}
+
+func (s *encryptedStore) RegistryListAll() ([]*model.Registry, error) {
+	registries, err := s.Store.RegistryListAll()
+	if err != nil {
+		return nil, err
+	}
+	return registries, s.decryptRegistries(registries)
+}
+
+func (s *encryptedStore) RegistryCreate(registry *model.Registry) error {
+	return s.withRegistryEncrypted(registry, s.Store.RegistryCreate)
+}
+
+func (s *encryptedStore) RegistryUpdate(registry *model.Registry) error {
+	return s.withRegistryEncrypted(registry, s.Store.RegistryUpdate)
+}
+
+// withSecretEncrypted writes the secret with its value encrypted. The
+// value of the secret is left unchanged for the caller.
+func (s *encryptedStore) withSecretEncrypted(secret *model.Secret, write func(*model.Secret) error) error {
+	value := secret.Value
+	defer func() { secret.Value = value }()
+
+	var err error
+	if secret.Value, err = s.enc.encrypt(value); err != nil {
+		return err
+	}
+	return write(secret)
+}
+
+// withRegistryEncrypted writes the registry with its credentials
+// encrypted. The credentials of the registry are left unchanged for the
+// caller.
+func (s *encryptedStore) withRegistryEncrypted(registry *model.Registry, write func(*model.Registry) error) error {
+	password, token := registry.Password, registry.Token
+	defer func() { registry.Password, registry.Token = password, token }()
+
+	var err error
+	if registry.Password, err = s.enc.encrypt(password); err != nil {
+		return err
+	}
+	if registry.Token, err = s.enc.encrypt(token); err != nil {
+		return err
+	}
+	return write(registry)
+}
+
+func (s *encryptedStore) decryptSecret(secret *model.Secret) (err error) {
+	secret.Value, err = s.enc.decrypt(secret.Value)
+	return err
+}
+
+func (s *encryptedStore) decryptSecrets(secrets []*model.Secret) error {
+	for _, secret := range secrets {
+		if err := s.decryptSecret(secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *encryptedStore) decryptRegistry(registry *model.Registry) (err error) {
+	if registry.Password, err = s.enc.decrypt(registry.Password); err != nil {
+		return err
+	}
+	registry.Token, err = s.enc.decrypt(registry.Token)
+	return err
+}
+
+func (s *encryptedStore) decryptRegistries(registries []*model.Registry) error {
+	for _, registry := range registries {
+		if err := s.decryptRegistry(registry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envelope implements envelope encryption. Each value is encrypted
+// with a random data key, and the data key is encrypted with the key
+// of the store and stored alongside the value.
+type envelope struct {
+	// keys holds the current key followed by the old keys.
+	keys []cipher.AEAD
+}
+
+func (e *envelope) encrypt(value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealedKey, err := seal(e.keys[0], key)
+	if err != nil {
+		return "", err
+	}
+	sealedValue, err := seal(aead, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix +
+		base64.StdEncoding.EncodeToString(sealedKey) + ":" +
+		base64.StdEncoding.EncodeToString(sealedValue), nil
+}
+
+func (e *envelope) decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errEncryptedMalformed
+	}
+	sealedKey, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errEncryptedMalformed
+	}
+	sealedValue, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errEncryptedMalformed
+	}
+	for _, kek := range e.keys {
+		key, err := open(kek, sealedKey)
+		if err != nil {
+			continue
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return "", err
+		}
+		data, err := open(aead, sealedValue)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", errEncryptedKey
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the data and prepends the random nonce.
+func seal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// open decrypts the data sealed with seal.
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	size := aead.NonceSize()
+	if len(data) < size {
+		return nil, errEncryptedMalformed
+	}
+	return aead.Open(nil, data[:size], data[size:], nil)
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+// secretStore is an in-memory store of secrets and registries.
+type secretStore struct {
+	Store
+	secrets    []*model.Secret
+	registries []*model.Registry
+}
+
+func (s *secretStore) SecretListAll() ([]*model.Secret, error) {
+	var secrets []*model.Secret
+	for _, secret := range s.secrets {
+		copy := *secret
+		secrets = append(secrets, &copy)
+	}
+	return secrets, nil
+}
+
+func (s *secretStore) SecretCreate(secret *model.Secret) error {
+	copy := *secret
+	copy.ID = int64(len(s.secrets) + 1)
+	s.secrets = append(s.secrets, &copy)
+	return nil
+}
+
+func (s *secretStore) SecretUpdate(secret *model.Secret) error {
+	copy := *secret
+	s.secrets[secret.ID-1] = &copy
+	return nil
+}
+
+func (s *secretStore) RegistryListAll() ([]*model.Registry, error) {
+	var registries []*model.Registry
+	for _, registry := range s.registries {
+		copy := *registry
+		registries = append(registries, &copy)
+	}
+	return registries, nil
+}
+
+func (s *secretStore) RegistryCreate(registry *model.Registry) error {
+	copy := *registry
+	copy.ID = int64(len(s.registries) + 1)
+	s.registries = append(s.registries, &copy)
+	return nil
+}
+
+func (s *secretStore) RegistryUpdate(registry *model.Registry) error {
+	copy := *registry
+	s.registries[registry.ID-1] = &copy
+	return nil
+}
+
+func TestEncryption(t *testing.T) {
+	db := new(secretStore)
+	s, err := WithEncryption(db, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := &model.Secret{Name: "password", Value: "correct-horse"}
+	if err := s.SecretCreate(secret); err != nil {
+		t.Fatal(err)
+	}
+	if secret.Value != "correct-horse" {
+		t.Errorf("Want the value of the caller unchanged, got %q", secret.Value)
+	}
+	if stored := db.secrets[0].Value; !strings.HasPrefix(stored, encryptedPrefix) || strings.Contains(stored, "correct-horse") {
+		t.Errorf("Want the value stored encrypted, got %q", stored)
+	}
+
+	registry := &model.Registry{Address: "index.docker.io", Password: "pa55word"}
+	if err := s.RegistryCreate(registry); err != nil {
+		t.Fatal(err)
+	}
+	if stored := db.registries[0]; !strings.HasPrefix(stored.Password, encryptedPrefix) || stored.Token != "" {
+		t.Errorf("Want the password stored encrypted and the empty token kept, got %q and %q", stored.Password, stored.Token)
+	}
+
+	secrets, _ := s.SecretListAll()
+	if got := secrets[0].Value; got != "correct-horse" {
+		t.Errorf("Want the value decrypted, got %q", got)
+	}
+	registries, _ := s.RegistryListAll()
+	if got := registries[0].Password; got != "pa55word" {
+		t.Errorf("Want the password decrypted, got %q", got)
+	}
+}
+
+func TestEncryptionPlaintext(t *testing.T) {
+	db := new(secretStore)
+	db.SecretCreate(&model.Secret{Name: "password", Value: "correct-horse"})
+
+	s, _ := WithEncryption(db, []byte("0123456789abcdef"))
+	secrets, _ := s.SecretListAll()
+	if got := secrets[0].Value; got != "correct-horse" {
+		t.Errorf("Want plain text values read as is, got %q", got)
+	}
+
+	count, err := Reencrypt(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Want 1 value encrypted, got %d", count)
+	}
+	if stored := db.secrets[0].Value; !strings.HasPrefix(stored, encryptedPrefix) {
+		t.Errorf("Want the value stored encrypted, got %q", stored)
+	}
+}
+
+func TestEncryptionRotate(t *testing.T) {
+	oldKey := []byte("0123456789abcdef")
+	newKey := []byte("fedcba9876543210")
+
+	db := new(secretStore)
+	s, _ := WithEncryption(db, oldKey)
+	s.SecretCreate(&model.Secret{Name: "password", Value: "correct-horse"})
+
+	s, _ = WithEncryption(db, newKey)
+	if _, err := s.SecretListAll(); err == nil {
+		t.Errorf("Want an error decrypting with the wrong key")
+	}
+
+	s, _ = WithEncryption(db, newKey, oldKey)
+	if _, err := Reencrypt(s); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ = WithEncryption(db, newKey)
+	secrets, err := s.SecretListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := secrets[0].Value; got != "correct-horse" {
+		t.Errorf("Want the value decrypted with the new key, got %q", got)
+	}
+}
+
+func TestEncryptionKeySize(t *testing.T) {
+	if _, err := WithEncryption(new(secretStore), []byte("short")); err == nil {
+		t.Errorf("Want an error for an invalid key size")
+	}
+	if _, err := Reencrypt(new(secretStore)); err != errNotEncrypted {
+		t.Errorf("Want an error re-encrypting a store without encryption")
+	}
+}
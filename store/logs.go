@@ -0,0 +1,60 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"io"
+
+	"github.com/drone/drone/model"
+)
+
+// WithLogStore returns a Store that reads and writes the logs of
+// procs using the given LogStore instead of the database.
+func WithLogStore(s Store, logs model.LogStore) Store {
+	return &logStore{Store: s, logs: logs}
+}
+
+type logStore struct {
+	Store
+	logs model.LogStore
+}
+
+func (s *logStore) LogFind(proc *model.Proc) (io.ReadCloser, error) {
+	return s.logs.LogFind(proc)
+}
+
+func (s *logStore) LogSave(proc *model.Proc, r io.Reader) error {
+	return s.logs.LogSave(proc, r)
+}
+
+func (s *logStore) LogDelete(proc *model.Proc) error {
+	return s.logs.LogDelete(proc)
+}
+
+// DeleteBuild deletes the logs of the build procs from the log store
+// before deleting the build, since the logs are not stored with the
+// build in the database.
+func (s *logStore) DeleteBuild(build *model.Build) error {
+	procs, err := s.Store.ProcList(build)
+	if err != nil {
+		return err
+	}
+	for _, proc := range procs {
+		if err := s.logs.LogDelete(proc); err != nil {
+			return err
+		}
+	}
+	return s.Store.DeleteBuild(build)
+}
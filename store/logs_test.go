@@ -0,0 +1,65 @@
+// Copyright 2018 Drone.IO Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/drone/drone/model"
+)
+
+// buildLogStore is a store with the procs of a single build that
+// records the deleted builds.
+type buildLogStore struct {
+	Store
+	procs   []*model.Proc
+	deleted []*model.Build
+}
+
+func (s *buildLogStore) ProcList(*model.Build) ([]*model.Proc, error) {
+	return s.procs, nil
+}
+
+func (s *buildLogStore) DeleteBuild(build *model.Build) error {
+	s.deleted = append(s.deleted, build)
+	return nil
+}
+
+// deletedLogs is a log store that records the deleted logs.
+type deletedLogs struct {
+	model.LogStore
+	deleted []int64
+}
+
+func (l *deletedLogs) LogDelete(proc *model.Proc) error {
+	l.deleted = append(l.deleted, proc.ID)
+	return nil
+}
+
+func TestLogStoreDeleteBuild(t *testing.T) {
+	s := &buildLogStore{procs: []*model.Proc{{ID: 1}, {ID: 2}}}
+	logs := new(deletedLogs)
+
+	build := &model.Build{ID: 1}
+	if err := WithLogStore(s, logs).DeleteBuild(build); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs.deleted) != 2 || logs.deleted[0] != 1 || logs.deleted[1] != 2 {
+		t.Errorf("Want the logs of every proc deleted, got %v", logs.deleted)
+	}
+	if len(s.deleted) != 1 {
+		t.Errorf("Want the build deleted from the store")
+	}
+}
@@ -50,6 +50,9 @@ type Store interface {
 	// GetRepoName gets a repo by its full name.
 	GetRepoName(string) (*model.Repo, error)
 
+	// GetRepoListActive gets a list of all active repositories.
+	GetRepoListActive() ([]*model.Repo, error)
+
 	// GetRepoCount gets a count of all repositories in the system.
 	GetRepoCount() (int, error)
 
@@ -74,18 +77,78 @@ type Store interface {
 	// GetBuildCommit gets a build by its commit sha.
 	GetBuildCommit(*model.Repo, string, string) (*model.Build, error)
 
+	// GetBuildLastCommit gets the last build of the commit sha on
+	// any branch.
+	GetBuildLastCommit(*model.Repo, string) (*model.Build, error)
+
+	// GetBuildCommitList gets up to N distinct commit shas of builds
+	// for the repository starting with the given prefix. The prefix
+	// must not contain LIKE wildcards.
+	GetBuildCommitList(*model.Repo, string, int) ([]string, error)
+
 	// GetBuildLast gets the last build for the branch.
 	GetBuildLast(*model.Repo, string) (*model.Build, error)
 
+	// GetBuildLastFiltered gets the last build for the repository
+	// matching the given filter.
+	GetBuildLastFiltered(*model.Repo, *model.BuildFilter) (*model.Build, error)
+
 	// GetBuildLastBefore gets the last build before build number N.
 	GetBuildLastBefore(*model.Repo, string, int64) (*model.Build, error)
 
-	// GetBuildList gets a list of builds for the repository
-	GetBuildList(*model.Repo, int) ([]*model.Build, error)
+	// GetBuildList gets a page of builds for the repository
+	// using the given page number and page size.
+	GetBuildList(*model.Repo, int, int) ([]*model.Build, error)
+
+	// GetBuildListFiltered gets a page of builds for the repository
+	// matching the given filter.
+	GetBuildListFiltered(*model.Repo, int, int, *model.BuildFilter) ([]*model.Build, error)
+
+	// GetBuildListBefore gets up to N builds for the repository
+	// with a build number lower than the given build number.
+	GetBuildListBefore(*model.Repo, int, int) ([]*model.Build, error)
+
+	// GetBuildListCount gets a count of builds for the repository
+	// matching the given filter. A nil filter counts all builds.
+	GetBuildListCount(*model.Repo, *model.BuildFilter) (int, error)
+
+	// GetBuildActiveCount gets a count of the pending and running
+	// builds of the repository that are not held back.
+	GetBuildActiveCount(*model.Repo) (int, error)
+
+	// GetBuildActiveList gets a list of the pending and running builds
+	// of the repository, including held back builds.
+	GetBuildActiveList(*model.Repo) ([]*model.Build, error)
+
+	// GetBuildHeld gets the oldest build of the repository held back
+	// by the build concurrency limit.
+	GetBuildHeld(*model.Repo) (*model.Build, error)
+
+	// GetRepoStats gets the aggregate build statistics of the repository
+	// for the builds created since the given timestamp.
+	GetRepoStats(*model.Repo, int64) (*model.RepoStats, error)
 
 	// GetBuildQueue gets a list of build in queue.
 	GetBuildQueue() ([]*model.Feed, error)
 
+	// GetBuildRecent gets up to N most recent builds of all repositories,
+	// optionally with the given status and created after and before the
+	// given timestamps. Empty values are ignored.
+	GetBuildRecent(status string, after, before int64, limit int) ([]*model.Feed, error)
+
+	// GetBuildListPrunable gets up to N builds for the repository that
+	// can be pruned. Builds among the given number of most recent
+	// builds, created after the given time, unfinished, or the latest
+	// build of their branch are never returned.
+	GetBuildListPrunable(repo *model.Repo, keep int, before int64, limit int) ([]*model.Build, error)
+
+	// DeleteBuild deletes a build and its procs, files, logs and
+	// parameters.
+	DeleteBuild(*model.Build) error
+
+	// GetBuildRunning gets a list of running builds in all repositories.
+	GetBuildRunning() ([]*model.Feed, error)
+
 	// GetBuildCount gets a count of all builds in the system.
 	GetBuildCount() (int, error)
 
@@ -95,6 +158,29 @@ type Store interface {
 	// UpdateBuild updates a build.
 	UpdateBuild(*model.Build) error
 
+	// UpdateBuildProcs updates a build and its procs in a single
+	// transaction.
+	UpdateBuildProcs(*model.Build, []*model.Proc) error
+
+	// BuildParamsFind gets the custom parameters of a build.
+	BuildParamsFind(buildID int64) (map[string]string, error)
+
+	// BuildParamsSave saves the custom parameters of a build.
+	BuildParamsSave(buildID int64, params map[string]string) error
+
+	// BuildEnvironFind gets the environment a build was dispatched with.
+	BuildEnvironFind(buildID int64) (map[string]string, error)
+
+	// BuildEnvironSave saves the environment a build was dispatched with.
+	BuildEnvironSave(buildID int64, environ map[string]string) error
+
+	// BuildConfigFind gets the configurations a build was created from.
+	// It is empty for builds created from a single configuration file.
+	BuildConfigFind(buildID int64) ([]*model.Config, error)
+
+	// BuildConfigSave saves the configurations a build was created from.
+	BuildConfigSave(buildID int64, confs []*model.Config) error
+
 	//
 	// new functions
 	//
@@ -124,12 +210,14 @@ type Store interface {
 
 	SecretFind(*model.Repo, string) (*model.Secret, error)
 	SecretList(*model.Repo) ([]*model.Secret, error)
+	SecretListAll() ([]*model.Secret, error)
 	SecretCreate(*model.Secret) error
 	SecretUpdate(*model.Secret) error
 	SecretDelete(*model.Secret) error
 
 	RegistryFind(*model.Repo, string) (*model.Registry, error)
 	RegistryList(*model.Repo) ([]*model.Registry, error)
+	RegistryListAll() ([]*model.Registry, error)
 	RegistryCreate(*model.Registry) error
 	RegistryUpdate(*model.Registry) error
 	RegistryDelete(*model.Registry) error
@@ -142,14 +230,41 @@ type Store interface {
 	ProcUpdate(*model.Proc) error
 	ProcClear(*model.Build) error
 
+	// ProcAverageDuration gets the average duration in seconds of the
+	// most recently finished pipelines.
+	ProcAverageDuration(limit int) (int64, error)
+
 	LogFind(*model.Proc) (io.ReadCloser, error)
 	LogSave(*model.Proc, io.Reader) error
+	LogDelete(*model.Proc) error
+	LogProcList() ([]*model.Proc, error)
 
 	FileList(*model.Build) ([]*model.File, error)
 	FileFind(*model.Proc, string) (*model.File, error)
 	FileRead(*model.Proc, string) (io.ReadCloser, error)
 	FileCreate(*model.File, io.Reader) error
 
+	CronFind(*model.Repo, string) (*model.Cron, error)
+	CronList(*model.Repo) ([]*model.Cron, error)
+	CronListNext(int64) ([]*model.Cron, error)
+	CronCreate(*model.Cron) error
+	CronUpdate(*model.Cron) error
+	CronDelete(*model.Cron) error
+
+	EnvironFind(*model.Repo, string) (*model.Environ, error)
+	EnvironList(*model.Repo) ([]*model.Environ, error)
+	EnvironCreate(*model.Environ) error
+	EnvironUpdate(*model.Environ) error
+	EnvironDelete(*model.Environ) error
+
+	AuditList(*model.Repo) ([]*model.Audit, error)
+	AuditCreate(*model.Audit) error
+
+	DeliveryList(*model.Repo) ([]*model.Delivery, error)
+	DeliveryFind(*model.Repo, int64) (*model.Delivery, error)
+	DeliveryCreate(*model.Delivery) error
+	DeliveryPrune(*model.Repo, int) error
+
 	TaskList() ([]*model.Task, error)
 	TaskInsert(*model.Task) error
 	TaskDelete(string) error
@@ -237,8 +352,20 @@ func GetBuildLastBefore(c context.Context, repo *model.Repo, branch string, numb
 	return FromContext(c).GetBuildLastBefore(repo, branch, number)
 }
 
-func GetBuildList(c context.Context, repo *model.Repo, page int) ([]*model.Build, error) {
-	return FromContext(c).GetBuildList(repo, page)
+func GetBuildList(c context.Context, repo *model.Repo, page, perPage int) ([]*model.Build, error) {
+	return FromContext(c).GetBuildList(repo, page, perPage)
+}
+
+func GetBuildListFiltered(c context.Context, repo *model.Repo, page, perPage int, filter *model.BuildFilter) ([]*model.Build, error) {
+	return FromContext(c).GetBuildListFiltered(repo, page, perPage, filter)
+}
+
+func GetBuildListBefore(c context.Context, repo *model.Repo, number, limit int) ([]*model.Build, error) {
+	return FromContext(c).GetBuildListBefore(repo, number, limit)
+}
+
+func GetBuildListCount(c context.Context, repo *model.Repo, filter *model.BuildFilter) (int, error) {
+	return FromContext(c).GetBuildListCount(repo, filter)
 }
 
 func GetBuildQueue(c context.Context) ([]*model.Feed, error) {